@@ -0,0 +1,847 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io/pat"
+	"html"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	activityStreamsContext = "https://www.w3.org/ns/activitystreams"
+	activityStreamsPublic  = "https://www.w3.org/ns/activitystreams#Public"
+	securityContext        = "https://w3id.org/security/v1"
+	activityJsonType       = "application/activity+json"
+	outboxSize             = 50
+	inboxMaxBodySize       = 1 << 20
+	signatureMaxAge        = 12 * time.Hour
+	deliveryWorkers        = 8
+	deliveryQueueSize      = 10000
+)
+
+// deliveryRetryDelays are the delays before the attempts to deliver an
+// activity, the receiving server may be down for a while.
+var deliveryRetryDelays = []time.Duration{0, time.Minute, 10 * time.Minute, time.Hour}
+
+var (
+	baseUrl              string
+	activityPubStorage   string
+	activityPub          = activityPubStore{Followers: make(map[string]map[string]string)}
+	activityPubClient    = newActivityPubClient()
+	activityDeliveries   = newDeliveryQueue(deliveryWorkers, deliveryRetryDelays, deliverActivity)
+	activityPubKey       *rsa.PrivateKey
+	activityPubNoteTypes = map[string]bool{"added": true, "opened": true, "closed": true}
+)
+
+// activityPubStore holds the instance key and the followers of every space,
+// mapping the space id to the actor id and inbox of its followers.
+type activityPubStore struct {
+	mutex      sync.Mutex
+	PrivateKey string                       `json:"privateKey"`
+	Followers  map[string]map[string]string `json:"followers"`
+}
+
+type activity struct {
+	Context interface{} `json:"@context,omitempty"`
+	Id      string      `json:"id,omitempty"`
+	Type    string      `json:"type"`
+	Actor   string      `json:"actor,omitempty"`
+	Object  interface{} `json:"object,omitempty"`
+}
+
+type remoteActor struct {
+	Id        string `json:"id"`
+	Inbox     string `json:"inbox"`
+	Endpoints struct {
+		SharedInbox string `json:"sharedInbox"`
+	} `json:"endpoints"`
+	PublicKey struct {
+		Id           string `json:"id"`
+		Owner        string `json:"owner"`
+		PublicKeyPem string `json:"publicKeyPem"`
+	} `json:"publicKey"`
+}
+
+// activityDelivery is an activity waiting to be posted to an inbox.
+type activityDelivery struct {
+	inbox    string
+	activity activity
+	actor    string
+	attempt  int
+}
+
+// deliveryQueue posts activities with a fixed number of workers, so a burst
+// of events doesn't start a request per follower at once. Failed deliveries
+// are queued again after the next of the delays.
+type deliveryQueue struct {
+	deliveries chan activityDelivery
+	delays     []time.Duration
+	deliver    func(activityDelivery) error
+	// pending counts the deliveries queued or waiting for a retry
+	pending sync.WaitGroup
+}
+
+func newDeliveryQueue(workers int, delays []time.Duration, deliver func(activityDelivery) error) *deliveryQueue {
+	q := &deliveryQueue{deliveries: make(chan activityDelivery, deliveryQueueSize), delays: delays, deliver: deliver}
+	for i := 0; i < workers; i++ {
+		go q.work()
+	}
+
+	return q
+}
+
+// enqueue adds a delivery, it's dropped if the queue is full.
+func (q *deliveryQueue) enqueue(delivery activityDelivery) {
+	q.pending.Add(1)
+	select {
+	case q.deliveries <- delivery:
+	default:
+		log.Printf("delivery queue is full, dropping the delivery to %v\n", delivery.inbox)
+		q.pending.Done()
+	}
+}
+
+func (q *deliveryQueue) work() {
+	for delivery := range q.deliveries {
+		err := q.deliver(delivery)
+		delivery.attempt++
+		if err != nil {
+			log.Printf("delivery %d to %v failed: %v\n", delivery.attempt, delivery.inbox, err)
+		}
+		if err != nil && delivery.attempt < len(q.delays) {
+			retry := delivery
+			q.pending.Add(1)
+			time.AfterFunc(q.delays[delivery.attempt], func() {
+				defer q.pending.Done()
+				q.enqueue(retry)
+			})
+		}
+		q.pending.Done()
+	}
+}
+
+// wait returns once all deliveries were made or gave up, deliveries
+// waiting for a retry are waited for as well.
+func (q *deliveryQueue) wait() {
+	q.pending.Wait()
+}
+
+func init() {
+	flag.StringVar(
+		&baseUrl,
+		"baseUrl",
+		"https://api.spaceapi.io",
+		"Public url of the api, used for links in feeds and ActivityPub ids",
+	)
+
+	flag.StringVar(
+		&activityPubStorage,
+		"activityPubStorage",
+		"activityPub.json",
+		"Path to the file for persistent storage of the ActivityPub key and followers",
+	)
+}
+
+// setupActivityPub loads or creates the key used to sign our requests and
+// starts announcing change events to the followers of the spaces.
+func setupActivityPub() {
+	activityPub.mutex.Lock()
+	defer activityPub.mutex.Unlock()
+
+	fileContent, err := ioutil.ReadFile(activityPubStorage)
+	if err == nil {
+		if err := json.Unmarshal(fileContent, &activityPub); err != nil {
+			log.Println(err)
+			panic("can't unmarshal ActivityPub storage")
+		}
+		if activityPub.Followers == nil {
+			activityPub.Followers = make(map[string]map[string]string)
+		}
+	} else {
+		log.Println(err)
+		log.Println("can't read ActivityPub storage, generating a new key...")
+	}
+
+	if block, _ := pem.Decode([]byte(activityPub.PrivateKey)); block != nil {
+		activityPubKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			panic(err)
+		}
+	} else {
+		activityPubKey, err = rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			panic(err)
+		}
+		activityPub.PrivateKey = string(pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(activityPubKey),
+		}))
+		persistActivityPubLocked()
+	}
+
+	go announceChanges()
+}
+
+func persistActivityPubLocked() {
+	storageJson, err := json.Marshal(&activityPub)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := ioutil.WriteFile(activityPubStorage, storageJson, 0600); err != nil {
+		log.Println(err)
+	}
+}
+
+func actorUrl(id string) string {
+	return baseUrl + "/ap/spaces/" + url.PathEscape(id)
+}
+
+func webfingerDomain() string {
+	parsed, err := url.Parse(baseUrl)
+	if err != nil {
+		return baseUrl
+	}
+
+	return parsed.Host
+}
+
+func writeActivityJson(w http.ResponseWriter, contentType string, value interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		panic(err)
+	}
+}
+
+func serveWebfinger(w http.ResponseWriter, r *http.Request) {
+	resource := r.URL.Query().Get("resource")
+	account := strings.TrimPrefix(resource, "acct:")
+	at := strings.LastIndex(account, "@")
+	if !strings.HasPrefix(resource, "acct:") || at < 0 || account[at+1:] != webfingerDomain() {
+		http.NotFound(w, r)
+		return
+	}
+
+	id := account[:at]
+	if _, ok := getSpace(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	writeActivityJson(w, "application/jrd+json", map[string]interface{}{
+		"subject": resource,
+		"aliases": []string{actorUrl(id)},
+		"links": []map[string]string{
+			{"rel": "self", "type": activityJsonType, "href": actorUrl(id)},
+		},
+	})
+}
+
+func serveActor(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+	space, ok := getSpace(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(&activityPubKey.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	actor := map[string]interface{}{
+		"@context":          []string{activityStreamsContext, securityContext},
+		"id":                actorUrl(id),
+		"type":              "Service",
+		"preferredUsername": id,
+		"name":              space.SpaceName(),
+		"summary":           html.EscapeString("Opening state of " + space.SpaceName() + " from the SpaceAPI directory"),
+		"inbox":             actorUrl(id) + "/inbox",
+		"outbox":            actorUrl(id) + "/outbox",
+		"followers":         actorUrl(id) + "/followers",
+		"publicKey": map[string]string{
+			"id":           actorUrl(id) + "#main-key",
+			"owner":        actorUrl(id),
+			"publicKeyPem": string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		},
+	}
+	if homepage, ok := space.Data["url"].(string); ok {
+		actor["url"] = homepage
+	}
+	if logo, ok := space.Data["logo"].(string); ok && logo != "" {
+		actor["icon"] = map[string]string{"type": "Image", "url": logo}
+	}
+
+	writeActivityJson(w, activityJsonType, actor)
+}
+
+func serveOutbox(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+	if _, ok := getSpace(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	events, err := getSpaceNoteEvents(id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	items := []activity{}
+	for i := len(events) - 1; i >= 0 && len(items) < outboxSize; i-- {
+		items = append(items, createActivity(events[i]))
+	}
+
+	writeActivityJson(w, activityJsonType, map[string]interface{}{
+		"@context":     activityStreamsContext,
+		"id":           actorUrl(id) + "/outbox",
+		"type":         "OrderedCollection",
+		"totalItems":   len(events),
+		"orderedItems": items,
+	})
+}
+
+func serveNote(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+	eventId, err := strconv.ParseInt(pat.Param(r, "event"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	events, err := getSpaceNoteEvents(id)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	for _, event := range events {
+		if event.Id == eventId {
+			note := createActivity(event).Object.(map[string]interface{})
+			note["@context"] = activityStreamsContext
+			writeActivityJson(w, activityJsonType, note)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+func serveFollowers(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+	if _, ok := getSpace(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	activityPub.mutex.Lock()
+	followers := len(activityPub.Followers[id])
+	activityPub.mutex.Unlock()
+
+	writeActivityJson(w, activityJsonType, map[string]interface{}{
+		"@context":   activityStreamsContext,
+		"id":         actorUrl(id) + "/followers",
+		"type":       "OrderedCollection",
+		"totalItems": followers,
+	})
+}
+
+// getSpaceNoteEvents returns the events of a space we publish notes for,
+// ordered from the oldest to the newest.
+func getSpaceNoteEvents(id string) ([]spaceapi.ChangeEvent, error) {
+	var types []string
+	for t := range activityPubNoteTypes {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	var events []spaceapi.ChangeEvent
+	since := ""
+	for {
+		changes, err := getChanges(changesQuery{Since: since, Limit: maxReplayLimit, SpaceIds: id, Types: strings.Join(types, ",")})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, changes.Events...)
+		since = changes.Cursor
+		if !changes.HasMore {
+			return events, nil
+		}
+	}
+}
+
+func createActivity(event spaceapi.ChangeEvent) activity {
+	actor := actorUrl(event.SpaceId)
+	published := time.Unix(event.Time, 0).UTC().Format(time.RFC3339)
+	eventId := strconv.FormatInt(event.Id, 10)
+
+	return activity{
+		Context: activityStreamsContext,
+		Id:      actor + "/notes/" + eventId + "/activity",
+		Type:    "Create",
+		Actor:   actor,
+		Object: map[string]interface{}{
+			"id":           actor + "/notes/" + eventId,
+			"type":         "Note",
+			"attributedTo": actor,
+			"published":    published,
+			"content":      "<p>" + html.EscapeString(describeEvent(event)) + "</p>",
+			"to":           []string{activityStreamsPublic},
+			"cc":           []string{actor + "/followers"},
+		},
+	}
+}
+
+// serveInbox handles follow requests. Only activities with a valid http
+// signature of the sending actor are accepted.
+func serveInbox(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+	if _, ok := getSpace(id); !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, inboxMaxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sender, err := verifyRequestSignature(r, body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var received activity
+	if err := json.Unmarshal(body, &received); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if received.Actor != sender.Id {
+		http.Error(w, "actor doesn't match the signature", http.StatusUnauthorized)
+		return
+	}
+
+	switch received.Type {
+	case "Follow":
+		if objectId(received.Object) != actorUrl(id) {
+			http.Error(w, "can only follow "+actorUrl(id), http.StatusBadRequest)
+			return
+		}
+		addFollower(id, sender)
+		activityDeliveries.enqueue(activityDelivery{
+			inbox: sender.Inbox,
+			activity: activity{
+				Context: activityStreamsContext,
+				Id:      actorUrl(id) + "#accepts/" + randomId(),
+				Type:    "Accept",
+				Actor:   actorUrl(id),
+				Object:  received,
+			},
+			actor: actorUrl(id),
+		})
+	case "Undo":
+		undone, _ := received.Object.(map[string]interface{})
+		if undone["type"] == "Follow" {
+			removeFollower(id, sender.Id)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func objectId(object interface{}) string {
+	switch object := object.(type) {
+	case string:
+		return object
+	case map[string]interface{}:
+		id, _ := object["id"].(string)
+		return id
+	}
+
+	return ""
+}
+
+func addFollower(id string, follower remoteActor) {
+	inbox := follower.Endpoints.SharedInbox
+	if inbox == "" {
+		inbox = follower.Inbox
+	}
+
+	activityPub.mutex.Lock()
+	defer activityPub.mutex.Unlock()
+	if activityPub.Followers[id] == nil {
+		activityPub.Followers[id] = make(map[string]string)
+	}
+	activityPub.Followers[id][follower.Id] = inbox
+	persistActivityPubLocked()
+}
+
+func removeFollower(id string, followerId string) {
+	activityPub.mutex.Lock()
+	defer activityPub.mutex.Unlock()
+	delete(activityPub.Followers[id], followerId)
+	persistActivityPubLocked()
+}
+
+// announceChanges sends a note to the followers of a space whenever it was
+// added to the directory, opened or closed.
+func announceChanges() {
+	for {
+		events := hub.subscribe()
+		for event := range events {
+			if !activityPubNoteTypes[event.Type] {
+				continue
+			}
+
+			activityPub.mutex.Lock()
+			inboxes := make(map[string]bool)
+			for _, inbox := range activityPub.Followers[event.SpaceId] {
+				inboxes[inbox] = true
+			}
+			activityPub.mutex.Unlock()
+
+			for inbox := range inboxes {
+				activityDeliveries.enqueue(activityDelivery{
+					inbox:    inbox,
+					activity: createActivity(event),
+					actor:    actorUrl(event.SpaceId),
+				})
+			}
+		}
+		log.Println("ActivityPub announcements fell behind the change events, resubscribing...")
+	}
+}
+
+// deliverActivity posts an activity to an inbox, signed by the actor.
+func deliverActivity(delivery activityDelivery) error {
+	body, err := json.Marshal(delivery.activity)
+	if err != nil {
+		return err
+	}
+
+	return postSigned(delivery.inbox, body, delivery.actor)
+}
+
+func postSigned(inbox string, body []byte, actor string) error {
+	if err := checkRemoteUrl(inbox); err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, inbox, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", activityJsonType)
+	digest := sha256.Sum256(body)
+	req.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+	if err := signRequest(req, actor, []string{"(request-target)", "host", "date", "digest"}); err != nil {
+		return err
+	}
+
+	resp, err := activityPubClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	_, _ = ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("inbox responded with %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// signRequest adds a draft-cavage http signature made with the instance key.
+func signRequest(req *http.Request, actor string, headers []string) error {
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	signed := sha256.Sum256([]byte(signingString(req, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, activityPubKey, crypto.SHA256, signed[:])
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s#main-key",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		actor, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature),
+	))
+
+	return nil
+}
+
+func signingString(req *http.Request, headers []string) string {
+	var lines []string
+	for _, header := range headers {
+		switch header {
+		case "(request-target)":
+			lines = append(lines, "(request-target): "+strings.ToLower(req.Method)+" "+req.URL.RequestURI())
+		case "host":
+			host := req.Host
+			if host == "" {
+				host = req.URL.Host
+			}
+			lines = append(lines, "host: "+host)
+		default:
+			lines = append(lines, header+": "+strings.Join(req.Header.Values(header), ", "))
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// verifyRequestSignature checks the http signature and digest of an incoming
+// request against the public key of the signing actor and returns the actor.
+func verifyRequestSignature(r *http.Request, body []byte) (remoteActor, error) {
+	params := make(map[string]string)
+	for _, part := range strings.Split(r.Header.Get("Signature"), ",") {
+		if i := strings.Index(part, "="); i > 0 {
+			params[strings.TrimSpace(part[:i])] = strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+	}
+	if params["keyId"] == "" || params["signature"] == "" {
+		return remoteActor{}, errors.New("missing http signature")
+	}
+
+	headers := strings.Fields(params["headers"])
+	if len(headers) == 0 {
+		headers = []string{"date"}
+	}
+	required := map[string]bool{"(request-target)": false, "digest": false, "date": false}
+	for _, header := range headers {
+		if _, ok := required[header]; ok {
+			required[header] = true
+		}
+	}
+	for header, signed := range required {
+		if !signed {
+			return remoteActor{}, errors.New(header + " has to be signed")
+		}
+	}
+
+	date, err := http.ParseTime(r.Header.Get("Date"))
+	if err != nil || time.Since(date) > signatureMaxAge || time.Until(date) > time.Hour {
+		return remoteActor{}, errors.New("date is missing or out of range")
+	}
+
+	digest := sha256.Sum256(body)
+	if r.Header.Get("Digest") != "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]) {
+		return remoteActor{}, errors.New("digest doesn't match the body")
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return remoteActor{}, errors.New("signature isn't base64 encoded")
+	}
+
+	sender, err := fetchActor(strings.SplitN(params["keyId"], "#", 2)[0], actorUrl(pat.Param(r, "id")))
+	if err != nil {
+		return remoteActor{}, err
+	}
+	if sender.PublicKey.Id != params["keyId"] || sender.PublicKey.Owner != sender.Id {
+		return remoteActor{}, errors.New("key doesn't belong to the actor")
+	}
+	// anyone can publish a document claiming the id of another actor, only
+	// the server of the actor can vouch for its key
+	if !sameOrigin(sender.Id, params["keyId"]) {
+		return remoteActor{}, errors.New("key isn't hosted by the server of the actor")
+	}
+
+	block, _ := pem.Decode([]byte(sender.PublicKey.PublicKeyPem))
+	if block == nil {
+		return remoteActor{}, errors.New("can't decode public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return remoteActor{}, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return remoteActor{}, errors.New("only rsa keys are supported")
+	}
+
+	signed := sha256.Sum256([]byte(signingString(r, headers)))
+	if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, signed[:], signature); err != nil {
+		return remoteActor{}, errors.New("invalid signature")
+	}
+
+	return sender, nil
+}
+
+// fetchActor requests the actor document with a signed request, as servers
+// running in secure mode only answer those.
+func fetchActor(id string, signer string) (remoteActor, error) {
+	var actor remoteActor
+
+	if err := checkRemoteUrl(id); err != nil {
+		return actor, err
+	}
+	req, err := http.NewRequest(http.MethodGet, id, nil)
+	if err != nil {
+		return actor, err
+	}
+	req.Header.Set("Accept", activityJsonType)
+	if err := signRequest(req, signer, []string{"(request-target)", "host", "date"}); err != nil {
+		return actor, err
+	}
+
+	resp, err := activityPubClient.Do(req)
+	if err != nil {
+		return actor, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return actor, fmt.Errorf("can't fetch actor %v: %v", id, resp.StatusCode)
+	}
+
+	err = json.NewDecoder(io.LimitReader(resp.Body, inboxMaxBodySize)).Decode(&actor)
+	if err == nil && actor.Inbox == "" {
+		err = errors.New("actor has no inbox")
+	}
+	// we post to the inboxes of our followers, they must not point us to
+	// other servers
+	if err == nil && !sameOrigin(actor.Inbox, actor.Id) {
+		err = errors.New("the inbox of the actor is on another server")
+	}
+	if err == nil && actor.Endpoints.SharedInbox != "" && !sameOrigin(actor.Endpoints.SharedInbox, actor.Id) {
+		err = errors.New("the shared inbox of the actor is on another server")
+	}
+
+	return actor, err
+}
+
+// privateNetworks are the address ranges remote actors and inboxes must
+// not point to, they would give the senders of activities access to our
+// internal services.
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+		"172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16", "198.18.0.0/15", "224.0.0.0/3",
+		"::/128", "::1/128", "64:ff9b::/96", "fc00::/7", "fe80::/10", "ff00::/8",
+	} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+
+	return networks
+}()
+
+// newActivityPubClient returns a client only connecting to public
+// addresses. The addresses are checked when connecting, so host names
+// resolving to internal addresses are refused as well.
+func newActivityPubClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: func(network string, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIp(ip) {
+				return fmt.Errorf("%v is not a public address", host)
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 10 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return checkRemoteUrl(req.URL.String())
+		},
+	}
+}
+
+func isPublicIp(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkRemoteUrl only allows https urls for remote actors and inboxes.
+func checkRemoteUrl(remoteUrl string) error {
+	parsed, err := url.Parse(remoteUrl)
+	if err != nil {
+		return err
+	}
+	if parsed.Scheme != "https" || parsed.Host == "" {
+		return fmt.Errorf("%v is not an https url", remoteUrl)
+	}
+
+	return nil
+}
+
+// sameOrigin compares the scheme and host of two urls.
+func sameOrigin(a string, b string) bool {
+	parsedA, errA := url.Parse(a)
+	parsedB, errB := url.Parse(b)
+	if errA != nil || errB != nil || parsedA.Host == "" {
+		return false
+	}
+
+	return parsedA.Scheme == parsedB.Scheme && strings.EqualFold(parsedA.Host, parsedB.Host)
+}
+
+func randomId() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return fmt.Sprintf("%x", b)
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// remoteServer hosts the actor documents of a fake ActivityPub server.
+type remoteServer struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	actors map[string]remoteActor
+}
+
+func newRemoteServer(t *testing.T) *remoteServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &remoteServer{key: key, actors: make(map[string]remoteActor)}
+	remote.Server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, ok := remote.actors[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", activityJsonType)
+		_ = json.NewEncoder(w).Encode(actor)
+	}))
+
+	return remote
+}
+
+// addActor publishes an actor document on path using the key of the
+// server, id and owner are what the document claims.
+func (s *remoteServer) addActor(path string, id string, owner string) string {
+	publicKey, err := x509.MarshalPKIXPublicKey(&s.key.PublicKey)
+	if err != nil {
+		panic(err)
+	}
+
+	actor := remoteActor{Id: id, Inbox: s.URL + path + "/inbox"}
+	actor.PublicKey.Id = s.URL + path + "#main-key"
+	actor.PublicKey.Owner = owner
+	actor.PublicKey.PublicKeyPem = string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey}))
+	s.actors[path] = actor
+
+	return actor.PublicKey.Id
+}
+
+// followRequest returns a Follow of the fixture space by actor, signed with
+// the key of the server.
+func (s *remoteServer) followRequest(actor string, keyId string) *http.Request {
+	body := fmt.Sprintf(`{"type": "Follow", "actor": %q, "object": %q}`, actor, actorUrl("fixture-space"))
+	r := httptest.NewRequest(http.MethodPost, "/ap/spaces/fixture-space/inbox", strings.NewReader(body))
+	digest := sha256.Sum256([]byte(body))
+	r.Header.Set("Digest", "SHA-256="+base64.StdEncoding.EncodeToString(digest[:]))
+	r.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	headers := []string{"(request-target)", "host", "date", "digest"}
+	signed := sha256.Sum256([]byte(signingString(r, headers)))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.key, crypto.SHA256, signed[:])
+	if err != nil {
+		panic(err)
+	}
+	r.Header.Set("Signature", fmt.Sprintf(
+		`keyId="%s",algorithm="rsa-sha256",headers="%s",signature="%s"`,
+		keyId, strings.Join(headers, " "), base64.StdEncoding.EncodeToString(signature),
+	))
+
+	return r
+}
+
+// deliveryRecorder replaces the delivery of activities in tests.
+type deliveryRecorder struct {
+	queue     *deliveryQueue
+	mutex     sync.Mutex
+	delivered []activityDelivery
+}
+
+func recordDeliveries() *deliveryRecorder {
+	recorder := &deliveryRecorder{}
+	recorder.queue = newDeliveryQueue(1, nil, func(delivery activityDelivery) error {
+		recorder.mutex.Lock()
+		defer recorder.mutex.Unlock()
+		recorder.delivered = append(recorder.delivered, delivery)
+		return nil
+	})
+
+	return recorder
+}
+
+func TestInboxOnlyAcceptsKeysOfTheActorsServer(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	remote := newRemoteServer(t)
+	defer remote.Close()
+
+	var err error
+	activityPubKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activityPubStorage = filepath.Join(t.TempDir(), "activityPub.json")
+	// the test server listens on a loopback address
+	defer func(client *http.Client) {
+		activityPubClient = client
+	}(activityPubClient)
+	activityPubClient = remote.Client()
+	deliveries := recordDeliveries()
+	defer func(q *deliveryQueue) {
+		activityDeliveries = q
+	}(activityDeliveries)
+	activityDeliveries = deliveries.queue
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	victim := "https://victim.example/users/alice"
+	forgedKey := remote.addActor("/users/mallory", victim, victim)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, remote.followRequest(victim, forgedKey))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("follow of an actor of another server responded with %d: %s", w.Code, w.Body.String())
+	}
+
+	bob := remote.URL + "/users/bob"
+	key := remote.addActor("/users/bob", bob, bob)
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, remote.followRequest(bob, key))
+	if w.Code != http.StatusAccepted {
+		t.Errorf("follow of an actor of the key's server responded with %d: %s", w.Code, w.Body.String())
+	}
+
+	deliveries.queue.wait()
+	if len(deliveries.delivered) != 1 || deliveries.delivered[0].inbox != bob+"/inbox" || deliveries.delivered[0].activity.Type != "Accept" {
+		t.Errorf("expected an Accept to the inbox of %v, got %+v", bob, deliveries.delivered)
+	}
+
+	activityPub.mutex.Lock()
+	defer activityPub.mutex.Unlock()
+	if _, ok := activityPub.Followers["fixture-space"][victim]; ok {
+		t.Errorf("the forged follow was accepted")
+	}
+	if _, ok := activityPub.Followers["fixture-space"][bob]; !ok {
+		t.Errorf("the follow of %v wasn't accepted", bob)
+	}
+}
+
+func TestActivityPubClientOnlyConnectsToPublicHttpsUrls(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	client := newActivityPubClient()
+	if _, err := client.Get(server.URL); err == nil || !strings.Contains(err.Error(), "not a public address") {
+		t.Errorf("request to %v wasn't refused: %v", server.URL, err)
+	}
+
+	for _, remoteUrl := range []string{"http://example.org/actor", "file:///etc/passwd", "/actor"} {
+		if err := checkRemoteUrl(remoteUrl); err == nil {
+			t.Errorf("%v was allowed", remoteUrl)
+		}
+	}
+	if _, err := fetchActor("http://169.254.169.254/latest/meta-data", actorUrl("fixture-space")); err == nil {
+		t.Errorf("an actor was fetched over http")
+	}
+}
+
+func TestFollowersInboxesMustBeOnTheActorsServer(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	remote := newRemoteServer(t)
+	defer remote.Close()
+
+	var err error
+	activityPubKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	activityPubStorage = filepath.Join(t.TempDir(), "activityPub.json")
+	defer func(client *http.Client) {
+		activityPubClient = client
+	}(activityPubClient)
+	activityPubClient = remote.Client()
+	deliveries := recordDeliveries()
+	defer func(q *deliveryQueue) {
+		activityDeliveries = q
+	}(activityDeliveries)
+	activityDeliveries = deliveries.queue
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		name        string
+		inbox       string
+		sharedInbox string
+	}{
+		{"inbox", "https://internal.example/admin", ""},
+		{"shared inbox", "", "https://internal.example/admin"},
+	} {
+		path := "/users/" + strings.Replace(test.name, " ", "-", -1)
+		actor := remote.URL + path
+		key := remote.addActor(path, actor, actor)
+		document := remote.actors[path]
+		if test.inbox != "" {
+			document.Inbox = test.inbox
+		}
+		document.Endpoints.SharedInbox = test.sharedInbox
+		remote.actors[path] = document
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, remote.followRequest(actor, key))
+		if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "another server") {
+			t.Errorf("%s: follow with an inbox on another server responded with %d: %s", test.name, w.Code, w.Body.String())
+		}
+	}
+
+	deliveries.queue.wait()
+	if len(deliveries.delivered) != 0 {
+		t.Errorf("activities were delivered to other servers: %+v", deliveries.delivered)
+	}
+}
+
+func TestDeliveryQueueLimitsAndRetriesDeliveries(t *testing.T) {
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	attempts := make(map[string]int)
+	q := newDeliveryQueue(3, []time.Duration{0, time.Millisecond, time.Millisecond}, func(delivery activityDelivery) error {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		attempts[delivery.inbox]++
+		attempt := attempts[delivery.inbox]
+		mutex.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		switch {
+		case delivery.inbox == "failing":
+			return errors.New("unavailable")
+		case delivery.inbox == "flaky" && attempt == 1:
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+
+	for i := 0; i < 20; i++ {
+		q.enqueue(activityDelivery{inbox: fmt.Sprintf("inbox%d", i)})
+	}
+	q.enqueue(activityDelivery{inbox: "failing"})
+	q.enqueue(activityDelivery{inbox: "flaky"})
+	q.wait()
+
+	if maxRunning > 3 {
+		t.Errorf("%d deliveries ran at the same time", maxRunning)
+	}
+	if attempts["failing"] != 3 || attempts["flaky"] != 2 || attempts["inbox0"] != 1 {
+		t.Errorf("unexpected attempts %v", attempts)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+var availabilityWindows = map[string]bool{"24h": true, "7d": true, "30d": true}
+
+// availabilitySort orders the directory by the reachability during a window,
+// by default the most reliable endpoints come first.
+type availabilitySort struct {
+	window    string
+	ascending bool
+}
+
+// parseAvailabilitySort reads the sort, window and order parameters. A zero
+// availabilitySort is returned if the directory shouldn't be sorted.
+func parseAvailabilitySort(query url.Values) (availabilitySort, error) {
+	switch query.Get("sort") {
+	case "":
+		return availabilitySort{}, nil
+	case "availability":
+	default:
+		return availabilitySort{}, errors.New("sort has to be availability")
+	}
+
+	s := availabilitySort{window: query.Get("window")}
+	if s.window == "" {
+		s.window = "30d"
+	}
+	if !availabilityWindows[s.window] {
+		return s, errors.New("window has to be 24h, 7d or 30d")
+	}
+
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		s.ascending = true
+	default:
+		return s, errors.New("order has to be asc or desc")
+	}
+
+	return s, nil
+}
+
+// sortEntries sorts by reachability, then validity and then name. Entries
+// without any scrapes in the window are always last.
+func (s availabilitySort) sortEntries(entries []spaceapi.ListedEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, aOk := entries[i].Availability[s.window]
+		b, bOk := entries[j].Availability[s.window]
+		if aOk != bOk {
+			return aOk
+		}
+		if a.Reachable != b.Reachable {
+			return (a.Reachable < b.Reachable) == s.ascending
+		}
+		if a.Valid != b.Valid {
+			return (a.Valid < b.Valid) == s.ascending
+		}
+		return strings.ToLower(entries[i].Space) < strings.ToLower(entries[j].Space)
+	})
+}
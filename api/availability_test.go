@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseAvailabilitySort(t *testing.T) {
+	for _, test := range []struct {
+		query    string
+		expected availabilitySort
+		err      string
+	}{
+		{"", availabilitySort{}, ""},
+		{"window=7d&order=asc", availabilitySort{}, ""},
+		{"sort=availability", availabilitySort{window: "30d"}, ""},
+		{"sort=availability&window=24h", availabilitySort{window: "24h"}, ""},
+		{"sort=availability&window=7d&order=asc", availabilitySort{window: "7d", ascending: true}, ""},
+		{"sort=availability&order=desc", availabilitySort{window: "30d"}, ""},
+		{"sort=name", availabilitySort{}, "sort has to be availability"},
+		{"sort=availability&window=1y", availabilitySort{}, "window has to be 24h, 7d or 30d"},
+		{"sort=availability&order=random", availabilitySort{}, "order has to be asc or desc"},
+	} {
+		query, _ := url.ParseQuery(test.query)
+		s, err := parseAvailabilitySort(query)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected the error %q, got %v", test.query, test.err, err)
+			}
+			continue
+		}
+		if err != nil || s != test.expected {
+			t.Errorf("%s: expected %+v, got %+v and %v", test.query, test.expected, s, err)
+		}
+	}
+}
+
+func TestSortEntriesByAvailability(t *testing.T) {
+	entry := func(space string, reachable float64, valid float64) spaceapi.ListedEntry {
+		return spaceapi.ListedEntry{Space: space, Availability: map[string]spaceapi.Availability{
+			"30d": {Scrapes: 10, Reachable: reachable, Valid: valid},
+		}}
+	}
+	entries := []spaceapi.ListedEntry{
+		{Space: "never scraped"},
+		entry("flaky", 50, 50),
+		entry("beta", 100, 100),
+		entry("invalid", 100, 0),
+		entry("Alpha", 100, 100),
+		{Space: "only today", Availability: map[string]spaceapi.Availability{"24h": {Scrapes: 1, Reachable: 100}}},
+	}
+
+	for _, test := range []struct {
+		sort     availabilitySort
+		expected string
+	}{
+		{availabilitySort{window: "30d"}, "Alpha,beta,invalid,flaky,never scraped,only today"},
+		{availabilitySort{window: "30d", ascending: true}, "flaky,invalid,Alpha,beta,never scraped,only today"},
+		{availabilitySort{window: "24h"}, "only today,Alpha,beta,flaky,invalid,never scraped"},
+	} {
+		sorted := append([]spaceapi.ListedEntry(nil), entries...)
+		test.sort.sortEntries(sorted)
+
+		var names []string
+		for _, e := range sorted {
+			names = append(names, e.Space)
+		}
+		if strings.Join(names, ",") != test.expected {
+			t.Errorf("%+v: expected %v, got %v", test.sort, test.expected, names)
+		}
+	}
+}
+
+func TestDirectorySortedByAvailability(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query    string
+		status   int
+		expected string
+	}{
+		{"valid=all&sort=availability", http.StatusOK, "fixture-space,legacy-space"},
+		{"valid=all&sort=availability&order=asc", http.StatusOK, "legacy-space,fixture-space"},
+		{"sort=availability&window=1y", http.StatusBadRequest, ""},
+		{"sort=uptime", http.StatusBadRequest, ""},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.query, test.status, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var entries []spaceapi.ListedEntry
+		if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, e := range entries {
+			ids = append(ids, e.Id)
+		}
+		if strings.Join(ids, ",") != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.query, test.expected, ids)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io/pat"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"html/template"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	badgeMaxAge     = 60
+	badgeHeight     = 20
+	badgePadding    = 6
+	badgeCharWidth  = 7
+	badgeTextOffset = 14
+	// badgeMaxText limits the characters of the label and the id, the size
+	// of the image grows with them
+	badgeMaxText = 64
+)
+
+type badgeTheme struct {
+	label       string
+	labelText   string
+	open        string
+	closed      string
+	unknown     string
+	messageText string
+	radius      int
+}
+
+var (
+	badgeThemes = map[string]badgeTheme{
+		"flat":        {"#555", "#fff", "#4c1", "#e05d44", "#9f9f9f", "#fff", 3},
+		"flat-square": {"#555", "#fff", "#4c1", "#e05d44", "#9f9f9f", "#fff", 0},
+		"dark":        {"#222", "#eee", "#2ea043", "#cf222e", "#444", "#fff", 3},
+		"light":       {"#eee", "#333", "#a6e3a1", "#f5a3a3", "#ddd", "#222", 3},
+	}
+	badgeScales = map[string]int{
+		"small":  1,
+		"medium": 2,
+		"large":  3,
+	}
+	badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.ScaledWidth}}" height="{{.ScaledHeight}}" viewBox="0 0 {{.Width}} {{.Height}}" role="img" aria-label="{{.Title}}">
+<title>{{.Title}}</title>
+<clipPath id="r"><rect width="{{.Width}}" height="{{.Height}}" rx="{{.Radius}}" fill="#fff"/></clipPath>
+<g clip-path="url(#r)">
+<rect width="{{.LabelWidth}}" height="{{.Height}}" fill="{{.LabelColor}}"/>
+<rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="{{.Height}}" fill="{{.MessageColor}}"/>
+</g>
+<g text-anchor="middle" font-family="DejaVu Sans Mono,Menlo,Consolas,monospace" font-size="11">
+{{if .Label}}<text x="{{.LabelX}}" y="{{.TextY}}" fill="{{.LabelTextColor}}" textLength="{{.LabelTextWidth}}" lengthAdjust="spacingAndGlyphs">{{.Label}}</text>{{end}}
+<text x="{{.MessageX}}" y="{{.TextY}}" fill="{{.MessageTextColor}}" textLength="{{.MessageTextWidth}}" lengthAdjust="spacingAndGlyphs">{{.Message}}</text>
+</g>
+</svg>
+`))
+	errUnknownBadgeOption = errors.New("unknown badge option")
+	errBadgeTextTooLong   = errors.New("label and id have to be at most " + strconv.Itoa(badgeMaxText) + " characters")
+)
+
+// badge is the content of a badge, rendered as svg or png with the same
+// layout. Text widths are based on a monospace font with 7px per character.
+type badge struct {
+	label   string
+	message string
+	title   string
+	color   string
+	theme   badgeTheme
+	scale   int
+}
+
+// serveBadge renders the open state of a space as /badge/<id>.svg or
+// /badge/<id>.png. Badges of unknown spaces are still rendered, so embedding
+// pages show that something is wrong.
+func serveBadge(w http.ResponseWriter, r *http.Request) {
+	file := pat.Param(r, "file")
+	format := ""
+	for _, extension := range []string{"svg", "png"} {
+		if strings.HasSuffix(file, "."+extension) {
+			format = extension
+		}
+	}
+	if format == "" {
+		http.NotFound(w, r)
+		return
+	}
+	id := strings.TrimSuffix(file, "."+format)
+	if utf8.RuneCountInString(id) > badgeMaxText {
+		http.Error(w, errBadgeTextTooLong.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b, err := newBadge(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusOK
+	lastModified := time.Time{}
+	space, ok := getSpace(id)
+	if ok {
+		lastModified = b.setState(r, space)
+	} else {
+		status = http.StatusNotFound
+		b.message = "not found"
+		b.title = "Unknown space " + id
+		b.color = b.theme.unknown
+	}
+	if b.label == "" && r.URL.Query()["label"] == nil {
+		b.label = id
+	}
+
+	var body []byte
+	if format == "svg" {
+		w.Header().Set("Content-Type", "image/svg+xml; charset=utf-8")
+		body, err = b.svg()
+	} else {
+		w.Header().Set("Content-Type", "image/png")
+		body, err = b.png()
+	}
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	hash := sha256.Sum256(body)
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(badgeMaxAge))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+
+	if status != http.StatusOK {
+		w.WriteHeader(status)
+		if _, err := w.Write(body); err != nil {
+			log.Println(err)
+		}
+		return
+	}
+
+	// handles If-None-Match and If-Modified-Since
+	http.ServeContent(w, r, file, lastModified, bytes.NewReader(body))
+}
+
+func newBadge(r *http.Request) (badge, error) {
+	query := r.URL.Query()
+	b := badge{label: query.Get("label"), scale: 1}
+	if utf8.RuneCountInString(b.label) > badgeMaxText {
+		return b, errBadgeTextTooLong
+	}
+
+	themeName := query.Get("theme")
+	if themeName == "" {
+		themeName = "flat"
+	}
+	theme, ok := badgeThemes[themeName]
+	if !ok {
+		return b, errUnknownBadgeOption
+	}
+	b.theme = theme
+
+	if size := query.Get("size"); size != "" {
+		scale, ok := badgeScales[size]
+		if !ok {
+			return b, errUnknownBadgeOption
+		}
+		b.scale = scale
+	}
+
+	return b, nil
+}
+
+// setState fills in the open state, the time since the last change and, if
+// requested, the people present. The time of the last change is returned.
+func (b *badge) setState(r *http.Request, space spaceapi.Entry) time.Time {
+	if b.label == "" && r.URL.Query()["label"] == nil {
+		b.label = truncateBadgeText(space.SpaceName())
+	}
+
+	state, _ := space.Data["state"].(map[string]interface{})
+	open, known := state["open"].(bool)
+	switch {
+	case !known:
+		b.message = "unknown"
+		b.color = b.theme.unknown
+	case open:
+		b.message = "open"
+		b.color = b.theme.open
+	default:
+		b.message = "closed"
+		b.color = b.theme.closed
+	}
+	b.title = space.SpaceName() + " is " + b.message
+
+	var lastChange time.Time
+	if timestamp, ok := state["lastchange"].(float64); ok && timestamp > 0 {
+		lastChange = time.Unix(int64(timestamp), 0)
+		b.title += " since " + lastChange.UTC().Format(time.RFC3339)
+		if r.URL.Query().Get("lastchange") != "false" && known {
+			b.message += " for " + formatBadgeDuration(time.Since(lastChange))
+		}
+	}
+
+	if r.URL.Query().Get("people") == "true" {
+		people := 0.0
+		found := false
+		for _, s := range spaceSensors(space, "people_now_present") {
+			if value, ok := s.Value.(float64); ok {
+				people += value
+				found = true
+			}
+		}
+		if found {
+			b.message += ", " + strconv.FormatFloat(people, 'f', -1, 64) + " people"
+		}
+	}
+
+	return lastChange
+}
+
+// truncateBadgeText shortens the names of spaces to the length allowed for
+// labels.
+func truncateBadgeText(text string) string {
+	if utf8.RuneCountInString(text) <= badgeMaxText {
+		return text
+	}
+
+	return string([]rune(text)[:badgeMaxText-1]) + "…"
+}
+
+func formatBadgeDuration(d time.Duration) string {
+	switch {
+	case d < time.Hour:
+		return strconv.Itoa(int(d.Minutes())) + "m"
+	case d < 48*time.Hour:
+		return strconv.Itoa(int(d.Hours())) + "h"
+	default:
+		return strconv.Itoa(int(d.Hours()/24)) + "d"
+	}
+}
+
+func badgeTextWidth(text string) int {
+	return utf8.RuneCountInString(text) * badgeCharWidth
+}
+
+func (b badge) labelWidth() int {
+	if b.label == "" {
+		return 0
+	}
+	return badgeTextWidth(b.label) + 2*badgePadding
+}
+
+func (b badge) messageWidth() int {
+	return badgeTextWidth(b.message) + 2*badgePadding
+}
+
+func (b badge) svg() ([]byte, error) {
+	labelWidth := b.labelWidth()
+	messageWidth := b.messageWidth()
+	width := labelWidth + messageWidth
+
+	var buffer bytes.Buffer
+	err := badgeTemplate.Execute(&buffer, map[string]interface{}{
+		"Width":            width,
+		"Height":           badgeHeight,
+		"ScaledWidth":      width * b.scale,
+		"ScaledHeight":     badgeHeight * b.scale,
+		"Radius":           b.theme.radius,
+		"Title":            b.title,
+		"Label":            b.label,
+		"LabelWidth":       labelWidth,
+		"LabelColor":       b.theme.label,
+		"LabelTextColor":   b.theme.labelText,
+		"LabelX":           labelWidth / 2,
+		"LabelTextWidth":   badgeTextWidth(b.label),
+		"Message":          b.message,
+		"MessageWidth":     messageWidth,
+		"MessageColor":     b.color,
+		"MessageTextColor": b.theme.messageText,
+		"MessageX":         labelWidth + messageWidth/2,
+		"MessageTextWidth": badgeTextWidth(b.message),
+		"TextY":            badgeTextOffset,
+	})
+
+	return buffer.Bytes(), err
+}
+
+// png draws the badge with a bitmap font and scales it up for larger sizes,
+// corners are always square.
+func (b badge) png() ([]byte, error) {
+	labelWidth := b.labelWidth()
+	width := labelWidth + b.messageWidth()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, badgeHeight))
+	draw.Draw(img, image.Rect(0, 0, labelWidth, badgeHeight), image.NewUniform(parseHexColor(b.theme.label)), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(labelWidth, 0, width, badgeHeight), image.NewUniform(parseHexColor(b.color)), image.Point{}, draw.Src)
+
+	drawer := font.Drawer{Dst: img, Face: basicfont.Face7x13}
+	drawer.Src = image.NewUniform(parseHexColor(b.theme.labelText))
+	drawer.Dot = fixed.P(badgePadding, badgeTextOffset)
+	drawer.DrawString(b.label)
+	drawer.Src = image.NewUniform(parseHexColor(b.theme.messageText))
+	drawer.Dot = fixed.P(labelWidth+badgePadding, badgeTextOffset)
+	drawer.DrawString(b.message)
+
+	var result image.Image = img
+	if b.scale > 1 {
+		scaled := image.NewRGBA(image.Rect(0, 0, width*b.scale, badgeHeight*b.scale))
+		draw.NearestNeighbor.Scale(scaled, scaled.Bounds(), img, img.Bounds(), draw.Src, nil)
+		result = scaled
+	}
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, result)
+	return buffer.Bytes(), err
+}
+
+// parseHexColor parses the #rgb and #rrggbb colors of the themes.
+func parseHexColor(value string) color.RGBA {
+	value = strings.TrimPrefix(value, "#")
+	if len(value) == 3 {
+		value = string([]byte{value[0], value[0], value[1], value[1], value[2], value[2]})
+	}
+
+	rgb, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return color.RGBA{A: 0xff}
+	}
+
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestBadgeTextIsLimited(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	long := strings.Repeat("ä", badgeMaxText+1)
+	for _, test := range []struct {
+		path   string
+		status int
+	}{
+		{"/badge/fixture-space.svg?label=" + url.QueryEscape(strings.Repeat("ä", badgeMaxText)), http.StatusOK},
+		{"/badge/fixture-space.svg?label=" + url.QueryEscape(long), http.StatusBadRequest},
+		{"/badge/fixture-space.png?size=large&label=" + url.QueryEscape(long), http.StatusBadRequest},
+		{"/badge/" + strings.Repeat("a", badgeMaxText) + ".svg", http.StatusNotFound},
+		{"/badge/" + strings.Repeat("a", badgeMaxText+1) + ".svg", http.StatusBadRequest},
+		{"/badge/" + strings.Repeat("a", badgeMaxText+1) + ".png?size=large", http.StatusBadRequest},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, w.Code)
+		}
+	}
+}
+
+func TestTruncateBadgeText(t *testing.T) {
+	if text := truncateBadgeText("Fixture Space"); text != "Fixture Space" {
+		t.Errorf("a short name was changed to %q", text)
+	}
+	text := truncateBadgeText(strings.Repeat("ä", 1000))
+	if utf8.RuneCountInString(text) != badgeMaxText || !strings.HasSuffix(text, "…") {
+		t.Errorf("expected the name to be cut to %d characters, got %q", badgeMaxText, text)
+	}
+}
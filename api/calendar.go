@@ -0,0 +1,438 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/teambition/rrule-go"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata"
+	"unicode/utf8"
+)
+
+const (
+	defaultCalendarWindow = 90 * 24 * time.Hour
+	maxCalendarWindow     = 366 * 24 * time.Hour
+	defaultCalendarLimit  = 500
+	maxCalendarLimit      = 5000
+)
+
+// calendarOccurrence is a single occurrence of an event in the merged
+// calendar.
+type calendarOccurrence struct {
+	SpaceId     string   `json:"spaceId"`
+	Space       string   `json:"space,omitempty"`
+	Country     string   `json:"country,omitempty"`
+	Lat         *float64 `json:"lat,omitempty"`
+	Lon         *float64 `json:"lon,omitempty"`
+	Uid         string   `json:"uid"`
+	Summary     string   `json:"summary,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	Url         string   `json:"url,omitempty"`
+	Start       int64    `json:"start" description:"Unix timestamp"`
+	End         int64    `json:"end" description:"Unix timestamp"`
+	AllDay      bool     `json:"allDay,omitempty"`
+	Recurring   bool     `json:"recurring,omitempty" description:"The event is an occurrence of a recurring event"`
+	// location the dates of all-day events are in
+	location *time.Location
+}
+
+type calendarResponse struct {
+	From    int64                `json:"from"`
+	To      int64                `json:"to"`
+	Events  []calendarOccurrence `json:"events"`
+	HasMore bool                 `json:"hasMore"`
+}
+
+type calendarQuery struct {
+	from      time.Time
+	to        time.Time
+	limit     int
+	ids       map[string]bool
+	countries map[string]bool
+	// bbox is min longitude, min latitude, max longitude, max latitude
+	bbox []float64
+}
+
+func (q calendarQuery) matches(calendar spaceapi.SpaceCalendar) bool {
+	if len(q.ids) > 0 && !q.ids[calendar.SpaceId] {
+		return false
+	}
+	if len(q.countries) > 0 && !q.countries[strings.ToLower(calendar.Country)] {
+		return false
+	}
+	if q.bbox != nil {
+		return calendar.Lat != nil && calendar.Lon != nil &&
+			*calendar.Lon >= q.bbox[0] && *calendar.Lat >= q.bbox[1] &&
+			*calendar.Lon <= q.bbox[2] && *calendar.Lat <= q.bbox[3]
+	}
+
+	return true
+}
+
+// parseCalendarQuery reads the filters of a calendar request. Without from
+// and to the upcoming events of the next 90 days are returned.
+func parseCalendarQuery(r *http.Request) (calendarQuery, error) {
+	query := calendarQuery{
+		from:      time.Now(),
+		limit:     defaultCalendarLimit,
+		ids:       listParam(r.URL.Query().Get("ids")),
+		countries: listParam(strings.ToLower(r.URL.Query().Get("country"))),
+	}
+
+	if from := r.URL.Query().Get("from"); from != "" {
+		timestamp, err := strconv.ParseInt(from, 10, 64)
+		if err != nil {
+			return query, errors.New("from has to be a unix timestamp")
+		}
+		query.from = time.Unix(timestamp, 0)
+	}
+
+	query.to = query.from.Add(defaultCalendarWindow)
+	if to := r.URL.Query().Get("to"); to != "" {
+		timestamp, err := strconv.ParseInt(to, 10, 64)
+		if err != nil {
+			return query, errors.New("to has to be a unix timestamp")
+		}
+		query.to = time.Unix(timestamp, 0)
+	}
+	if !query.to.After(query.from) || query.to.Sub(query.from) > maxCalendarWindow {
+		return query, errors.New("to has to be after from and at most 366 days later")
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		query.limit, err = strconv.Atoi(limit)
+		if err != nil || query.limit <= 0 {
+			return query, errors.New("limit has to be a positive number")
+		}
+		if query.limit > maxCalendarLimit {
+			query.limit = maxCalendarLimit
+		}
+	}
+
+	if bbox := r.URL.Query().Get("bbox"); bbox != "" {
+		for _, v := range strings.Split(bbox, ",") {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return query, errors.New("bbox has to be minLon,minLat,maxLon,maxLat")
+			}
+			query.bbox = append(query.bbox, f)
+		}
+		if len(query.bbox) != 4 {
+			return query, errors.New("bbox has to be minLon,minLat,maxLon,maxLat")
+		}
+	}
+
+	return query, nil
+}
+
+func serveCalendarJson(w http.ResponseWriter, r *http.Request) {
+	response, ok := getCalendarResponse(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+func serveCalendarIcs(w http.ResponseWriter, r *http.Request) {
+	response, ok := getCalendarResponse(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if _, err := w.Write([]byte(createIcs(response.Events))); err != nil {
+		log.Println(err)
+	}
+}
+
+func getCalendarResponse(w http.ResponseWriter, r *http.Request) (calendarResponse, bool) {
+	query, err := parseCalendarQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return calendarResponse{}, false
+	}
+
+	calendars, err := getCalendars()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return calendarResponse{}, false
+	}
+
+	var occurrences []calendarOccurrence
+	for _, calendar := range calendars {
+		if query.matches(calendar) {
+			occurrences = append(occurrences, expandCalendar(calendar, query.from, query.to)...)
+		}
+	}
+
+	sort.SliceStable(occurrences, func(i, j int) bool {
+		if occurrences[i].Start != occurrences[j].Start {
+			return occurrences[i].Start < occurrences[j].Start
+		}
+		return occurrences[i].SpaceId < occurrences[j].SpaceId
+	})
+
+	response := calendarResponse{
+		From:   query.from.Unix(),
+		To:     query.to.Unix(),
+		Events: []calendarOccurrence{},
+	}
+	if len(occurrences) > query.limit {
+		occurrences = occurrences[:query.limit]
+		response.HasMore = true
+	}
+	response.Events = append(response.Events, occurrences...)
+
+	return response, true
+}
+
+func getCalendars() ([]spaceapi.SpaceCalendar, error) {
+	var calendars []spaceapi.SpaceCalendar
+	resp, err := http.Get(spaceApiCollectorUrl + "/calendars")
+	if err != nil {
+		return calendars, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return calendars, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return calendars, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &calendars)
+	return calendars, err
+}
+
+// expandCalendar returns the occurrences of the events of a calendar
+// overlapping the time range. Occurrences replaced by an event with a
+// recurrence id are skipped, the replacement is used instead. Occurrences of
+// all-day events span the same number of days as the event.
+func expandCalendar(calendar spaceapi.SpaceCalendar, from time.Time, to time.Time) []calendarOccurrence {
+	replaced := make(map[string]bool)
+	for _, event := range calendar.Events {
+		if event.RecurrenceId != 0 {
+			replaced[event.Uid+"/"+strconv.FormatInt(event.RecurrenceId, 10)] = true
+		}
+	}
+
+	var occurrences []calendarOccurrence
+	for _, event := range calendar.Events {
+		if event.Cancelled {
+			continue
+		}
+
+		location, err := eventLocation(event)
+		if err != nil {
+			log.Printf("can't expand event %v of %v: %v\n", event.Uid, calendar.SpaceId, err)
+			continue
+		}
+
+		recurring := event.RecurrenceId == 0 && (event.RRule != "" || len(event.RDates) > 0)
+		starts := []time.Time{time.Unix(event.Start, 0)}
+		if recurring {
+			starts, err = expandEvent(event, location, from, to)
+			if err != nil {
+				log.Printf("can't expand event %v of %v: %v\n", event.Uid, calendar.SpaceId, err)
+				continue
+			}
+		}
+
+		duration := event.End - event.Start
+		days := calendarDays(time.Unix(event.Start, 0).In(location), time.Unix(event.End, 0).In(location))
+		for _, start := range starts {
+			if recurring && replaced[event.Uid+"/"+strconv.FormatInt(start.Unix(), 10)] {
+				continue
+			}
+
+			end := start.Unix() + duration
+			if event.AllDay {
+				end = start.In(location).AddDate(0, 0, days).Unix()
+			}
+			if !start.Before(to) || (end <= from.Unix() && start.Before(from)) {
+				continue
+			}
+
+			occurrences = append(occurrences, calendarOccurrence{
+				SpaceId:     calendar.SpaceId,
+				Space:       calendar.Space,
+				Country:     calendar.Country,
+				Lat:         calendar.Lat,
+				Lon:         calendar.Lon,
+				Uid:         event.Uid,
+				Summary:     event.Summary,
+				Description: event.Description,
+				Location:    event.Location,
+				Url:         event.Url,
+				Start:       start.Unix(),
+				End:         end,
+				AllDay:      event.AllDay,
+				Recurring:   recurring,
+				location:    location,
+			})
+		}
+	}
+
+	return occurrences
+}
+
+// eventLocation returns the time zone floating times and dates of an event
+// are in.
+func eventLocation(event spaceapi.CalendarEvent) (*time.Location, error) {
+	if event.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(event.TimeZone)
+}
+
+// calendarDays returns the number of dates from start to end.
+func calendarDays(start time.Time, end time.Time) int {
+	startDate := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.UTC)
+	endDate := time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.UTC)
+
+	return int(endDate.Sub(startDate).Hours() / 24)
+}
+
+// expandEvent returns the starts of a recurring event that may overlap the
+// time range. The rule is evaluated in the time zone of the event, rules
+// repeating more often than daily aren't supported.
+func expandEvent(event spaceapi.CalendarEvent, location *time.Location, from time.Time, to time.Time) ([]time.Time, error) {
+	start := time.Unix(event.Start, 0).In(location)
+
+	set := rrule.Set{}
+	set.DTStart(start)
+	// the start is always the first occurrence, even if it doesn't match
+	// the rule
+	set.RDate(start)
+
+	if event.RRule != "" {
+		option, err := rrule.StrToROptionInLocation(event.RRule, location)
+		if err != nil {
+			return nil, err
+		}
+		if option.Freq > rrule.DAILY {
+			return nil, errors.New("rules repeating more often than daily aren't supported")
+		}
+		option.Dtstart = start
+		rule, err := rrule.NewRRule(*option)
+		if err != nil {
+			return nil, err
+		}
+		set.RRule(rule)
+	}
+
+	for _, rdate := range event.RDates {
+		set.RDate(time.Unix(rdate, 0).In(location))
+	}
+	for _, exdate := range event.ExDates {
+		set.ExDate(time.Unix(exdate, 0).In(location))
+	}
+
+	duration := time.Duration(event.End-event.Start) * time.Second
+	if event.AllDay {
+		// a daylight saving time change can make an occurrence an hour longer
+		duration += time.Hour
+	}
+	return set.Between(from.Add(-duration), to, true), nil
+}
+
+// createIcs renders occurrences as an iCalendar file. Occurrences of
+// recurring events get their own uid, as the rules aren't passed on.
+func createIcs(occurrences []calendarOccurrence) string {
+	var b strings.Builder
+	now := time.Now().UTC().Format("20060102T150405Z")
+
+	writeIcsLine(&b, "BEGIN:VCALENDAR")
+	writeIcsLine(&b, "VERSION:2.0")
+	writeIcsLine(&b, "PRODID:-//SpaceAPI//Directory API//EN")
+	writeIcsLine(&b, "CALSCALE:GREGORIAN")
+	writeIcsLine(&b, "X-WR-CALNAME:SpaceAPI events")
+
+	for _, o := range occurrences {
+		uid := o.SpaceId + "/" + o.Uid
+		if o.Recurring {
+			uid += "/" + strconv.FormatInt(o.Start, 10)
+		}
+
+		summary := o.Summary
+		if o.Space != "" {
+			summary = o.Space + ": " + summary
+		}
+
+		writeIcsLine(&b, "BEGIN:VEVENT")
+		writeIcsLine(&b, "UID:"+escapeIcsText(uid))
+		writeIcsLine(&b, "DTSTAMP:"+now)
+		if o.AllDay {
+			location := o.location
+			if location == nil {
+				location = time.UTC
+			}
+			writeIcsLine(&b, "DTSTART;VALUE=DATE:"+time.Unix(o.Start, 0).In(location).Format("20060102"))
+			writeIcsLine(&b, "DTEND;VALUE=DATE:"+time.Unix(o.End, 0).In(location).Format("20060102"))
+		} else {
+			writeIcsLine(&b, "DTSTART:"+time.Unix(o.Start, 0).UTC().Format("20060102T150405Z"))
+			writeIcsLine(&b, "DTEND:"+time.Unix(o.End, 0).UTC().Format("20060102T150405Z"))
+		}
+		writeIcsLine(&b, "SUMMARY:"+escapeIcsText(summary))
+		if o.Description != "" {
+			writeIcsLine(&b, "DESCRIPTION:"+escapeIcsText(o.Description))
+		}
+		if o.Location != "" {
+			writeIcsLine(&b, "LOCATION:"+escapeIcsText(o.Location))
+		}
+		if o.Url != "" {
+			writeIcsLine(&b, "URL:"+o.Url)
+		}
+		writeIcsLine(&b, "END:VEVENT")
+	}
+
+	writeIcsLine(&b, "END:VCALENDAR")
+	return b.String()
+}
+
+func escapeIcsText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(text)
+}
+
+// writeIcsLine folds lines longer than 75 octets without splitting utf-8
+// characters.
+func writeIcsLine(b *strings.Builder, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space
+		limit = 74
+	}
+	b.WriteString(line)
+	b.WriteString("\r\n")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestExpandCalendar(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(month time.Month, day int, hour int) time.Time {
+		return time.Date(2030, month, day, hour, 0, 0, 0, berlin)
+	}
+
+	// the clocks move forward on March 31st
+	calendar := spaceapi.SpaceCalendar{
+		SpaceId: "fixture-space",
+		Events: []spaceapi.CalendarEvent{
+			{
+				Uid: "weekly", Start: at(3, 19, 18).Unix(), End: at(3, 19, 20).Unix(), TimeZone: "Europe/Berlin",
+				RRule: "FREQ=WEEKLY;COUNT=5", ExDates: []int64{at(3, 26, 18).Unix()},
+			},
+			// moves the occurrence of April 2nd to the next day
+			{Uid: "weekly", Start: at(4, 3, 19).Unix(), End: at(4, 3, 21).Unix(), RecurrenceId: at(4, 2, 18).Unix()},
+			{Uid: "weekly", Start: at(4, 9, 18).Unix(), End: at(4, 9, 20).Unix(), RecurrenceId: at(4, 9, 18).Unix(), Cancelled: true},
+			{
+				Uid: "all-day", Start: at(3, 24, 0).Unix(), End: at(3, 25, 0).Unix(), TimeZone: "Europe/Berlin",
+				AllDay: true, RRule: "FREQ=WEEKLY;COUNT=2",
+			},
+			{Uid: "single", Start: at(3, 20, 10).Unix(), End: at(3, 20, 12).Unix()},
+		},
+	}
+
+	type occurrence struct {
+		uid   string
+		start time.Time
+		end   time.Time
+	}
+	for _, test := range []struct {
+		name     string
+		from     time.Time
+		to       time.Time
+		expected []occurrence
+	}{
+		{"all", at(3, 1, 0), at(5, 1, 0), []occurrence{
+			{"weekly", at(3, 19, 18), at(3, 19, 20)},
+			{"single", at(3, 20, 10), at(3, 20, 12)},
+			{"all-day", at(3, 24, 0), at(3, 25, 0)},
+			{"all-day", at(3, 31, 0), at(4, 1, 0)},
+			{"weekly", at(4, 3, 19), at(4, 3, 21)},
+			{"weekly", at(4, 16, 18), at(4, 16, 20)},
+		}},
+		{"overlapping the start", at(3, 19, 19), at(3, 24, 0), []occurrence{
+			{"weekly", at(3, 19, 18), at(3, 19, 20)},
+			{"single", at(3, 20, 10), at(3, 20, 12)},
+		}},
+		{"all-day across the time change", at(3, 31, 12), at(4, 1, 0), []occurrence{
+			{"all-day", at(3, 31, 0), at(4, 1, 0)},
+		}},
+		{"nothing", at(5, 1, 0), at(6, 1, 0), nil},
+	} {
+		occurrences := expandCalendar(calendar, test.from, test.to)
+		sort.Slice(occurrences, func(i, j int) bool {
+			return occurrences[i].Start < occurrences[j].Start
+		})
+
+		var got []occurrence
+		for _, o := range occurrences {
+			got = append(got, occurrence{o.Uid, time.Unix(o.Start, 0).In(berlin), time.Unix(o.End, 0).In(berlin)})
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i].uid != test.expected[i].uid || !got[i].start.Equal(test.expected[i].start) || !got[i].end.Equal(test.expected[i].end) {
+				t.Errorf("%s: expected %v, got %v", test.name, test.expected[i], got[i])
+			}
+		}
+	}
+}
+
+func TestCreateIcs(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	description := strings.Repeat("Löten für Anfänger, mit Pizza; ", 10)
+	ics := createIcs([]calendarOccurrence{
+		{
+			SpaceId: "fixture-space", Space: "Fixture Space", Uid: "weekly", Summary: "Open evening", Description: description,
+			Start: time.Date(2030, 3, 19, 18, 0, 0, 0, berlin).Unix(), End: time.Date(2030, 3, 19, 20, 0, 0, 0, berlin).Unix(),
+			Recurring: true, location: berlin,
+		},
+		{
+			SpaceId: "fixture-space", Uid: "all-day", Summary: "Congress",
+			Start: time.Date(2030, 3, 31, 0, 0, 0, 0, berlin).Unix(), End: time.Date(2030, 4, 1, 0, 0, 0, 0, berlin).Unix(),
+			AllDay: true, location: berlin,
+		},
+	})
+
+	if !strings.HasSuffix(ics, "\r\n") {
+		t.Errorf("the file doesn't end with a line break")
+	}
+	lines := strings.Split(strings.TrimSuffix(ics, "\r\n"), "\r\n")
+	var unfolded []string
+	for _, line := range lines {
+		if len(line) > 75 {
+			t.Errorf("the line is longer than 75 octets: %q", line)
+		}
+		if !utf8.ValidString(line) {
+			t.Errorf("a character was split: %q", line)
+		}
+		if strings.HasPrefix(line, " ") {
+			unfolded[len(unfolded)-1] += line[1:]
+		} else {
+			unfolded = append(unfolded, line)
+		}
+	}
+
+	for _, expected := range []string{
+		"UID:fixture-space/weekly/" + strconv.FormatInt(time.Date(2030, 3, 19, 18, 0, 0, 0, berlin).Unix(), 10),
+		"DTSTART:20300319T170000Z",
+		"DTEND:20300319T190000Z",
+		"SUMMARY:Fixture Space: Open evening",
+		"DESCRIPTION:" + escapeIcsText(description),
+		"UID:fixture-space/all-day",
+		"DTSTART;VALUE=DATE:20300331",
+		"DTEND;VALUE=DATE:20300401",
+	} {
+		found := false
+		for _, line := range unfolded {
+			found = found || line == expected
+		}
+		if !found {
+			t.Errorf("expected the line %q", expected)
+		}
+	}
+	if !strings.Contains(escapeIcsText(description), `Anfänger\, mit Pizza\;`) {
+		t.Errorf("commas and semicolons aren't escaped")
+	}
+}
+
+// filterCalendars are calendars of spaces in different countries, one of
+// them without a location.
+const filterCalendars = `[
+	{"spaceId": "berlin", "country": "de", "lat": 52.5, "lon": 13.4, "url": "https://berlin.example/calendar.ics",
+	 "events": [{"uid": "a", "start": 1900000000, "end": 1900003600}, {"uid": "b", "start": 1900086400, "end": 1900090000}]},
+	{"spaceId": "amsterdam", "country": "nl", "lat": 52.4, "lon": 4.9, "url": "https://amsterdam.example/calendar.ics",
+	 "events": [{"uid": "c", "start": 1900000000, "end": 1900003600}]},
+	{"spaceId": "nowhere", "country": "de", "url": "https://nowhere.example/calendar.ics",
+	 "events": [{"uid": "d", "start": 1900000000, "end": 1900003600}]}
+]`
+
+func TestCalendarFilters(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(filterCalendars))
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query   string
+		status  int
+		uids    string
+		hasMore bool
+	}{
+		{"", http.StatusOK, "c,a,d,b", false},
+		{"country=DE", http.StatusOK, "a,d,b", false},
+		{"country=de,nl", http.StatusOK, "c,a,d,b", false},
+		{"ids=amsterdam,nowhere", http.StatusOK, "c,d", false},
+		{"bbox=10,50,15,55", http.StatusOK, "a,b", false},
+		{"bbox=0,50,15,55&country=nl", http.StatusOK, "c", false},
+		{"bbox=0,0,1,1", http.StatusOK, "", false},
+		{"limit=2", http.StatusOK, "c,a", true},
+		{"to=1900050000", http.StatusOK, "c,a,d", false},
+		{"bbox=10,50,15", http.StatusBadRequest, "", false},
+		{"bbox=a,b,c,d", http.StatusBadRequest, "", false},
+		{"to=1899990000", http.StatusBadRequest, "", false},
+		{"limit=0", http.StatusBadRequest, "", false},
+	} {
+		path := "/v2/calendar.json?from=1899990000"
+		if test.query != "" {
+			path += "&" + test.query
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var response calendarResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var uids []string
+		for _, event := range response.Events {
+			uids = append(uids, event.Uid)
+		}
+		if strings.Join(uids, ",") != test.uids || response.HasMore != test.hasMore {
+			t.Errorf("%s: expected %v and hasMore %v, got %v and %v", test.query, test.uids, test.hasMore, uids, response.HasMore)
+		}
+	}
+}
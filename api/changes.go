@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// describeEvent returns a short human readable sentence about a change.
+func describeEvent(event spaceapi.ChangeEvent) string {
+	name := event.Space
+	if name == "" {
+		name = event.SpaceId
+	}
+
+	switch event.Type {
+	case "added":
+		return name + " was added to the SpaceAPI directory."
+	case "removed":
+		return name + " was removed from the SpaceAPI directory."
+	case "valid":
+		return name + " is valid again."
+	case "invalid":
+		return name + " became invalid."
+	case "opened":
+		return name + " is now open."
+	case "closed":
+		return name + " is now closed."
+	default:
+		return name + " has changed."
+	}
+}
+
+// serveChanges passes the change feed of the collector through, the since
+// and limit parameters are handled by the collector.
+func serveChanges(w http.ResponseWriter, r *http.Request) {
+	proxyCollector(w, r, "/changes")
+}
+
+// changesQuery selects the change events requested from the collector, the
+// space ids and types are comma separated lists.
+type changesQuery struct {
+	Since    string
+	Limit    int
+	SpaceIds string
+	Types    string
+	// Order is either asc (default) or desc for the newest events first
+	Order string
+}
+
+func getChanges(q changesQuery) (spaceapi.ChangesResponse, error) {
+	query := url.Values{}
+	if q.Since != "" {
+		query.Set("since", q.Since)
+	}
+	if q.Limit > 0 {
+		query.Set("limit", strconv.Itoa(q.Limit))
+	}
+	if q.SpaceIds != "" {
+		query.Set("spaceId", q.SpaceIds)
+	}
+	if q.Types != "" {
+		query.Set("types", q.Types)
+	}
+	if q.Order != "" {
+		query.Set("order", q.Order)
+	}
+
+	var changes spaceapi.ChangesResponse
+	resp, err := http.Get(spaceApiCollectorUrl + "/changes?" + query.Encode())
+	if err != nil {
+		return changes, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return changes, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return changes, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &changes)
+	return changes, err
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"sort"
+	"strconv"
+)
+
+type spaceDeprecations struct {
+	Id    string `json:"id"`
+	Space string `json:"space,omitempty"`
+	Url   string `json:"url"`
+	spaceapi.DeprecationReport
+}
+
+// deprecationSummary counts the spaces per deprecated version and field.
+type deprecationSummary struct {
+	Spaces             int            `json:"spaces"`
+	Compliant          int            `json:"compliant"`
+	DeprecatedVersions map[string]int `json:"deprecatedVersions" description:"Number of spaces per deprecated version"`
+	DeprecatedFields   map[string]int `json:"deprecatedFields" description:"Number of spaces per deprecated field"`
+}
+
+type deprecationsResponse struct {
+	Summary deprecationSummary  `json:"summary"`
+	Spaces  []spaceDeprecations `json:"spaces"`
+}
+
+// serveDeprecations lists what the spaces have to change to implement the
+// latest SpaceAPI version, filtered by space ids, declared versions and
+// whether they are compliant already.
+func serveDeprecations(w http.ResponseWriter, r *http.Request) {
+	ids := listParam(r.URL.Query().Get("ids"))
+	versions := listParam(r.URL.Query().Get("versions"))
+
+	var compliant *bool
+	if param := r.URL.Query().Get("compliant"); param != "" {
+		value, err := strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "compliant has to be true or false", http.StatusBadRequest)
+			return
+		}
+		compliant = &value
+	}
+
+	response := deprecationsResponse{
+		Summary: deprecationSummary{
+			DeprecatedVersions: make(map[string]int),
+			DeprecatedFields:   make(map[string]int),
+		},
+		Spaces: []spaceDeprecations{},
+	}
+	for _, entry := range getDirectory(".[]") {
+		if entry.ValidationResult.Deprecations == nil {
+			continue
+		}
+		report := *entry.ValidationResult.Deprecations
+		if len(ids) > 0 && !ids[entry.Id] {
+			continue
+		}
+		if len(versions) > 0 && !declaresAny(report.Versions, versions) {
+			continue
+		}
+		if compliant != nil && report.Compliant != *compliant {
+			continue
+		}
+
+		response.Spaces = append(response.Spaces, spaceDeprecations{
+			Id:                entry.Id,
+			Space:             entry.SpaceName(),
+			Url:               entry.Url,
+			DeprecationReport: report,
+		})
+
+		response.Summary.Spaces++
+		if report.Compliant {
+			response.Summary.Compliant++
+		}
+		for _, version := range report.DeprecatedVersions {
+			response.Summary.DeprecatedVersions[version]++
+		}
+		for _, field := range report.DeprecatedFields {
+			response.Summary.DeprecatedFields[field]++
+		}
+	}
+
+	sort.Slice(response.Spaces, func(i, j int) bool {
+		return response.Spaces[i].Id < response.Spaces[j].Id
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+func declaresAny(declared []string, versions map[string]bool) bool {
+	for _, version := range declared {
+		if versions[version] {
+			return true
+		}
+	}
+
+	return false
+}
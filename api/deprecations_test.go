@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeprecations(t *testing.T) {
+	entry := func(id string, report *spaceapi.DeprecationReport) spaceapi.Entry {
+		return spaceapi.Entry{
+			Id:               id,
+			Url:              "https://" + id + ".example/spaceapi.json",
+			Data:             map[string]interface{}{"space": id},
+			ValidationResult: spaceapi.ValidationResult{Deprecations: report},
+		}
+	}
+	directory := []spaceapi.Entry{
+		entry("legacy", &spaceapi.DeprecationReport{
+			Versions:           []string{"0.13"},
+			DeprecatedVersions: []string{"0.13"},
+			DeprecatedFields:   []string{"/api", "/contact/jabber"},
+			Changes:            []string{"declare 15 in /api_compatibility", "remove /api", "remove /contact/jabber"},
+		}),
+		entry("current", &spaceapi.DeprecationReport{Versions: []string{"14", "15"}, Compliant: true}),
+		entry("migrating", &spaceapi.DeprecationReport{
+			Versions:         []string{"14"},
+			DeprecatedFields: []string{"/api"},
+			Changes:          []string{"declare 15 in /api_compatibility", "remove /api"},
+		}),
+		// spaces without a declared version have no report
+		entry("unversioned", nil),
+	}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(directory)
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query   string
+		status  int
+		spaces  string
+		summary deprecationSummary
+	}{
+		{"", http.StatusOK, "current,legacy,migrating", deprecationSummary{
+			Spaces: 3, Compliant: 1,
+			DeprecatedVersions: map[string]int{"0.13": 1},
+			DeprecatedFields:   map[string]int{"/api": 2, "/contact/jabber": 1},
+		}},
+		{"compliant=false", http.StatusOK, "legacy,migrating", deprecationSummary{
+			Spaces:             2,
+			DeprecatedVersions: map[string]int{"0.13": 1},
+			DeprecatedFields:   map[string]int{"/api": 2, "/contact/jabber": 1},
+		}},
+		{"compliant=true", http.StatusOK, "current", deprecationSummary{
+			Spaces: 1, Compliant: 1, DeprecatedVersions: map[string]int{}, DeprecatedFields: map[string]int{},
+		}},
+		{"versions=14", http.StatusOK, "current,migrating", deprecationSummary{
+			Spaces: 2, Compliant: 1, DeprecatedVersions: map[string]int{}, DeprecatedFields: map[string]int{"/api": 1},
+		}},
+		{"ids=legacy,unversioned&versions=0.13,15", http.StatusOK, "legacy", deprecationSummary{
+			Spaces:             1,
+			DeprecatedVersions: map[string]int{"0.13": 1},
+			DeprecatedFields:   map[string]int{"/api": 1, "/contact/jabber": 1},
+		}},
+		{"ids=unknown", http.StatusOK, "", deprecationSummary{
+			DeprecatedVersions: map[string]int{}, DeprecatedFields: map[string]int{},
+		}},
+		{"compliant=maybe", http.StatusBadRequest, "", deprecationSummary{}},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/deprecations?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.query, test.status, w.Code)
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var response deprecationsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Spaces == nil {
+			t.Errorf("%s: expected the spaces to be a list", test.query)
+		}
+		var spaces []string
+		for _, space := range response.Spaces {
+			spaces = append(spaces, space.Id)
+		}
+		if strings.Join(spaces, ",") != test.spaces {
+			t.Errorf("%s: expected %v, got %v", test.query, test.spaces, spaces)
+		}
+		if !reflect.DeepEqual(response.Summary, test.summary) {
+			t.Errorf("%s: expected the summary %+v, got %+v", test.query, test.summary, response.Summary)
+		}
+	}
+}
+
+func TestDeclaresAny(t *testing.T) {
+	for _, test := range []struct {
+		declared []string
+		versions string
+		expected bool
+	}{
+		{[]string{"14", "15"}, "15", true},
+		{[]string{"0.13"}, "14,0.13", true},
+		{[]string{"14"}, "15", false},
+		{nil, "15", false},
+	} {
+		if declares := declaresAny(test.declared, listParam(test.versions)); declares != test.expected {
+			t.Errorf("%v %s: expected %v, got %v", test.declared, test.versions, test.expected, declares)
+		}
+	}
+}
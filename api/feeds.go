@@ -0,0 +1,318 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io/pat"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	feedLength         = 50
+	directoryFeedTypes = "added,removed,invalid,valid"
+	spaceFeedTypes     = "opened,closed"
+)
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	Id      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomEntry struct {
+	Title    string       `xml:"title"`
+	Id       string       `xml:"id"`
+	Updated  string       `xml:"updated"`
+	Link     atomLink     `xml:"link"`
+	Author   *atomAuthor  `xml:"author"`
+	Category atomCategory `xml:"category"`
+	Summary  atomText     `xml:"summary"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssGuid struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Guid        rssGuid `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+	Category    string  `xml:"category"`
+	Description string  `xml:"description"`
+}
+
+// feed is the format independent content of an Atom or RSS feed.
+type feed struct {
+	title       string
+	description string
+	self        string
+	entries     []feedEntry
+}
+
+type feedEntry struct {
+	id       string
+	title    string
+	link     string
+	author   string
+	updated  int64
+	category string
+	// html is set if the content is html instead of plain text
+	content string
+	html    bool
+}
+
+// serveFeed serves the directory and the planet feed as Atom or RSS.
+func serveFeed(w http.ResponseWriter, r *http.Request) {
+	name, format := splitFeedName(pat.Param(r, "name"))
+	if format == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch name {
+	case "directory":
+		serveDirectoryFeed(w, r, format)
+	case "planet":
+		servePlanetFeed(w, r, format)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveDirectoryFeed serves the spaces that were added to or removed from the
+// directory or changed their validity.
+func serveDirectoryFeed(w http.ResponseWriter, r *http.Request, format string) {
+	events, err := getFeedEvents(r, "", directoryFeedTypes)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	writeFeed(w, format, feed{
+		title:       "SpaceAPI directory",
+		description: "Spaces added to and removed from the SpaceAPI directory",
+		self:        baseUrl + "/feeds/directory." + format,
+		entries:     changeFeedEntries(events),
+	})
+}
+
+// serveSpaceFeed serves the opening and closing of a single space, as
+// <id>.atom or <id>.rss.
+func serveSpaceFeed(w http.ResponseWriter, r *http.Request) {
+	id, format := splitFeedName(pat.Param(r, "name"))
+	space, ok := getSpace(id)
+	if !ok || format == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	events, err := getFeedEvents(r, id, spaceFeedTypes)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	title := space.SpaceName()
+	if title == "" {
+		title = id
+	}
+
+	writeFeed(w, format, feed{
+		title:       title,
+		description: "State changes of " + title,
+		self:        baseUrl + "/feeds/spaces/" + url.PathEscape(id) + "." + format,
+		entries:     changeFeedEntries(events),
+	})
+}
+
+// splitFeedName splits a file name into its base name and the feed format,
+// the format is empty for unknown extensions.
+func splitFeedName(file string) (string, string) {
+	i := strings.LastIndex(file, ".")
+	if i < 0 {
+		return file, ""
+	}
+
+	switch format := file[i+1:]; format {
+	case "atom", "rss":
+		return file[:i], format
+	default:
+		return file[:i], ""
+	}
+}
+
+// getFeedEvents returns the latest events of a feed, newest first. The types
+// query parameter overrides the default types of the feed.
+func getFeedEvents(r *http.Request, spaceIds string, types string) ([]spaceapi.ChangeEvent, error) {
+	if t := r.URL.Query().Get("types"); t != "" {
+		types = t
+	}
+
+	changes, err := getChanges(changesQuery{
+		Limit:    feedLength,
+		SpaceIds: spaceIds,
+		Types:    types,
+		Order:    "desc",
+	})
+
+	return changes.Events, err
+}
+
+func changeFeedEntries(events []spaceapi.ChangeEvent) []feedEntry {
+	entries := make([]feedEntry, 0, len(events))
+	for _, event := range events {
+		entries = append(entries, feedEntry{
+			id:       feedEventId(event),
+			title:    describeEvent(event),
+			link:     event.Url,
+			updated:  event.Time,
+			category: event.Type,
+			content:  describeEvent(event),
+		})
+	}
+
+	return entries
+}
+
+func writeFeed(w http.ResponseWriter, format string, f feed) {
+	var value interface{}
+	var contentType string
+	if format == "rss" {
+		value, contentType = createRssFeed(f), "application/rss+xml; charset=utf-8"
+	} else {
+		value, contentType = createAtomFeed(f), "application/atom+xml; charset=utf-8"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		log.Println(err)
+		return
+	}
+
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Println(err)
+	}
+}
+
+func createAtomFeed(f feed) atomFeed {
+	atom := atomFeed{
+		Title:   f.title,
+		Id:      f.self,
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: f.self},
+			{Rel: "alternate", Type: "text/html", Href: "https://spaceapi.io"},
+		},
+		Author: atomAuthor{Name: "SpaceAPI"},
+	}
+	if len(f.entries) > 0 {
+		atom.Updated = time.Unix(f.entries[0].updated, 0).UTC().Format(time.RFC3339)
+	}
+
+	for _, e := range f.entries {
+		entry := atomEntry{
+			Title:    e.title,
+			Id:       e.id,
+			Updated:  time.Unix(e.updated, 0).UTC().Format(time.RFC3339),
+			Link:     atomLink{Rel: "alternate", Href: e.link},
+			Category: atomCategory{Term: e.category},
+			Summary:  atomText{Body: e.content},
+		}
+		if e.author != "" {
+			entry.Author = &atomAuthor{Name: e.author}
+		}
+		if e.html {
+			entry.Summary.Type = "html"
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return atom
+}
+
+func createRssFeed(f feed) rssFeed {
+	rss := rssFeed{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:       f.title,
+			Link:        f.self,
+			Description: f.description,
+		},
+	}
+	if len(f.entries) > 0 {
+		rss.Channel.LastBuildDate = time.Unix(f.entries[0].updated, 0).UTC().Format(time.RFC1123Z)
+	}
+
+	for _, e := range f.entries {
+		description := e.content
+		if !e.html {
+			description = html.EscapeString(description)
+		}
+
+		rss.Channel.Items = append(rss.Channel.Items, rssItem{
+			Title:       e.title,
+			Link:        e.link,
+			Guid:        rssGuid{Value: e.id},
+			PubDate:     time.Unix(e.updated, 0).UTC().Format(time.RFC1123Z),
+			Category:    e.category,
+			Description: description,
+		})
+	}
+
+	return rss
+}
+
+// feedEventId is a stable id of an event, it stays the same in the Atom and
+// the RSS feed so readers don't show an event twice.
+func feedEventId(event spaceapi.ChangeEvent) string {
+	return "tag:" + webfingerDomain() + ",2020:changes:" + strconv.FormatInt(event.Id, 10)
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/xml"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSplitFeedName(t *testing.T) {
+	for _, test := range []struct {
+		file   string
+		name   string
+		format string
+	}{
+		{"directory.atom", "directory", "atom"},
+		{"directory.rss", "directory", "rss"},
+		{"fixture.space.rss", "fixture.space", "rss"},
+		{"directory.json", "directory", ""},
+		{"directory", "directory", ""},
+	} {
+		if name, format := splitFeedName(test.file); name != test.name || format != test.format {
+			t.Errorf("%s: expected %q and %q, got %q and %q", test.file, test.name, test.format, name, format)
+		}
+	}
+}
+
+func TestChangeFeeds(t *testing.T) {
+	var mutex sync.Mutex
+	var query url.Values
+	failing := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.URL.Path == "/changes" {
+			query = r.URL.Query()
+			if failing {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+		}
+		serveCollectorFixture(w, r)
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		path        string
+		failing     bool
+		status      int
+		contentType string
+		query       string
+	}{
+		{"/feeds/directory.atom", false, http.StatusOK, "application/atom+xml", "limit=50&order=desc&types=added%2Cremoved%2Cinvalid%2Cvalid"},
+		{"/feeds/directory.rss", false, http.StatusOK, "application/rss+xml", "limit=50&order=desc&types=added%2Cremoved%2Cinvalid%2Cvalid"},
+		{"/feeds/directory.atom?types=added", false, http.StatusOK, "application/atom+xml", "limit=50&order=desc&types=added"},
+		{"/feeds/spaces/fixture-space.rss", false, http.StatusOK, "application/rss+xml", "limit=50&order=desc&spaceId=fixture-space&types=opened%2Cclosed"},
+		{"/feeds/spaces/fixture-space.atom?types=added", false, http.StatusOK, "application/atom+xml", "limit=50&order=desc&spaceId=fixture-space&types=added"},
+		{"/feeds/directory.json", false, http.StatusNotFound, "", ""},
+		{"/feeds/other.atom", false, http.StatusNotFound, "", ""},
+		{"/feeds/spaces/unknown-space.atom", false, http.StatusNotFound, "", ""},
+		{"/feeds/spaces/fixture-space.json", false, http.StatusNotFound, "", ""},
+		{"/feeds/directory.atom", true, http.StatusBadGateway, "", "limit=50&order=desc&types=added%2Cremoved%2Cinvalid%2Cvalid"},
+		{"/feeds/spaces/fixture-space.atom", true, http.StatusBadGateway, "", "limit=50&order=desc&spaceId=fixture-space&types=opened%2Cclosed"},
+	} {
+		mutex.Lock()
+		query, failing = nil, test.failing
+		mutex.Unlock()
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.path, test.status, w.Code)
+			continue
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), test.contentType) {
+			t.Errorf("%s: expected %s, got %s", test.path, test.contentType, w.Header().Get("Content-Type"))
+		}
+
+		mutex.Lock()
+		if query.Encode() != test.query {
+			t.Errorf("%s: expected the collector to be asked for %q, got %q", test.path, test.query, query.Encode())
+		}
+		mutex.Unlock()
+	}
+}
+
+func TestFeedFormats(t *testing.T) {
+	defer func(url string) {
+		baseUrl = url
+	}(baseUrl)
+	baseUrl = "https://api.example"
+	events := []spaceapi.ChangeEvent{
+		{Id: 2, Type: "removed", SpaceId: "legacy-space", Time: 1600000100, Url: "https://legacy.example/space.json"},
+		{Id: 1, Type: "added", SpaceId: "fixture-space", Space: "Fixture & Space", Time: 1600000000},
+	}
+	f := feed{title: "SpaceAPI directory", self: "https://api.example/feeds/directory.atom", entries: changeFeedEntries(events)}
+	f.entries = append(f.entries, feedEntry{id: "post", title: "Post", updated: 1500000000, content: "<p>laser</p>", html: true})
+
+	atom := createAtomFeed(f)
+	rss := createRssFeed(f)
+	if atom.Updated != "2020-09-13T12:28:20Z" || rss.Channel.LastBuildDate != "Sun, 13 Sep 2020 12:28:20 +0000" {
+		t.Errorf("expected the feed to be updated with its newest entry, got %v and %v", atom.Updated, rss.Channel.LastBuildDate)
+	}
+	if len(atom.Entries) != 3 || len(rss.Channel.Items) != 3 {
+		t.Fatalf("expected 3 entries, got %d and %d", len(atom.Entries), len(rss.Channel.Items))
+	}
+
+	for _, test := range []struct {
+		entry       int
+		id          string
+		title       string
+		summaryType string
+		description string
+	}{
+		{0, "tag:api.example,2020:changes:2", "legacy-space was removed from the SpaceAPI directory.", "", "legacy-space was removed from the SpaceAPI directory."},
+		{1, "tag:api.example,2020:changes:1", "Fixture & Space was added to the SpaceAPI directory.", "", "Fixture &amp; Space was added to the SpaceAPI directory."},
+		{2, "post", "Post", "html", "<p>laser</p>"},
+	} {
+		entry, item := atom.Entries[test.entry], rss.Channel.Items[test.entry]
+		if entry.Id != test.id || item.Guid.Value != test.id {
+			t.Errorf("%d: expected the id %v in both formats, got %v and %v", test.entry, test.id, entry.Id, item.Guid.Value)
+		}
+		if entry.Title != test.title || item.Title != test.title {
+			t.Errorf("%d: expected the title %q, got %q and %q", test.entry, test.title, entry.Title, item.Title)
+		}
+		if entry.Summary.Type != test.summaryType {
+			t.Errorf("%d: expected the summary type %q, got %q", test.entry, test.summaryType, entry.Summary.Type)
+		}
+		if item.Description != test.description {
+			t.Errorf("%d: expected the description %q, got %q", test.entry, test.description, item.Description)
+		}
+	}
+
+	// an empty feed is still a valid document
+	if _, err := xml.Marshal(createAtomFeed(feed{title: "empty"})); err != nil {
+		t.Error(err)
+	}
+	if updated := createAtomFeed(feed{}).Updated; updated != "1970-01-01T00:00:00Z" {
+		t.Errorf("expected an empty feed to be updated at the epoch, got %v", updated)
+	}
+}
@@ -5,9 +5,16 @@ go 1.12
 require (
 	github.com/felixge/httpsnoop v1.0.1
 	github.com/golang/protobuf v1.3.5 // indirect
+	github.com/gorilla/websocket v1.4.2
+	github.com/graphql-go/graphql v0.8.1
 	github.com/itchyny/gojq v0.11.2
 	github.com/prometheus/client_golang v1.3.0
 	github.com/prometheus/procfs v0.0.11 // indirect
 	github.com/rs/cors v1.7.0
+	github.com/spaceapi/directory-api/spaceapi v0.0.0
+	github.com/teambition/rrule-go v1.7.2
 	goji.io v2.0.2+incompatible
+	golang.org/x/image v0.0.0-20210628002857-a66eb6448b8d
 )
+
+replace github.com/spaceapi/directory-api/spaceapi => ../spaceapi
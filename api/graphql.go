@@ -0,0 +1,720 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+	// sensorsEstimate is the number of sensors a space is expected to
+	// have when estimating the cost of a query
+	sensorsEstimate = 20
+)
+
+var (
+	graphqlMaxDepth int
+	graphqlMaxCost  int
+	graphqlSchema   graphql.Schema
+)
+
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+}
+
+type spaceConnection struct {
+	TotalCount  int
+	HasNextPage bool
+	EndCursor   string
+	Nodes       []spaceapi.Entry
+}
+
+type versionCount struct {
+	Version string `json:"version"`
+	Count   int    `json:"count"`
+}
+
+type directoryStatistics struct {
+	Total    int            `json:"total"`
+	Valid    int            `json:"valid"`
+	Invalid  int            `json:"invalid"`
+	Https    int            `json:"https"`
+	Open     int            `json:"open"`
+	Versions []versionCount `json:"versions"`
+}
+
+type sensor struct {
+	Type        string
+	Name        string
+	Location    string
+	Description string
+	Unit        string
+	Value       interface{}
+}
+
+func init() {
+	flag.IntVar(
+		&graphqlMaxDepth,
+		"graphqlMaxDepth",
+		8,
+		"Maximum nesting depth of a graphql query",
+	)
+
+	flag.IntVar(
+		&graphqlMaxCost,
+		"graphqlMaxCost",
+		5000,
+		"Maximum estimated cost of a graphql query",
+	)
+
+	schema, err := buildGraphqlSchema()
+	if err != nil {
+		panic(err)
+	}
+	graphqlSchema = schema
+}
+
+func serveGraphql(w http.ResponseWriter, r *http.Request) {
+	var request graphqlRequest
+	if r.Method == http.MethodPost {
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			writeGraphqlError(w, http.StatusBadRequest, err)
+			return
+		}
+	} else {
+		request.Query = r.URL.Query().Get("query")
+		request.OperationName = r.URL.Query().Get("operationName")
+		if variables := r.URL.Query().Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &request.Variables); err != nil {
+				writeGraphqlError(w, http.StatusBadRequest, err)
+				return
+			}
+		}
+	}
+
+	if err := checkGraphqlLimits(request); err != nil {
+		writeGraphqlError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	result := graphql.Do(graphql.Params{
+		Schema:         graphqlSchema,
+		RequestString:  request.Query,
+		VariableValues: request.Variables,
+		OperationName:  request.OperationName,
+		Context:        context.WithValue(r.Context(), directoryContextKey{}, &requestDirectory{}),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		panic(err)
+	}
+}
+
+// requestDirectory fetches the directory once per graphql request, the
+// resolvers of a request share it.
+type requestDirectory struct {
+	once      sync.Once
+	directory interface{}
+}
+
+type directoryContextKey struct{}
+
+// graphqlDirectory returns the entries of the directory of the request
+// selected by the jq filter.
+func graphqlDirectory(ctx context.Context, filter string) []spaceapi.Entry {
+	var d *requestDirectory
+	if ctx != nil {
+		d, _ = ctx.Value(directoryContextKey{}).(*requestDirectory)
+	}
+	if d == nil {
+		return getDirectory(filter)
+	}
+
+	d.once.Do(func() {
+		d.directory = fetchDirectory()
+	})
+	return filterDirectory(d.directory, filter)
+}
+
+func writeGraphqlError(w http.ResponseWriter, code int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"errors": []map[string]string{{"message": err.Error()}},
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// checkGraphqlLimits rejects queries that nest deeper than graphqlMaxDepth or
+// whose estimated cost exceeds graphqlMaxCost. Every field costs one, list
+// fields multiply the cost of their selection by the requested page size.
+func checkGraphqlLimits(request graphqlRequest) error {
+	document, err := parser.Parse(parser.ParseParams{Source: request.Query})
+	if err != nil {
+		return err
+	}
+
+	fragments := make(map[string]*ast.FragmentDefinition)
+	for _, definition := range document.Definitions {
+		if fragment, ok := definition.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	for _, definition := range document.Definitions {
+		operation, ok := definition.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		if request.OperationName != "" && (operation.Name == nil || operation.Name.Value != request.OperationName) {
+			continue
+		}
+
+		analyzer := queryAnalyzer{fragments: fragments, variables: variablesWithDefaults(operation, request.Variables), visiting: map[string]bool{}}
+		cost, err := analyzer.selectionCost(operation.SelectionSet, 1)
+		if err != nil {
+			return err
+		}
+		if cost > graphqlMaxCost {
+			return fmt.Errorf("query cost %d exceeds the maximum of %d", cost, graphqlMaxCost)
+		}
+	}
+
+	return nil
+}
+
+// variablesWithDefaults adds the defaults declared by the operation to the
+// variables of the request.
+func variablesWithDefaults(operation *ast.OperationDefinition, variables map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(variables))
+	for _, definition := range operation.VariableDefinitions {
+		if value, ok := definition.DefaultValue.(*ast.IntValue); ok {
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				merged[definition.Variable.Name.Value] = float64(n)
+			}
+		}
+	}
+	for name, value := range variables {
+		merged[name] = value
+	}
+
+	return merged
+}
+
+type queryAnalyzer struct {
+	fragments map[string]*ast.FragmentDefinition
+	variables map[string]interface{}
+	visiting  map[string]bool
+}
+
+func (a queryAnalyzer) selectionCost(selectionSet *ast.SelectionSet, depth int) (int, error) {
+	if selectionSet == nil {
+		return 0, nil
+	}
+	if depth > graphqlMaxDepth {
+		return 0, fmt.Errorf("query depth exceeds the maximum of %d", graphqlMaxDepth)
+	}
+
+	cost := 0
+	for _, selection := range selectionSet.Selections {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			childCost, err := a.selectionCost(selection.SelectionSet, depth+1)
+			if err != nil {
+				return 0, err
+			}
+			cost += 1 + childCost*a.multiplier(selection)
+		case *ast.InlineFragment:
+			childCost, err := a.selectionCost(selection.SelectionSet, depth)
+			if err != nil {
+				return 0, err
+			}
+			cost += childCost
+		case *ast.FragmentSpread:
+			name := selection.Name.Value
+			fragment, ok := a.fragments[name]
+			if !ok || a.visiting[name] {
+				continue
+			}
+			a.visiting[name] = true
+			childCost, err := a.selectionCost(fragment.SelectionSet, depth)
+			delete(a.visiting, name)
+			if err != nil {
+				return 0, err
+			}
+			cost += childCost
+		}
+	}
+
+	return cost, nil
+}
+
+// multiplier estimates how many items a field returns, the page size of
+// paginated fields and a fixed estimate for the sensors of a space.
+func (a queryAnalyzer) multiplier(field *ast.Field) int {
+	switch field.Name.Value {
+	case "spaces":
+		return pageSize(a.first(field))
+	case "sensors":
+		return sensorsEstimate
+	}
+
+	return 1
+}
+
+// first returns the page size requested by the first argument of a field,
+// from a literal, a variable or the default of the variable, and 0 if it
+// isn't set.
+func (a queryAnalyzer) first(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := a.variables[value.Name.Value].(float64); ok {
+				return int(n)
+			}
+		}
+	}
+
+	return 0
+}
+
+// pageSize applies the default and the maximum to a requested page size.
+func pageSize(first int) int {
+	switch {
+	case first <= 0:
+		return defaultPageSize
+	case first > maxPageSize:
+		return maxPageSize
+	}
+
+	return first
+}
+
+func buildGraphqlSchema() (graphql.Schema, error) {
+	validationResultType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "ValidationResult",
+		Fields: graphql.Fields{
+			"valid":        &graphql.Field{Type: graphql.Boolean},
+			"isHttps":      &graphql.Field{Type: graphql.Boolean},
+			"httpsForward": &graphql.Field{Type: graphql.Boolean},
+			"reachable":    &graphql.Field{Type: graphql.Boolean},
+			"cors":         &graphql.Field{Type: graphql.Boolean},
+			"contentType":  &graphql.Field{Type: graphql.Boolean},
+			"certValid":    &graphql.Field{Type: graphql.Boolean},
+		},
+	})
+
+	locationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Location",
+		Fields: graphql.Fields{
+			"address":  &graphql.Field{Type: graphql.String},
+			"lat":      &graphql.Field{Type: graphql.Float},
+			"lon":      &graphql.Field{Type: graphql.Float},
+			"timezone": &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	stateType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "State",
+		Fields: graphql.Fields{
+			"open":          &graphql.Field{Type: graphql.Boolean},
+			"lastchange":    &graphql.Field{Type: graphql.Float},
+			"triggerPerson": &graphql.Field{Type: graphql.String, Resolve: mapField("trigger_person")},
+			"message":       &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	sensorType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Sensor",
+		Fields: graphql.Fields{
+			"type":        &graphql.Field{Type: graphql.String},
+			"name":        &graphql.Field{Type: graphql.String},
+			"location":    &graphql.Field{Type: graphql.String},
+			"description": &graphql.Field{Type: graphql.String},
+			"unit":        &graphql.Field{Type: graphql.String},
+			"value":       &graphql.Field{Type: graphql.Float, Resolve: resolveSensorValue},
+		},
+	})
+
+	spaceType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Space",
+		Fields: graphql.Fields{
+			"id":       &graphql.Field{Type: graphql.String},
+			"url":      &graphql.Field{Type: graphql.NewNonNull(graphql.String)},
+			"valid":    &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"lastSeen": &graphql.Field{Type: graphql.Float},
+			"errMsg":   &graphql.Field{Type: graphql.NewList(graphql.String)},
+			"name": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(spaceapi.Entry).SpaceName(), nil
+			}},
+			"logo": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(spaceapi.Entry).Data["logo"], nil
+			}},
+			"homepage": &graphql.Field{Type: graphql.String, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(spaceapi.Entry).Data["url"], nil
+			}},
+			"versions": &graphql.Field{Type: graphql.NewList(graphql.String), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return spaceVersions(p.Source.(spaceapi.Entry)), nil
+			}},
+			"validationResult": &graphql.Field{Type: validationResultType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return p.Source.(spaceapi.Entry).ValidationResult, nil
+			}},
+			"location": &graphql.Field{Type: locationType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return nilIfEmpty(p.Source.(spaceapi.Entry).Data["location"]), nil
+			}},
+			"state": &graphql.Field{Type: stateType, Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return nilIfEmpty(p.Source.(spaceapi.Entry).Data["state"]), nil
+			}},
+			"sensors": &graphql.Field{
+				Type: graphql.NewList(sensorType),
+				Args: graphql.FieldConfigArgument{
+					"type": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					sensorType, _ := p.Args["type"].(string)
+					return spaceSensors(p.Source.(spaceapi.Entry), sensorType), nil
+				},
+			},
+			"data": &graphql.Field{
+				Type:        graphql.String,
+				Description: "The last validated data as json document",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					data := p.Source.(spaceapi.Entry).Data
+					if data == nil {
+						return nil, nil
+					}
+					encoded, err := json.Marshal(data)
+					return string(encoded), err
+				},
+			},
+		},
+	})
+
+	pageInfoType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "PageInfo",
+		Fields: graphql.Fields{
+			"hasNextPage": &graphql.Field{Type: graphql.NewNonNull(graphql.Boolean)},
+			"endCursor":   &graphql.Field{Type: graphql.String},
+		},
+	})
+
+	spaceConnectionType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "SpaceConnection",
+		Fields: graphql.Fields{
+			"totalCount": &graphql.Field{Type: graphql.NewNonNull(graphql.Int)},
+			"pageInfo": &graphql.Field{Type: graphql.NewNonNull(pageInfoType), Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				connection := p.Source.(spaceConnection)
+				return map[string]interface{}{
+					"hasNextPage": connection.HasNextPage,
+					"endCursor":   connection.EndCursor,
+				}, nil
+			}},
+			"nodes": &graphql.Field{Type: graphql.NewList(spaceType)},
+		},
+	})
+
+	versionCountType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "VersionCount",
+		Fields: graphql.Fields{
+			"version": &graphql.Field{Type: graphql.String},
+			"count":   &graphql.Field{Type: graphql.Int},
+		},
+	})
+
+	statisticsType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Statistics",
+		Fields: graphql.Fields{
+			"total":    &graphql.Field{Type: graphql.Int},
+			"valid":    &graphql.Field{Type: graphql.Int},
+			"invalid":  &graphql.Field{Type: graphql.Int},
+			"https":    &graphql.Field{Type: graphql.Int},
+			"open":     &graphql.Field{Type: graphql.Int},
+			"versions": &graphql.Field{Type: graphql.NewList(versionCountType)},
+		},
+	})
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"spaces": &graphql.Field{
+				Type: spaceConnectionType,
+				Args: graphql.FieldConfigArgument{
+					"valid":   &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Only return valid (true) or invalid (false) spaces, all if omitted"},
+					"https":   &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Only return spaces served over https"},
+					"open":    &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Only return spaces that are currently open (true) or closed (false)"},
+					"name":    &graphql.ArgumentConfig{Type: graphql.String, Description: "Case insensitive substring of the space name"},
+					"version": &graphql.ArgumentConfig{Type: graphql.String, Description: "Only return spaces implementing this SpaceAPI version"},
+					"filter":  &graphql.ArgumentConfig{Type: graphql.String, Description: "jq select filter, same as the filter parameter of /v2"},
+					"first":   &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: defaultPageSize, Description: "Number of spaces per page, at most 500"},
+					"after":   &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveSpaces,
+			},
+			"space": &graphql.Field{
+				Type: spaceType,
+				Args: graphql.FieldConfigArgument{
+					"id":   &graphql.ArgumentConfig{Type: graphql.String},
+					"url":  &graphql.ArgumentConfig{Type: graphql.String},
+					"name": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolveSpace,
+			},
+			"statistics": &graphql.Field{
+				Type: statisticsType,
+				Args: graphql.FieldConfigArgument{
+					"filter": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					filter, _ := p.Args["filter"].(string)
+					return buildDirectoryStatistics(graphqlDirectory(p.Context, jqSelectFilter(filter))), nil
+				},
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{Query: queryType})
+}
+
+func resolveSpaces(p graphql.ResolveParams) (interface{}, error) {
+	filter, _ := p.Args["filter"].(string)
+	entries := graphqlDirectory(p.Context, jqSelectFilter(filter))
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Url < entries[j].Url
+	})
+
+	var matching []spaceapi.Entry
+	for _, entry := range entries {
+		if valid, ok := p.Args["valid"].(bool); ok && entry.Valid != valid {
+			continue
+		}
+		if https, ok := p.Args["https"].(bool); ok && strings.HasPrefix(entry.Url, "https://") != https {
+			continue
+		}
+		if open, ok := p.Args["open"].(bool); ok {
+			state, _ := entry.Data["state"].(map[string]interface{})
+			if isOpen, _ := state["open"].(bool); isOpen != open {
+				continue
+			}
+		}
+		if name, ok := p.Args["name"].(string); ok && !strings.Contains(strings.ToLower(entry.SpaceName()), strings.ToLower(name)) {
+			continue
+		}
+		if version, ok := p.Args["version"].(string); ok && !containsString(spaceVersions(entry), version) {
+			continue
+		}
+		matching = append(matching, entry)
+	}
+
+	offset := 0
+	if after, ok := p.Args["after"].(string); ok && after != "" {
+		decoded, err := decodeCursor(after)
+		if err != nil {
+			return nil, err
+		}
+		// a cursor past the end returns an empty page
+		offset = len(matching)
+		if decoded < len(matching) {
+			offset = decoded + 1
+		}
+	}
+
+	first, _ := p.Args["first"].(int)
+	first = pageSize(first)
+
+	connection := spaceConnection{TotalCount: len(matching)}
+	if offset < len(matching) {
+		end := len(matching)
+		if first < end-offset {
+			end = offset + first
+		}
+		connection.Nodes = matching[offset:end]
+		connection.HasNextPage = end < len(matching)
+		connection.EndCursor = encodeCursor(end - 1)
+	}
+
+	return connection, nil
+}
+
+func resolveSpace(p graphql.ResolveParams) (interface{}, error) {
+	id, _ := p.Args["id"].(string)
+	url, _ := p.Args["url"].(string)
+	name, _ := p.Args["name"].(string)
+	if id == "" && url == "" && name == "" {
+		return nil, errors.New("one of id, url or name is required")
+	}
+
+	for _, entry := range graphqlDirectory(p.Context, ".[]") {
+		if (id != "" && entry.Id == id) || (url != "" && entry.Url == url) || (name != "" && entry.SpaceName() == name) {
+			return entry, nil
+		}
+	}
+
+	return nil, nil
+}
+
+func resolveSensorValue(p graphql.ResolveParams) (interface{}, error) {
+	if value, ok := p.Source.(sensor).Value.(float64); ok {
+		return value, nil
+	}
+	return nil, nil
+}
+
+func mapField(name string) graphql.FieldResolveFn {
+	return func(p graphql.ResolveParams) (interface{}, error) {
+		if source, ok := p.Source.(map[string]interface{}); ok {
+			return source[name], nil
+		}
+		return nil, nil
+	}
+}
+
+func buildDirectoryStatistics(entries []spaceapi.Entry) directoryStatistics {
+	stats := directoryStatistics{}
+	versions := make(map[string]int)
+	for _, entry := range entries {
+		stats.Total++
+		if entry.Valid {
+			stats.Valid++
+		} else {
+			stats.Invalid++
+		}
+		if strings.HasPrefix(entry.Url, "https://") {
+			stats.Https++
+		}
+		state, _ := entry.Data["state"].(map[string]interface{})
+		if open, _ := state["open"].(bool); open {
+			stats.Open++
+		}
+		for _, version := range spaceVersions(entry) {
+			versions[version]++
+		}
+	}
+
+	for version, count := range versions {
+		stats.Versions = append(stats.Versions, versionCount{version, count})
+	}
+	sort.Slice(stats.Versions, func(i, j int) bool {
+		return stats.Versions[i].Version < stats.Versions[j].Version
+	})
+
+	return stats
+}
+
+func spaceVersions(entry spaceapi.Entry) []string {
+	data := entry.Data
+
+	var versions []string
+	if version, ok := data["api"].(string); ok {
+		versions = append(versions, version)
+	}
+	if compatibility, ok := data["api_compatibility"].([]interface{}); ok {
+		for _, version := range compatibility {
+			if version, ok := version.(string); ok {
+				versions = append(versions, version)
+			}
+		}
+	}
+
+	return versions
+}
+
+// spaceSensors flattens the sensors object of a space, which maps a sensor
+// type to a list of measurements, into a single list.
+func spaceSensors(entry spaceapi.Entry, sensorType string) []sensor {
+	sensors, _ := entry.Data["sensors"].(map[string]interface{})
+
+	var types []string
+	for name := range sensors {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+
+	var result []sensor
+	for _, name := range types {
+		if sensorType != "" && sensorType != name {
+			continue
+		}
+		measurements, _ := sensors[name].([]interface{})
+		for _, measurement := range measurements {
+			values, ok := measurement.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			s := sensor{Type: name, Value: values["value"]}
+			s.Name, _ = values["name"].(string)
+			s.Location, _ = values["location"].(string)
+			s.Description, _ = values["description"].(string)
+			s.Unit, _ = values["unit"].(string)
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func nilIfEmpty(value interface{}) interface{} {
+	if value, ok := value.(map[string]interface{}); ok && len(value) > 0 {
+		return value
+	}
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func jqSelectFilter(filter string) string {
+	if filter != "" {
+		return `.[] | select(` + filter + `)`
+	}
+
+	return ".[]"
+}
+
+func encodeCursor(offset int) string {
+	return base64.StdEncoding.EncodeToString([]byte("offset:" + strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	decoded, err := base64.StdEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), "offset:") {
+		return 0, errors.New("invalid cursor")
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(decoded), "offset:"))
+	if err != nil || offset < 0 {
+		return 0, errors.New("invalid cursor")
+	}
+
+	return offset, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/graphql-go/graphql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSpacesCursor(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	spaces := func(after string) (spaceConnection, error) {
+		result, err := resolveSpaces(graphql.ResolveParams{Args: map[string]interface{}{"after": after, "first": 1}})
+		if err != nil {
+			return spaceConnection{}, err
+		}
+		return result.(spaceConnection), nil
+	}
+	offset := func(offset string) string {
+		return base64.StdEncoding.EncodeToString([]byte("offset:" + offset))
+	}
+
+	first, err := spaces("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Nodes) != 1 || !first.HasNextPage || first.TotalCount != 2 {
+		t.Fatalf("unexpected first page %+v", first)
+	}
+	second, err := spaces(first.EndCursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second.Nodes) != 1 || second.HasNextPage || second.Nodes[0].Url == first.Nodes[0].Url {
+		t.Fatalf("unexpected second page %+v", second)
+	}
+
+	for _, cursor := range []string{"-1", "-5", "", "two", strconv.Itoa(-1 << 40)} {
+		if _, err := spaces(offset(cursor)); err == nil {
+			t.Errorf("the cursor offset %q was accepted", cursor)
+		}
+	}
+	if _, err := spaces("not base64"); err == nil {
+		t.Errorf("an invalid cursor was accepted")
+	}
+
+	// cursors past the end return an empty page
+	for _, cursor := range []string{"1", "2", "100", strconv.Itoa(int(^uint(0) >> 1))} {
+		page, err := spaces(offset(cursor))
+		if err != nil {
+			t.Errorf("the cursor offset %q: %v", cursor, err)
+			continue
+		}
+		if len(page.Nodes) != 0 || page.HasNextPage || page.TotalCount != 2 {
+			t.Errorf("expected an empty page for the cursor offset %q, got %+v", cursor, page)
+		}
+	}
+}
+
+func TestGraphqlLimits(t *testing.T) {
+	defer func(depth int, cost int) {
+		graphqlMaxDepth, graphqlMaxCost = depth, cost
+	}(graphqlMaxDepth, graphqlMaxCost)
+	graphqlMaxDepth, graphqlMaxCost = 8, 1000
+
+	for _, test := range []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		rejected  string
+	}{
+		{"small page", `{ spaces(first: 100) { nodes { id name url valid } } }`, nil, ""},
+		{"large page", `{ spaces(first: 300) { nodes { id name url valid } } }`, nil, "cost"},
+		{"default page size", `{ spaces { nodes { id name url valid } } }`, nil, ""},
+		{"page size above the maximum", `{ spaces(first: 100000) { nodes { id } } }`, nil, "cost"},
+		{"variable", `query($n: Int) { spaces(first: $n) { nodes { id name url valid } } }`, map[string]interface{}{"n": 300.0}, "cost"},
+		{"variable without value", `query($n: Int) { spaces(first: $n) { nodes { id name url valid } } }`, nil, ""},
+		{"variable default", `query($n: Int = 100000) { spaces(first: $n) { nodes { id name url valid } } }`, nil, "cost"},
+		{"variable overriding the default", `query($n: Int = 100000) { spaces(first: $n) { nodes { id name url valid } } }`, map[string]interface{}{"n": 10.0}, ""},
+		{"sensors", `{ spaces(first: 10) { nodes { sensors { type name value unit location description } } } }`, nil, "cost"},
+		{"few sensors", `{ spaces(first: 2) { nodes { sensors { type name value } } } }`, nil, ""},
+		{"fragment", `query { spaces(first: 300) { ...nodes } } fragment nodes on SpaceConnection { nodes { id name url valid } }`, nil, "cost"},
+		{"recursive fragment", `query { ...a } fragment a on Query { ...a }`, nil, ""},
+		{"shallow", `{ a { b { c { d { e { f { g } } } } } } }`, nil, ""},
+		{"deep", `{ a { b { c { d { e { f { g { h { i } } } } } } } } }`, nil, "depth"},
+		{"deep fragment", `query { ...a } fragment a on Query { a { b { c { d { e { f { g { h { i } } } } } } } } }`, nil, "depth"},
+	} {
+		err := checkGraphqlLimits(graphqlRequest{Query: test.query, Variables: test.variables})
+		switch {
+		case test.rejected == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", test.name, err)
+		case test.rejected != "" && (err == nil || !strings.Contains(err.Error(), test.rejected)):
+			t.Errorf("%s: expected the %s limit to reject the query, got %v", test.name, test.rejected, err)
+		}
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	for first, expected := range map[int]int{-1: defaultPageSize, 0: defaultPageSize, 10: 10, maxPageSize: maxPageSize, 100000: maxPageSize} {
+		if size := pageSize(first); size != expected {
+			t.Errorf("pageSize(%d) = %d, expected %d", first, size, expected)
+		}
+	}
+}
+
+func TestGraphqlFetchesTheDirectoryOnce(t *testing.T) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "collector", "directory.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var requests int32
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		_, _ = w.Write(content)
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	query := `{ all: spaces { totalCount } valid: spaces(valid: true) { totalCount } statistics { total } space(id: "fixture-space") { id } }`
+	w := httptest.NewRecorder()
+	serveGraphql(w, httptest.NewRequest(http.MethodGet, "/graphql?query="+url.QueryEscape(query), nil))
+
+	var result struct {
+		Data struct {
+			All        spaceConnection
+			Statistics directoryStatistics
+			Space      struct{ Id string }
+		}
+		Errors []interface{}
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Errors) != 0 || result.Data.All.TotalCount != 2 || result.Data.Statistics.Total != 2 || result.Data.Space.Id != "fixture-space" {
+		t.Fatalf("unexpected response %s", w.Body.String())
+	}
+	if requests != 1 {
+		t.Errorf("expected the directory to be fetched once, got %d requests", requests)
+	}
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"github.com/felixge/httpsnoop"
@@ -8,46 +11,20 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/cors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
 	"goji.io"
 	"goji.io/pat"
+	"io"
 	"io/ioutil"
 	"log"
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
-//go:generate go run scripts/generateOpenApi.go
-
-type entry struct {
-	Url              string            `json:"url"`
-	Valid            bool              `json:"valid"`
-	Space            string            `json:"space,omitempty"`
-	LastSeen         int64             `json:"lastSeen,omitempty"`
-	ErrMsg           []string          `json:"errMsg,omitempty"`
-	Data             interface{}       `json:"data,omitempty"`
-	ValidationResult *validationResult `json:"validationResult,omitempty"`
-}
-
-type validationResult struct {
-	Valid       bool `json:"valid"`
-	IsHttps     bool `json:"isHttps"`
-	HttpForward bool `json:"httpsForward"`
-	Reachable   bool `json:"reachable"`
-	Cors        bool `json:"cors"`
-	ContentType bool `json:"contentType"`
-	CertValid   bool `json:"certValid"`
-}
-
-type collectorEntry struct {
-	Url              string            `json:"url"`
-	Valid            bool              `json:"valid"`
-	LastSeen         int64             `json:"lastSeen,omitempty"`
-	ErrMsg           []string          `json:"errMsg,omitempty"`
-	Data             interface{}       `json:"data,omitempty"`
-	ValidationResult *validationResult `json:"validationResult,omitempty"`
-}
-
 var (
 	httpRequestSummary = prometheus.NewSummaryVec(
 		prometheus.SummaryOpts{
@@ -56,11 +33,20 @@ var (
 		},
 		[]string{"method", "route", "code"},
 	)
+	nonConformingResponses = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "spaceapi_openapi_nonconforming_responses",
+			Help: "Responses not matching their schema in the OpenAPI document",
+		},
+		[]string{"method", "route"},
+	)
 	spaceApiCollectorUrl string
+	checkResponses       bool
 )
 
 func init() {
 	prometheus.MustRegister(httpRequestSummary)
+	prometheus.MustRegister(nonConformingResponses)
 
 	flag.StringVar(
 		&spaceApiCollectorUrl,
@@ -68,11 +54,17 @@ func init() {
 		"http://collector:8080",
 		"Url to the collector service",
 	)
-
-	flag.Parse()
+	flag.BoolVar(
+		&checkResponses,
+		"checkResponses",
+		false,
+		"Check the JSON responses against the OpenAPI document and log the ones not matching",
+	)
 }
 
 func main() {
+	flag.Parse()
+
 	c := cors.New(cors.Options{
 		AllowedOrigins: []string{"*"},
 	})
@@ -83,21 +75,44 @@ func main() {
 
 	mux.Handle(pat.Get("/metrics"), promhttp.Handler())
 
-	mux.HandleFunc(pat.Get("/"), serveV1)
-	mux.HandleFunc(pat.Get("/v1"), serveV1)
-	mux.HandleFunc(pat.Get("/v2"), serveV2)
-	mux.HandleFunc(pat.Get("/cache"), serveCache)
-	mux.HandleFunc(pat.Get("/openapi.json"), openApi)
+	spec := newSpec()
+	if checkResponses {
+		spec.CheckResponses = logNonConformingResponse
+	}
+	handleRoutes(mux, spec)
+
+	go hub.run(streamPollInterval)
+	go spaceStates.run(statePollInterval)
+	setupActivityPub()
 
 	log.Println("starting api...")
 	log.Fatal(http.ListenAndServe(":8080", mux))
 }
 
-func openApi(writer http.ResponseWriter, _ *http.Request) {
-	_, err := writer.Write([]byte(openapi))
-	if err != nil {
-		writer.WriteHeader(500)
+// newSpec generates the OpenAPI document of the routes of the api.
+func newSpec() *openapi.Spec {
+	spec := openapi.New(apiDocument, apiRoutes())
+	spec.PathParam = pat.Param
+
+	return spec
+}
+
+// handleRoutes registers the routes of the spec and the document itself on
+// /openapi.json.
+func handleRoutes(mux *goji.Mux, spec *openapi.Spec) {
+	for _, route := range spec.Routes() {
+		mux.Handle(routePattern(route), spec.Handler(route))
+		// the root is kept as an alias of /v1
+		if route.Path == "/v1" {
+			mux.Handle(pat.Get("/"), spec.Handler(route))
+		}
 	}
+	mux.Handle(pat.Get("/openapi.json"), spec)
+}
+
+func logNonConformingResponse(r *http.Request, route openapi.Route, problems []string) {
+	nonConformingResponses.With(prometheus.Labels{"method": route.Method, "route": route.Path}).Inc()
+	log.Printf("response of %s %s doesn't match the OpenAPI document: %s", r.Method, r.URL, strings.Join(problems, "; "))
 }
 
 func getFilter(r *http.Request) (bool, bool) {
@@ -118,33 +133,24 @@ func getFilter(r *http.Request) (bool, bool) {
 }
 
 func getJQFilter(r *http.Request) string {
-	filter := r.URL.Query().Get("filter")
-	if filter != "" {
-		return `.[] | select(` + filter + `)`
-	}
-
-	return ".[]"
+	return jqSelectFilter(r.URL.Query().Get("filter"))
 }
 
 func serveV1(w http.ResponseWriter, r *http.Request) {
 	validFilter, noFilter := getFilter(r)
-	if err := json.NewEncoder(w).Encode(func() interface{} {
+	serveJson(w, r, func() interface{} {
 		response := make(map[string]string)
 		for _, entry := range getDirectory(getJQFilter(r)) {
 			if entry.Valid == validFilter || noFilter == true {
 				if entry.Data != nil {
-					spaceName := entry.Data.(map[string]interface{})["space"]
-					response[spaceName.(string)] = entry.Url
+					response[entry.SpaceName()] = entry.Url
 				} else {
 					response["unknown_"+strconv.FormatInt(rand.Int63(), 10)] = entry.Url
 				}
 			}
 		}
-		w.Header().Set("Content-Type", "application/json")
 		return response
-	}()); err != nil {
-		panic(err)
-	}
+	}())
 }
 
 func serveV2(w http.ResponseWriter, r *http.Request) {
@@ -155,65 +161,140 @@ func serveV2(w http.ResponseWriter, r *http.Request) {
 		includeData = false
 	}
 
+	dataOptions, err := parseDataOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	includeValidationResultParam := r.URL.Query().Get("includeValidationResult")
 	includeValidationResult, err := strconv.ParseBool(includeValidationResultParam)
 	if err != nil {
 		includeValidationResult = false
 	}
 
-	if err := json.NewEncoder(w).Encode(func() []entry {
-		var response []entry
+	availabilitySort, err := parseAvailabilitySort(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serveJson(w, r, func() []spaceapi.ListedEntry {
+		var response []spaceapi.ListedEntry
+		unrepresentable := make(map[string]bool)
+		var unconverted []string
 		for _, collectorEntry := range getDirectory(getJQFilter(r)) {
 			if collectorEntry.Valid == validFilter || noFilter == true {
-				var spaceName string
-				if collectorEntry.Data != nil {
-					spaceName = collectorEntry.Data.(map[string]interface{})["space"].(string)
-				} else {
-					spaceName = ""
-				}
-
-				var data interface{}
+				var data map[string]interface{}
 				if includeData {
-					data = collectorEntry.Data
+					var dropped []string
+					var converted bool
+					data, dropped, converted = dataOptions.data(collectorEntry)
+					for _, field := range dropped {
+						unrepresentable[field] = true
+					}
+					if !converted {
+						unconverted = append(unconverted, collectorEntry.Id)
+					}
 				}
 
-				var validationResult *validationResult
+				var validationResult *spaceapi.ValidationResult
 				if includeValidationResult {
-					validationResult = collectorEntry.ValidationResult
+					result := collectorEntry.ValidationResult
+					validationResult = &result
 				}
 
-				response = append(response, entry{
-					collectorEntry.Url,
-					collectorEntry.Valid,
-					spaceName,
-					collectorEntry.LastSeen,
-					collectorEntry.ErrMsg,
-					data,
-					validationResult,
+				response = append(response, spaceapi.ListedEntry{
+					Id:               collectorEntry.Id,
+					Url:              collectorEntry.Url,
+					Valid:            collectorEntry.Valid,
+					Space:            collectorEntry.SpaceName(),
+					LastSeen:         collectorEntry.LastSeen,
+					ErrMsg:           collectorEntry.ErrMsg,
+					Data:             data,
+					ValidationResult: validationResult,
+					Availability:     collectorEntry.Availability,
 				})
 			}
 		}
-		w.Header().Set("Content-Type", "application/json")
+		if availabilitySort.window != "" {
+			availabilitySort.sortEntries(response)
+		}
+		setUnrepresentableFields(w, unrepresentable)
+		setUnconvertedSpaces(w, unconverted)
 		return response
-	}()); err != nil {
-		panic(err)
+	}())
+}
+
+// serveSpace returns the entry of a single space with its data and
+// validation result.
+func serveSpace(w http.ResponseWriter, r *http.Request) {
+	dataOptions, err := parseDataOptions(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+
+	collectorEntry, ok := getSpace(pat.Param(r, "id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	data, dropped, converted := dataOptions.data(collectorEntry)
+	unrepresentable := make(map[string]bool)
+	for _, field := range dropped {
+		unrepresentable[field] = true
+	}
+	if !converted {
+		setUnconvertedSpaces(w, []string{collectorEntry.Id})
+	}
+
+	response := spaceapi.ListedEntry{
+		Id:               collectorEntry.Id,
+		Url:              collectorEntry.Url,
+		Valid:            collectorEntry.Valid,
+		Space:            collectorEntry.SpaceName(),
+		LastSeen:         collectorEntry.LastSeen,
+		ErrMsg:           collectorEntry.ErrMsg,
+		Data:             data,
+		ValidationResult: &collectorEntry.ValidationResult,
+		Availability:     collectorEntry.Availability,
+	}
+
+	setUnrepresentableFields(w, unrepresentable)
+	serveJson(w, r, response)
 }
 
 func serveCache(w http.ResponseWriter, r *http.Request) {
 	validFilter, noFilter := getFilter(r)
-	if err := json.NewEncoder(w).Encode(func() []collectorEntry {
-		var response []collectorEntry
+	serveJson(w, r, func() []spaceapi.Entry {
+		var response []spaceapi.Entry
 		for _, collectorEntry := range getDirectory(getJQFilter(r)) {
 			if collectorEntry.Valid == validFilter || noFilter == true {
 				response = append(response, collectorEntry)
 			}
 		}
-		w.Header().Set("Content-Type", "application/json")
 		return response
-	}()); err != nil {
+	}())
+}
+
+// serveJson writes the response with an ETag of its content, clients
+// sending it back in If-None-Match get a 304 if nothing changed.
+func serveJson(w http.ResponseWriter, r *http.Request, response interface{}) {
+	body, err := json.Marshal(response)
+	if err != nil {
 		panic(err)
 	}
+	body = append(body, '\n')
+
+	hash := sha256.Sum256(body)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+hex.EncodeToString(hash[:16])+`"`)
+
+	// handles If-None-Match
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(body))
 }
 
 func statisticMiddelware(inner http.Handler) http.Handler {
@@ -224,11 +305,12 @@ func statisticMiddelware(inner http.Handler) http.Handler {
 	return http.HandlerFunc(mw)
 }
 
-func getDirectory(filter string) []collectorEntry {
-	var staticDirectory []collectorEntry
-	resp, err := http.Get(spaceApiCollectorUrl)
+func proxyCollector(w http.ResponseWriter, r *http.Request, path string) {
+	resp, err := http.Get(spaceApiCollectorUrl + path + "?" + r.URL.RawQuery)
 	if err != nil {
 		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
 	}
 	defer func() {
 		err := resp.Body.Close()
@@ -237,12 +319,42 @@ func getDirectory(filter string) []collectorEntry {
 		}
 	}()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		log.Println(err)
+	}
+}
+
+// getSpace looks up a single space by its id.
+func getSpace(id string) (spaceapi.Entry, bool) {
+	for _, entry := range getDirectory(".[]") {
+		if entry.Id == id {
+			return entry, true
+		}
+	}
+
+	return spaceapi.Entry{}, false
+}
+
+func getDirectory(filter string) []spaceapi.Entry {
+	return filterDirectory(fetchDirectory(), filter)
+}
+
+// fetchDirectory returns the directory of the collector as decoded json.
+func fetchDirectory() interface{} {
+	resp, err := http.Get(spaceApiCollectorUrl)
 	if err != nil {
 		log.Println(err)
 	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
 
-	query, err := gojq.Parse(filter)
+	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		log.Println(err)
 	}
@@ -250,6 +362,18 @@ func getDirectory(filter string) []collectorEntry {
 	var m interface{}
 	err = json.Unmarshal(body, &m)
 
+	return m
+}
+
+// filterDirectory runs the jq filter on the directory and returns the
+// entries it selects.
+func filterDirectory(m interface{}, filter string) []spaceapi.Entry {
+	var staticDirectory []spaceapi.Entry
+	query, err := gojq.Parse(filter)
+	if err != nil {
+		log.Println(err)
+	}
+
 	iter := query.Run(m)
 	for {
 		v, ok := iter.Next()
@@ -265,7 +389,7 @@ func getDirectory(filter string) []collectorEntry {
 			continue
 		}
 
-		var entry collectorEntry
+		var entry spaceapi.Entry
 		err = json.Unmarshal(marshal, &entry)
 		if err != nil {
 			continue
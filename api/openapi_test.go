@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"github.com/gorilla/websocket"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
+	"goji.io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newFixtureCollector serves the responses of a collector from the files in
+// testdata/collector, the query parameters are ignored.
+func newFixtureCollector() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(serveCollectorFixture))
+}
+
+func serveCollectorFixture(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/")
+	if name == "" {
+		name = "directory"
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "collector", name+".json"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(content)
+}
+
+// conformanceRequest is a request of the conformance test, its response
+// has to have the status and match the OpenAPI document.
+type conformanceRequest struct {
+	method string
+	path   string
+	body   string
+	status int
+}
+
+func TestResponsesMatchOpenApiDocument(t *testing.T) {
+	collector := newFixtureCollector()
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	var err error
+	activityPubKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mutex sync.Mutex
+	covered := make(map[string]bool)
+	spec := newSpec()
+	spec.CheckResponses = func(r *http.Request, route openapi.Route, problems []string) {
+		t.Errorf("%s %s doesn't match the OpenAPI document:\n%s", r.Method, r.URL, strings.Join(problems, "\n"))
+	}
+	mux := goji.NewMux()
+	mux.Use(func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mutex.Lock()
+			for _, route := range spec.Routes() {
+				if route.Method == r.Method && matchesPath(route.Path, r.URL.Path) {
+					covered[route.Method+" "+route.Path] = true
+				}
+			}
+			mutex.Unlock()
+			inner.ServeHTTP(w, r)
+		})
+	})
+	handleRoutes(mux, spec)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	for _, request := range []conformanceRequest{
+		{method: http.MethodGet, path: "/v1", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2?valid=all&includeData=true&includeValidationResult=true&sort=availability", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2?valid=all&includeData=true&raw=true", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2?valid=all&includeData=true&version=0.13", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2?valid=1", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2?version=12", status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/v2/changes", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/calendar.ics", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/calendar.json", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/planet.json", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/sensors", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/sensors?normalize=false", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/openinghours", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/stats", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/trends?series=totals:*,fields:*&relative=true", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/deprecations", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/spaces/fixture-space", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/spaces/legacy-space?version=14", status: http.StatusOK},
+		{method: http.MethodGet, path: "/v2/spaces/unknown", status: http.StatusNotFound},
+		{method: http.MethodGet, path: "/v2/spaces/fixture-space/state", status: http.StatusOK},
+		{method: http.MethodGet, path: "/badge/fixture-space.svg", status: http.StatusOK},
+		{method: http.MethodGet, path: "/feeds/directory.atom", status: http.StatusOK},
+		{method: http.MethodGet, path: "/feeds/planet.rss", status: http.StatusOK},
+		{method: http.MethodGet, path: "/feeds/spaces/fixture-space.atom", status: http.StatusOK},
+		{method: http.MethodGet, path: "/.well-known/webfinger?resource=acct:fixture-space@" + webfingerDomain(), status: http.StatusOK},
+		{method: http.MethodGet, path: "/ap/spaces/fixture-space", status: http.StatusOK},
+		{method: http.MethodGet, path: "/ap/spaces/fixture-space/outbox", status: http.StatusOK},
+		{method: http.MethodGet, path: "/ap/spaces/fixture-space/followers", status: http.StatusOK},
+		{method: http.MethodGet, path: "/ap/spaces/fixture-space/notes/2", status: http.StatusOK},
+		{method: http.MethodPost, path: "/ap/spaces/fixture-space/inbox", body: `{"type": "Follow"}`, status: http.StatusUnauthorized},
+		{method: http.MethodGet, path: "/cache", status: http.StatusOK},
+		{method: http.MethodGet, path: "/graphql?query=" + url.QueryEscape("{ spaces(first: 1) { totalCount nodes { id name state { open } } } }"), status: http.StatusOK},
+		{method: http.MethodPost, path: "/graphql", body: `{"query": "{ spaces { nodes { id } } }"}`, status: http.StatusOK},
+		{method: http.MethodGet, path: "/openapi.json", status: http.StatusOK},
+	} {
+		req, err := http.NewRequest(request.method, server.URL+request.path, strings.NewReader(request.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+
+		if resp.StatusCode != request.status {
+			t.Errorf("%s %s responded with %d instead of %d: %s", request.method, request.path, resp.StatusCode, request.status, body)
+		}
+	}
+
+	// the stream and the websocket don't end on their own
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/v2/stream", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Errorf("/v2/stream responded with %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	cancel()
+	_ = resp.Body.Close()
+
+	conn, resp, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/v2/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("/v2/ws responded with %d", resp.StatusCode)
+	}
+	_ = conn.Close()
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, route := range spec.Routes() {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("%s %s isn't covered by the conformance test", route.Method, route.Path)
+		}
+	}
+}
+
+// matchesPath compares a path with the path of a route, parameters match
+// any segment.
+func matchesPath(routePath string, requestPath string) bool {
+	routeParts := strings.Split(routePath, "/")
+	requestParts := strings.Split(requestPath, "/")
+	if len(routeParts) != len(requestParts) {
+		return false
+	}
+	for i, part := range routeParts {
+		if !strings.HasPrefix(part, "{") && part != requestParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
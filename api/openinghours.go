@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+)
+
+const (
+	hoursPerWeek = 7 * 24
+	// usuallyOpenProbability is the share of samples a space has to be open
+	// in an hour to be considered usually open then
+	usuallyOpenProbability = 0.5
+)
+
+var weekdays = []string{"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday"}
+
+// spaceOpeningHours is the heatmap of a space from the collector with the
+// hours it's usually open.
+type spaceOpeningHours struct {
+	spaceapi.SpaceOpeningHours
+	UsuallyOpen []openingRange `json:"usuallyOpen" description:"Hours the space is open in at least half of the samples, to is exclusive"`
+}
+
+// openingRange is a range of hours on a weekday, to is exclusive.
+type openingRange struct {
+	Day  string `json:"day"`
+	From int    `json:"from"`
+	To   int    `json:"to"`
+}
+
+// directoryOpeningHours combines the heatmaps of all matching spaces. Every
+// bucket holds the average probability over the spaces with samples in that
+// bucket and the number of spaces expected to be open.
+type directoryOpeningHours struct {
+	Spaces       int       `json:"spaces" description:"Number of spaces combined"`
+	Probability  []float64 `json:"probability" description:"Average open probability of the spaces with samples per bucket"`
+	ExpectedOpen []float64 `json:"expectedOpen" description:"Number of spaces expected to be open per bucket"`
+}
+
+type openingHoursResponse struct {
+	Days      []string              `json:"days" description:"Names of the days in bucket order"`
+	Spaces    []spaceOpeningHours   `json:"spaces"`
+	Directory directoryOpeningHours `json:"directory"`
+}
+
+// serveOpeningHours returns the weekly open probability of the spaces and
+// the combined pattern of the directory, filtered by space ids and country.
+func serveOpeningHours(w http.ResponseWriter, r *http.Request) {
+	heatmaps, err := getOpeningHours()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	ids := listParam(r.URL.Query().Get("ids"))
+	countries := listParam(strings.ToLower(r.URL.Query().Get("country")))
+
+	response := openingHoursResponse{
+		Days:   weekdays,
+		Spaces: []spaceOpeningHours{},
+		Directory: directoryOpeningHours{
+			Probability:  make([]float64, hoursPerWeek),
+			ExpectedOpen: make([]float64, hoursPerWeek),
+		},
+	}
+	spacesPerBucket := make([]int, hoursPerWeek)
+	for _, heatmap := range heatmaps {
+		if len(ids) > 0 && !ids[heatmap.SpaceId] {
+			continue
+		}
+		if len(countries) > 0 && !countries[strings.ToLower(heatmap.Country)] {
+			continue
+		}
+		if len(heatmap.Samples) != hoursPerWeek || len(heatmap.Probability) != hoursPerWeek {
+			continue
+		}
+
+		response.Spaces = append(response.Spaces, spaceOpeningHours{
+			SpaceOpeningHours: heatmap,
+			UsuallyOpen:       usuallyOpen(heatmap),
+		})
+
+		response.Directory.Spaces++
+		for i, samples := range heatmap.Samples {
+			if samples > 0 {
+				spacesPerBucket[i]++
+				response.Directory.ExpectedOpen[i] += heatmap.Probability[i]
+			}
+		}
+	}
+
+	for i, spaces := range spacesPerBucket {
+		if spaces > 0 {
+			response.Directory.Probability[i] = math.Round(response.Directory.ExpectedOpen[i]/float64(spaces)*1000) / 1000
+		}
+		response.Directory.ExpectedOpen[i] = math.Round(response.Directory.ExpectedOpen[i]*100) / 100
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// usuallyOpen joins the hours a space is open in at least half of the
+// samples into ranges per weekday, e.g. tuesday from 18 to 23.
+func usuallyOpen(heatmap spaceapi.SpaceOpeningHours) []openingRange {
+	ranges := []openingRange{}
+	for day, name := range weekdays {
+		from := -1
+		for hour := 0; hour <= 24; hour++ {
+			open := hour < 24 && heatmap.Samples[day*24+hour] > 0 && heatmap.Probability[day*24+hour] >= usuallyOpenProbability
+			if open && from < 0 {
+				from = hour
+			}
+			if !open && from >= 0 {
+				ranges = append(ranges, openingRange{Day: name, From: from, To: hour})
+				from = -1
+			}
+		}
+	}
+
+	return ranges
+}
+
+func getOpeningHours() ([]spaceapi.SpaceOpeningHours, error) {
+	var heatmaps []spaceapi.SpaceOpeningHours
+	resp, err := http.Get(spaceApiCollectorUrl + "/openinghours")
+	if err != nil {
+		return heatmaps, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return heatmaps, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return heatmaps, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &heatmaps)
+	return heatmaps, err
+}
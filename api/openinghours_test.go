@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// heatmap returns the heatmap of a space sampled once per bucket, open with
+// the given probability during the hours of a weekday.
+func heatmap(id string, country string, probability float64, day int, hours ...int) spaceapi.SpaceOpeningHours {
+	h := spaceapi.SpaceOpeningHours{
+		SpaceId:     id,
+		Country:     country,
+		Samples:     make([]float64, hoursPerWeek),
+		Probability: make([]float64, hoursPerWeek),
+	}
+	for i := range h.Samples {
+		h.Samples[i] = 1
+	}
+	for _, hour := range hours {
+		h.Probability[day*24+hour] = probability
+	}
+
+	return h
+}
+
+func TestUsuallyOpen(t *testing.T) {
+	unsampled := heatmap("a", "", 1, 0, 10, 11)
+	unsampled.Samples[10] = 0
+
+	for _, test := range []struct {
+		name     string
+		heatmap  spaceapi.SpaceOpeningHours
+		expected []openingRange
+	}{
+		{"never", heatmap("a", "", 0, 0), []openingRange{}},
+		{"evening", heatmap("a", "", 0.8, 1, 18, 19, 20, 21, 22), []openingRange{{"tuesday", 18, 23}}},
+		{"until midnight", heatmap("a", "", 1, 6, 22, 23), []openingRange{{"sunday", 22, 24}}},
+		{"two ranges", heatmap("a", "", 1, 2, 0, 1, 14, 15), []openingRange{{"wednesday", 0, 2}, {"wednesday", 14, 16}}},
+		{"exactly half", heatmap("a", "", 0.5, 3, 12), []openingRange{{"thursday", 12, 13}}},
+		{"less than half", heatmap("a", "", 0.49, 3, 12), []openingRange{}},
+		{"without samples", unsampled, []openingRange{{"monday", 11, 12}}},
+	} {
+		if ranges := usuallyOpen(test.heatmap); !reflect.DeepEqual(ranges, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, ranges)
+		}
+	}
+}
+
+func TestOpeningHours(t *testing.T) {
+	berlin := heatmap("berlin", "de", 1, 1, 18, 19)
+	amsterdam := heatmap("amsterdam", "nl", 0.5, 1, 19, 20)
+	// amsterdam was never sampled on tuesday at 18
+	amsterdam.Samples[24+18] = 0
+	broken := heatmap("broken", "de", 1, 1, 18)
+	broken.Samples = broken.Samples[:24]
+
+	failing := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]spaceapi.SpaceOpeningHours{berlin, amsterdam, broken})
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query        string
+		spaces       string
+		probability  []float64
+		expectedOpen []float64
+	}{
+		// tuesday from 18 to 21
+		{"", "berlin,amsterdam", []float64{1, 0.75, 0.25}, []float64{1, 1.5, 0.5}},
+		{"ids=amsterdam,broken", "amsterdam", []float64{0, 0.5, 0.5}, []float64{0, 0.5, 0.5}},
+		{"country=DE", "berlin", []float64{1, 1, 0}, []float64{1, 1, 0}},
+		{"country=fr", "", []float64{0, 0, 0}, []float64{0, 0, 0}},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/openinghours?"+test.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: expected %d, got %d", test.query, http.StatusOK, w.Code)
+		}
+
+		var response openingHoursResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var spaces []string
+		for _, space := range response.Spaces {
+			spaces = append(spaces, space.SpaceId)
+		}
+		if strings.Join(spaces, ",") != test.spaces || response.Directory.Spaces != len(spaces) {
+			t.Errorf("%s: expected the spaces %v, got %v and %d", test.query, test.spaces, spaces, response.Directory.Spaces)
+		}
+		if len(response.Days) != 7 || len(response.Directory.Probability) != hoursPerWeek || len(response.Directory.ExpectedOpen) != hoursPerWeek {
+			t.Fatalf("%s: expected 7 days with 24 buckets each", test.query)
+		}
+		if p := response.Directory.Probability[24+18 : 24+21]; !reflect.DeepEqual(p, test.probability) {
+			t.Errorf("%s: expected the probability %v, got %v", test.query, test.probability, p)
+		}
+		if e := response.Directory.ExpectedOpen[24+18 : 24+21]; !reflect.DeepEqual(e, test.expectedOpen) {
+			t.Errorf("%s: expected %v spaces to be open, got %v", test.query, test.expectedOpen, e)
+		}
+	}
+
+	failing = true
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/openinghours", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected %d, got %d", http.StatusBadGateway, w.Code)
+	}
+}
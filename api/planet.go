@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultPlanetLimit = 50
+	maxPlanetLimit     = 500
+)
+
+// planetPost is an item of the combined feed attributed to its space.
+type planetPost struct {
+	SpaceId   string `json:"spaceId"`
+	Space     string `json:"space,omitempty"`
+	Country   string `json:"country,omitempty"`
+	Feed      string `json:"feed" enum:"blog,wiki"`
+	FeedUrl   string `json:"feedUrl"`
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Author    string `json:"author,omitempty"`
+	Published int64  `json:"published"`
+	Content   string `json:"content,omitempty" description:"Sanitized html"`
+}
+
+type planetResponse struct {
+	Posts   []planetPost `json:"posts"`
+	HasMore bool         `json:"hasMore"`
+}
+
+type planetQuery struct {
+	ids       map[string]bool
+	countries map[string]bool
+	feeds     map[string]bool
+	since     int64
+	limit     int
+}
+
+func (q planetQuery) matches(feed spaceapi.PlanetFeed) bool {
+	if len(q.ids) > 0 && !q.ids[feed.SpaceId] {
+		return false
+	}
+	if len(q.countries) > 0 && !q.countries[strings.ToLower(feed.Country)] {
+		return false
+	}
+	if len(q.feeds) > 0 && !q.feeds[feed.Type] {
+		return false
+	}
+
+	return true
+}
+
+func parsePlanetQuery(r *http.Request) (planetQuery, error) {
+	query := planetQuery{
+		ids:       listParam(r.URL.Query().Get("ids")),
+		countries: listParam(strings.ToLower(r.URL.Query().Get("country"))),
+		feeds:     listParam(r.URL.Query().Get("feeds")),
+		limit:     defaultPlanetLimit,
+	}
+
+	if since := r.URL.Query().Get("since"); since != "" {
+		var err error
+		query.since, err = strconv.ParseInt(since, 10, 64)
+		if err != nil {
+			return query, errors.New("since has to be a unix timestamp")
+		}
+	}
+
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		var err error
+		query.limit, err = strconv.Atoi(limit)
+		if err != nil || query.limit <= 0 {
+			return query, errors.New("limit has to be a positive number")
+		}
+		if query.limit > maxPlanetLimit {
+			query.limit = maxPlanetLimit
+		}
+	}
+
+	return query, nil
+}
+
+func servePlanet(w http.ResponseWriter, r *http.Request) {
+	response, ok := getPlanetResponse(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// servePlanetFeed serves the combined posts of the spaces, the title of
+// every entry is prefixed with the name of its space.
+func servePlanetFeed(w http.ResponseWriter, r *http.Request, format string) {
+	response, ok := getPlanetResponse(w, r)
+	if !ok {
+		return
+	}
+
+	entries := make([]feedEntry, 0, len(response.Posts))
+	for _, post := range response.Posts {
+		name := post.Space
+		if name == "" {
+			name = post.SpaceId
+		}
+
+		entries = append(entries, feedEntry{
+			id:       post.Link,
+			title:    name + ": " + post.Title,
+			link:     post.Link,
+			author:   post.Author,
+			updated:  post.Published,
+			category: post.Feed,
+			content:  post.Content,
+			html:     true,
+		})
+	}
+
+	writeFeed(w, format, feed{
+		title:       "Planet SpaceAPI",
+		description: "Blog posts and wiki changes of the spaces in the SpaceAPI directory",
+		self:        baseUrl + "/feeds/planet." + format,
+		entries:     entries,
+	})
+}
+
+func getPlanetResponse(w http.ResponseWriter, r *http.Request) (planetResponse, bool) {
+	query, err := parsePlanetQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return planetResponse{}, false
+	}
+
+	feeds, err := getPlanetFeeds()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return planetResponse{}, false
+	}
+
+	posts := mergePlanetFeeds(feeds, query)
+	response := planetResponse{Posts: posts}
+	if len(posts) > query.limit {
+		response.Posts = posts[:query.limit]
+		response.HasMore = true
+	}
+
+	return response, true
+}
+
+// mergePlanetFeeds combines the items of the matching feeds, newest first.
+// Posts showing up in several feeds, e.g. a blog shared by two spaces, are
+// only kept once.
+func mergePlanetFeeds(feeds []spaceapi.PlanetFeed, query planetQuery) []planetPost {
+	var posts []planetPost
+	for _, feed := range feeds {
+		if !query.matches(feed) {
+			continue
+		}
+
+		for _, item := range feed.Items {
+			if item.Published < query.since || item.Link == "" {
+				continue
+			}
+
+			posts = append(posts, planetPost{
+				SpaceId:   feed.SpaceId,
+				Space:     feed.Space,
+				Country:   feed.Country,
+				Feed:      feed.Type,
+				FeedUrl:   feed.Url,
+				Title:     item.Title,
+				Link:      item.Link,
+				Author:    item.Author,
+				Published: item.Published,
+				Content:   item.Content,
+			})
+		}
+	}
+
+	sort.SliceStable(posts, func(i, j int) bool {
+		if posts[i].Published != posts[j].Published {
+			return posts[i].Published > posts[j].Published
+		}
+		return posts[i].SpaceId < posts[j].SpaceId
+	})
+
+	seen := make(map[string]bool)
+	unique := make([]planetPost, 0, len(posts))
+	for _, post := range posts {
+		key := planetPostKey(post.Link)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, post)
+	}
+
+	return unique
+}
+
+// planetPostKey normalizes a link, so the same post linked with http and
+// https or with and without a trailing slash is recognized.
+func planetPostKey(link string) string {
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return link
+	}
+
+	return strings.ToLower(parsed.Host) + strings.TrimSuffix(parsed.Path, "/") + "?" + parsed.RawQuery
+}
+
+func getPlanetFeeds() ([]spaceapi.PlanetFeed, error) {
+	var feeds []spaceapi.PlanetFeed
+	resp, err := http.Get(spaceApiCollectorUrl + "/planet")
+	if err != nil {
+		return feeds, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return feeds, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return feeds, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &feeds)
+	return feeds, err
+}
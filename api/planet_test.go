@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// planetFeeds has a blog shared by two spaces, a wiki and a post without a
+// link.
+const planetFeeds = `[
+	{"spaceId": "berlin", "space": "Berlin Space", "country": "de", "type": "blog", "url": "https://berlin.example/blog.rss",
+	 "items": [
+		{"id": "1", "title": "Laser", "link": "https://shared.example/laser/", "published": 1600000300},
+		{"id": "2", "title": "Drafts", "published": 1600000400},
+		{"id": "3", "title": "Old", "link": "https://berlin.example/old", "published": 1600000000}
+	 ]},
+	{"spaceId": "amsterdam", "space": "Amsterdam Space", "country": "nl", "type": "blog", "url": "https://shared.example/blog.rss",
+	 "items": [
+		{"id": "1", "title": "Laser", "link": "http://SHARED.example/laser", "published": 1600000300},
+		{"id": "4", "title": "Solder", "link": "https://shared.example/solder", "published": 1600000200}
+	 ]},
+	{"spaceId": "berlin", "space": "Berlin Space", "country": "de", "type": "wiki", "url": "https://berlin.example/wiki.atom",
+	 "items": [
+		{"id": "5", "title": "Printer", "link": "https://berlin.example/wiki/printer", "published": 1600000100}
+	 ]}
+]`
+
+func TestPlanet(t *testing.T) {
+	failing := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(planetFeeds))
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query   string
+		status  int
+		posts   string
+		hasMore bool
+	}{
+		{"", http.StatusOK, "amsterdam:Laser,amsterdam:Solder,berlin:Printer,berlin:Old", false},
+		{"ids=berlin", http.StatusOK, "berlin:Laser,berlin:Printer,berlin:Old", false},
+		{"country=DE,fr", http.StatusOK, "berlin:Laser,berlin:Printer,berlin:Old", false},
+		{"feeds=wiki", http.StatusOK, "berlin:Printer", false},
+		{"since=1600000200", http.StatusOK, "amsterdam:Laser,amsterdam:Solder", false},
+		{"limit=2", http.StatusOK, "amsterdam:Laser,amsterdam:Solder", true},
+		{"limit=4", http.StatusOK, "amsterdam:Laser,amsterdam:Solder,berlin:Printer,berlin:Old", false},
+		{"ids=unknown", http.StatusOK, "", false},
+		{"since=yesterday", http.StatusBadRequest, "", false},
+		{"limit=0", http.StatusBadRequest, "", false},
+		{"feeds=podcast", http.StatusBadRequest, "", false},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/planet.json?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var response planetResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var posts []string
+		for _, post := range response.Posts {
+			posts = append(posts, post.SpaceId+":"+post.Title)
+		}
+		if strings.Join(posts, ",") != test.posts || response.HasMore != test.hasMore {
+			t.Errorf("%s: expected %v and hasMore %v, got %v and %v", test.query, test.posts, test.hasMore, posts, response.HasMore)
+		}
+	}
+
+	// the feed prefixes the titles with the space
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/feeds/planet.rss?feeds=wiki", nil))
+	var rss rssFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &rss); err != nil {
+		t.Fatal(err)
+	}
+	if len(rss.Channel.Items) != 1 || rss.Channel.Items[0].Title != "Berlin Space: Printer" || rss.Channel.Items[0].Category != "wiki" {
+		t.Errorf("expected the wiki post of Berlin Space, got %+v", rss.Channel.Items)
+	}
+
+	failing = true
+	for _, path := range []string{"/v2/planet.json", "/feeds/planet.atom"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusBadGateway {
+			t.Errorf("%s: expected %d, got %d", path, http.StatusBadGateway, w.Code)
+		}
+	}
+}
+
+func TestPlanetPostKey(t *testing.T) {
+	for _, test := range []struct {
+		a    string
+		b    string
+		same bool
+	}{
+		{"https://example.org/post", "http://example.org/post", true},
+		{"https://example.org/post/", "https://example.org/post", true},
+		{"https://EXAMPLE.org/post", "https://example.org/post", true},
+		{"https://example.org/post?id=1", "https://example.org/post?id=2", false},
+		{"https://example.org/Post", "https://example.org/post", false},
+		{"https://example.org/post", "https://example.com/post", false},
+	} {
+		if same := planetPostKey(test.a) == planetPostKey(test.b); same != test.same {
+			t.Errorf("%s and %s: expected the same key to be %v", test.a, test.b, test.same)
+		}
+	}
+}
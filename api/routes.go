@@ -0,0 +1,575 @@
+package main
+
+import (
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
+	"goji.io/pat"
+	"net/http"
+)
+
+// apiDocument is the part of the OpenAPI document that isn't generated from
+// the routes.
+var apiDocument = openapi.Document{
+	Info: openapi.Info{
+		Title:          "SpaceApi Directory",
+		Description:    "This is the spaceApi directory",
+		Version:        "0.0.1",
+		TermsOfService: "https://spaceapi.io/daemon/terms",
+		Contact:        &openapi.Contact{Email: "spaceapi-team@chaospott.de"},
+		License: &openapi.License{
+			Name: "Apache 2.0",
+			Url:  "http://www.apache.org/licenses/LICENSE-2.0.html",
+		},
+	},
+	ExternalDocs: &openapi.ExternalDocs{
+		Description: "Find out more about spaceApi directory",
+		Url:         "https://spaceapi.io",
+	},
+}
+
+// apiRoutes lists the routes of the api. The OpenAPI document served on
+// /openapi.json is generated from them and their parameters are validated
+// before the handlers are called.
+func apiRoutes() []openapi.Route {
+	// valid, includeData and includeValidationResult are plain strings, the
+	// handlers parse them with strconv.ParseBool and fall back to their
+	// default for unknown values instead of rejecting them
+	valid := openapi.Query("valid", "Filter for valid endpoints: all, true or false, 1, t, 0 and f work as well, unknown values return the valid endpoints", openapi.String().WithDefault("true"))
+	ids := openapi.Query("ids", "Comma separated list of space ids", openapi.String())
+	country := openapi.Query("country", "Comma separated list of country codes", openapi.String())
+	types := openapi.Query("types", "Comma separated list of event types", openapi.String())
+	spaceId := openapi.PathParam("id", "Id of the space")
+	raw := openapi.Query("raw", "Return the data as published by the space instead of normalized to the latest schema version", openapi.Boolean().WithDefault(false))
+	version := openapi.Query("version", "Convert the normalized data to the layout of this version, fields that can't be represented are dropped and listed in the X-SpaceAPI-Unrepresentable-Fields header. Spaces the collector couldn't normalize are returned as published and listed in the X-SpaceAPI-Unconverted-Spaces header", openapi.Enum("0.13", "14", "15"))
+	ifNoneMatch := openapi.HeaderParam("If-None-Match", "ETag of a previous response", openapi.String())
+	calendarParameters := []openapi.Parameter{
+		openapi.Query("from", "Unix timestamp, defaults to now so only upcoming and running events are returned", openapi.Integer()),
+		openapi.Query("to", "Unix timestamp, defaults to 90 days after from and can be at most 366 days after it", openapi.Integer()),
+		ids,
+		country,
+		openapi.Query("bbox", "Bounding box as minLon,minLat,maxLon,maxLat", openapi.String()),
+		openapi.Query("limit", "Maximum number of events to return, larger values are capped at 5000", openapi.Integer().WithDefault(defaultCalendarLimit).WithMinimum(1)),
+	}
+
+	etag := openapi.Header{
+		Description: "Hash of the response, send it as If-None-Match to get a 304 if nothing changed",
+		Schema:      openapi.String(),
+	}
+	unrepresentableFields := openapi.Header{
+		Description: "Comma separated fields that were dropped converting to the requested version",
+		Schema:      openapi.String(),
+	}
+	unconvertedSpaces := openapi.Header{
+		Description: "Comma separated ids of the spaces the collector couldn't normalize, their data is returned as published",
+		Schema:      openapi.String(),
+	}
+	notModified := openapi.Response{Status: http.StatusNotModified, Description: "The response didn't change since the ETag sent as If-None-Match"}
+	invalidParameter := openapi.Response{Status: http.StatusBadRequest, Description: "invalid parameter"}
+	unknownSpace := openapi.Response{Status: http.StatusNotFound, Description: "unknown space"}
+	collectorUnavailable := openapi.Response{Status: http.StatusBadGateway, Description: "the collector can't be reached"}
+	feed := []openapi.Response{
+		{Status: http.StatusOK, Description: "successful operation", ContentType: "application/atom+xml", Body: openapi.String()},
+		{Status: http.StatusOK, Description: "successful operation", ContentType: "application/rss+xml", Body: openapi.String()},
+	}
+	activity := func(description string) openapi.Response {
+		return openapi.Response{Status: http.StatusOK, Description: description, ContentType: activityJsonType, Body: openapi.Object()}
+	}
+
+	return []openapi.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/v1",
+			Handler: serveV1,
+			Operation: openapi.Operation{
+				Description: "The names of the spaces mapped to their endpoints, spaces without data are listed as unknown_ followed by a random number",
+				Parameters: []openapi.Parameter{
+					valid,
+					{
+						Name:        "filter",
+						In:          "query",
+						Description: "jq select filter",
+						Schema:      openapi.String(),
+						Examples: map[string]openapi.Example{
+							"only ext_ccc":          {Summary: "Get all spaces wich are providing the ext_ccc field", Value: ".data.ext_ccc"},
+							"valid":                 {Summary: "Get all valid spaces", Value: ".valid == true"},
+							"https and has twitter": {Summary: "Get all spaces using https that are providing a twitter contact", Value: ".validationResult.isHttps == true and .validationResult.cors == true and .data.contact.twitter"},
+						},
+					},
+					ifNoneMatch,
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: map[string]string{}, Headers: map[string]openapi.Header{"ETag": etag}},
+					notModified,
+					invalidParameter,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2",
+			Handler: serveV2,
+			Operation: openapi.Operation{
+				Description: "List of directory entries",
+				Parameters: []openapi.Parameter{
+					valid,
+					{
+						Name:        "filter",
+						In:          "query",
+						Description: "jq select filter",
+						Schema:      openapi.String(),
+						Examples: map[string]openapi.Example{
+							"https and has twitter": {Summary: "Get all spaces using https that have a valid certificate", Value: ".validationResult.isHttps == true and .validationResult.certValid == true"},
+							"only ext_ccc":          {Summary: "Get all spaces wich are providing the ext_ccc field", Value: ".data.ext_ccc"},
+							"cors":                  {Summary: "Get all spaces that send CORS headers", Value: ".validationResult.cors == true"},
+						},
+					},
+					openapi.Query("includeData", "Add last validated data to response, unknown values are treated as false", openapi.String().WithDefault("false")),
+					raw,
+					version,
+					openapi.Query("includeValidationResult", "Add last validation result, unknown values are treated as false", openapi.String().WithDefault("false")),
+					openapi.Query("sort", "Sort the spaces by the share of scrapes their endpoint was reachable, then by validity", openapi.Enum("availability")),
+					openapi.Query("window", "Window of the availability used for sorting", openapi.Enum("24h", "7d", "30d").WithDefault("30d")),
+					openapi.Query("order", "desc puts the most reliable endpoints first", openapi.Enum("asc", "desc").WithDefault("desc")),
+					ifNoneMatch,
+				},
+				Responses: []openapi.Response{
+					{
+						Status:      http.StatusOK,
+						Description: "successful operation",
+						Body:        []spaceapi.ListedEntry{},
+						Headers: map[string]openapi.Header{
+							"ETag":                      etag,
+							unrepresentableFieldsHeader: unrepresentableFields,
+							unconvertedSpacesHeader:     unconvertedSpaces,
+						},
+					},
+					notModified,
+					invalidParameter,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/changes",
+			Handler: serveChanges,
+			Operation: openapi.Operation{
+				Summary: "Change events recorded while rebuilding the directory",
+				Parameters: []openapi.Parameter{
+					openapi.Query("since", "Unix timestamp or a cursor returned by a previous call, only newer events are returned", openapi.String()),
+					openapi.Query("limit", "Maximum number of events to return, larger values are capped at 5000", openapi.Integer().WithDefault(500).WithMinimum(1)),
+					openapi.Query("spaceId", "Comma separated list of space ids", openapi.String()),
+					types,
+					openapi.Query("order", "asc returns the oldest events after since first, desc the newest events first", openapi.Enum("asc", "desc").WithDefault("asc")),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: spaceapi.ChangesResponse{}},
+					{Status: http.StatusBadRequest, Description: "invalid since, limit or order parameter"},
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/stream",
+			Handler: serveStream,
+			Operation: openapi.Operation{
+				Summary:     "Server sent events stream of directory changes",
+				Description: "Every event carries its change feed cursor as id. Clients reconnecting with the Last-Event-ID header get the events they missed replayed. A keepalive comment is sent periodically.",
+				Parameters: []openapi.Parameter{
+					country,
+					ids,
+					types,
+					openapi.HeaderParam("Last-Event-ID", "Cursor of the last event received, can also be passed as lastEventId query parameter", openapi.String()),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "event stream, the data of every event is a ChangeEvent", ContentType: "text/event-stream", Body: openapi.String()},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/ws",
+			Handler: serveWebsocket,
+			Operation: openapi.Operation{
+				Summary:     "WebSocket subscription to directory changes",
+				Description: `After the upgrade clients send JSON messages like {"action": "subscribe", "id": "<space id>"}, {"action": "subscribe", "country": "de"} or {"action": "subscribe", "bbox": [minLon, minLat, maxLon, maxLat]}, optionally limited to event types with "types" and tagged with a "ref" that is echoed in the reply. The same messages with "action": "unsubscribe" remove a subscription. The server replies with messages of type subscribed, unsubscribed or error and sends matching changes as {"type": "event", "event": ChangeEvent}. Connections that can't keep up with the events are closed with code 1013.`,
+				Responses: []openapi.Response{
+					{Status: http.StatusSwitchingProtocols, Description: "switching to the websocket protocol"},
+					{Status: http.StatusServiceUnavailable, Description: "too many websocket connections"},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/calendar.ics",
+			Handler: serveCalendarIcs,
+			Operation: openapi.Operation{
+				Summary:    "Merged calendar of the events published by the spaces as iCalendar file",
+				Parameters: calendarParameters,
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", ContentType: "text/calendar", Body: openapi.String()},
+					invalidParameter,
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/calendar.json",
+			Handler: serveCalendarJson,
+			Operation: openapi.Operation{
+				Summary:    "Merged calendar of the events published by the spaces, recurring events are expanded",
+				Parameters: calendarParameters,
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: calendarResponse{}},
+					invalidParameter,
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/planet.json",
+			Handler: servePlanet,
+			Operation: openapi.Operation{
+				Summary: "Combined blog posts and wiki changes of the spaces, newest first",
+				Parameters: []openapi.Parameter{
+					ids,
+					country,
+					openapi.Query("feeds", "Comma separated list of feed types, blog or wiki", openapi.List(openapi.Enum("blog", "wiki"))),
+					openapi.Query("since", "Unix timestamp, only newer posts are returned", openapi.Integer()),
+					openapi.Query("limit", "Maximum number of posts to return, larger values are capped at 500", openapi.Integer().WithDefault(defaultPlanetLimit).WithMinimum(1)),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: planetResponse{}},
+					invalidParameter,
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/sensors",
+			Handler: serveSensors,
+			Operation: openapi.Operation{
+				Summary: "Sensor values of the spaces and directory wide aggregates like the total number of people present",
+				Parameters: []openapi.Parameter{
+					openapi.Query("types", "Comma separated list of sensor types", openapi.String()),
+					ids,
+					country,
+					openapi.Query("normalize", "Convert values to °C, hPa, W, m/s, m and µSv/h where the unit is known", openapi.Boolean().WithDefault(true)),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: sensorsResponse{}},
+					{Status: http.StatusBadRequest, Description: "invalid normalize parameter"},
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/openinghours",
+			Handler: serveOpeningHours,
+			Operation: openapi.Operation{
+				Summary:    "Weekly open probability per space and for the whole directory, derived from the sampled state of the spaces",
+				Parameters: []openapi.Parameter{ids, country},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "Heatmaps with 168 hourly buckets, bucket 0 is Monday 00:00 to 01:00 in the local time of the space", Body: openingHoursResponse{}},
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/stats",
+			Handler: serveStatistics,
+			Operation: openapi.Operation{
+				Summary: "Field usage, versions, countries and validity of the directory",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: spaceapi.Statistics{}},
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/trends",
+			Handler: serveTrends,
+			Operation: openapi.Operation{
+				Summary: "Time series of the daily directory statistics, e.g. the adoption of a SpaceAPI version",
+				Parameters: []openapi.Parameter{
+					openapi.Query("from", "First day, e.g. 2024-01-01", openapi.String().WithFormat("date")),
+					openapi.Query("to", "Last day, inclusive", openapi.String().WithFormat("date")),
+					openapi.Query("series", "Comma separated list of series named group:key like versions:15 or fields:/state/open, group:* selects all keys of a group. Groups are totals, validity, versions, countries and fields.", openapi.String().WithDefault("totals:*,versions:*")),
+					openapi.Query("relative", "Return the values as percentage of all spaces of the day", openapi.Boolean().WithDefault(false)),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: trendsResponse{}},
+					invalidParameter,
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/deprecations",
+			Handler: serveDeprecations,
+			Operation: openapi.Operation{
+				Summary: "What the spaces have to change to implement the latest SpaceAPI version",
+				Parameters: []openapi.Parameter{
+					ids,
+					openapi.Query("versions", "Comma separated list of declared versions, e.g. 0.13", openapi.String()),
+					openapi.Query("compliant", "Only spaces that are (not) compliant with the latest version", openapi.Boolean()),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: deprecationsResponse{}},
+					{Status: http.StatusBadRequest, Description: "invalid compliant parameter"},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/spaces/{id}",
+			Handler: serveSpace,
+			Operation: openapi.Operation{
+				Summary:    "A single space with its data and validation result",
+				Parameters: []openapi.Parameter{spaceId, raw, version, ifNoneMatch},
+				Responses: []openapi.Response{
+					{
+						Status:      http.StatusOK,
+						Description: "The space",
+						Body:        spaceapi.ListedEntry{},
+						Headers: map[string]openapi.Header{
+							"ETag":                      etag,
+							unrepresentableFieldsHeader: unrepresentableFields,
+							unconvertedSpacesHeader:     unconvertedSpaces,
+						},
+					},
+					notModified,
+					{Status: http.StatusBadRequest, Description: "Invalid raw or version parameter"},
+					unknownSpace,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/v2/spaces/{id}/state",
+			Handler: serveSpaceState,
+			Operation: openapi.Operation{
+				Summary: "Minimal state of a space, optionally waiting for it to change (long-poll)",
+				Parameters: []openapi.Parameter{
+					spaceId,
+					openapi.Query("since", "Version of the state already known to the client", openapi.String()),
+					openapi.Query("wait", "If the current version equals since, wait up to this long (e.g. 60s, at most 2m) for the state to change. The unchanged state is returned when the time is over.", openapi.String()),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "The state of the space", Body: spaceState{}},
+					{Status: http.StatusBadRequest, Description: "Invalid wait parameter"},
+					unknownSpace,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/badge/{file}",
+			Handler: serveBadge,
+			Operation: openapi.Operation{
+				Summary: "Badge showing whether a space is open, as SVG or PNG",
+				Parameters: []openapi.Parameter{
+					openapi.PathParam("file", "Space id followed by .svg or .png"),
+					openapi.Query("theme", "Color theme of the badge", openapi.Enum("flat", "flat-square", "dark", "light").WithDefault("flat")),
+					openapi.Query("size", "Size of the badge", openapi.Enum("small", "medium", "large").WithDefault("small")),
+					openapi.Query("label", "Text of the left part of the badge, defaults to the space name", openapi.String().WithMaxLength(badgeMaxText)),
+					openapi.Query("lastchange", "Show for how long the space is open or closed", openapi.Boolean().WithDefault(true)),
+					openapi.Query("people", "Show the number of people present", openapi.Boolean().WithDefault(false)),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "The badge", ContentType: "image/svg+xml", Body: openapi.String()},
+					{Status: http.StatusOK, Description: "The badge", ContentType: "image/png", Body: openapi.String().WithFormat("binary")},
+					{Status: http.StatusNotModified, Description: "The badge didn't change"},
+					{Status: http.StatusBadRequest, Description: "Unknown theme or size, or a label or id longer than 64 characters"},
+					{Status: http.StatusNotFound, Description: "Badge for an unknown space"},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/feeds/{name}",
+			Handler: serveFeed,
+			Operation: openapi.Operation{
+				Summary: "Atom or RSS feed of directory changes or of the combined blog and wiki posts of the spaces. The directory feed contains spaces added to or removed from the directory and spaces becoming invalid or valid again",
+				Parameters: []openapi.Parameter{
+					{Name: "name", In: "path", Required: true, Schema: openapi.Enum("directory.atom", "directory.rss", "planet.atom", "planet.rss")},
+					openapi.Query("types", "Comma separated list of event types, overrides the default types of the directory feed", openapi.String()),
+					openapi.Query("ids", "Comma separated list of space ids, only used by the planet feed", openapi.String()),
+					openapi.Query("country", "Comma separated list of country codes, only used by the planet feed", openapi.String()),
+					openapi.Query("feeds", "Comma separated list of feed types, blog or wiki, only used by the planet feed", openapi.List(openapi.Enum("blog", "wiki"))),
+					openapi.Query("since", "Unix timestamp, only newer posts are returned, only used by the planet feed", openapi.Integer()),
+					openapi.Query("limit", "Maximum number of posts to return, larger values are capped at 500, only used by the planet feed", openapi.Integer().WithDefault(defaultPlanetLimit).WithMinimum(1)),
+				},
+				Responses: append(feed,
+					openapi.Response{Status: http.StatusNotFound, Description: "unknown feed or space"},
+					collectorUnavailable,
+					invalidParameter,
+				),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/feeds/spaces/{name}",
+			Handler: serveSpaceFeed,
+			Operation: openapi.Operation{
+				Summary: "Atom or RSS feed of a space opening and closing",
+				Parameters: []openapi.Parameter{
+					openapi.PathParam("name", "Space id followed by .atom or .rss"),
+					openapi.Query("types", "Comma separated list of event types, overrides the default types of the feed", openapi.String()),
+				},
+				Responses: append(feed,
+					openapi.Response{Status: http.StatusNotFound, Description: "unknown feed or space"},
+					collectorUnavailable,
+				),
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/.well-known/webfinger",
+			Handler: serveWebfinger,
+			Operation: openapi.Operation{
+				Summary: "WebFinger lookup of the ActivityPub actor of a space",
+				Parameters: []openapi.Parameter{
+					{Name: "resource", In: "query", Required: true, Schema: openapi.String(), Example: "acct:<space id>@api.spaceapi.io"},
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", ContentType: "application/jrd+json", Body: openapi.Object()},
+					unknownSpace,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/ap/spaces/{id}",
+			Handler: serveActor,
+			Operation: openapi.Operation{
+				Summary:    "ActivityPub actor of a space",
+				Parameters: []openapi.Parameter{spaceId},
+				Responses:  []openapi.Response{activity("successful operation"), unknownSpace},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/ap/spaces/{id}/outbox",
+			Handler: serveOutbox,
+			Operation: openapi.Operation{
+				Summary:    "Notes about the space being added to the directory, opened and closed, newest first",
+				Parameters: []openapi.Parameter{spaceId},
+				Responses:  []openapi.Response{activity("successful operation"), unknownSpace, collectorUnavailable},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/ap/spaces/{id}/followers",
+			Handler: serveFollowers,
+			Operation: openapi.Operation{
+				Summary:    "Followers collection of a space",
+				Parameters: []openapi.Parameter{spaceId},
+				Responses:  []openapi.Response{activity("successful operation"), unknownSpace},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/ap/spaces/{id}/notes/{event}",
+			Handler: serveNote,
+			Operation: openapi.Operation{
+				Summary: "A single note of the outbox of a space",
+				Parameters: []openapi.Parameter{
+					spaceId,
+					{Name: "event", In: "path", Description: "Id of the change event the note is about", Required: true, Schema: openapi.Integer()},
+				},
+				Responses: []openapi.Response{
+					activity("successful operation"),
+					{Status: http.StatusNotFound, Description: "unknown space or note"},
+					collectorUnavailable,
+				},
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/ap/spaces/{id}/inbox",
+			Handler: serveInbox,
+			Operation: openapi.Operation{
+				Summary:     "Inbox accepting Follow and Undo activities signed with http signatures",
+				Parameters:  []openapi.Parameter{spaceId},
+				RequestBody: &openapi.RequestBody{ContentType: activityJsonType, Body: openapi.Object()},
+				Responses: []openapi.Response{
+					{Status: http.StatusAccepted, Description: "activity accepted"},
+					invalidParameter,
+					{Status: http.StatusUnauthorized, Description: "missing or invalid http signature"},
+					unknownSpace,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/cache",
+			Handler: serveCache,
+			Operation: openapi.Operation{
+				Summary:     "The directory as kept by the collector",
+				Description: "Includes the data as published by the spaces and normalized to the latest schema version",
+				Parameters:  []openapi.Parameter{valid, openapi.Query("filter", "jq select filter", openapi.String()), ifNoneMatch},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.Entry{}, Headers: map[string]openapi.Header{"ETag": etag}},
+					notModified,
+					invalidParameter,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/graphql",
+			Handler: serveGraphql,
+			Operation: graphqlOperation(
+				openapi.Query("query", "The GraphQL query", openapi.String()),
+				openapi.Query("operationName", "Operation of the query to execute", openapi.String()),
+				openapi.Query("variables", "JSON encoded variables of the query", openapi.String()),
+			),
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/graphql",
+			Handler: serveGraphql,
+			Operation: func() openapi.Operation {
+				operation := graphqlOperation()
+				operation.RequestBody = &openapi.RequestBody{
+					Required: true,
+					Body:     graphqlRequest{},
+					Example:  map[string]string{"query": "{ spaces(valid: true, first: 10) { totalCount pageInfo { hasNextPage endCursor } nodes { name url state { open } } } }"},
+				}
+				return operation
+			}(),
+		},
+	}
+}
+
+func graphqlOperation(parameters ...openapi.Parameter) openapi.Operation {
+	return openapi.Operation{
+		Summary:    "GraphQL endpoint covering spaces, validation results, location, state, sensors and statistics",
+		Parameters: parameters,
+		Responses: []openapi.Response{
+			{Status: http.StatusOK, Description: "successful operation", Body: openapi.Object()},
+			{Status: http.StatusBadRequest, Description: "the query could not be parsed or exceeds the depth or cost limit", Body: openapi.Object()},
+		},
+	}
+}
+
+// routePattern matches the method and path of a route, GET routes answer
+// HEAD requests as well.
+func routePattern(route openapi.Route) *pat.Pattern {
+	switch route.Method {
+	case http.MethodPost:
+		return pat.Post(route.Pattern())
+	case http.MethodDelete:
+		return pat.Delete(route.Pattern())
+	default:
+		return pat.Get(route.Pattern())
+	}
+}
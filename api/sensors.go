@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type sensorValue struct {
+	SpaceId     string  `json:"spaceId"`
+	Space       string  `json:"space,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	Type        string  `json:"type" description:"Sensor type of the SpaceAPI schema, e.g. temperature or people_now_present"`
+	Property    string  `json:"property,omitempty" description:"Kind of radiation, property of wind and network_traffic sensors or type of network_connections"`
+	Sensor      string  `json:"sensor" description:"Name or location of the sensor, its position if it has neither"`
+	Name        string  `json:"name,omitempty"`
+	Location    string  `json:"location,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Value       float64 `json:"value" description:"Booleans like door_locked are 1 or 0"`
+	Unit        string  `json:"unit,omitempty"`
+	LastChange  int64   `json:"lastchange,omitempty"`
+}
+
+// sensorAggregate summarizes the values of one sensor type, property and
+// unit over all matching spaces.
+type sensorAggregate struct {
+	Type     string  `json:"type"`
+	Property string  `json:"property,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	Count    int     `json:"count"`
+	Spaces   int     `json:"spaces"`
+	Sum      float64 `json:"sum"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+	Avg      float64 `json:"avg"`
+}
+
+type sensorsResponse struct {
+	Sensors    []sensorValue     `json:"sensors"`
+	Aggregates []sensorAggregate `json:"aggregates"`
+}
+
+// serveSensors returns the sensor values of the spaces filtered by type,
+// space id and country, by default converted to a common unit per type.
+func serveSensors(w http.ResponseWriter, r *http.Request) {
+	normalize := true
+	if param := r.URL.Query().Get("normalize"); param != "" {
+		var err error
+		normalize, err = strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "normalize has to be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	readings, err := getSensors()
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	types := listParam(r.URL.Query().Get("types"))
+	ids := listParam(r.URL.Query().Get("ids"))
+	countries := listParam(strings.ToLower(r.URL.Query().Get("country")))
+
+	response := sensorsResponse{Sensors: []sensorValue{}}
+	for _, reading := range readings {
+		if len(types) > 0 && !types[reading.Type] {
+			continue
+		}
+		if len(ids) > 0 && !ids[reading.SpaceId] {
+			continue
+		}
+		if len(countries) > 0 && !countries[strings.ToLower(reading.Country)] {
+			continue
+		}
+
+		value := sensorValue{
+			SpaceId:     reading.SpaceId,
+			Space:       reading.Space,
+			Country:     reading.Country,
+			Type:        reading.Type,
+			Property:    reading.Property,
+			Sensor:      reading.Sensor,
+			Name:        reading.Name,
+			Location:    reading.Location,
+			Description: reading.Description,
+			Value:       reading.Value,
+			Unit:        reading.Unit,
+			LastChange:  reading.LastChange,
+		}
+		if normalize {
+			value.Value = reading.NormalizedValue
+			value.Unit = reading.NormalizedUnit
+		}
+		response.Sensors = append(response.Sensors, value)
+	}
+	response.Aggregates = aggregateSensors(response.Sensors)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// aggregateSensors builds the directory wide aggregates, e.g. the sum of
+// people_now_present is the number of people in all spaces. Values in
+// different units are aggregated separately.
+func aggregateSensors(values []sensorValue) []sensorAggregate {
+	aggregates := make(map[string]*sensorAggregate)
+	spaces := make(map[string]map[string]bool)
+
+	for _, v := range values {
+		key := v.Type + "/" + v.Property + "/" + v.Unit
+		aggregate, ok := aggregates[key]
+		if !ok {
+			aggregate = &sensorAggregate{
+				Type:     v.Type,
+				Property: v.Property,
+				Unit:     v.Unit,
+				Min:      math.Inf(1),
+				Max:      math.Inf(-1),
+			}
+			aggregates[key] = aggregate
+			spaces[key] = make(map[string]bool)
+		}
+
+		aggregate.Count++
+		aggregate.Sum += v.Value
+		aggregate.Min = math.Min(aggregate.Min, v.Value)
+		aggregate.Max = math.Max(aggregate.Max, v.Value)
+		spaces[key][v.SpaceId] = true
+	}
+
+	response := make([]sensorAggregate, 0, len(aggregates))
+	for key, aggregate := range aggregates {
+		aggregate.Spaces = len(spaces[key])
+		aggregate.Avg = aggregate.Sum / float64(aggregate.Count)
+		response = append(response, *aggregate)
+	}
+
+	sort.Slice(response, func(i, j int) bool {
+		a, b := response[i], response[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Property != b.Property {
+			return a.Property < b.Property
+		}
+		return a.Unit < b.Unit
+	})
+
+	return response
+}
+
+func getSensors() ([]spaceapi.SensorReading, error) {
+	var readings []spaceapi.SensorReading
+	resp, err := http.Get(spaceApiCollectorUrl + "/sensors")
+	if err != nil {
+		return readings, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return readings, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return readings, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &readings)
+	return readings, err
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"goji.io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sensorReadings are the readings of two spaces, one of the temperatures is
+// in °F.
+const sensorReadings = `[
+	{"spaceId": "berlin", "country": "de", "type": "temperature", "sensor": "Lounge", "value": 21, "unit": "°C", "normalizedValue": 21, "normalizedUnit": "°C"},
+	{"spaceId": "berlin", "country": "de", "type": "temperature", "sensor": "Workshop", "value": 59, "unit": "°F", "normalizedValue": 15, "normalizedUnit": "°C"},
+	{"spaceId": "berlin", "country": "de", "type": "people_now_present", "sensor": "0", "value": 4, "normalizedValue": 4},
+	{"spaceId": "amsterdam", "country": "nl", "type": "temperature", "sensor": "Hall", "value": 18, "unit": "°C", "normalizedValue": 18, "normalizedUnit": "°C"},
+	{"spaceId": "amsterdam", "country": "nl", "type": "people_now_present", "sensor": "0", "value": 2, "normalizedValue": 2},
+	{"spaceId": "amsterdam", "country": "nl", "type": "wind", "property": "speed", "sensor": "Roof", "value": 36, "unit": "km/h", "normalizedValue": 10, "normalizedUnit": "m/s"}
+]`
+
+func TestSensors(t *testing.T) {
+	failing := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(sensorReadings))
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query   string
+		status  int
+		sensors string
+		values  []float64
+	}{
+		{"", http.StatusOK, "Lounge,Workshop,0,Hall,0,Roof", []float64{21, 15, 4, 18, 2, 10}},
+		{"normalize=false", http.StatusOK, "Lounge,Workshop,0,Hall,0,Roof", []float64{21, 59, 4, 18, 2, 36}},
+		{"types=temperature,wind", http.StatusOK, "Lounge,Workshop,Hall,Roof", []float64{21, 15, 18, 10}},
+		{"ids=amsterdam", http.StatusOK, "Hall,0,Roof", []float64{18, 2, 10}},
+		{"country=DE&types=people_now_present", http.StatusOK, "0", []float64{4}},
+		{"types=humidity", http.StatusOK, "", nil},
+		{"normalize=maybe", http.StatusBadRequest, "", nil},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/sensors?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var response sensorsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		var sensors []string
+		var values []float64
+		for _, sensor := range response.Sensors {
+			sensors = append(sensors, sensor.Sensor)
+			values = append(values, sensor.Value)
+		}
+		if strings.Join(sensors, ",") != test.sensors || !reflect.DeepEqual(values, test.values) {
+			t.Errorf("%s: expected %v with %v, got %v with %v", test.query, test.sensors, test.values, sensors, values)
+		}
+	}
+
+	failing = true
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/sensors", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("expected %d, got %d", http.StatusBadGateway, w.Code)
+	}
+}
+
+func TestAggregateSensors(t *testing.T) {
+	values := []sensorValue{
+		{SpaceId: "berlin", Type: "temperature", Value: 21, Unit: "°C"},
+		{SpaceId: "berlin", Type: "temperature", Value: 15, Unit: "°C"},
+		{SpaceId: "amsterdam", Type: "temperature", Value: 18, Unit: "°C"},
+		{SpaceId: "paris", Type: "temperature", Value: 50, Unit: "°F"},
+		{SpaceId: "berlin", Type: "people_now_present", Value: 4},
+		{SpaceId: "amsterdam", Type: "people_now_present", Value: 2},
+		{SpaceId: "amsterdam", Type: "wind", Property: "speed", Value: 10, Unit: "m/s"},
+		{SpaceId: "amsterdam", Type: "wind", Property: "gust", Value: 15, Unit: "m/s"},
+	}
+
+	expected := []sensorAggregate{
+		{Type: "people_now_present", Count: 2, Spaces: 2, Sum: 6, Min: 2, Max: 4, Avg: 3},
+		{Type: "temperature", Unit: "°C", Count: 3, Spaces: 2, Sum: 54, Min: 15, Max: 21, Avg: 18},
+		{Type: "temperature", Unit: "°F", Count: 1, Spaces: 1, Sum: 50, Min: 50, Max: 50, Avg: 50},
+		{Type: "wind", Property: "gust", Unit: "m/s", Count: 1, Spaces: 1, Sum: 15, Min: 15, Max: 15, Avg: 15},
+		{Type: "wind", Property: "speed", Unit: "m/s", Count: 1, Spaces: 1, Sum: 10, Min: 10, Max: 10, Avg: 10},
+	}
+	if aggregates := aggregateSensors(values); !reflect.DeepEqual(aggregates, expected) {
+		t.Errorf("expected %+v, got %+v", expected, aggregates)
+	}
+
+	if aggregates := aggregateSensors(nil); len(aggregates) != 0 {
+		t.Errorf("expected no aggregates, got %+v", aggregates)
+	}
+	for _, aggregate := range aggregateSensors(values[:1]) {
+		if math.IsInf(aggregate.Min, 0) || math.IsInf(aggregate.Max, 0) {
+			t.Errorf("expected the minimum and maximum of a single value, got %+v", aggregate)
+		}
+	}
+}
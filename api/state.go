@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io/pat"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const maxStateWait = 2 * time.Minute
+
+var (
+	statePollInterval time.Duration
+	spaceStates       = newStateWatcher()
+)
+
+func init() {
+	flag.DurationVar(
+		&statePollInterval,
+		"statePollInterval",
+		15*time.Second,
+		"How often the state of spaces with waiting long-poll requests is checked",
+	)
+}
+
+// spaceState is the minimal state of a space for door displays and bots. The
+// version changes whenever any of the other fields changes.
+type spaceState struct {
+	Id            string   `json:"id"`
+	Open          *bool    `json:"open" description:"Null if the space doesn't publish its state"`
+	LastChange    int64    `json:"lastchange,omitempty" description:"Unix timestamp of the last state change"`
+	Message       string   `json:"message,omitempty"`
+	PeoplePresent *float64 `json:"peoplePresent,omitempty" description:"Sum of the people_now_present sensors"`
+	Version       string   `json:"version" description:"Changes whenever any of the other fields changes"`
+}
+
+func newSpaceState(entry spaceapi.Entry) spaceState {
+	s := spaceState{Id: entry.Id}
+
+	state, _ := entry.Data["state"].(map[string]interface{})
+	if open, ok := state["open"].(bool); ok {
+		s.Open = &open
+	}
+	if lastChange, ok := state["lastchange"].(float64); ok {
+		s.LastChange = int64(lastChange)
+	}
+	s.Message, _ = state["message"].(string)
+
+	for _, sensor := range spaceSensors(entry, "people_now_present") {
+		if value, ok := sensor.Value.(float64); ok {
+			if s.PeoplePresent == nil {
+				s.PeoplePresent = new(float64)
+			}
+			*s.PeoplePresent += value
+		}
+	}
+
+	content, err := json.Marshal(s)
+	if err != nil {
+		panic(err)
+	}
+	hash := sha256.Sum256(content)
+	s.Version = hex.EncodeToString(hash[:8])
+
+	return s
+}
+
+// stateWaiter is a long-poll request waiting for the state of a space to
+// differ from the version it already knows.
+type stateWaiter struct {
+	id      string
+	version string
+	states  chan spaceState
+}
+
+// stateWatcher checks the state of the spaces long-poll requests are waiting
+// for. Open and close events trigger a check right away, other changes like
+// the message are noticed with the next regular check.
+type stateWatcher struct {
+	mutex   sync.Mutex
+	waiters map[*stateWaiter]bool
+}
+
+func newStateWatcher() *stateWatcher {
+	return &stateWatcher{waiters: make(map[*stateWaiter]bool)}
+}
+
+func (s *stateWatcher) add(id string, version string) *stateWaiter {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	waiter := &stateWaiter{id: id, version: version, states: make(chan spaceState, 1)}
+	s.waiters[waiter] = true
+
+	return waiter
+}
+
+func (s *stateWatcher) remove(waiter *stateWaiter) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.waiters, waiter)
+}
+
+func (s *stateWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		events := hub.subscribe()
+		for subscribed := true; subscribed; {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					subscribed = false
+				} else if event.Type == "opened" || event.Type == "closed" {
+					s.check()
+				}
+			case <-ticker.C:
+				s.check()
+			}
+		}
+	}
+}
+
+// check fetches the directory once and wakes up every waiter whose space
+// changed or disappeared in the meantime.
+func (s *stateWatcher) check() {
+	s.mutex.Lock()
+	waiting := len(s.waiters) > 0
+	s.mutex.Unlock()
+	if !waiting {
+		return
+	}
+
+	states := make(map[string]spaceState)
+	for _, entry := range getDirectory(".[]") {
+		states[entry.Id] = newSpaceState(entry)
+	}
+	if len(states) == 0 {
+		// the collector isn't reachable, keep waiting
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for waiter := range s.waiters {
+		state, ok := states[waiter.id]
+		if !ok || state.Version != waiter.version {
+			waiter.states <- state
+			delete(s.waiters, waiter)
+		}
+	}
+}
+
+// serveSpaceState returns the state of a single space. With wait and since
+// the request is held until the version differs from since or the wait time
+// is over, in which case the unchanged state is returned.
+func serveSpaceState(w http.ResponseWriter, r *http.Request) {
+	id := pat.Param(r, "id")
+
+	var wait time.Duration
+	if param := r.URL.Query().Get("wait"); param != "" {
+		var err error
+		wait, err = parseWait(param)
+		if err != nil || wait < 0 {
+			http.Error(w, "wait has to be a duration like 60s", http.StatusBadRequest)
+			return
+		}
+		if wait > maxStateWait {
+			wait = maxStateWait
+		}
+	}
+
+	entry, ok := getSpace(id)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	state := newSpaceState(entry)
+
+	since := r.URL.Query().Get("since")
+	if wait > 0 && since == state.Version {
+		waiter := spaceStates.add(id, since)
+		timeout := time.NewTimer(wait)
+
+		select {
+		case state = <-waiter.states:
+		case <-timeout.C:
+		case <-r.Context().Done():
+		}
+
+		timeout.Stop()
+		spaceStates.remove(waiter)
+	}
+
+	// the space was removed while waiting
+	if state.Id == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+state.Version+`"`)
+	if err := json.NewEncoder(w).Encode(state); err != nil {
+		log.Println(err)
+	}
+}
+
+// parseWait accepts durations like 60s or 2m as well as plain seconds.
+func parseWait(value string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return time.ParseDuration(value)
+}
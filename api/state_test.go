@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewSpaceState(t *testing.T) {
+	data := func(state map[string]interface{}, sensors map[string]interface{}) map[string]interface{} {
+		return map[string]interface{}{"state": state, "sensors": sensors}
+	}
+	people := func(values ...interface{}) map[string]interface{} {
+		var sensors []interface{}
+		for _, value := range values {
+			sensors = append(sensors, map[string]interface{}{"value": value})
+		}
+		return map[string]interface{}{"people_now_present": sensors}
+	}
+
+	for _, test := range []struct {
+		name       string
+		data       map[string]interface{}
+		open       string
+		lastChange int64
+		message    string
+		people     string
+	}{
+		{"open", data(map[string]interface{}{"open": true, "lastchange": 1600000000.0, "message": "until midnight"}, nil), "true", 1600000000, "until midnight", "<nil>"},
+		{"closed", data(map[string]interface{}{"open": false}, nil), "false", 0, "", "<nil>"},
+		{"without state", data(nil, nil), "<nil>", 0, "", "<nil>"},
+		{"unknown state", data(map[string]interface{}{"open": nil}, nil), "<nil>", 0, "", "<nil>"},
+		{"people", data(nil, people(3.0, 2.0)), "<nil>", 0, "", "5"},
+		{"nobody", data(nil, people(0.0)), "<nil>", 0, "", "0"},
+		{"people without values", data(nil, people("many")), "<nil>", 0, "", "<nil>"},
+	} {
+		s := newSpaceState(spaceapi.Entry{Id: "fixture-space", Data: test.data})
+		if s.Id != "fixture-space" || formatPointer(s.Open) != test.open || s.LastChange != test.lastChange ||
+			s.Message != test.message || formatPointer(s.PeoplePresent) != test.people {
+			t.Errorf("%s: unexpected state %+v", test.name, s)
+		}
+		if len(s.Version) != 16 {
+			t.Errorf("%s: expected a version, got %q", test.name, s.Version)
+		}
+	}
+
+	entry := spaceapi.Entry{Id: "fixture-space", Data: data(map[string]interface{}{"open": true, "message": "a"}, nil)}
+	version := newSpaceState(entry).Version
+	if newSpaceState(entry).Version != version {
+		t.Errorf("expected the version of the same state to stay the same")
+	}
+	entry.Data = data(map[string]interface{}{"open": true, "message": "b"}, nil)
+	if newSpaceState(entry).Version == version {
+		t.Errorf("expected the version to change with the message")
+	}
+}
+
+func formatPointer(value interface{}) string {
+	switch v := value.(type) {
+	case *bool:
+		if v != nil {
+			return fmt.Sprint(*v)
+		}
+	case *float64:
+		if v != nil {
+			return fmt.Sprint(*v)
+		}
+	}
+
+	return "<nil>"
+}
+
+func TestParseWait(t *testing.T) {
+	for _, test := range []struct {
+		value string
+		wait  time.Duration
+		valid bool
+	}{
+		{"60", time.Minute, true},
+		{"60s", time.Minute, true},
+		{"2m", 2 * time.Minute, true},
+		{"1m30s", 90 * time.Second, true},
+		{"-5", -5 * time.Second, true},
+		{"soon", 0, false},
+		{"5 minutes", 0, false},
+	} {
+		wait, err := parseWait(test.value)
+		if (err == nil) != test.valid || wait != test.wait {
+			t.Errorf("%s: expected %v and valid %v, got %v and %v", test.value, test.wait, test.valid, wait, err)
+		}
+	}
+}
+
+// stateCollector serves the fixture directory, the message of the fixture
+// space can be changed and the space removed.
+type stateCollector struct {
+	mutex   sync.Mutex
+	message string
+	removed bool
+}
+
+func (c *stateCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "collector", "directory.json"))
+	if err != nil {
+		panic(err)
+	}
+	var directory []map[string]interface{}
+	if err := json.Unmarshal(content, &directory); err != nil {
+		panic(err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var entries []map[string]interface{}
+	for _, entry := range directory {
+		if entry["id"] != "fixture-space" {
+			entries = append(entries, entry)
+			continue
+		}
+		if c.removed {
+			continue
+		}
+		entry["data"].(map[string]interface{})["state"].(map[string]interface{})["message"] = c.message
+		entries = append(entries, entry)
+	}
+
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func (c *stateCollector) change(message string, removed bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.message, c.removed = message, removed
+}
+
+func TestSpaceState(t *testing.T) {
+	directory := &stateCollector{message: "open until midnight"}
+	collector := httptest.NewServer(directory)
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+	get := func(query string) (*httptest.ResponseRecorder, spaceState) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/spaces/fixture-space/state"+query, nil))
+		var state spaceState
+		if w.Code == http.StatusOK {
+			if err := json.Unmarshal(w.Body.Bytes(), &state); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return w, state
+	}
+
+	w, state := get("")
+	if w.Code != http.StatusOK || state.Open == nil || !*state.Open || state.Message != "open until midnight" || formatPointer(state.PeoplePresent) != "3" {
+		t.Fatalf("unexpected state %d %+v", w.Code, state)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"`+state.Version+`"` {
+		t.Errorf("expected the version as etag, got %v", etag)
+	}
+
+	for _, test := range []struct {
+		query  string
+		status int
+	}{
+		{"?wait=soon", http.StatusBadRequest},
+		{"?wait=-5s", http.StatusBadRequest},
+		{"?wait=1m&since=outdated", http.StatusOK},
+		{"?wait=10ms&since=" + state.Version, http.StatusOK},
+	} {
+		start := time.Now()
+		if w, _ := get(test.query); w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.query, test.status, w.Code)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: the request wasn't answered in time", test.query)
+		}
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/spaces/unknown-space/state", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected %d for an unknown space, got %d", http.StatusNotFound, w.Code)
+	}
+
+	// waiting requests are woken up by a change of the space
+	for _, test := range []struct {
+		name    string
+		message string
+		removed bool
+		status  int
+	}{
+		{"changed", "closing soon", false, http.StatusOK},
+		{"removed", "", true, http.StatusNotFound},
+	} {
+		directory.change("open until midnight", false)
+		responses := make(chan *httptest.ResponseRecorder)
+		go func() {
+			w, _ := get("?wait=1m&since=" + state.Version)
+			responses <- w
+		}()
+		for waiting := 0; waiting == 0; time.Sleep(10 * time.Millisecond) {
+			spaceStates.mutex.Lock()
+			waiting = len(spaceStates.waiters)
+			spaceStates.mutex.Unlock()
+		}
+
+		// unchanged spaces keep waiting
+		spaceStates.check()
+		select {
+		case <-responses:
+			t.Fatalf("%s: the request was answered without a change", test.name)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		directory.change(test.message, test.removed)
+		spaceStates.check()
+		select {
+		case w := <-responses:
+			var changed spaceState
+			_ = json.Unmarshal(w.Body.Bytes(), &changed)
+			if w.Code != test.status || (w.Code == http.StatusOK && changed.Message != test.message) {
+				t.Errorf("%s: unexpected response %d %s", test.name, w.Code, w.Body.String())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the request wasn't woken up", test.name)
+		}
+	}
+}
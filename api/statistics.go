@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTrendSeries are charted if no series are requested.
+var defaultTrendSeries = []string{"totals:*", "versions:*"}
+
+// dailyStatistics are the average statistics of the directory on a day as
+// rolled up by the collector.
+type dailyStatistics struct {
+	Date      string             `json:"date"`
+	Snapshots int                `json:"snapshots"`
+	Totals    map[string]float64 `json:"totals"`
+	Validity  map[string]float64 `json:"validity"`
+	Versions  map[string]float64 `json:"versions"`
+	Countries map[string]float64 `json:"countries"`
+	Fields    map[string]float64 `json:"fields"`
+}
+
+func (d dailyStatistics) group(name string) (map[string]float64, bool) {
+	switch name {
+	case "totals":
+		return d.Totals, true
+	case "validity":
+		return d.Validity, true
+	case "versions":
+		return d.Versions, true
+	case "countries":
+		return d.Countries, true
+	case "fields":
+		return d.Fields, true
+	default:
+		return nil, false
+	}
+}
+
+// trendSeries is one value per date of the response, days without a value
+// are 0.
+type trendSeries struct {
+	Name   string    `json:"name"`
+	Values []float64 `json:"values" description:"One value per date, 0 for days without a value"`
+}
+
+type trendsResponse struct {
+	Dates  []string      `json:"dates"`
+	Series []trendSeries `json:"series"`
+}
+
+// serveStatistics passes the statistics of the latest directory snapshot
+// from the collector through.
+func serveStatistics(w http.ResponseWriter, r *http.Request) {
+	proxyCollector(w, r, "/stats")
+}
+
+// serveTrends turns the daily statistics into time series for charting. A
+// series is named by its group and key like versions:15 or fields:/state/open,
+// group:* selects all keys of a group. With relative=true the values are
+// shares of all spaces in percent.
+func serveTrends(w http.ResponseWriter, r *http.Request) {
+	names := defaultTrendSeries
+	if series := r.URL.Query().Get("series"); series != "" {
+		names = strings.Split(series, ",")
+	}
+
+	relative := false
+	if param := r.URL.Query().Get("relative"); param != "" {
+		var err error
+		relative, err = strconv.ParseBool(param)
+		if err != nil {
+			http.Error(w, "relative has to be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	query := url.Values{}
+	for _, param := range []string{"from", "to"} {
+		if value := r.URL.Query().Get(param); value != "" {
+			if _, err := time.Parse("2006-01-02", value); err != nil {
+				http.Error(w, "from and to have to be dates like 2006-01-02", http.StatusBadRequest)
+				return
+			}
+			query.Set(param, value)
+		}
+	}
+
+	days, err := getTrends(query)
+	if err != nil {
+		log.Println(err)
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	response, err := buildTrends(days, names, relative)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+func buildTrends(days []dailyStatistics, names []string, relative bool) (trendsResponse, error) {
+	response := trendsResponse{Dates: []string{}, Series: []trendSeries{}}
+	for _, day := range days {
+		response.Dates = append(response.Dates, day.Date)
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		separator := strings.Index(name, ":")
+		if separator < 0 {
+			return response, errors.New("series have to be named like group:key or group:*")
+		}
+		group, key := name[:separator], name[separator+1:]
+		if _, ok := (dailyStatistics{}).group(group); !ok {
+			return response, fmt.Errorf("unknown group %v, use totals, validity, versions, countries or fields", group)
+		}
+
+		keys := []string{key}
+		if key == "*" {
+			keys = groupKeys(days, group)
+		}
+
+		for _, key := range keys {
+			if seen[group+":"+key] {
+				continue
+			}
+			seen[group+":"+key] = true
+
+			series := trendSeries{Name: group + ":" + key, Values: make([]float64, len(days))}
+			for i, day := range days {
+				values, _ := day.group(group)
+				series.Values[i] = values[key]
+				if relative && day.Totals["spaces"] > 0 {
+					series.Values[i] = math.Round(values[key]/day.Totals["spaces"]*10000) / 100
+				}
+			}
+			response.Series = append(response.Series, series)
+		}
+	}
+
+	return response, nil
+}
+
+// groupKeys returns the sorted keys of a group over all days.
+func groupKeys(days []dailyStatistics, group string) []string {
+	seen := make(map[string]bool)
+	for _, day := range days {
+		values, _ := day.group(group)
+		for key := range values {
+			seen[key] = true
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func getTrends(query url.Values) ([]dailyStatistics, error) {
+	var days []dailyStatistics
+	resp, err := http.Get(spaceApiCollectorUrl + "/trends?" + query.Encode())
+	if err != nil {
+		return days, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			panic(err)
+		}
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return days, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return days, fmt.Errorf("collector responded with %v: %s", resp.StatusCode, body)
+	}
+
+	err = json.Unmarshal(body, &days)
+	return days, err
+}
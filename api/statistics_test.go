@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestStatisticsArePassedThrough(t *testing.T) {
+	collector := newFixtureCollector()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/stats", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expected the statistics as json, got %d %v", w.Code, w.Header().Get("Content-Type"))
+	}
+	var statistics spaceapi.Statistics
+	if err := json.Unmarshal(w.Body.Bytes(), &statistics); err != nil {
+		t.Fatal(err)
+	}
+	if statistics.Countries["de"] != 1 || statistics.Fields["/space"] != 2 {
+		t.Errorf("expected the statistics of the collector, got %+v", statistics)
+	}
+
+	// the collector responds with its own status or not at all
+	for _, test := range []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"error", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}, http.StatusServiceUnavailable},
+		{"unreachable", nil, http.StatusBadGateway},
+	} {
+		collector.Close()
+		collector = httptest.NewServer(test.handler)
+		if test.handler == nil {
+			collector.Close()
+		}
+		spaceApiCollectorUrl = collector.URL
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/stats", nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d", test.name, test.status, w.Code)
+		}
+	}
+	collector.Close()
+}
+
+func TestBuildTrends(t *testing.T) {
+	days := []dailyStatistics{
+		{Date: "2024-01-01", Totals: map[string]float64{"spaces": 4}, Versions: map[string]float64{"14": 3, "15": 1}},
+		{Date: "2024-01-02", Totals: map[string]float64{"spaces": 5}, Versions: map[string]float64{"14": 2, "15": 2, "16": 1}},
+		{Date: "2024-01-03", Versions: map[string]float64{"15": 1}},
+	}
+
+	for _, test := range []struct {
+		name     string
+		series   []string
+		relative bool
+		expected []trendSeries
+		err      string
+	}{
+		{"single", []string{"versions:15"}, false, []trendSeries{{"versions:15", []float64{1, 2, 1}}}, ""},
+		{"missing days are 0", []string{"versions:16"}, false, []trendSeries{{"versions:16", []float64{0, 1, 0}}}, ""},
+		{"all keys", []string{"versions:*"}, false, []trendSeries{
+			{"versions:14", []float64{3, 2, 0}},
+			{"versions:15", []float64{1, 2, 1}},
+			{"versions:16", []float64{0, 1, 0}},
+		}, ""},
+		{"duplicates", []string{"versions:15", " versions:*", "versions:15"}, false, []trendSeries{
+			{"versions:15", []float64{1, 2, 1}},
+			{"versions:14", []float64{3, 2, 0}},
+			{"versions:16", []float64{0, 1, 0}},
+		}, ""},
+		// days without a total keep their absolute values
+		{"relative", []string{"versions:14", "totals:spaces"}, true, []trendSeries{
+			{"versions:14", []float64{75, 40, 0}},
+			{"totals:spaces", []float64{100, 100, 0}},
+		}, ""},
+		{"unknown key", []string{"countries:nl"}, false, []trendSeries{{"countries:nl", []float64{0, 0, 0}}}, ""},
+		{"empty group", []string{"fields:*"}, false, []trendSeries{}, ""},
+		{"without key", []string{"versions"}, false, nil, "series have to be named like group:key or group:*"},
+		{"unknown group", []string{"sensors:*"}, false, nil, "unknown group sensors, use totals, validity, versions, countries or fields"},
+	} {
+		response, err := buildTrends(days, test.series, test.relative)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s: expected the error %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(response.Dates, []string{"2024-01-01", "2024-01-02", "2024-01-03"}) {
+			t.Errorf("%s: unexpected dates %v", test.name, response.Dates)
+		}
+		if !reflect.DeepEqual(response.Series, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, response.Series)
+		}
+	}
+}
+
+func TestTrends(t *testing.T) {
+	var mutex sync.Mutex
+	var query url.Values
+	failing := false
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		query = r.URL.Query()
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		serveCollectorFixture(w, r)
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		query   string
+		failing bool
+		status  int
+		series  int
+		asked   string
+	}{
+		{"", false, http.StatusOK, 6, ""},
+		{"series=countries:de&from=2024-01-01&to=2024-12-31", false, http.StatusOK, 1, "from=2024-01-01&to=2024-12-31"},
+		{"series=countries:*&relative=true", false, http.StatusOK, 1, ""},
+		{"relative=maybe", false, http.StatusBadRequest, 0, ""},
+		{"from=yesterday", false, http.StatusBadRequest, 0, ""},
+		{"series=sensors:*", false, http.StatusBadRequest, 0, ""},
+		{"", true, http.StatusBadGateway, 0, ""},
+	} {
+		mutex.Lock()
+		query, failing = nil, test.failing
+		mutex.Unlock()
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2/trends?"+test.query, nil))
+		if w.Code != test.status {
+			t.Errorf("%s: expected %d, got %d: %s", test.query, test.status, w.Code, w.Body.String())
+			continue
+		}
+		if w.Code != http.StatusOK {
+			continue
+		}
+
+		var response trendsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Series) != test.series {
+			t.Errorf("%s: expected %d series, got %v", test.query, test.series, response.Series)
+		}
+		mutex.Lock()
+		if query.Encode() != test.asked {
+			t.Errorf("%s: expected the collector to be asked for %q, got %q", test.query, test.asked, query.Encode())
+		}
+		mutex.Unlock()
+	}
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	subscriberBuffer = 256
+	maxReplayLimit   = 5000
+)
+
+var (
+	streamPollInterval time.Duration
+	streamHeartbeat    time.Duration
+	hub                = newChangeHub()
+)
+
+func init() {
+	flag.DurationVar(
+		&streamPollInterval,
+		"streamPollInterval",
+		5*time.Second,
+		"How often the collector is asked for new change events",
+	)
+
+	flag.DurationVar(
+		&streamHeartbeat,
+		"streamHeartbeat",
+		15*time.Second,
+		"Interval of keepalive messages on open streams",
+	)
+}
+
+// changeHub polls the change feed of the collector and fans the events out to
+// all subscribers. Subscribers that don't keep up are dropped, their channel
+// gets closed and they have to resume from the last event they've seen.
+type changeHub struct {
+	mutex       sync.Mutex
+	subscribers map[chan spaceapi.ChangeEvent]bool
+	cursor      string
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{subscribers: make(map[chan spaceapi.ChangeEvent]bool)}
+}
+
+func (h *changeHub) subscribe() chan spaceapi.ChangeEvent {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	events := make(chan spaceapi.ChangeEvent, subscriberBuffer)
+	h.subscribers[events] = true
+
+	return events
+}
+
+func (h *changeHub) unsubscribe(events chan spaceapi.ChangeEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if h.subscribers[events] {
+		delete(h.subscribers, events)
+		close(events)
+	}
+}
+
+func (h *changeHub) publish(event spaceapi.ChangeEvent) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for events := range h.subscribers {
+		select {
+		case events <- event:
+		default:
+			delete(h.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+func (h *changeHub) run(interval time.Duration) {
+	for {
+		if err := h.poll(); err != nil {
+			log.Println(err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+func (h *changeHub) poll() error {
+	if h.cursor == "" {
+		// start with the events happening from now on
+		changes, err := getChanges(changesQuery{Since: strconv.FormatInt(time.Now().Unix(), 10), Limit: 1})
+		if err != nil {
+			return err
+		}
+		h.cursor = changes.Cursor
+		return nil
+	}
+
+	for {
+		changes, err := getChanges(changesQuery{Since: h.cursor, Limit: maxReplayLimit})
+		if err != nil {
+			return err
+		}
+		if changes.Truncated {
+			log.Println("change events were dropped before they could be streamed")
+		}
+
+		for _, event := range changes.Events {
+			h.publish(event)
+		}
+		h.cursor = changes.Cursor
+
+		if !changes.HasMore {
+			return nil
+		}
+	}
+}
+
+// eventFilter selects the events a client is interested in, an empty filter
+// matches every event.
+type eventFilter struct {
+	countries map[string]bool
+	ids       map[string]bool
+	types     map[string]bool
+}
+
+func newEventFilter(query url.Values) eventFilter {
+	return eventFilter{
+		countries: listParam(strings.ToLower(query.Get("country"))),
+		ids:       listParam(query.Get("ids")),
+		types:     listParam(query.Get("types")),
+	}
+}
+
+func (f eventFilter) matches(event spaceapi.ChangeEvent) bool {
+	if len(f.countries) > 0 && !f.countries[strings.ToLower(event.Country)] {
+		return false
+	}
+	if len(f.ids) > 0 && !f.ids[event.SpaceId] {
+		return false
+	}
+	if len(f.types) > 0 && !f.types[event.Type] {
+		return false
+	}
+
+	return true
+}
+
+func listParam(value string) map[string]bool {
+	values := make(map[string]bool)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values[v] = true
+		}
+	}
+
+	return values
+}
+
+// serveStream pushes change events as server sent events. The id of every
+// event is a change feed cursor, so reconnecting clients that send the
+// Last-Event-ID header get the events they missed replayed.
+func serveStream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := newEventFilter(r.URL.Query())
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "retry: %d\n\n", (streamPollInterval * 2).Milliseconds())
+	flusher.Flush()
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("lastEventId")
+	}
+
+	var lastId int64
+	if lastEventId != "" {
+		for {
+			changes, err := getChanges(changesQuery{Since: lastEventId, Limit: maxReplayLimit})
+			if err != nil {
+				log.Println(err)
+				break
+			}
+			for _, event := range changes.Events {
+				lastId = event.Id
+				if filter.matches(event) {
+					writeServerSentEvent(w, event)
+				}
+			}
+			lastEventId = changes.Cursor
+			if !changes.HasMore {
+				break
+			}
+		}
+		flusher.Flush()
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if event.Id <= lastId || !filter.matches(event) {
+				continue
+			}
+			writeServerSentEvent(w, event)
+			flusher.Flush()
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, event spaceapi.ChangeEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.Cursor, event.Type, data)
+}
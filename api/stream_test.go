@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// changeFeedPageSize makes the fake change feed page with fewer events than
+// requested.
+const changeFeedPageSize = 2
+
+// changeFeed serves /changes of the collector from a list of events, the
+// cursors are "event:<id>".
+type changeFeed struct {
+	mutex  sync.Mutex
+	events []spaceapi.ChangeEvent
+}
+
+func (f *changeFeed) add(events ...spaceapi.ChangeEvent) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for _, event := range events {
+		event.Id = int64(len(f.events) + 1)
+		event.Cursor = "event:" + strconv.FormatInt(event.Id, 10)
+		f.events = append(f.events, event)
+	}
+}
+
+func (f *changeFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	since := r.URL.Query().Get("since")
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > changeFeedPageSize {
+		limit = changeFeedPageSize
+	}
+
+	response := spaceapi.ChangesResponse{Events: []spaceapi.ChangeEvent{}, Cursor: "event:" + strconv.Itoa(len(f.events))}
+	timestamp, timeErr := strconv.ParseInt(since, 10, 64)
+	eventId, _ := strconv.ParseInt(strings.TrimPrefix(since, "event:"), 10, 64)
+	for _, event := range f.events {
+		if (timeErr == nil && event.Time <= timestamp) || (timeErr != nil && event.Id <= eventId) {
+			continue
+		}
+		if len(response.Events) == limit {
+			response.HasMore = true
+			break
+		}
+		response.Events = append(response.Events, event)
+		response.Cursor = event.Cursor
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// readServerSentEvents returns the ids of the next count events of a stream.
+func readServerSentEvents(t *testing.T, scanner *bufio.Scanner, count int) []string {
+	var ids []string
+	for len(ids) < count && scanner.Scan() {
+		if id := strings.TrimPrefix(scanner.Text(), "id: "); id != scanner.Text() {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) < count {
+		t.Fatalf("the stream ended after %v: %v", ids, scanner.Err())
+	}
+
+	return ids
+}
+
+func TestStreamReplaysMissedEvents(t *testing.T) {
+	feed := &changeFeed{}
+	feed.add(
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened, SpaceId: "a"},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened, SpaceId: "b"},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeClosed, SpaceId: "a"},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened, SpaceId: "a"},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeClosed, SpaceId: "b"},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened, SpaceId: "b"},
+	)
+	collector := httptest.NewServer(feed)
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	server := httptest.NewServer(http.HandlerFunc(serveStream))
+	defer server.Close()
+
+	for _, test := range []struct {
+		name     string
+		query    string
+		header   string
+		replayed string
+	}{
+		{"header", "", "event:2", "event:3,event:4,event:5,event:6"},
+		{"query", "?lastEventId=event:2", "", "event:3,event:4,event:5,event:6"},
+		{"filtered", "?types=opened", "event:1", "event:2,event:4,event:6"},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		request, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+test.query, nil)
+		if test.header != "" {
+			request.Header.Set("Last-Event-ID", test.header)
+		}
+		resp, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scanner := bufio.NewScanner(resp.Body)
+
+		replayed := readServerSentEvents(t, scanner, strings.Count(test.replayed, ",")+1)
+		if strings.Join(replayed, ",") != test.replayed {
+			t.Errorf("%s: expected %v to be replayed, got %v", test.name, test.replayed, replayed)
+		}
+
+		// events of the hub that were already replayed aren't sent again
+		hub.publish(spaceapi.ChangeEvent{Id: 6, Cursor: "event:6", Type: spaceapi.ChangeOpened})
+		hub.publish(spaceapi.ChangeEvent{Id: 7, Cursor: "event:7", Type: spaceapi.ChangeClosed})
+		hub.publish(spaceapi.ChangeEvent{Id: 8, Cursor: "event:8", Type: spaceapi.ChangeOpened})
+		live := "event:7,event:8"
+		if test.name == "filtered" {
+			live = "event:8"
+		}
+		if ids := readServerSentEvents(t, scanner, strings.Count(live, ",")+1); strings.Join(ids, ",") != live {
+			t.Errorf("%s: expected %v to be streamed, got %v", test.name, live, ids)
+		}
+
+		cancel()
+		_ = resp.Body.Close()
+	}
+}
+
+func TestEventFilter(t *testing.T) {
+	event := spaceapi.ChangeEvent{SpaceId: "fixture-space", Country: "DE", Type: spaceapi.ChangeOpened}
+	for _, test := range []struct {
+		query   string
+		matches bool
+	}{
+		{"", true},
+		{"country=de", true},
+		{"country=nl,DE", true},
+		{"country=nl", false},
+		{"ids=other,fixture-space", true},
+		{"ids=other", false},
+		{"types=opened,closed", true},
+		{"types=closed", false},
+		{"country=de&ids=fixture-space&types=opened", true},
+		{"country=de&ids=fixture-space&types=closed", false},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/v2/stream?"+test.query, nil)
+		if matches := newEventFilter(request.URL.Query()).matches(event); matches != test.matches {
+			t.Errorf("%s: expected %v, got %v", test.query, test.matches, matches)
+		}
+	}
+}
+
+func TestChangeHubDropsSlowSubscribers(t *testing.T) {
+	h := newChangeHub()
+	fast := h.subscribe()
+	slow := h.subscribe()
+
+	for i := 0; i <= subscriberBuffer; i++ {
+		h.publish(spaceapi.ChangeEvent{Id: int64(i + 1)})
+		<-fast
+	}
+
+	received := 0
+	for range slow {
+		received++
+	}
+	if received != subscriberBuffer {
+		t.Errorf("expected the buffered %d events before the channel was closed, got %d", subscriberBuffer, received)
+	}
+
+	h.publish(spaceapi.ChangeEvent{Id: subscriberBuffer + 2})
+	if event := <-fast; event.Id != subscriberBuffer+2 {
+		t.Errorf("expected the subscriber keeping up to get the next event, got %d", event.Id)
+	}
+
+	// unsubscribing a dropped subscriber doesn't close its channel again
+	h.unsubscribe(slow)
+	h.unsubscribe(fast)
+	if _, ok := <-fast; ok {
+		t.Errorf("expected the channel to be closed")
+	}
+}
+
+func TestChangeHubPollsNewEvents(t *testing.T) {
+	feed := &changeFeed{}
+	feed.add(spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened, Time: time.Now().Add(-time.Hour).Unix()})
+	collector := httptest.NewServer(feed)
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	h := newChangeHub()
+	events := h.subscribe()
+
+	// the first poll only finds the position of the newest event
+	if err := h.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("expected no events to be published, got %d", len(events))
+	}
+
+	feed.add(
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeClosed},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeOpened},
+		spaceapi.ChangeEvent{Type: spaceapi.ChangeClosed},
+	)
+	if err := h.poll(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []int64{2, 3, 4} {
+		if event := <-events; event.Id != id {
+			t.Errorf("expected event %d, got %d", id, event.Id)
+		}
+	}
+	if h.cursor != "event:4" {
+		t.Errorf("expected the cursor to be at the last event, got %v", h.cursor)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// unrepresentableFieldsHeader lists the fields that were dropped converting
+// data to an older version, comma separated in the notation of the field
+// statistics.
+const unrepresentableFieldsHeader = "X-SpaceAPI-Unrepresentable-Fields"
+
+// unconvertedSpacesHeader lists the ids of the spaces the collector couldn't
+// normalize, comma separated. Their data is returned as published instead
+// of in the requested version.
+const unconvertedSpacesHeader = "X-SpaceAPI-Unconverted-Spaces"
+
+// versionConverters turn data normalized to the latest version into the
+// layout of an older one and return the fields they had to drop.
+var versionConverters = map[string]func(data map[string]interface{}) []string{
+	"15":   func(data map[string]interface{}) []string { return nil },
+	"14":   convertTo14,
+	"0.13": convertTo13,
+}
+
+// dataOptions select which form of the space data is returned.
+type dataOptions struct {
+	raw     bool
+	version string
+}
+
+func parseDataOptions(query url.Values) (dataOptions, error) {
+	var options dataOptions
+
+	if param := query.Get("raw"); param != "" {
+		var err error
+		options.raw, err = strconv.ParseBool(param)
+		if err != nil {
+			return options, errors.New("raw has to be true or false")
+		}
+	}
+
+	options.version = query.Get("version")
+	if options.version != "" {
+		if _, ok := versionConverters[options.version]; !ok {
+			return options, errors.New("version has to be 0.13, 14 or 15")
+		}
+		if options.raw {
+			return options, errors.New("raw data can't be converted to another version")
+		}
+	}
+
+	return options, nil
+}
+
+// data returns the data of an entry as selected by the options together
+// with the fields that couldn't be represented in the requested version.
+// Entries the collector couldn't normalize fall back to the raw data, the
+// last result is false for them.
+func (o dataOptions) data(e spaceapi.Entry) (map[string]interface{}, []string, bool) {
+	if o.raw || e.Data == nil {
+		return e.Data, nil, true
+	}
+	if e.Normalized == nil {
+		return e.Data, nil, false
+	}
+
+	data, err := e.Normalized.Map()
+	if err != nil {
+		log.Println(err)
+		return e.Data, nil, false
+	}
+	if o.version == "" {
+		return data, nil, true
+	}
+
+	return data, versionConverters[o.version](data), true
+}
+
+// setUnrepresentableFields adds the header if any fields were dropped.
+func setUnrepresentableFields(w http.ResponseWriter, fields map[string]bool) {
+	if len(fields) == 0 {
+		return
+	}
+
+	list := make([]string, 0, len(fields))
+	for field := range fields {
+		list = append(list, field)
+	}
+	sort.Strings(list)
+	w.Header().Set(unrepresentableFieldsHeader, strings.Join(list, ", "))
+}
+
+// setUnconvertedSpaces adds the header if the data of any space is returned
+// as published.
+func setUnconvertedSpaces(w http.ResponseWriter, ids []string) {
+	if len(ids) == 0 {
+		return
+	}
+
+	sort.Strings(ids)
+	w.Header().Set(unconvertedSpacesHeader, strings.Join(ids, ", "))
+}
+
+// convertTo14 drops the fields introduced in 15.
+func convertTo14(data map[string]interface{}) []string {
+	data["api_compatibility"] = []interface{}{"14"}
+
+	var dropped []string
+	dropped = dropField(dropped, data, "/linked_spaces")
+	dropped = dropField(dropped, data, "/location/country_code")
+	dropped = dropField(dropped, data, "/location/hint")
+	dropped = dropField(dropped, data, "/location/areas")
+
+	return dropped
+}
+
+// convertTo13 drops the fields introduced in 14 and 15, moves the ones that
+// were renamed back to their old name and derives the issue report channels
+// 0.13 requires from the contact. The general contact isn't an issue_mail,
+// so email is listed as a channel instead.
+func convertTo13(data map[string]interface{}) []string {
+	dropped := convertTo14(data)
+	delete(data, "api_compatibility")
+	data["api"] = "0.13"
+
+	dropped = dropField(dropped, data, "/location/timezone")
+	dropped = dropField(dropped, data, "/links")
+	dropped = dropField(dropped, data, "/membership_plans")
+	dropped = dropField(dropped, data, "/contact/mastodon")
+	dropped = dropField(dropped, data, "/contact/matrix")
+	dropped = dropField(dropped, data, "/sensors/carbondioxide")
+	dropped = dropField(dropped, data, "/sensors/power_generation")
+	dropped = dropField(dropped, data, "/sensors/network_traffic")
+
+	if contact, ok := data["contact"].(map[string]interface{}); ok {
+		if xmpp, ok := contact["xmpp"]; ok {
+			contact["jabber"] = xmpp
+			delete(contact, "xmpp")
+		}
+
+		if keymasters, ok := contact["keymasters"].([]interface{}); ok {
+			for _, keymaster := range keymasters {
+				if keymaster, ok := keymaster.(map[string]interface{}); ok {
+					for _, field := range []string{"xmpp", "mastodon", "matrix"} {
+						if _, ok := keymaster[field]; ok {
+							delete(keymaster, field)
+							dropped = appendMissing(dropped, "/contact/keymasters[]/"+field)
+						}
+					}
+				}
+			}
+		}
+
+		var channels []interface{}
+		for _, channel := range []string{"email", "twitter", "ml"} {
+			if _, ok := contact[channel]; ok {
+				channels = append(channels, channel)
+			}
+		}
+		if len(channels) > 0 {
+			data["issue_report_channels"] = channels
+		}
+	}
+
+	if sensors, ok := data["sensors"].(map[string]interface{}); ok {
+		for sensorType, values := range sensors {
+			dropped = dropSensorLastChange(dropped, "/sensors/"+sensorType, values)
+		}
+	}
+
+	return dropped
+}
+
+// dropSensorLastChange removes lastchange from all sensors of a type, the
+// radiation sensors are nested one level deeper.
+func dropSensorLastChange(dropped []string, path string, values interface{}) []string {
+	switch values := values.(type) {
+	case map[string]interface{}:
+		for name, nested := range values {
+			dropped = dropSensorLastChange(dropped, path+"/"+name, nested)
+		}
+	case []interface{}:
+		for _, sensor := range values {
+			if sensor, ok := sensor.(map[string]interface{}); ok {
+				if _, ok := sensor["lastchange"]; ok {
+					delete(sensor, "lastchange")
+					dropped = appendMissing(dropped, path+"[]/lastchange")
+				}
+			}
+		}
+	}
+
+	return dropped
+}
+
+// dropField removes the field at path and records it if it was set.
+func dropField(dropped []string, data map[string]interface{}, path string) []string {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	parent := data
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := parent[part].(map[string]interface{})
+		if !ok {
+			return dropped
+		}
+		parent = next
+	}
+
+	last := parts[len(parts)-1]
+	if _, ok := parent[last]; !ok {
+		return dropped
+	}
+	delete(parent, last)
+
+	return append(dropped, path)
+}
+
+func appendMissing(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+
+	return append(list, value)
+}
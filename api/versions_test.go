@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// unconvertedDirectory has a space the collector couldn't normalize next to
+// one it could.
+const unconvertedDirectory = `[
+	{"id": "fixture-space", "url": "https://fixture.example/space.json", "valid": true,
+	 "data": {"api_compatibility": ["14"], "space": "Fixture Space", "contact": {"xmpp": "space@fixture.example"}},
+	 "normalized": {"api_compatibility": ["15"], "space": "Fixture Space", "logo": "", "url": "", "contact": {"xmpp": "space@fixture.example"}}},
+	{"id": "broken-space", "url": "https://broken.example/space.json", "valid": true,
+	 "data": {"api_compatibility": ["14"], "space": "Broken Space", "contact": {"xmpp": "space@broken.example"}}}
+]`
+
+func TestDataFallsBackToTheRawData(t *testing.T) {
+	data := map[string]interface{}{"space": "Broken Space"}
+	for _, test := range []struct {
+		name      string
+		options   dataOptions
+		entry     spaceapi.Entry
+		converted bool
+	}{
+		{"not normalized", dataOptions{}, spaceapi.Entry{Data: data}, false},
+		{"not normalized with version", dataOptions{version: "0.13"}, spaceapi.Entry{Data: data}, false},
+		{"raw", dataOptions{raw: true}, spaceapi.Entry{Data: data}, true},
+		{"without data", dataOptions{version: "0.13"}, spaceapi.Entry{}, true},
+		{"normalized", dataOptions{version: "0.13"}, spaceapi.Entry{Data: data, Normalized: &spaceapi.Space{Space: "Broken Space"}}, true},
+	} {
+		if _, _, converted := test.options.data(test.entry); converted != test.converted {
+			t.Errorf("%s: expected converted to be %v", test.name, test.converted)
+		}
+	}
+}
+
+func TestUnconvertedSpacesAreMarked(t *testing.T) {
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(unconvertedDirectory))
+	}))
+	defer collector.Close()
+	spaceApiCollectorUrl = collector.URL
+
+	mux := goji.NewMux()
+	handleRoutes(mux, newSpec())
+
+	for _, test := range []struct {
+		path        string
+		unconverted string
+	}{
+		{"/v2?includeData=true&version=0.13", "broken-space"},
+		{"/v2?includeData=true", "broken-space"},
+		{"/v2?includeData=true&raw=true", ""},
+		{"/v2?version=0.13", ""},
+		{"/v2/spaces/broken-space?version=0.13", "broken-space"},
+		{"/v2/spaces/fixture-space?version=0.13", ""},
+	} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s responded with %d: %s", test.path, w.Code, w.Body.String())
+		}
+		if header := w.Header().Get(unconvertedSpacesHeader); header != test.unconverted {
+			t.Errorf("%s: expected %q, got %q", test.path, test.unconverted, header)
+		}
+	}
+
+	// the converted space is in the layout of 0.13, the other one as published
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v2?includeData=true&version=0.13", nil))
+	var entries []spaceapi.ListedEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &entries); err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		contact, _ := entry.Data["contact"].(map[string]interface{})
+		switch entry.Id {
+		case "fixture-space":
+			if contact["jabber"] != "space@fixture.example" {
+				t.Errorf("the space wasn't converted: %v", entry.Data)
+			}
+		case "broken-space":
+			if contact["xmpp"] != "space@broken.example" {
+				t.Errorf("the raw data wasn't returned: %v", entry.Data)
+			}
+		}
+	}
+}
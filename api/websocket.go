@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	wsWriteTimeout    = 10 * time.Second
+	wsPongTimeout     = 60 * time.Second
+	wsPingInterval    = 45 * time.Second
+	wsMaxMessageSize  = 4096
+	wsRepliesBuffered = 16
+)
+
+var (
+	wsMaxConnections   int
+	wsMaxSubscriptions int
+	wsConnections      int64
+	wsUpgrader         = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			return true
+		},
+	}
+)
+
+func init() {
+	flag.IntVar(
+		&wsMaxConnections,
+		"wsMaxConnections",
+		1000,
+		"Maximum number of concurrent websocket connections",
+	)
+
+	flag.IntVar(
+		&wsMaxSubscriptions,
+		"wsMaxSubscriptions",
+		100,
+		"Maximum number of subscriptions per websocket connection",
+	)
+}
+
+// wsRequest is sent by clients to subscribe to or unsubscribe from the events
+// of a space, of all spaces in a country or of all spaces in a bounding box.
+type wsRequest struct {
+	Action  string    `json:"action"`
+	Ref     string    `json:"ref,omitempty"`
+	Id      string    `json:"id,omitempty"`
+	Country string    `json:"country,omitempty"`
+	Bbox    []float64 `json:"bbox,omitempty"`
+	Types   []string  `json:"types,omitempty"`
+}
+
+type wsResponse struct {
+	Type         string                `json:"type"`
+	Ref          string                `json:"ref,omitempty"`
+	Subscription string                `json:"subscription,omitempty"`
+	Message      string                `json:"message,omitempty"`
+	Event        *spaceapi.ChangeEvent `json:"event,omitempty"`
+}
+
+type wsSubscription struct {
+	id      string
+	country string
+	// bbox is min longitude, min latitude, max longitude, max latitude
+	bbox  []float64
+	types map[string]bool
+}
+
+func newWsSubscription(request wsRequest) (wsSubscription, error) {
+	subscription := wsSubscription{
+		id:      request.Id,
+		country: strings.ToLower(request.Country),
+		bbox:    request.Bbox,
+		types:   make(map[string]bool),
+	}
+	for _, t := range request.Types {
+		subscription.types[t] = true
+	}
+
+	criteria := 0
+	for _, set := range []bool{subscription.id != "", subscription.country != "", subscription.bbox != nil} {
+		if set {
+			criteria++
+		}
+	}
+	if criteria != 1 {
+		return subscription, errors.New("exactly one of id, country or bbox is required")
+	}
+	if subscription.bbox != nil && len(subscription.bbox) != 4 {
+		return subscription, errors.New("bbox has to be [minLon, minLat, maxLon, maxLat]")
+	}
+
+	return subscription, nil
+}
+
+func (s wsSubscription) key() string {
+	switch {
+	case s.id != "":
+		return "id:" + s.id
+	case s.country != "":
+		return "country:" + s.country
+	default:
+		return fmt.Sprintf("bbox:%v,%v,%v,%v", s.bbox[0], s.bbox[1], s.bbox[2], s.bbox[3])
+	}
+}
+
+func (s wsSubscription) matches(event spaceapi.ChangeEvent) bool {
+	if len(s.types) > 0 && !s.types[event.Type] {
+		return false
+	}
+
+	switch {
+	case s.id != "":
+		return event.SpaceId == s.id
+	case s.country != "":
+		return strings.ToLower(event.Country) == s.country
+	default:
+		return event.Lat != nil && event.Lon != nil &&
+			*event.Lon >= s.bbox[0] && *event.Lat >= s.bbox[1] &&
+			*event.Lon <= s.bbox[2] && *event.Lat <= s.bbox[3]
+	}
+}
+
+type wsSubscriptions struct {
+	mutex         sync.Mutex
+	subscriptions map[string]wsSubscription
+}
+
+func (s *wsSubscriptions) add(subscription wsSubscription) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.subscriptions[subscription.key()]; !ok && len(s.subscriptions) >= wsMaxSubscriptions {
+		return fmt.Errorf("a connection can't have more than %d subscriptions", wsMaxSubscriptions)
+	}
+	s.subscriptions[subscription.key()] = subscription
+
+	return nil
+}
+
+func (s *wsSubscriptions) remove(key string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.subscriptions[key]
+	delete(s.subscriptions, key)
+
+	return ok
+}
+
+func (s *wsSubscriptions) matches(event spaceapi.ChangeEvent) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, subscription := range s.subscriptions {
+		if subscription.matches(event) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// serveWebsocket upgrades the connection and forwards the change events
+// matching the subscriptions of the client. All writes happen on this
+// goroutine, a connection that can't keep up with the events is closed.
+func serveWebsocket(w http.ResponseWriter, r *http.Request) {
+	if atomic.AddInt64(&wsConnections, 1) > int64(wsMaxConnections) {
+		atomic.AddInt64(&wsConnections, -1)
+		http.Error(w, "too many websocket connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer atomic.AddInt64(&wsConnections, -1)
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer func() {
+		err := conn.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	subscriptions := &wsSubscriptions{subscriptions: make(map[string]wsSubscription)}
+	replies := make(chan wsResponse, wsRepliesBuffered)
+	done := make(chan struct{})
+	go readWebsocket(conn, subscriptions, replies, done)
+
+	events := hub.subscribe()
+	defer hub.unsubscribe(events)
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case reply := <-replies:
+			if err := writeWebsocket(conn, reply); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				closeWebsocket(conn, websocket.CloseTryAgainLater, "client is not keeping up with the events")
+				return
+			}
+			if !subscriptions.matches(event) {
+				continue
+			}
+			if err := writeWebsocket(conn, wsResponse{Type: "event", Event: &event}); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func readWebsocket(conn *websocket.Conn, subscriptions *wsSubscriptions, replies chan<- wsResponse, done chan<- struct{}) {
+	defer close(done)
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongTimeout))
+	})
+
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var request wsRequest
+		response := wsResponse{Type: "error", Message: "invalid message"}
+		if err := json.Unmarshal(message, &request); err == nil {
+			response = handleWsRequest(request, subscriptions)
+		}
+
+		if !reply(replies, response) {
+			return
+		}
+	}
+}
+
+// reply queues a response for the writer, a client flooding us with requests
+// without reading the replies is disconnected.
+func reply(replies chan<- wsResponse, response wsResponse) bool {
+	select {
+	case replies <- response:
+		return true
+	default:
+		return false
+	}
+}
+
+func handleWsRequest(request wsRequest, subscriptions *wsSubscriptions) wsResponse {
+	subscription, err := newWsSubscription(request)
+	if request.Action != "subscribe" && request.Action != "unsubscribe" {
+		err = errors.New("action has to be subscribe or unsubscribe")
+	}
+	if err != nil {
+		return wsResponse{Type: "error", Ref: request.Ref, Message: err.Error()}
+	}
+
+	if request.Action == "subscribe" {
+		if err := subscriptions.add(subscription); err != nil {
+			return wsResponse{Type: "error", Ref: request.Ref, Message: err.Error()}
+		}
+		return wsResponse{Type: "subscribed", Ref: request.Ref, Subscription: subscription.key()}
+	}
+
+	if !subscriptions.remove(subscription.key()) {
+		return wsResponse{Type: "error", Ref: request.Ref, Message: "not subscribed to " + subscription.key()}
+	}
+	return wsResponse{Type: "unsubscribed", Ref: request.Ref, Subscription: subscription.key()}
+}
+
+func writeWebsocket(conn *websocket.Conn, response wsResponse) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+
+	return conn.WriteJSON(response)
+}
+
+func closeWebsocket(conn *websocket.Conn, code int, text string) {
+	message := websocket.FormatCloseMessage(code, text)
+	if err := conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(wsWriteTimeout)); err != nil {
+		log.Println(err)
+	}
+}
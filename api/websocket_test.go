@@ -0,0 +1,156 @@
+package main
+
+import (
+	"github.com/gorilla/websocket"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWsSubscriptionMatches(t *testing.T) {
+	lat, lon := 50.1, 8.6
+	located := spaceapi.ChangeEvent{SpaceId: "fixture-space", Country: "DE", Type: spaceapi.ChangeOpened, Lat: &lat, Lon: &lon}
+	unlocated := spaceapi.ChangeEvent{SpaceId: "legacy-space", Country: "de", Type: spaceapi.ChangeOpened}
+
+	for _, test := range []struct {
+		name      string
+		request   wsRequest
+		located   bool
+		unlocated bool
+	}{
+		{"id", wsRequest{Id: "fixture-space"}, true, false},
+		{"country", wsRequest{Country: "de"}, true, true},
+		{"country in upper case", wsRequest{Country: "DE"}, true, true},
+		{"other country", wsRequest{Country: "nl"}, false, false},
+		{"bbox", wsRequest{Bbox: []float64{8, 50, 9, 51}}, true, false},
+		{"bbox edges", wsRequest{Bbox: []float64{8.6, 50.1, 8.6, 50.1}}, true, false},
+		{"bbox elsewhere", wsRequest{Bbox: []float64{-10, 50, 0, 51}}, false, false},
+		{"swapped bbox", wsRequest{Bbox: []float64{50, 8, 51, 9}}, false, false},
+		{"types", wsRequest{Country: "de", Types: []string{spaceapi.ChangeOpened}}, true, true},
+		{"other types", wsRequest{Country: "de", Types: []string{spaceapi.ChangeClosed}}, false, false},
+	} {
+		subscription, err := newWsSubscription(test.request)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if matches := subscription.matches(located); matches != test.located {
+			t.Errorf("%s: expected %v for the located event, got %v", test.name, test.located, matches)
+		}
+		if matches := subscription.matches(unlocated); matches != test.unlocated {
+			t.Errorf("%s: expected %v for the event without a location, got %v", test.name, test.unlocated, matches)
+		}
+	}
+}
+
+func TestWsRequests(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		request wsRequest
+		message string
+	}{
+		{"no criteria", wsRequest{Action: "subscribe"}, "exactly one of id, country or bbox is required"},
+		{"two criteria", wsRequest{Action: "subscribe", Id: "a", Country: "de"}, "exactly one of id, country or bbox is required"},
+		{"short bbox", wsRequest{Action: "subscribe", Bbox: []float64{1, 2, 3}}, "bbox has to be [minLon, minLat, maxLon, maxLat]"},
+		{"unknown action", wsRequest{Action: "watch", Id: "a"}, "action has to be subscribe or unsubscribe"},
+		{"not subscribed", wsRequest{Action: "unsubscribe", Id: "a"}, "not subscribed to id:a"},
+	} {
+		subscriptions := &wsSubscriptions{subscriptions: make(map[string]wsSubscription)}
+		response := handleWsRequest(test.request, subscriptions)
+		if response.Type != "error" || response.Message != test.message {
+			t.Errorf("%s: expected the error %q, got %+v", test.name, test.message, response)
+		}
+	}
+}
+
+func TestWsSubscriptionLimit(t *testing.T) {
+	defer func(max int) {
+		wsMaxSubscriptions = max
+	}(wsMaxSubscriptions)
+	wsMaxSubscriptions = 3
+
+	subscriptions := &wsSubscriptions{subscriptions: make(map[string]wsSubscription)}
+	subscribe := func(id string) wsResponse {
+		return handleWsRequest(wsRequest{Action: "subscribe", Ref: id, Id: id}, subscriptions)
+	}
+	for i := 0; i < wsMaxSubscriptions; i++ {
+		if response := subscribe(strconv.Itoa(i)); response.Type != "subscribed" {
+			t.Fatalf("expected subscription %d to be accepted, got %+v", i, response)
+		}
+	}
+
+	if response := subscribe("3"); response.Type != "error" || response.Ref != "3" {
+		t.Errorf("expected the subscription over the limit to be refused, got %+v", response)
+	}
+	// subscribing again to the same space doesn't count
+	if response := subscribe("0"); response.Type != "subscribed" {
+		t.Errorf("expected the repeated subscription to be accepted, got %+v", response)
+	}
+
+	if response := handleWsRequest(wsRequest{Action: "unsubscribe", Id: "0"}, subscriptions); response.Type != "unsubscribed" {
+		t.Fatalf("expected the subscription to be removed, got %+v", response)
+	}
+	if response := subscribe("3"); response.Type != "subscribed" {
+		t.Errorf("expected a subscription below the limit to be accepted, got %+v", response)
+	}
+}
+
+func TestWsMaxConnections(t *testing.T) {
+	defer func(max int) {
+		wsMaxConnections = max
+	}(wsMaxConnections)
+	wsMaxConnections = 1
+
+	server := httptest.NewServer(http.HandlerFunc(serveWebsocket))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the open connection gets the events it subscribed to
+	if err := conn.WriteJSON(wsRequest{Action: "subscribe", Bbox: []float64{8, 50, 9, 51}}); err != nil {
+		t.Fatal(err)
+	}
+	var response wsResponse
+	if err := conn.ReadJSON(&response); err != nil || response.Type != "subscribed" {
+		t.Fatalf("expected the subscription to be confirmed, got %+v: %v", response, err)
+	}
+	lat, lon := 50.1, 8.6
+	hub.publish(spaceapi.ChangeEvent{Id: 1, SpaceId: "elsewhere"})
+	hub.publish(spaceapi.ChangeEvent{Id: 2, SpaceId: "fixture-space", Lat: &lat, Lon: &lon})
+	if err := conn.ReadJSON(&response); err != nil || response.Type != "event" || response.Event.Id != 2 {
+		t.Fatalf("expected the event in the bounding box, got %+v: %v", response, err)
+	}
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected the connection over the limit to be refused, got %v", err)
+	}
+	if connections := atomic.LoadInt64(&wsConnections); connections != 1 {
+		t.Errorf("expected the refused connection not to be counted, got %d", connections)
+	}
+
+	if err := conn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); atomic.LoadInt64(&wsConnections) != 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("the closed connection is still counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn, _, err = websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("expected a connection after the other one was closed: %v", err)
+	}
+	_ = conn.Close()
+}
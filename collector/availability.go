@@ -0,0 +1,164 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const availabilityRetention = 30 * 24 * time.Hour
+
+// availabilityWindows are the periods availability is computed for, the
+// longest one has to match the retention of the scrape history.
+var availabilityWindows = []struct {
+	name     string
+	duration time.Duration
+}{
+	{"24h", 24 * time.Hour},
+	{"7d", 7 * 24 * time.Hour},
+	{"30d", availabilityRetention},
+}
+
+// scrapeBucket counts the scrapes of an endpoint during one hour and how many
+// of them were reachable, valid and served over https.
+type scrapeBucket struct {
+	Hour      int64 `json:"hour"`
+	Scrapes   int   `json:"scrapes"`
+	Reachable int   `json:"reachable"`
+	Valid     int   `json:"valid"`
+	Https     int   `json:"https"`
+}
+
+type availabilityStore struct {
+	mutex   sync.RWMutex
+	History map[string][]scrapeBucket `json:"history"`
+}
+
+// recordAvailability adds the results of a rebuild to the scrape history and
+// stores the resulting availability in the directory entries. The endpoints
+// the validator failed for weren't checked and aren't counted. The history of
+// endpoints that were removed from the directory is dropped.
+func (c *Collector) recordAvailability(directory map[string]spaceapi.Entry, unchecked map[string]bool, now time.Time) {
+	hour := now.Truncate(time.Hour).Unix()
+	oldest := now.Add(-availabilityRetention).Unix()
+
+	c.scrapeHistory.mutex.Lock()
+	defer c.scrapeHistory.mutex.Unlock()
+
+	for url := range c.scrapeHistory.History {
+		if _, ok := directory[url]; !ok {
+			delete(c.scrapeHistory.History, url)
+		}
+	}
+
+	c.metrics.availabilityGauge.Reset()
+	for url, e := range directory {
+		var history []scrapeBucket
+		for _, bucket := range c.scrapeHistory.History[url] {
+			if bucket.Hour > oldest {
+				history = append(history, bucket)
+			}
+		}
+		if len(history) == 0 || history[len(history)-1].Hour != hour {
+			history = append(history, scrapeBucket{Hour: hour})
+		}
+
+		if !unchecked[url] {
+			current := &history[len(history)-1]
+			current.Scrapes++
+			current.Reachable += countTrue(e.ValidationResult.Reachable)
+			current.Valid += countTrue(e.Valid)
+			current.Https += countTrue(e.ValidationResult.IsHttps)
+		}
+		c.scrapeHistory.History[url] = history
+
+		e.Availability = computeAvailability(history, now)
+		directory[url] = e
+
+		for window, a := range e.Availability {
+			c.metrics.availabilityGauge.With(prometheus.Labels{"route": url, "window": window, "check": "reachable"}).Set(a.Reachable / 100)
+			c.metrics.availabilityGauge.With(prometheus.Labels{"route": url, "window": window, "check": "valid"}).Set(a.Valid / 100)
+			c.metrics.availabilityGauge.With(prometheus.Labels{"route": url, "window": window, "check": "https"}).Set(a.Https / 100)
+		}
+	}
+}
+
+func computeAvailability(history []scrapeBucket, now time.Time) map[string]spaceapi.Availability {
+	result := make(map[string]spaceapi.Availability)
+	for _, window := range availabilityWindows {
+		start := now.Add(-window.duration).Unix()
+
+		var total scrapeBucket
+		for _, bucket := range history {
+			if bucket.Hour <= start {
+				continue
+			}
+			total.Scrapes += bucket.Scrapes
+			total.Reachable += bucket.Reachable
+			total.Valid += bucket.Valid
+			total.Https += bucket.Https
+		}
+		if total.Scrapes == 0 {
+			continue
+		}
+
+		result[window.name] = spaceapi.Availability{
+			Scrapes:   total.Scrapes,
+			Reachable: percentage(total.Reachable, total.Scrapes),
+			Valid:     percentage(total.Valid, total.Scrapes),
+			Https:     percentage(total.Https, total.Scrapes),
+		}
+	}
+
+	return result
+}
+
+// percentage rounds to two decimal places.
+func percentage(count int, total int) float64 {
+	return math.Round(float64(count)*10000/float64(total)) / 100
+}
+
+func countTrue(value bool) int {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+func (c *Collector) persistAvailability() {
+	c.scrapeHistory.mutex.RLock()
+	historyJson, err := json.Marshal(&c.scrapeHistory)
+	c.scrapeHistory.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreAvailability, historyJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentAvailability() {
+	content, err := c.options.Storage.Load(StoreAvailability)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read availability, starting without scrape history...")
+		return
+	}
+
+	c.scrapeHistory.mutex.Lock()
+	defer c.scrapeHistory.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.scrapeHistory); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal availability, starting without scrape history...")
+		c.scrapeHistory.History = nil
+	}
+	if c.scrapeHistory.History == nil {
+		c.scrapeHistory.History = make(map[string][]scrapeBucket)
+	}
+}
@@ -0,0 +1,521 @@
+package collector
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata"
+)
+
+const (
+	calendarTimeout       = 30 * time.Second
+	calendarMaxSize       = 5 << 20
+	calendarMaxEvents     = 2000
+	calendarPastRetention = 30 * 24 * time.Hour
+)
+
+var (
+	calendarClient  = &http.Client{Timeout: calendarTimeout}
+	icalDuration    = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	icalTextEscapes = strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	errNoCalendar   = errors.New("not an iCalendar file")
+)
+
+type calendarStore struct {
+	mutex     sync.RWMutex
+	Calendars map[string]spaceapi.SpaceCalendar `json:"calendars"`
+}
+
+func (c *Collector) serveCalendars(w http.ResponseWriter, _ *http.Request) {
+	c.calendars.mutex.RLock()
+	response := make([]spaceapi.SpaceCalendar, 0, len(c.calendars.Calendars))
+	for _, calendar := range c.calendars.Calendars {
+		response = append(response, calendar)
+	}
+	c.calendars.mutex.RUnlock()
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].SpaceId < response[j].SpaceId
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// updateCalendarSources takes the calendar urls and the location of the
+// spaces from a rebuilt directory. The feeds themselves are fetched by
+// updateCalendars on their own schedule.
+func (c *Collector) updateCalendarSources(directory map[string]spaceapi.Entry) {
+	sources := make(map[string]spaceapi.SpaceCalendar)
+	for _, e := range directory {
+		feeds, _ := e.Data["feeds"].(map[string]interface{})
+		calendar, _ := feeds["calendar"].(map[string]interface{})
+		calendarUrl, _ := calendar["url"].(string)
+		if calendarUrl == "" {
+			continue
+		}
+
+		source := spaceapi.SpaceCalendar{
+			SpaceId:  spaceId(e),
+			Url:      calendarUrl,
+			Country:  spaceCountry(e),
+			TimeZone: calendarTimeZone(e),
+			Events:   []spaceapi.CalendarEvent{},
+		}
+		source.Space, _ = e.Data["space"].(string)
+		if location, ok := e.Data["location"].(map[string]interface{}); ok {
+			lat, latOk := location["lat"].(float64)
+			lon, lonOk := location["lon"].(float64)
+			if latOk && lonOk {
+				source.Lat = &lat
+				source.Lon = &lon
+			}
+		}
+		sources[source.SpaceId] = source
+	}
+
+	c.calendars.mutex.Lock()
+	defer c.calendars.mutex.Unlock()
+
+	for id, source := range sources {
+		if previous, ok := c.calendars.Calendars[id]; ok && previous.Url == source.Url {
+			source.LastFetched = previous.LastFetched
+			source.Error = previous.Error
+			source.Events = previous.Events
+		}
+		sources[id] = source
+	}
+	c.calendars.Calendars = sources
+}
+
+// updateCalendars fetches the calendar feeds of all spaces. A feed that
+// can't be fetched keeps its previous events.
+func (c *Collector) updateCalendars() {
+	c.calendars.mutex.RLock()
+	var sources []spaceapi.SpaceCalendar
+	for _, calendar := range c.calendars.Calendars {
+		sources = append(sources, calendar)
+	}
+	c.calendars.mutex.RUnlock()
+
+	fetched := make([]spaceapi.SpaceCalendar, len(sources))
+	forEachParallel(len(sources), feedFetchWorkers, func(i int) {
+		fetched[i] = c.fetchSpaceCalendar(sources[i])
+	})
+
+	c.calendars.mutex.Lock()
+	total := 0
+	for _, calendar := range fetched {
+		// the source may have been removed or changed while fetching
+		if current, ok := c.calendars.Calendars[calendar.SpaceId]; ok && current.Url == calendar.Url {
+			calendar.Space = current.Space
+			calendar.Country = current.Country
+			calendar.Lat = current.Lat
+			calendar.Lon = current.Lon
+			calendar.TimeZone = current.TimeZone
+			c.calendars.Calendars[calendar.SpaceId] = calendar
+		}
+	}
+	for _, calendar := range c.calendars.Calendars {
+		total += len(calendar.Events)
+	}
+	c.calendars.mutex.Unlock()
+
+	c.metrics.calendarEventsGauge.Set(float64(total))
+	c.persistCalendars()
+}
+
+func (c *Collector) fetchSpaceCalendar(calendar spaceapi.SpaceCalendar) spaceapi.SpaceCalendar {
+	events, err := fetchCalendar(calendar.Url, calendar.TimeZone)
+	calendar.LastFetched = time.Now().Unix()
+	if err != nil {
+		c.metrics.calendarFetchCounter.With(prometheus.Labels{"result": "error"}).Inc()
+		calendar.Error = err.Error()
+		return calendar
+	}
+
+	c.metrics.calendarFetchCounter.With(prometheus.Labels{"result": "success"}).Inc()
+	calendar.Error = ""
+	calendar.Events = events
+	return calendar
+}
+
+func fetchCalendar(calendarUrl string, timeZone string) ([]spaceapi.CalendarEvent, error) {
+	location, err := loadTimeZone(timeZone)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := calendarClient.Get(calendarUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("calendar responded with %v", resp.StatusCode)
+	}
+
+	events, err := parseCalendar(io.LimitReader(resp.Body, calendarMaxSize), location)
+	if err != nil {
+		return nil, err
+	}
+
+	return pruneCalendarEvents(events, time.Now()), nil
+}
+
+// pruneCalendarEvents drops single events that ended more than
+// calendarPastRetention before now and limits the number of events kept per
+// calendar. Past events are dropped first, the oldest of them before the
+// others, then the upcoming events furthest in the future.
+func pruneCalendarEvents(events []spaceapi.CalendarEvent, now time.Time) []spaceapi.CalendarEvent {
+	cutoff := now.Add(-calendarPastRetention).Unix()
+	var past, current []spaceapi.CalendarEvent
+	for _, event := range events {
+		single := event.RRule == "" && len(event.RDates) == 0
+		switch {
+		case single && event.End < cutoff:
+		case single && event.End < now.Unix():
+			past = append(past, event)
+		default:
+			current = append(current, event)
+		}
+	}
+
+	byStart := func(events []spaceapi.CalendarEvent) {
+		sort.SliceStable(events, func(i, j int) bool {
+			return events[i].Start < events[j].Start
+		})
+	}
+	byStart(past)
+	byStart(current)
+	if len(current) > calendarMaxEvents {
+		current = current[:calendarMaxEvents]
+	}
+	if room := calendarMaxEvents - len(current); len(past) > room {
+		past = past[len(past)-room:]
+	}
+
+	kept := append(past, current...)
+	byStart(kept)
+	return kept
+}
+
+// parseCalendar reads the events of an iCalendar (RFC 5545) file, floating
+// times and dates are read in the given location. Nested components like
+// alarms and properties we don't need are skipped.
+func parseCalendar(r io.Reader, location *time.Location) ([]spaceapi.CalendarEvent, error) {
+	lines, err := unfoldIcalLines(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []spaceapi.CalendarEvent
+	var event *spaceapi.CalendarEvent
+	var duration *time.Duration
+	broken := false
+	inCalendar := false
+	nested := 0
+
+	for _, line := range lines {
+		name, params, value := parseIcalProperty(line)
+
+		switch {
+		case name == "BEGIN" && value == "VCALENDAR":
+			inCalendar = true
+		case !inCalendar:
+			continue
+		case name == "BEGIN" && value == "VEVENT" && event == nil:
+			event = &spaceapi.CalendarEvent{}
+			duration = nil
+			broken = false
+		case name == "BEGIN":
+			nested++
+		case name == "END" && nested > 0:
+			nested--
+		case name == "END" && value == "VEVENT" && event != nil:
+			if !broken && finishCalendarEvent(event, duration, location) {
+				events = append(events, *event)
+			}
+			event = nil
+		case event != nil && nested == 0:
+			if err := setCalendarEventProperty(event, &duration, name, params, value, location); err != nil {
+				// a broken property only invalidates its event
+				broken = true
+			}
+		}
+	}
+
+	if !inCalendar {
+		return nil, errNoCalendar
+	}
+
+	return events, nil
+}
+
+func unfoldIcalLines(r io.Reader) ([]string, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), calendarMaxSize)
+
+	var lines []string
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines, scanner.Err()
+}
+
+// parseIcalProperty splits a content line into its upper cased name, its
+// parameters and its value.
+func parseIcalProperty(line string) (string, map[string]string, string) {
+	params := make(map[string]string)
+
+	colon := -1
+	quoted := false
+	for i, c := range line {
+		if c == '"' {
+			quoted = !quoted
+		} else if c == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return "", params, ""
+	}
+
+	parts := strings.Split(line[:colon], ";")
+	for _, param := range parts[1:] {
+		if i := strings.Index(param, "="); i > 0 {
+			params[strings.ToUpper(param[:i])] = strings.Trim(param[i+1:], `"`)
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, line[colon+1:]
+}
+
+func setCalendarEventProperty(event *spaceapi.CalendarEvent, duration **time.Duration, name string, params map[string]string, value string, location *time.Location) error {
+	switch name {
+	case "UID":
+		event.Uid = value
+	case "SUMMARY":
+		event.Summary = icalTextEscapes.Replace(value)
+	case "DESCRIPTION":
+		event.Description = icalTextEscapes.Replace(value)
+	case "LOCATION":
+		event.Location = icalTextEscapes.Replace(value)
+	case "URL":
+		event.Url = value
+	case "STATUS":
+		event.Cancelled = strings.EqualFold(value, "CANCELLED")
+	case "RRULE":
+		event.RRule = value
+	case "DTSTART":
+		start, allDay, timeZone, err := parseIcalTime(value, params, location)
+		if err != nil {
+			return err
+		}
+		event.Start = start.Unix()
+		event.AllDay = allDay
+		event.TimeZone = timeZone
+	case "DTEND":
+		end, _, _, err := parseIcalTime(value, params, location)
+		if err != nil {
+			return err
+		}
+		event.End = end.Unix()
+	case "DURATION":
+		d, err := parseIcalDuration(value)
+		if err != nil {
+			return err
+		}
+		*duration = &d
+	case "RECURRENCE-ID":
+		recurrenceId, _, _, err := parseIcalTime(value, params, location)
+		if err != nil {
+			return err
+		}
+		event.RecurrenceId = recurrenceId.Unix()
+	case "RDATE", "EXDATE":
+		for _, v := range strings.Split(value, ",") {
+			t, _, _, err := parseIcalTime(v, params, location)
+			if err != nil {
+				// periods and broken dates are ignored
+				continue
+			}
+			if name == "RDATE" {
+				event.RDates = append(event.RDates, t.Unix())
+			} else {
+				event.ExDates = append(event.ExDates, t.Unix())
+			}
+		}
+	}
+
+	return nil
+}
+
+// finishCalendarEvent fills in the end of an event and tells if the event is
+// complete enough to be kept. All-day events end on a later date in the
+// location, which isn't always 24 hours per day.
+func finishCalendarEvent(event *spaceapi.CalendarEvent, duration *time.Duration, location *time.Location) bool {
+	if event.Uid == "" || event.Start == 0 {
+		return false
+	}
+
+	start := time.Unix(event.Start, 0).In(location)
+	switch {
+	case duration != nil && event.AllDay:
+		event.End = start.AddDate(0, 0, int(*duration/(24*time.Hour))).Unix()
+	case duration != nil:
+		event.End = event.Start + int64(duration.Seconds())
+	case event.End == 0 && event.AllDay:
+		event.End = start.AddDate(0, 0, 1).Unix()
+	}
+	if event.End < event.Start {
+		event.End = event.Start
+	}
+
+	return true
+}
+
+// parseIcalTime parses a DATE or DATE-TIME value. Dates, floating times and
+// times with an unknown TZID are read in the location of the calendar.
+func parseIcalTime(value string, params map[string]string, location *time.Location) (time.Time, bool, string, error) {
+	value = strings.TrimSpace(value)
+
+	timeZone := ""
+	if location != time.UTC {
+		timeZone = location.String()
+	}
+
+	if params["VALUE"] == "DATE" || len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, location)
+		return t, true, timeZone, err
+	}
+
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, "", err
+	}
+
+	if tzid := strings.TrimPrefix(params["TZID"], "/"); tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			location = l
+			timeZone = tzid
+		}
+	}
+
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, timeZone, err
+}
+
+// calendarTimeZone returns the name of the time zone of a space. The fixed
+// offsets derived from the longitude are passed on as the Etc zone with the
+// same offset, so the api can load them.
+func calendarTimeZone(e spaceapi.Entry) string {
+	location := spaceLocation(e)
+	if location == time.UTC {
+		return ""
+	}
+	if _, err := time.LoadLocation(location.String()); err == nil {
+		return location.String()
+	}
+
+	// the sign of the Etc zones is inverted
+	_, offset := time.Now().In(location).Zone()
+	return fmt.Sprintf("Etc/GMT%+d", -offset/3600)
+}
+
+func loadTimeZone(timeZone string) (*time.Location, error) {
+	if timeZone == "" {
+		return time.UTC, nil
+	}
+
+	return time.LoadLocation(timeZone)
+}
+
+func parseIcalDuration(value string) (time.Duration, error) {
+	match := icalDuration.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid duration %v", value)
+	}
+
+	var d time.Duration
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	for i, unit := range units {
+		if match[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+2])
+		if err != nil {
+			return 0, err
+		}
+		d += time.Duration(n) * unit
+	}
+
+	if match[1] == "-" {
+		d = -d
+	}
+
+	return d, nil
+}
+
+func (c *Collector) persistCalendars() {
+	c.calendars.mutex.RLock()
+	calendarsJson, err := json.Marshal(&c.calendars)
+	c.calendars.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreCalendars, calendarsJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentCalendars() {
+	content, err := c.options.Storage.Load(StoreCalendars)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read calendars, fetching calendars from scratch...")
+		return
+	}
+
+	c.calendars.mutex.Lock()
+	defer c.calendars.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.calendars); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal calendars, fetching calendars from scratch...")
+		c.calendars.Calendars = nil
+	}
+	if c.calendars.Calendars == nil {
+		c.calendars.Calendars = make(map[string]spaceapi.SpaceCalendar)
+	}
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"github.com/spaceapi/directory-api/spaceapi"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPruneCalendarEventsKeepsUpcomingEvents(t *testing.T) {
+	now := time.Now()
+	event := func(uid string, start time.Time) spaceapi.CalendarEvent {
+		return spaceapi.CalendarEvent{Uid: uid, Start: start.Unix(), End: start.Add(time.Hour).Unix()}
+	}
+
+	var events []spaceapi.CalendarEvent
+	for i := 0; i < calendarMaxEvents; i++ {
+		events = append(events, event("past", now.Add(-time.Duration(i+2)*time.Hour)))
+		events = append(events, event("upcoming", now.Add(time.Duration(i+1)*time.Hour)))
+	}
+	events = append(events, event("expired", now.Add(-calendarPastRetention-2*time.Hour)))
+	weekly := event("weekly", now.Add(-calendarPastRetention-2*time.Hour))
+	weekly.RRule = "FREQ=WEEKLY"
+	events = append(events, weekly)
+
+	kept := pruneCalendarEvents(events, now)
+	if len(kept) != calendarMaxEvents {
+		t.Fatalf("expected %d events, got %d", calendarMaxEvents, len(kept))
+	}
+	counts := make(map[string]int)
+	for i, e := range kept {
+		counts[e.Uid]++
+		if i > 0 && kept[i-1].Start > e.Start {
+			t.Fatalf("the events aren't sorted by their start")
+		}
+	}
+	if counts["upcoming"] != calendarMaxEvents-1 || counts["weekly"] != 1 || counts["past"] != 0 || counts["expired"] != 0 {
+		t.Errorf("expected the recurring and the next upcoming events, got %v", counts)
+	}
+	if last := kept[len(kept)-1]; last.Start != now.Add(time.Duration(calendarMaxEvents-1)*time.Hour).Unix() {
+		t.Errorf("the upcoming events closest to now weren't kept")
+	}
+
+	// past events within the retention fill the remaining room
+	kept = pruneCalendarEvents(events[:10], now)
+	counts = make(map[string]int)
+	for _, e := range kept {
+		counts[e.Uid]++
+	}
+	if counts["past"] != 5 || counts["upcoming"] != 5 {
+		t.Errorf("expected the past events within the retention to be kept, got %v", counts)
+	}
+}
+
+func TestParseCalendarReadsFloatingTimesInTheSpaceTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ics := strings.Join([]string{
+		"BEGIN:VCALENDAR",
+		"BEGIN:VEVENT",
+		"UID:floating",
+		"DTSTART:20300331T180000",
+		"DTEND:20300331T200000",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:utc",
+		"DTSTART:20300331T180000Z",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:tzid",
+		"DTSTART;TZID=America/New_York:20300331T180000",
+		"END:VEVENT",
+		// the clocks move forward on the 31st, the day has 23 hours
+		"BEGIN:VEVENT",
+		"UID:all-day",
+		"DTSTART;VALUE=DATE:20300331",
+		"END:VEVENT",
+		"BEGIN:VEVENT",
+		"UID:all-day-duration",
+		"DTSTART;VALUE=DATE:20300330",
+		"DURATION:P2D",
+		"END:VEVENT",
+		"END:VCALENDAR",
+	}, "\r\n")
+
+	events, err := parseCalendar(strings.NewReader(ics), berlin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newYork, _ := time.LoadLocation("America/New_York")
+	expected := map[string]struct {
+		start    time.Time
+		end      time.Time
+		timeZone string
+	}{
+		"floating":         {time.Date(2030, 3, 31, 18, 0, 0, 0, berlin), time.Date(2030, 3, 31, 20, 0, 0, 0, berlin), "Europe/Berlin"},
+		"utc":              {time.Date(2030, 3, 31, 18, 0, 0, 0, time.UTC), time.Date(2030, 3, 31, 18, 0, 0, 0, time.UTC), ""},
+		"tzid":             {time.Date(2030, 3, 31, 18, 0, 0, 0, newYork), time.Date(2030, 3, 31, 18, 0, 0, 0, newYork), "America/New_York"},
+		"all-day":          {time.Date(2030, 3, 31, 0, 0, 0, 0, berlin), time.Date(2030, 4, 1, 0, 0, 0, 0, berlin), "Europe/Berlin"},
+		"all-day-duration": {time.Date(2030, 3, 30, 0, 0, 0, 0, berlin), time.Date(2030, 4, 1, 0, 0, 0, 0, berlin), "Europe/Berlin"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for _, event := range events {
+		e := expected[event.Uid]
+		if event.Start != e.start.Unix() || event.End != e.end.Unix() || event.TimeZone != e.timeZone {
+			t.Errorf("%s: expected %v to %v in %q, got %v to %v in %q", event.Uid, e.start, e.end, e.timeZone,
+				time.Unix(event.Start, 0).In(berlin), time.Unix(event.End, 0).In(berlin), event.TimeZone)
+		}
+	}
+}
+
+func TestCalendarTimeZone(t *testing.T) {
+	for _, test := range []struct {
+		location map[string]interface{}
+		timeZone string
+	}{
+		{map[string]interface{}{"timezone": "Europe/Berlin", "lon": -70.0}, "Europe/Berlin"},
+		{map[string]interface{}{"lon": 8.6}, "Etc/GMT-1"},
+		{map[string]interface{}{"lon": -74.0}, "Etc/GMT+5"},
+		{map[string]interface{}{"lon": 2.0}, ""},
+		{map[string]interface{}{}, ""},
+	} {
+		e := spaceapi.Entry{Data: map[string]interface{}{"location": test.location}}
+		if timeZone := calendarTimeZone(e); timeZone != test.timeZone {
+			t.Errorf("%v: expected %q, got %q", test.location, test.timeZone, timeZone)
+		}
+		if _, err := loadTimeZone(calendarTimeZone(e)); err != nil {
+			t.Errorf("%v: %v", test.location, err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"strings"
+)
+
+// schemaMigration converts the data of a space from the previous version to
+// version. Fields without a successor are dropped, the ones that were
+// renamed or fixed are moved to their new form.
+type schemaMigration struct {
+	version string
+	migrate func(data map[string]interface{})
+}
+
+// schemaMigrations are applied in order, starting after the latest version
+// a space declares. Spaces that don't declare a version get all of them.
+var schemaMigrations = []schemaMigration{
+	{version: "14", migrate: migrateTo14},
+	{version: "15", migrate: migrateTo15},
+}
+
+// normalizeDirectory converts the data of every space into the canonical
+// model, the raw data stays untouched.
+func normalizeDirectory(directory map[string]spaceapi.Entry) {
+	for url, e := range directory {
+		e.Normalized = normalizeSpace(e)
+		directory[url] = e
+	}
+}
+
+// normalizeSpace migrates the data to the latest version and decodes the
+// result into the canonical model. Values of the wrong type are left out.
+// Spaces without data aren't normalized.
+func normalizeSpace(e spaceapi.Entry) *spaceapi.Space {
+	if e.Data == nil {
+		return nil
+	}
+
+	// the migrations change nested objects, so they work on a copy
+	content, err := json.Marshal(e.Data)
+	if err != nil {
+		return nil
+	}
+	var data map[string]interface{}
+	if err := json.Unmarshal(content, &data); err != nil {
+		return nil
+	}
+	migrateSpace(data)
+
+	content, err = json.Marshal(data)
+	if err != nil {
+		return nil
+	}
+
+	var space spaceapi.Space
+	if err := json.Unmarshal(content, &space); err != nil {
+		if _, ok := err.(*json.UnmarshalTypeError); !ok {
+			return nil
+		}
+	}
+	space.ApiCompatibility = []string{latestSchemaVersion}
+
+	if space.Location != nil && space.Location.CountryCode == "" {
+		space.Location.CountryCode = strings.ToUpper(spaceCountry(e))
+	}
+
+	return &space
+}
+
+// migrateSpace applies the migrations to the versions after the latest one
+// the space declares.
+func migrateSpace(data map[string]interface{}) {
+	versions, _, _ := getNewStats(data)
+	declared := make(map[string]bool)
+	for _, version := range versions {
+		declared[version] = true
+	}
+
+	start := 0
+	for i, migration := range schemaMigrations {
+		if declared[migration.version] {
+			start = i + 1
+		}
+	}
+	for _, migration := range schemaMigrations[start:] {
+		migration.migrate(data)
+	}
+}
+
+// migrateTo14 fixes the unit of the barometer, which 0.13 spelled hPA.
+func migrateTo14(data map[string]interface{}) {
+	sensors, _ := data["sensors"].(map[string]interface{})
+	barometers, _ := sensors["barometer"].([]interface{})
+	for _, barometer := range barometers {
+		if barometer, ok := barometer.(map[string]interface{}); ok && barometer["unit"] == "hPA" {
+			barometer["unit"] = "hPa"
+		}
+	}
+}
+
+// migrateTo15 removes the fields 14 deprecated. Only jabber has a successor,
+// issue_mail is the address for issue reports and not the general contact,
+// so it's dropped with the issue_report_channels referring to it.
+func migrateTo15(data map[string]interface{}) {
+	for _, field := range []string{"api", "cache", "radio_show", "issue_report_channels"} {
+		delete(data, field)
+	}
+
+	if spacefed, ok := data["spacefed"].(map[string]interface{}); ok {
+		delete(spacefed, "spacephone")
+	}
+
+	if contact, ok := data["contact"].(map[string]interface{}); ok {
+		moveField(contact, "jabber", "xmpp")
+		for _, field := range []string{"issue_mail", "google", "identica", "foursquare"} {
+			delete(contact, field)
+		}
+	}
+}
+
+// moveField sets to to the value of from if to isn't set yet.
+func moveField(m map[string]interface{}, from string, to string) {
+	if value, ok := m[from]; ok {
+		if _, exists := m[to]; !exists {
+			m[to] = value
+		}
+		delete(m, from)
+	}
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"reflect"
+	"testing"
+)
+
+func decodeFixture(t *testing.T, content string) map[string]interface{} {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		t.Fatalf("invalid fixture %s: %v", content, err)
+	}
+	return data
+}
+
+func TestMigrateTo14(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			"barometer unit",
+			`{"sensors": {"barometer": [{"value": 1013, "unit": "hPA"}, {"value": 1000, "unit": "hPa"}]}}`,
+			`{"sensors": {"barometer": [{"value": 1013, "unit": "hPa"}, {"value": 1000, "unit": "hPa"}]}}`,
+		},
+		{
+			"fields deprecated by 14 are kept",
+			`{"api": "0.13", "contact": {"jabber": "space@jabber.example", "issue_mail": "issues@space.example"}, "issue_report_channels": ["issue_mail"]}`,
+			`{"api": "0.13", "contact": {"jabber": "space@jabber.example", "issue_mail": "issues@space.example"}, "issue_report_channels": ["issue_mail"]}`,
+		},
+		{
+			"sensors of the wrong type",
+			`{"sensors": {"barometer": {"unit": "hPA"}}}`,
+			`{"sensors": {"barometer": {"unit": "hPA"}}}`,
+		},
+	} {
+		data := decodeFixture(t, test.data)
+		migrateTo14(data)
+		if expected := decodeFixture(t, test.expected); !reflect.DeepEqual(data, expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, data)
+		}
+	}
+}
+
+func TestMigrateTo15(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			"api",
+			`{"api": "0.13", "api_compatibility": ["14"]}`,
+			`{"api_compatibility": ["14"]}`,
+		},
+		{
+			"jabber becomes xmpp",
+			`{"contact": {"jabber": "space@jabber.example"}}`,
+			`{"contact": {"xmpp": "space@jabber.example"}}`,
+		},
+		{
+			"xmpp wins over jabber",
+			`{"contact": {"jabber": "old@jabber.example", "xmpp": "space@xmpp.example"}}`,
+			`{"contact": {"xmpp": "space@xmpp.example"}}`,
+		},
+		{
+			"issue_mail isn't the general contact",
+			`{"contact": {"issue_mail": "issues@space.example"}, "issue_report_channels": ["issue_mail"]}`,
+			`{"contact": {}}`,
+		},
+		{
+			"issue_mail doesn't replace the email",
+			`{"contact": {"email": "info@space.example", "issue_mail": "issues@space.example"}}`,
+			`{"contact": {"email": "info@space.example"}}`,
+		},
+		{
+			"removed contacts",
+			`{"contact": {"google": {"plus": "https://plus.google.com/space"}, "identica": "space@identi.ca", "foursquare": "4sq", "twitter": "@space"}}`,
+			`{"contact": {"twitter": "@space"}}`,
+		},
+		{
+			"spacephone",
+			`{"spacefed": {"spacenet": true, "spacesaml": false, "spacephone": true}}`,
+			`{"spacefed": {"spacenet": true, "spacesaml": false}}`,
+		},
+		{
+			"cache and radio shows",
+			`{"cache": {"schedule": "m.02"}, "radio_show": [{"name": "Hacker Radio", "url": "https://radio.example", "type": "mp3", "start": "2020-01-01T20:00Z", "end": "2020-01-01T21:00Z"}]}`,
+			`{}`,
+		},
+		{
+			"extensions are kept",
+			`{"contact": {"ext_signal": "+49"}, "ext_ccc": "erfa"}`,
+			`{"contact": {"ext_signal": "+49"}, "ext_ccc": "erfa"}`,
+		},
+	} {
+		data := decodeFixture(t, test.data)
+		migrateTo15(data)
+		if expected := decodeFixture(t, test.expected); !reflect.DeepEqual(data, expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, data)
+		}
+	}
+}
+
+func TestMigrateSpaceStartsAfterTheDeclaredVersion(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected string
+	}{
+		{
+			"0.13 gets all migrations",
+			`{"api": "0.13", "contact": {"jabber": "space@jabber.example"}, "sensors": {"barometer": [{"value": 1013, "unit": "hPA"}]}}`,
+			`{"contact": {"xmpp": "space@jabber.example"}, "sensors": {"barometer": [{"value": 1013, "unit": "hPa"}]}}`,
+		},
+		{
+			"14 isn't migrated to 14",
+			`{"api_compatibility": ["14"], "contact": {"jabber": "space@jabber.example"}, "sensors": {"barometer": [{"value": 1013, "unit": "hPA"}]}}`,
+			`{"api_compatibility": ["14"], "contact": {"xmpp": "space@jabber.example"}, "sensors": {"barometer": [{"value": 1013, "unit": "hPA"}]}}`,
+		},
+		{
+			"0.13 and 14 start at the later one",
+			`{"api": "0.13", "api_compatibility": ["14"], "issue_report_channels": ["email"]}`,
+			`{"api_compatibility": ["14"]}`,
+		},
+		{
+			"15 isn't migrated",
+			`{"api_compatibility": ["14", "15"], "contact": {"jabber": "space@jabber.example"}}`,
+			`{"api_compatibility": ["14", "15"], "contact": {"jabber": "space@jabber.example"}}`,
+		},
+		{
+			"unknown versions get all migrations",
+			`{"api_compatibility": ["16"], "contact": {"jabber": "space@jabber.example"}}`,
+			`{"api_compatibility": ["16"], "contact": {"xmpp": "space@jabber.example"}}`,
+		},
+	} {
+		data := decodeFixture(t, test.data)
+		migrateSpace(data)
+		if expected := decodeFixture(t, test.expected); !reflect.DeepEqual(data, expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, expected, data)
+		}
+	}
+}
+
+func TestNormalizeSpaceLeavesTheRawDataUntouched(t *testing.T) {
+	raw := `{"api": "0.13", "space": "Legacy Space", "contact": {"jabber": "legacy@jabber.example", "issue_mail": "issues@legacy.example"}, "issue_report_channels": ["issue_mail"], "sensors": {"barometer": [{"value": 1013, "unit": "hPA"}]}}`
+	e := spaceapi.Entry{Data: decodeFixture(t, raw)}
+
+	space := normalizeSpace(e)
+	if space == nil {
+		t.Fatal("the space wasn't normalized")
+	}
+	if space.Contact.Xmpp != "legacy@jabber.example" || space.Contact.Email != "" {
+		t.Errorf("unexpected contact %+v", space.Contact)
+	}
+	if space.Sensors == nil || len(space.Sensors.Barometer) != 1 || space.Sensors.Barometer[0].Unit != "hPa" {
+		t.Errorf("unexpected sensors %+v", space.Sensors)
+	}
+	if !reflect.DeepEqual(space.ApiCompatibility, []string{latestSchemaVersion}) {
+		t.Errorf("unexpected versions %v", space.ApiCompatibility)
+	}
+
+	if expected := decodeFixture(t, raw); !reflect.DeepEqual(e.Data, expected) {
+		t.Errorf("the raw data was changed to %v", e.Data)
+	}
+}
@@ -0,0 +1,469 @@
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChangeLimit = 500
+	maxChangeLimit     = 5000
+)
+
+type changeLog struct {
+	mutex sync.RWMutex
+	// retention is the number of events to keep
+	retention int
+	LastId    int64                  `json:"lastId"`
+	Events    []spaceapi.ChangeEvent `json:"events"`
+}
+
+var (
+	nonAlphanumeric     = regexp.MustCompile(`[^a-z0-9]+`)
+	errInvalidChangeArg = errors.New("since has to be a unix timestamp or a cursor")
+)
+
+func (c *Collector) serveChanges(w http.ResponseWriter, r *http.Request) {
+	since, err := parseSince(r.URL.Query().Get("since"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultChangeLimit
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		limit, err = strconv.Atoi(limitParam)
+		if err != nil || limit <= 0 {
+			http.Error(w, "limit has to be a positive number", http.StatusBadRequest)
+			return
+		}
+		if limit > maxChangeLimit {
+			limit = maxChangeLimit
+		}
+	}
+
+	filter := changeFilter{
+		spaceIds: listParam(r.URL.Query().Get("spaceId")),
+		types:    listParam(r.URL.Query().Get("types")),
+	}
+
+	var response spaceapi.ChangesResponse
+	switch r.URL.Query().Get("order") {
+	case "", "asc":
+		response = c.changes.since(since, limit, filter)
+	case "desc":
+		response = c.changes.latest(since, limit, filter)
+	default:
+		http.Error(w, "order has to be asc or desc", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// changeFilter restricts the events returned to a set of spaces and event
+// types, empty sets match everything.
+type changeFilter struct {
+	spaceIds map[string]bool
+	types    map[string]bool
+}
+
+func (f changeFilter) matches(event spaceapi.ChangeEvent) bool {
+	return (len(f.spaceIds) == 0 || f.spaceIds[event.SpaceId]) &&
+		(len(f.types) == 0 || f.types[event.Type])
+}
+
+func listParam(value string) map[string]bool {
+	values := make(map[string]bool)
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values[v] = true
+		}
+	}
+
+	return values
+}
+
+// changeCursor holds the position in the change log a client wants to resume
+// from, either a specific event id or a point in time.
+type changeCursor struct {
+	eventId int64
+	time    int64
+}
+
+func parseSince(since string) (changeCursor, error) {
+	if since == "" {
+		return changeCursor{}, nil
+	}
+
+	if timestamp, err := strconv.ParseInt(since, 10, 64); err == nil {
+		return changeCursor{time: timestamp}, nil
+	}
+
+	eventId, err := decodeChangeCursor(since)
+	if err != nil {
+		return changeCursor{}, errInvalidChangeArg
+	}
+
+	return changeCursor{eventId: eventId}, nil
+}
+
+func encodeChangeCursor(eventId int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("event:" + strconv.FormatInt(eventId, 10)))
+}
+
+func decodeChangeCursor(cursor string) (int64, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(decoded), "event:") {
+		return 0, errInvalidChangeArg
+	}
+
+	return strconv.ParseInt(strings.TrimPrefix(string(decoded), "event:"), 10, 64)
+}
+
+// since returns up to limit events after the given cursor matching the
+// filter, ordered from the oldest to the newest. Truncated is set if events
+// the client hasn't seen yet were already dropped from the log.
+func (l *changeLog) since(cursor changeCursor, limit int, filter changeFilter) spaceapi.ChangesResponse {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	response := spaceapi.ChangesResponse{Events: []spaceapi.ChangeEvent{}}
+	lastSeen := cursor.eventId
+
+	start := len(l.Events)
+	for i, event := range l.Events {
+		if (cursor.time != 0 && event.Time > cursor.time) || (cursor.time == 0 && event.Id > cursor.eventId) {
+			start = i
+			break
+		}
+	}
+
+	if cursor.eventId != 0 && len(l.Events) > 0 && l.Events[0].Id > cursor.eventId+1 {
+		response.Truncated = true
+	}
+
+	i := start
+	for ; i < len(l.Events) && len(response.Events) < limit; i++ {
+		event := l.Events[i]
+		lastSeen = event.Id
+		if !filter.matches(event) {
+			continue
+		}
+		event.Cursor = encodeChangeCursor(event.Id)
+		response.Events = append(response.Events, event)
+	}
+	// the cursor skips the remaining events if none of them matches
+	for j := i; j < len(l.Events); j++ {
+		if filter.matches(l.Events[j]) {
+			response.HasMore = true
+			break
+		}
+	}
+	if !response.HasMore && i < len(l.Events) {
+		lastSeen = l.Events[len(l.Events)-1].Id
+	}
+
+	if i == start && cursor.eventId == 0 {
+		lastSeen = l.LastId
+	}
+	response.Cursor = encodeChangeCursor(lastSeen)
+
+	return response
+}
+
+// latest returns the newest limit events after the given cursor matching the
+// filter, ordered from the newest to the oldest. HasMore is set if older
+// matching events were left out, the cursor points to the newest event.
+func (l *changeLog) latest(cursor changeCursor, limit int, filter changeFilter) spaceapi.ChangesResponse {
+	l.mutex.RLock()
+	defer l.mutex.RUnlock()
+
+	response := spaceapi.ChangesResponse{Events: []spaceapi.ChangeEvent{}}
+	for i := len(l.Events) - 1; i >= 0; i-- {
+		event := l.Events[i]
+		if (cursor.time != 0 && event.Time <= cursor.time) || (cursor.time == 0 && event.Id <= cursor.eventId) {
+			break
+		}
+		if !filter.matches(event) {
+			continue
+		}
+		if len(response.Events) == limit {
+			response.HasMore = true
+			break
+		}
+		event.Cursor = encodeChangeCursor(event.Id)
+		response.Events = append(response.Events, event)
+	}
+
+	if cursor.eventId != 0 && len(l.Events) > 0 && l.Events[0].Id > cursor.eventId+1 {
+		response.Truncated = true
+	}
+	response.Cursor = encodeChangeCursor(l.LastId)
+
+	return response
+}
+
+// append assigns ids to the events, adds them to the log and returns them.
+func (l *changeLog) append(events []spaceapi.ChangeEvent) []spaceapi.ChangeEvent {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for i := range events {
+		l.LastId++
+		events[i].Id = l.LastId
+		l.Events = append(l.Events, events[i])
+	}
+
+	if len(l.Events) > l.retention {
+		l.Events = append([]spaceapi.ChangeEvent(nil), l.Events[len(l.Events)-l.retention:]...)
+	}
+
+	return events
+}
+
+// recordChanges compares two snapshots of the directory and appends an event
+// for every space that was added, removed, became valid or invalid, opened,
+// closed or changed its data. The recorded events are returned.
+func (c *Collector) recordChanges(previous, current map[string]spaceapi.Entry) []spaceapi.ChangeEvent {
+	now := time.Now().Unix()
+
+	var events []spaceapi.ChangeEvent
+	for url, oldEntry := range previous {
+		if _, ok := current[url]; !ok {
+			events = append(events, newChangeEvent(spaceapi.ChangeRemoved, now, oldEntry))
+		}
+	}
+
+	for url, newEntry := range current {
+		oldEntry, ok := previous[url]
+		if !ok {
+			events = append(events, newChangeEvent(spaceapi.ChangeAdded, now, newEntry))
+			continue
+		}
+
+		if oldEntry.Valid != newEntry.Valid {
+			if newEntry.Valid {
+				events = append(events, newChangeEvent(spaceapi.ChangeValid, now, newEntry))
+			} else {
+				events = append(events, newChangeEvent(spaceapi.ChangeInvalid, now, newEntry))
+			}
+		}
+
+		// the last data is kept if a scrape fails, so this only skips spaces
+		// we haven't seen data from yet
+		if oldEntry.Data == nil || newEntry.Data == nil {
+			continue
+		}
+
+		oldOpen, oldKnown := isOpen(oldEntry.Data)
+		newOpen, newKnown := isOpen(newEntry.Data)
+		if oldKnown && newKnown && oldOpen != newOpen {
+			if newOpen {
+				events = append(events, newChangeEvent(spaceapi.ChangeOpened, now, newEntry))
+			} else {
+				events = append(events, newChangeEvent(spaceapi.ChangeClosed, now, newEntry))
+			}
+		}
+
+		if !reflect.DeepEqual(withoutVolatileFields(oldEntry.Data), withoutVolatileFields(newEntry.Data)) {
+			events = append(events, newChangeEvent(spaceapi.ChangeData, now, newEntry))
+		}
+	}
+
+	if len(events) == 0 {
+		return nil
+	}
+
+	sortChangeEvents(events)
+	return c.changes.append(events)
+}
+
+func newChangeEvent(changeType string, now int64, e spaceapi.Entry) spaceapi.ChangeEvent {
+	space, _ := e.Data["space"].(string)
+	event := spaceapi.ChangeEvent{
+		Time:    now,
+		Type:    changeType,
+		Space:   space,
+		Url:     e.Url,
+		SpaceId: spaceId(e),
+		Country: spaceCountry(e),
+	}
+
+	if location, ok := e.Data["location"].(map[string]interface{}); ok {
+		lat, latOk := location["lat"].(float64)
+		lon, lonOk := location["lon"].(float64)
+		if latOk && lonOk {
+			event.Lat = &lat
+			event.Lon = &lon
+		}
+	}
+
+	return event
+}
+
+// sortChangeEvents orders the events of one rebuild by url and keeps the
+// event types of a space in a stable order, so ids are deterministic.
+func sortChangeEvents(events []spaceapi.ChangeEvent) {
+	order := map[string]int{
+		spaceapi.ChangeAdded:   0,
+		spaceapi.ChangeValid:   1,
+		spaceapi.ChangeInvalid: 1,
+		spaceapi.ChangeOpened:  2,
+		spaceapi.ChangeClosed:  2,
+		spaceapi.ChangeData:    3,
+		spaceapi.ChangeRemoved: 4,
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Url != events[j].Url {
+			return events[i].Url < events[j].Url
+		}
+		return order[events[i].Type] < order[events[j].Type]
+	})
+}
+
+// withoutVolatileFields drops the parts of a space document that change on
+// nearly every scrape and are reported separately.
+func withoutVolatileFields(data map[string]interface{}) map[string]interface{} {
+	stable := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if key == "state" || key == "sensors" {
+			continue
+		}
+		stable[key] = value
+	}
+
+	return stable
+}
+
+func isOpen(data map[string]interface{}) (bool, bool) {
+	state, ok := data["state"].(map[string]interface{})
+	if !ok {
+		return false, false
+	}
+
+	open, ok := state["open"].(bool)
+	return open, ok
+}
+
+// spaceId returns the id of a space, entries without one get a url
+// friendly identifier derived from the space name or, for spaces we've never
+// seen data from, the endpoint url.
+func spaceId(e spaceapi.Entry) string {
+	if e.Id != "" {
+		return e.Id
+	}
+
+	name, _ := e.Data["space"].(string)
+	if name == "" {
+		name = strings.TrimPrefix(strings.TrimPrefix(e.Url, "https://"), "http://")
+	}
+
+	return strings.Trim(nonAlphanumeric.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// assignSpaceIds gives every entry of the directory a unique id. The id of a
+// space is derived from its name and never changed once it was assigned, so
+// renaming a space keeps its id. New spaces whose name is already taken get
+// a suffix derived from their endpoint url. Spaces we've never seen data
+// from get a provisional id derived from their url until they provide data.
+// The urls are handled in order, so the result doesn't depend on the order
+// the endpoints answered in.
+func assignSpaceIds(directory map[string]spaceapi.Entry) {
+	urls := make([]string, 0, len(directory))
+	for url := range directory {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	taken := make(map[string]bool, len(directory))
+	var unnamed, provisional []string
+	for _, url := range urls {
+		e := directory[url]
+		switch {
+		case e.Data == nil:
+			provisional = append(provisional, url)
+		case e.Id == "" || taken[e.Id]:
+			unnamed = append(unnamed, url)
+		default:
+			taken[e.Id] = true
+		}
+	}
+
+	for _, url := range append(unnamed, provisional...) {
+		e := directory[url]
+		e.Id = ""
+		id := spaceId(e)
+		if taken[id] || id == "" {
+			id = strings.Trim(id+"-"+urlHash(url), "-")
+		}
+		taken[id] = true
+		e.Id = id
+		directory[url] = e
+	}
+}
+
+// urlHash is a short hash of an endpoint url to tell apart spaces with the
+// same name.
+func urlHash(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:4])
+}
+
+func copyDirectory(directory map[string]spaceapi.Entry) map[string]spaceapi.Entry {
+	directoryCopy := make(map[string]spaceapi.Entry, len(directory))
+	for url, e := range directory {
+		directoryCopy[url] = e
+	}
+
+	return directoryCopy
+}
+
+func (c *Collector) persistChanges() {
+	c.changes.mutex.RLock()
+	changesJson, err := json.Marshal(&c.changes)
+	c.changes.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreChanges, changesJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentChanges() {
+	content, err := c.options.Storage.Load(StoreChanges)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read changes, starting with an empty change log...")
+		return
+	}
+
+	c.changes.mutex.Lock()
+	defer c.changes.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.changes); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal changes, starting with an empty change log...")
+		c.changes.LastId = 0
+		c.changes.Events = nil
+	}
+}
@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"strings"
+	"testing"
+)
+
+func TestSpaceIdsAreUnique(t *testing.T) {
+	named := func(url string, name string) spaceapi.Entry {
+		return spaceapi.Entry{Url: url, Data: map[string]interface{}{"space": name}}
+	}
+	directory := map[string]spaceapi.Entry{
+		"https://b.example/space.json": named("https://b.example/space.json", "Hackerspace"),
+		"https://a.example/space.json": named("https://a.example/space.json", "Hackerspace"),
+		"https://c.example/space.json": named("https://c.example/space.json", "Other Space"),
+		"https://d.example/space.json": {Url: "https://d.example/space.json"},
+	}
+	assignSpaceIds(directory)
+
+	if id := directory["https://a.example/space.json"].Id; id != "hackerspace" {
+		t.Errorf("expected the first url to get the name, got %q", id)
+	}
+	if id := directory["https://b.example/space.json"].Id; !strings.HasPrefix(id, "hackerspace-") {
+		t.Errorf("expected a suffix for the second space with the same name, got %q", id)
+	}
+	if id := directory["https://c.example/space.json"].Id; id != "other-space" {
+		t.Errorf("expected other-space, got %q", id)
+	}
+	if id := directory["https://d.example/space.json"].Id; id != "d-example-space-json" {
+		t.Errorf("expected the url for a space without data, got %q", id)
+	}
+}
+
+func TestSpaceIdsAreStable(t *testing.T) {
+	directory := map[string]spaceapi.Entry{
+		"https://a.example/space.json": {Id: "hackerspace", Url: "https://a.example/space.json", Data: map[string]interface{}{"space": "Renamed Space"}},
+		// a new space takes the old name of the renamed one
+		"https://b.example/space.json": {Url: "https://b.example/space.json", Data: map[string]interface{}{"space": "Hackerspace"}},
+	}
+	assignSpaceIds(directory)
+	renamed, added := directory["https://a.example/space.json"].Id, directory["https://b.example/space.json"].Id
+	if renamed != "hackerspace" {
+		t.Errorf("the renamed space changed its id to %q", renamed)
+	}
+	if added == renamed || !strings.HasPrefix(added, "hackerspace-") {
+		t.Errorf("expected a suffix for the new space, got %q", added)
+	}
+
+	assignSpaceIds(directory)
+	if id := directory["https://b.example/space.json"].Id; id != added {
+		t.Errorf("the id changed from %q to %q", added, id)
+	}
+
+	// ids that were assigned twice before are made unique
+	directory["https://b.example/space.json"] = spaceapi.Entry{Id: "hackerspace", Url: "https://b.example/space.json", Data: map[string]interface{}{"space": "Hackerspace"}}
+	assignSpaceIds(directory)
+	if id := directory["https://b.example/space.json"].Id; id == "hackerspace" || directory["https://a.example/space.json"].Id != "hackerspace" {
+		t.Errorf("the duplicate id wasn't replaced: %q", id)
+	}
+}
+
+func TestSpacesWithoutDataGetAProvisionalId(t *testing.T) {
+	url := "https://a.example/space.json"
+	directory := map[string]spaceapi.Entry{url: {Url: url}}
+	assignSpaceIds(directory)
+	if id := directory[url].Id; id != "a-example-space-json" {
+		t.Fatalf("expected an id derived from the url, got %q", id)
+	}
+
+	server := newFixtureServer()
+	defer server.Close()
+
+	// the validator fails on the first scrape of the space
+	failing := true
+	c := newFixtureCollector(server, Options{})
+	validator := c.options.Validator
+	c.options.Validator = ValidatorFunc(func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+		if failing {
+			return spaceapi.ValidationResult{}, nil, context.DeadlineExceeded
+		}
+		return validator.Validate(ctx, url)
+	})
+	c.Rebuild()
+	e := c.Snapshot()[server.URL+"/space.json"]
+	if e.Data != nil || !strings.HasSuffix(e.Id, "-space-json") {
+		t.Fatalf("expected a provisional id, got %q", e.Id)
+	}
+
+	failing = false
+	c.Rebuild()
+	if id := c.Snapshot()[server.URL+"/space.json"].Id; id != "fixture-space" {
+		t.Errorf("expected the id to be derived from the name once there is data, got %q", id)
+	}
+}
+
+func TestFailedScrapesKeepTheEntry(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{})
+	validator := c.options.Validator
+	open, failing := true, false
+	c.options.Validator = ValidatorFunc(func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+		if !strings.HasSuffix(url, "/space.json") {
+			return validator.Validate(ctx, url)
+		}
+		if failing {
+			return spaceapi.ValidationResult{}, nil, context.DeadlineExceeded
+		}
+		result, data, err := validator.Validate(ctx, url)
+		if state, ok := data["state"].(map[string]interface{}); ok {
+			state["open"] = open
+		}
+		return result, data, err
+	})
+	c.Rebuild()
+	before := c.Snapshot()[server.URL+"/space.json"]
+
+	failing = true
+	c.Rebuild()
+	after := c.Snapshot()[server.URL+"/space.json"]
+	if !after.Valid || after.Data == nil || after.LastSeen != before.LastSeen || after.Id != before.Id {
+		t.Errorf("the entry changed after a failed scrape: %+v", after)
+	}
+	if scrapes := after.Availability["24h"].Scrapes; scrapes != 1 {
+		t.Errorf("expected the failed scrape not to be counted, got %d scrapes", scrapes)
+	}
+
+	// the space closes while the validator fails
+	open, failing = false, false
+	c.Rebuild()
+
+	response := c.changes.since(changeCursor{}, 100, changeFilter{spaceIds: map[string]bool{"fixture-space": true}})
+	var types []string
+	for _, event := range response.Events {
+		types = append(types, event.Type)
+	}
+	if strings.Join(types, ",") != "added,closed" {
+		t.Errorf("expected the events added and closed, got %v", types)
+	}
+}
+
+func TestSinceOnlyHasMoreWithMatchingEvents(t *testing.T) {
+	l := changeLog{retention: 100}
+	l.append([]spaceapi.ChangeEvent{
+		{Type: spaceapi.ChangeOpened, SpaceId: "a"},
+		{Type: spaceapi.ChangeOpened, SpaceId: "b"},
+		{Type: spaceapi.ChangeClosed, SpaceId: "b"},
+		{Type: spaceapi.ChangeClosed, SpaceId: "b"},
+		{Type: spaceapi.ChangeOpened, SpaceId: "a"},
+	})
+
+	for _, test := range []struct {
+		name    string
+		filter  changeFilter
+		limit   int
+		events  int
+		hasMore bool
+	}{
+		{"more matching events", changeFilter{}, 2, 2, true},
+		{"all events", changeFilter{}, 5, 5, false},
+		{"no more matching events", changeFilter{spaceIds: map[string]bool{"b": true}, types: map[string]bool{spaceapi.ChangeOpened: true}}, 1, 1, false},
+		{"one more matching event", changeFilter{spaceIds: map[string]bool{"a": true}}, 1, 1, true},
+	} {
+		response := l.since(changeCursor{}, test.limit, test.filter)
+		if len(response.Events) != test.events || response.HasMore != test.hasMore {
+			t.Errorf("%s: expected %d events and hasMore %v, got %d and %v", test.name, test.events, test.hasMore, len(response.Events), response.HasMore)
+		}
+		if !test.hasMore && response.Cursor != encodeChangeCursor(l.LastId) {
+			t.Errorf("%s: expected the cursor to skip the remaining events", test.name)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/collector"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+var (
+	options    collector.Options
+	storeFiles = make(map[string]*string)
+)
+
+func init() {
+	storeFlag(collector.StoreDirectory, "storage", "spaceApiDirectory.json", "Path to the file for persistent storage")
+	storeFlag(collector.StoreChanges, "changes", "spaceApiChanges.json", "Path to the file for persistent storage of change events")
+	storeFlag(collector.StoreWebhooks, "webhooks", "spaceApiWebhooks.json", "Path to the file for persistent storage of webhooks and their delivery queue")
+	storeFlag(collector.StoreCalendars, "calendars", "spaceApiCalendars.json", "Path to the file for persistent storage of the fetched calendars")
+	storeFlag(collector.StorePlanet, "planet", "spaceApiPlanet.json", "Path to the file for persistent storage of the fetched blog and wiki feeds")
+	storeFlag(collector.StoreAvailability, "availability", "spaceApiAvailability.json", "Path to the file for persistent storage of the scrape history")
+	storeFlag(collector.StoreOpeningHours, "openingHours", "spaceApiOpeningHours.json", "Path to the file for persistent storage of the opening hour statistics")
+	storeFlag(collector.StoreTrends, "trends", "spaceApiTrends.json", "Path to the file for persistent storage of the daily statistics")
+
+	flag.BoolVar(
+		&options.RebuildOnStart,
+		"rebuildDirectory",
+		false,
+		"Rebuild directory on startup",
+	)
+
+	flag.IntVar(
+		&options.ChangeRetention,
+		"changeRetention",
+		50000,
+		"Number of change events to keep",
+	)
+
+	flag.StringVar(
+		&options.WebhookToken,
+		"webhookToken",
+		"",
+		"Bearer token required to manage webhooks, registration is disabled if empty",
+	)
+
+	flag.IntVar(
+		&options.WebhookMaxAttempts,
+		"webhookMaxAttempts",
+		10,
+		"Delivery attempts before a webhook delivery is moved to the dead letters",
+	)
+
+	flag.DurationVar(
+		&options.CalendarInterval,
+		"calendarInterval",
+		time.Hour,
+		"How often the calendar feeds of the spaces are fetched",
+	)
+
+	flag.DurationVar(
+		&options.PlanetInterval,
+		"planetInterval",
+		30*time.Minute,
+		"How often the blog and wiki feeds of the spaces are fetched",
+	)
+
+	flag.BoolVar(
+		&options.CheckResponses,
+		"checkResponses",
+		false,
+		"Check the JSON responses against the OpenAPI document and log the ones not matching",
+	)
+
+	flag.StringVar(
+		&options.Mqtt.Broker,
+		"mqttBroker",
+		"",
+		"Url of the MQTT broker, e.g. tcp://localhost:1883 or ssl://broker:8883, publishing is disabled if empty",
+	)
+
+	flag.StringVar(
+		&options.Mqtt.TopicPrefix,
+		"mqttTopicPrefix",
+		"spaceapi",
+		"Prefix of all published MQTT topics",
+	)
+
+	flag.IntVar(
+		&options.Mqtt.Qos,
+		"mqttQos",
+		1,
+		"MQTT quality of service level (0, 1 or 2)",
+	)
+
+	flag.StringVar(
+		&options.Mqtt.ClientId,
+		"mqttClientId",
+		"spaceapi-directory-collector",
+		"MQTT client id",
+	)
+
+	flag.StringVar(&options.Mqtt.Username, "mqttUsername", "", "MQTT username")
+	flag.StringVar(&options.Mqtt.Password, "mqttPassword", "", "MQTT password")
+	flag.StringVar(&options.Mqtt.CaFile, "mqttCaFile", "", "PEM encoded CA certificates used to verify the MQTT broker")
+	flag.StringVar(&options.Mqtt.CertFile, "mqttCertFile", "", "PEM encoded client certificate for the MQTT broker")
+	flag.StringVar(&options.Mqtt.KeyFile, "mqttKeyFile", "", "PEM encoded key of the client certificate")
+	flag.BoolVar(&options.Mqtt.Insecure, "mqttInsecure", false, "Don't verify the certificate of the MQTT broker")
+}
+
+func storeFlag(store string, name string, value string, usage string) {
+	storeFiles[store] = flag.String(name, value, usage)
+}
+
+func main() {
+	flag.Parse()
+
+	storage := collector.FileStorage{}
+	for store, path := range storeFiles {
+		storage[store] = *path
+	}
+	options.Storage = storage
+	// the binary keeps serving the go and process metrics of the default registry
+	options.Registerer = prometheus.DefaultRegisterer
+	options.Gatherer = prometheus.DefaultGatherer
+
+	c := collector.New(options)
+	if err := c.Start(); err != nil {
+		log.Fatal(err)
+	}
+
+	server := &http.Server{Addr: ":8080", Handler: c.Handler()}
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		log.Println("stopping api...")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}()
+
+	log.Println("starting api...")
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	c.Stop()
+}
@@ -0,0 +1,632 @@
+// Package collector builds the SpaceAPI directory. It periodically validates
+// the endpoints of all spaces, keeps the change log, calendars, feeds and
+// statistics derived from them and serves everything over http.
+//
+// The collector binary in cmd/collector is a thin wrapper around this
+// package, other programs can embed a Collector with their own source of
+// urls, validator and storage.
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/robfig/cron"
+	"github.com/rs/cors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
+	"goji.io"
+	"goji.io/pat"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rebuildTimeout  = 60 * time.Second
+	subscriberQueue = 16
+)
+
+// Options configure a Collector, zero values are replaced by the defaults
+// of the collector binary.
+type Options struct {
+	// Source provides the urls of the endpoints, defaults to the directory
+	// file of the spaceapi/directory repository
+	Source Source
+	// Validator checks the endpoints, defaults to the validation service
+	Validator Validator
+	// Storage persists the state between restarts, nothing is persisted
+	// without a storage
+	Storage Storage
+	// Schedule is the cron spec of the directory rebuilds, defaults to
+	// @every 1m
+	Schedule string
+	// RebuildOnStart rebuilds the directory on Start even if a stored
+	// directory was loaded
+	RebuildOnStart bool
+	// CalendarInterval and PlanetInterval are how often the calendar, blog
+	// and wiki feeds of the spaces are fetched, defaults to 1h and 30m
+	CalendarInterval time.Duration
+	PlanetInterval   time.Duration
+	// ChangeRetention is the number of change events to keep, defaults to
+	// 50000
+	ChangeRetention int
+	// WebhookToken is the bearer token required to manage webhooks,
+	// registration is disabled without a token
+	WebhookToken string
+	// WebhookMaxAttempts are the delivery attempts before a webhook
+	// delivery is moved to the dead letters, defaults to 10
+	WebhookMaxAttempts int
+	Mqtt               MqttOptions
+	// CheckResponses checks the JSON responses of the Handler against the
+	// OpenAPI document and logs the ones not matching
+	CheckResponses bool
+	// Registerer and Gatherer are the prometheus registry the metrics of
+	// the collector are registered with and served from on /metrics. Both
+	// default to a registry of the collector, the Gatherer to the
+	// Registerer if it's a registry itself. Collectors sharing a registry
+	// fail to start.
+	Registerer prometheus.Registerer
+	Gatherer   prometheus.Gatherer
+}
+
+// Collector keeps the directory and everything derived from it. Create it
+// with New, Start it once and Stop it to persist its state.
+type Collector struct {
+	options Options
+	metrics *metrics
+
+	mutex     sync.RWMutex
+	directory map[string]spaceapi.Entry
+
+	// rebuildMutex ensures only one rebuild runs at a time, urls are the
+	// endpoints of the last successful lookup of the source
+	rebuildMutex sync.Mutex
+	urls         []string
+
+	changes       changeLog
+	webhooks      webhookStore
+	calendars     calendarStore
+	planet        planetStore
+	scrapeHistory availabilityStore
+	openingHours  openingHoursStore
+	trends        trendStore
+	statistics    statisticsStore
+	sensors       sensorStore
+	mqttClient    mqtt.Client
+
+	subscribersMutex sync.Mutex
+	subscribers      map[chan []spaceapi.ChangeEvent]bool
+
+	// runMutex guards stopped, Stop waits for the jobs started with run
+	runMutex sync.Mutex
+	stopped  bool
+	running  sync.WaitGroup
+	cron     *cron.Cron
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// New creates a Collector, it doesn't do anything before Start is called.
+func New(options Options) *Collector {
+	if options.Source == nil {
+		options.Source = StaticDirectory(DefaultDirectoryUrl)
+	}
+	if options.Validator == nil {
+		options.Validator = NewValidatorService(nil)
+	}
+	if options.Storage == nil {
+		options.Storage = FileStorage{}
+	}
+	if options.Schedule == "" {
+		options.Schedule = "@every 1m"
+	}
+	if options.CalendarInterval <= 0 {
+		options.CalendarInterval = time.Hour
+	}
+	if options.PlanetInterval <= 0 {
+		options.PlanetInterval = 30 * time.Minute
+	}
+	if options.ChangeRetention <= 0 {
+		options.ChangeRetention = 50000
+	}
+	if options.WebhookMaxAttempts <= 0 {
+		options.WebhookMaxAttempts = 10
+	}
+	if options.Mqtt.TopicPrefix == "" {
+		options.Mqtt.TopicPrefix = "spaceapi"
+	}
+	if options.Mqtt.ClientId == "" {
+		options.Mqtt.ClientId = "spaceapi-directory-collector"
+	}
+	if options.Registerer == nil || options.Gatherer == nil {
+		registry := prometheus.NewRegistry()
+		if options.Registerer == nil {
+			options.Registerer = registry
+		}
+		if options.Gatherer == nil {
+			if gatherer, ok := options.Registerer.(prometheus.Gatherer); ok {
+				options.Gatherer = gatherer
+			} else {
+				options.Gatherer = registry
+			}
+		}
+	}
+
+	return &Collector{
+		options:       options,
+		metrics:       newMetrics(),
+		directory:     make(map[string]spaceapi.Entry),
+		changes:       changeLog{retention: options.ChangeRetention},
+		webhooks:      webhookStore{Hooks: make(map[string]webhook)},
+		calendars:     calendarStore{Calendars: make(map[string]spaceapi.SpaceCalendar)},
+		planet:        planetStore{Feeds: make(map[string]spaceapi.PlanetFeed)},
+		scrapeHistory: availabilityStore{History: make(map[string][]scrapeBucket)},
+		openingHours: openingHoursStore{
+			Spaces: make(map[string]*openingHours),
+			info:   make(map[string]spaceapi.SpaceOpeningHours),
+		},
+		trends:      trendStore{Days: []dailyRollup{}},
+		statistics:  statisticsStore{snapshot: newDirectoryStatistics(time.Time{})},
+		sensors:     sensorStore{readings: []spaceapi.SensorReading{}},
+		subscribers: make(map[chan []spaceapi.ChangeEvent]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// Start loads the stored state, rebuilds the directory if there was none
+// and schedules the rebuilds and the fetching of the feeds. A failing MQTT
+// broker doesn't stop the collector, it's only logged.
+func (c *Collector) Start() error {
+	if err := c.registerMetrics(); err != nil {
+		return fmt.Errorf("can't register metrics: %v", err)
+	}
+
+	if err := c.connectMqtt(); err != nil {
+		log.Printf("Can't connect to MQTT broker %v", err)
+	}
+
+	directoryLoaded, err := c.loadPersistentDirectory()
+	if err != nil {
+		return err
+	}
+	c.loadPersistentChanges()
+	if err := c.loadPersistentWebhooks(); err != nil {
+		return err
+	}
+	c.loadPersistentCalendars()
+	c.loadPersistentPlanet()
+	c.loadPersistentAvailability()
+	c.loadPersistentOpeningHours()
+	c.loadPersistentTrends()
+
+	if c.options.RebuildOnStart || !directoryLoaded {
+		c.Rebuild()
+	}
+
+	c.cron = cron.New()
+	if err := c.cron.AddFunc(c.options.Schedule, func() {
+		c.run(c.Rebuild)
+	}); err != nil {
+		return fmt.Errorf("can't schedule rebuilding the directory: %v", err)
+	}
+	if err := c.cron.AddFunc("@every "+c.options.CalendarInterval.String(), func() {
+		c.run(c.updateCalendars)
+	}); err != nil {
+		return fmt.Errorf("can't schedule fetching calendars: %v", err)
+	}
+	if err := c.cron.AddFunc("@every "+c.options.PlanetInterval.String(), func() {
+		c.run(c.updatePlanet)
+	}); err != nil {
+		return fmt.Errorf("can't schedule fetching planet feeds: %v", err)
+	}
+	c.cron.Start()
+
+	go c.run(c.updateCalendars)
+	go c.run(c.updatePlanet)
+	go c.run(func() {
+		c.runWebhookDeliveries(time.Second)
+	})
+
+	return nil
+}
+
+// Stop cancels the scheduled jobs, waits for the running ones, persists the
+// state and closes the subscriptions.
+func (c *Collector) Stop() {
+	c.stopOnce.Do(func() {
+		c.runMutex.Lock()
+		c.stopped = true
+		c.runMutex.Unlock()
+
+		if c.cron != nil {
+			c.cron.Stop()
+		}
+		close(c.done)
+		c.running.Wait()
+
+		c.persist()
+		c.unregisterMetrics()
+
+		if c.mqttClient != nil {
+			c.mqttClient.Disconnect(uint(mqttPublishTimeout / time.Millisecond))
+		}
+
+		c.subscribersMutex.Lock()
+		for subscriber := range c.subscribers {
+			delete(c.subscribers, subscriber)
+			close(subscriber)
+		}
+		c.subscribersMutex.Unlock()
+	})
+}
+
+// run calls f unless the collector was stopped, Stop waits until it
+// returned.
+func (c *Collector) run(f func()) {
+	c.runMutex.Lock()
+	if c.stopped {
+		c.runMutex.Unlock()
+		return
+	}
+	c.running.Add(1)
+	c.runMutex.Unlock()
+
+	defer c.running.Done()
+	f()
+}
+
+// start runs f in a goroutine unless the collector was stopped. Unlike
+// go c.run(f), Stop waits for it as soon as start returned true.
+func (c *Collector) start(f func()) bool {
+	c.runMutex.Lock()
+	defer c.runMutex.Unlock()
+	if c.stopped {
+		return false
+	}
+	c.running.Add(1)
+
+	go func() {
+		defer c.running.Done()
+		f()
+	}()
+	return true
+}
+
+// Snapshot returns the current directory by endpoint url. The map is a
+// copy, the data of the entries is shared and must not be modified.
+func (c *Collector) Snapshot() map[string]spaceapi.Entry {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return copyDirectory(c.directory)
+}
+
+// Subscribe returns a channel receiving the change events of every rebuild
+// and a function ending the subscription. Events are dropped for
+// subscribers that don't keep up, the change log has all of them.
+func (c *Collector) Subscribe() (<-chan []spaceapi.ChangeEvent, func()) {
+	subscriber := make(chan []spaceapi.ChangeEvent, subscriberQueue)
+
+	c.subscribersMutex.Lock()
+	c.subscribers[subscriber] = true
+	c.subscribersMutex.Unlock()
+
+	return subscriber, func() {
+		c.subscribersMutex.Lock()
+		defer c.subscribersMutex.Unlock()
+		if c.subscribers[subscriber] {
+			delete(c.subscribers, subscriber)
+			close(subscriber)
+		}
+	}
+}
+
+func (c *Collector) notifySubscribers(events []spaceapi.ChangeEvent) {
+	c.subscribersMutex.Lock()
+	defer c.subscribersMutex.Unlock()
+
+	for subscriber := range c.subscribers {
+		select {
+		case subscriber <- events:
+		default:
+			log.Println("subscriber is too slow, dropping change events...")
+		}
+	}
+}
+
+// Handler serves the directory and everything derived from it.
+func (c *Collector) Handler() http.Handler {
+	co := cors.New(cors.Options{
+		AllowedOrigins: []string{"*"},
+	})
+
+	mux := goji.NewMux()
+	mux.Use(co.Handler)
+	mux.Use(c.statisticMiddelware)
+
+	mux.Handle(pat.Get("/metrics"), promhttp.HandlerFor(c.options.Gatherer, promhttp.HandlerOpts{}))
+
+	spec := c.spec()
+	if c.options.CheckResponses {
+		spec.CheckResponses = c.logNonConformingResponse
+	}
+	handleRoutes(mux, spec)
+
+	return mux
+}
+
+// spec generates the OpenAPI document of the routes of the collector.
+func (c *Collector) spec() *openapi.Spec {
+	spec := openapi.New(collectorDocument, c.routes())
+	spec.PathParam = pat.Param
+
+	return spec
+}
+
+// handleRoutes registers the routes of the spec and the document itself on
+// /openapi.json.
+func handleRoutes(mux *goji.Mux, spec *openapi.Spec) {
+	for _, route := range spec.Routes() {
+		mux.Handle(routePattern(route), spec.Handler(route))
+	}
+	mux.Handle(pat.Get("/openapi.json"), spec)
+}
+
+func (c *Collector) serveDirectory(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(func() interface{} {
+		var foo []spaceapi.Entry
+		for _, entry := range c.Snapshot() {
+			foo = append(foo, entry)
+		}
+		return foo
+	}()); err != nil {
+		panic(err)
+	}
+}
+
+func (c *Collector) logNonConformingResponse(r *http.Request, route openapi.Route, problems []string) {
+	c.metrics.nonConformingResponses.With(prometheus.Labels{"method": route.Method, "route": route.Path}).Inc()
+	log.Printf("response of %s %s doesn't match the OpenAPI document: %s", r.Method, r.URL, strings.Join(problems, "; "))
+}
+
+// Rebuild looks up the urls of the source, validates all endpoints and
+// replaces the directory. It's called on the schedule of the options, only
+// one rebuild runs at a time.
+func (c *Collector) Rebuild() {
+	c.rebuildMutex.Lock()
+	defer c.rebuildMutex.Unlock()
+
+	log.Println("rebuilding directory...")
+	ctx, cancel := context.WithTimeout(context.Background(), rebuildTimeout)
+	defer cancel()
+
+	previousDirectory := c.Snapshot()
+	directory := copyDirectory(previousDirectory)
+	c.updateUrls(ctx)
+	removeMissingEntries(directory, c.urls)
+	unchecked := c.buildDirectory(ctx, directory)
+	c.recordAvailability(directory, unchecked, time.Now())
+	updateDeprecations(directory)
+	normalizeDirectory(directory)
+
+	c.mutex.Lock()
+	c.directory = directory
+	c.mutex.Unlock()
+
+	events := c.recordChanges(previousDirectory, directory)
+	c.queueWebhookDeliveries(events)
+	c.publishChangesMqtt(previousDirectory, events)
+	if len(events) > 0 {
+		c.notifySubscribers(events)
+	}
+	c.updateCalendarSources(directory)
+	c.updatePlanetSources(directory)
+	c.updateSensors(directory)
+	c.updateOpeningHours(directory, time.Now())
+	c.recordTrends(c.generateStatistics(directory))
+	c.persistDirectory()
+	c.persistChanges()
+	c.persistAvailability()
+	c.persistOpeningHours()
+	c.persistTrends()
+	log.Println("rebuilding done.")
+}
+
+// updateUrls looks up the urls of the source, the previous urls are kept if
+// the source fails.
+func (c *Collector) updateUrls(ctx context.Context) {
+	urls, err := c.options.Source.Urls(ctx)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't look up the urls, keeping the previous ones...")
+		return
+	}
+
+	c.urls = urls
+}
+
+func removeMissingEntries(directory map[string]spaceapi.Entry, urls []string) {
+	exists := false
+	for directoryUrl := range directory {
+		exists = false
+		for _, url := range urls {
+			if directoryUrl == url {
+				exists = true
+			}
+		}
+
+		if !exists {
+			delete(directory, directoryUrl)
+		}
+	}
+}
+
+func (c *Collector) persist() {
+	c.persistDirectory()
+	c.persistChanges()
+	c.persistWebhooks()
+	c.persistCalendars()
+	c.persistPlanet()
+	c.persistAvailability()
+	c.persistOpeningHours()
+	c.persistTrends()
+}
+
+func (c *Collector) persistDirectory() {
+	log.Println("writing...")
+	c.mutex.RLock()
+	spaceApiDirectoryJson, err := json.Marshal(c.directory)
+	c.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		log.Println("can't marshal api directory")
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreDirectory, spaceApiDirectoryJson); err != nil {
+		log.Println(err)
+		log.Println("can't store api directory")
+	}
+}
+
+func (c *Collector) loadPersistentDirectory() (bool, error) {
+	log.Println("reading...")
+	content, err := c.options.Storage.Load(StoreDirectory)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read directory, skipping...")
+		return false, nil
+	}
+
+	directory := make(map[string]spaceapi.Entry)
+	if err := json.Unmarshal(content, &directory); err != nil {
+		return false, fmt.Errorf("can't unmarshal api directory: %v", err)
+	}
+	assignSpaceIds(directory)
+	c.generateStatistics(directory)
+	c.updateSensors(directory)
+
+	c.mutex.Lock()
+	c.directory = directory
+	c.mutex.Unlock()
+
+	return true, nil
+}
+
+// feedFetchWorkers limits the concurrent requests when fetching the feeds
+// published by the spaces.
+const feedFetchWorkers = 8
+
+// forEachParallel calls f for the indexes 0 to n-1 with at most workers
+// calls running at the same time and waits until all of them returned.
+func forEachParallel(n int, workers int, f func(i int)) {
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, workers)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			f(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// scrape is the entry built from a validation of an endpoint. checked is
+// false if the validator failed, the entry is the previous one then.
+type scrape struct {
+	entry   spaceapi.Entry
+	checked bool
+}
+
+// buildDirectory validates all endpoints and updates their entries. The urls
+// of the endpoints the validator failed for are returned.
+func (c *Collector) buildDirectory(ctx context.Context, directory map[string]spaceapi.Entry) map[string]bool {
+	scrapes := make(chan scrape, 32)
+	for _, spaceApiUrl := range c.urls {
+		go c.buildEntry(ctx, spaceApiUrl, directory[spaceApiUrl], scrapes)
+	}
+
+	previous := make(map[string]spaceapi.Entry, len(c.urls))
+	unchecked := make(map[string]bool)
+	n := len(c.urls)
+	for ; n > 0; n-- {
+		v := <-scrapes
+		if !v.checked {
+			unchecked[v.entry.Url] = true
+		}
+
+		previous[v.entry.Url] = directory[v.entry.Url]
+		directory[v.entry.Url] = v.entry
+	}
+
+	// the ids have to be unique before the spaces are published under them
+	assignSpaceIds(directory)
+	forEachParallel(len(c.urls), mqttPublishWorkers, func(i int) {
+		c.publishSpaceMqtt(directory[c.urls[i]], previous[c.urls[i]])
+	})
+
+	return unchecked
+}
+
+// buildEntry validates an endpoint and updates the previous entry of the
+// space with the result. The previous entry is kept as it is if the
+// validator fails, and the last data of the space is kept if the endpoint
+// didn't provide any. The id of a space is kept once it was derived from its
+// data, so the space keeps it when it's renamed.
+func (c *Collector) buildEntry(ctx context.Context, url string, previous spaceapi.Entry, scrapes chan scrape) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	start := time.Now()
+
+	entry := previous
+	entry.Url = url
+
+	result, data, err := c.options.Validator.Validate(ctx, url)
+	defer func() {
+		c.metrics.spaceRequestSummary.With(prometheus.Labels{"route": url}).Observe(time.Since(start).Seconds())
+	}()
+	if err != nil {
+		log.Printf("can't validate %v: %v\n", url, err)
+		scrapes <- scrape{entry: entry}
+		return
+	}
+
+	c.observeValidation(url, result)
+	entry.ValidationResult = result
+	entry.Valid = result.Valid
+	if data != nil {
+		if entry.Data == nil {
+			// the id was derived from the url, the data gives the space a name
+			entry.Id = ""
+		}
+		entry.LastSeen = time.Now().Unix()
+		entry.Data = data
+	}
+
+	scrapes <- scrape{entry: entry, checked: true}
+	return
+}
+
+func (c *Collector) observeValidation(url string, result spaceapi.ValidationResult) {
+	var b2i = map[bool]float64{false: 0, true: 1}
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "isHttps"}).Set(b2i[result.IsHttps])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "HttpsForward"}).Set(b2i[result.HttpsForward])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "Reachable"}).Set(b2i[result.Reachable])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "Cors"}).Set(b2i[result.Cors])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "ContentType"}).Set(b2i[result.ContentType])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "CertValid"}).Set(b2i[result.CertValid])
+	c.metrics.spaceValidationGauge.With(prometheus.Labels{"route": url, "attribute": "Valid"}).Set(b2i[result.Valid])
+	for _, v := range result.CheckedVersions {
+		c.metrics.spaceValidationVersionsGauge.With(prometheus.Labels{"route": url, "version": v}).Set(1)
+	}
+}
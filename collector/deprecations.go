@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"github.com/spaceapi/directory-api/spaceapi"
+	"sort"
+	"strings"
+)
+
+// latestSchemaVersion is the version spaces are asked to migrate to.
+const latestSchemaVersion = "15"
+
+// requiredFields are the fields a space needs for the latest version, next
+// to declaring it in api_compatibility.
+var requiredFields = []string{"/space", "/logo", "/url", "/contact"}
+
+// fieldReplacements suggest what to use instead of fields that are gone in
+// the latest version.
+var fieldReplacements = map[string]string{
+	"/api":                     "declare the versions in /api_compatibility",
+	"/contact/jabber":          "use /contact/xmpp",
+	"/contact/issue_mail":      "15 has no address for issue reports",
+	"/issue_report_channels[]": "15 has no channels for issue reports",
+	"/cache/schedule":          "the directory decides how often endpoints are fetched",
+}
+
+// updateDeprecations adds a deprecation report to the validation result of
+// every space that declares a version.
+func updateDeprecations(directory map[string]spaceapi.Entry) {
+	for url, e := range directory {
+		e.ValidationResult.Deprecations = nil
+
+		versions, fields, err := getNewStats(e.Data)
+		if err == nil {
+			e.ValidationResult.Deprecations = newDeprecationReport(versions, fields)
+		}
+
+		directory[url] = e
+	}
+}
+
+func newDeprecationReport(versions []string, fields []string) *spaceapi.DeprecationReport {
+	report := &spaceapi.DeprecationReport{
+		Versions:           versions,
+		DeprecatedVersions: []string{},
+		DeprecatedFields:   []string{},
+		Changes:            []string{},
+	}
+
+	used := make(map[string]bool)
+	for _, field := range fields {
+		used[field] = true
+	}
+
+	declaresLatest := false
+	deprecated := make(map[string]bool)
+	for _, version := range versions {
+		if version == latestSchemaVersion {
+			declaresLatest = true
+		}
+		if strings.HasPrefix(version, "0.") {
+			report.DeprecatedVersions = append(report.DeprecatedVersions, version)
+		}
+
+		for _, field := range fields {
+			known, hasSchema := knownField(version, field)
+			if latest, _ := knownField(latestSchemaVersion, field); hasSchema && known && !latest {
+				deprecated[field] = true
+			}
+		}
+	}
+	for field := range deprecated {
+		report.DeprecatedFields = append(report.DeprecatedFields, field)
+	}
+	sort.Strings(report.DeprecatedFields)
+
+	if !declaresLatest {
+		report.Changes = append(report.Changes, "declare "+latestSchemaVersion+" in /api_compatibility")
+	}
+	for _, field := range requiredFields {
+		if !used[field] && !usesParent(fields, field) {
+			report.Changes = append(report.Changes, "add "+field)
+		}
+	}
+	for _, field := range fields {
+		if known, _ := knownField(latestSchemaVersion, field); known {
+			continue
+		}
+		change := "remove " + field
+		if replacement, ok := fieldReplacements[field]; ok {
+			change += ", " + replacement
+		}
+		report.Changes = append(report.Changes, change)
+	}
+	report.Compliant = len(report.Changes) == 0
+
+	return report
+}
+
+// usesParent reports whether any field is nested in parent, e.g. /contact
+// is used if there is a /contact/email.
+func usesParent(fields []string, parent string) bool {
+	for _, field := range fields {
+		if strings.HasPrefix(field, parent+"/") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"reflect"
+	"testing"
+)
+
+func TestNewDeprecationReport(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected spaceapi.DeprecationReport
+	}{
+		{"compliant", `{"api_compatibility": ["14", "15"], "space": "a", "logo": "b", "url": "c", "contact": {"email": "d"}, "ext_ccc": "erfa"}`,
+			spaceapi.DeprecationReport{
+				Versions: []string{"14", "15"}, DeprecatedVersions: []string{}, DeprecatedFields: []string{},
+				Compliant: true, Changes: []string{},
+			}},
+		{"legacy", `{"api": "0.13", "space": "a", "logo": "b", "url": "c", "contact": {"jabber": "d"}}`,
+			spaceapi.DeprecationReport{
+				Versions: []string{"0.13"}, DeprecatedVersions: []string{"0.13"},
+				DeprecatedFields: []string{"/api", "/contact/jabber"},
+				Changes: []string{
+					"declare 15 in /api_compatibility",
+					"remove /api, declare the versions in /api_compatibility",
+					"remove /contact/jabber, use /contact/xmpp",
+				},
+			}},
+		{"missing fields", `{"api_compatibility": ["15"], "space": "a"}`,
+			spaceapi.DeprecationReport{
+				Versions: []string{"15"}, DeprecatedVersions: []string{}, DeprecatedFields: []string{},
+				Changes: []string{"add /logo", "add /url", "add /contact"},
+			}},
+		// fields that aren't in any schema have to go, but aren't deprecated
+		{"unknown field", `{"api_compatibility": ["15"], "space": "a", "logo": "b", "url": "c", "contact": {"email": "d"}, "favourite_color": "green"}`,
+			spaceapi.DeprecationReport{
+				Versions: []string{"15"}, DeprecatedVersions: []string{}, DeprecatedFields: []string{},
+				Changes: []string{"remove /favourite_color"},
+			}},
+		{"unknown version", `{"api_compatibility": ["16"], "space": "a", "logo": "b", "url": "c", "contact": {"email": "d"}}`,
+			spaceapi.DeprecationReport{
+				Versions: []string{"16"}, DeprecatedVersions: []string{}, DeprecatedFields: []string{},
+				Changes: []string{"declare 15 in /api_compatibility"},
+			}},
+	} {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(test.data), &data); err != nil {
+			t.Fatal(err)
+		}
+		versions, fields, err := getNewStats(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := newDeprecationReport(versions, fields); !reflect.DeepEqual(*report, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, *report)
+		}
+	}
+}
+
+func TestUpdateDeprecations(t *testing.T) {
+	directory := map[string]spaceapi.Entry{
+		"versioned": {Data: map[string]interface{}{"api_compatibility": []interface{}{"15"}, "space": "a"}},
+		"unversioned": {
+			Data:             map[string]interface{}{"space": "b"},
+			ValidationResult: spaceapi.ValidationResult{Deprecations: &spaceapi.DeprecationReport{Compliant: true}},
+		},
+	}
+	updateDeprecations(directory)
+
+	if report := directory["versioned"].ValidationResult.Deprecations; report == nil || report.Compliant {
+		t.Errorf("expected a report for the versioned space, got %+v", report)
+	}
+	if report := directory["unversioned"].ValidationResult.Deprecations; report != nil {
+		t.Errorf("expected the outdated report to be removed, got %+v", report)
+	}
+}
@@ -4,15 +4,20 @@ go 1.12
 
 require (
 	github.com/codingsince1985/geo-golang v1.6.1
+	github.com/eclipse/paho.mqtt.golang v1.2.0
 	github.com/felixge/httpsnoop v1.0.1
 	github.com/golang/protobuf v1.3.5 // indirect
+	github.com/microcosm-cc/bluemonday v1.0.9
 	github.com/prometheus/client_golang v1.3.0
 	github.com/prometheus/procfs v0.0.11 // indirect
 	github.com/robfig/cron v1.2.0
 	github.com/rs/cors v1.7.0
 	github.com/spaceapi-community/go-spaceapi-validator-client v1.2.0
+	github.com/spaceapi/directory-api/spaceapi v0.0.0
 	goji.io v2.0.2+incompatible
-	golang.org/x/net v0.0.0-20191209160850-c0dbc17a3553 // indirect
+	golang.org/x/net v0.0.0-20210421230115-4e50805a0758
 	golang.org/x/oauth2 v0.0.0-20191202225959-858c2ad4c8b6 // indirect
 	google.golang.org/appengine v1.6.5 // indirect
 )
+
+replace github.com/spaceapi/directory-api/spaceapi => ../spaceapi
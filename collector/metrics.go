@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"time"
+)
+
+// metrics are the prometheus metrics of a Collector. Every collector has
+// its own, Start registers them with the Registerer of the options and Stop
+// removes them again.
+type metrics struct {
+	spaceRequestSummary          *prometheus.SummaryVec
+	spaceValidationGauge         *prometheus.GaugeVec
+	spaceValidationVersionsGauge *prometheus.GaugeVec
+	spaceFieldGauge              *prometheus.GaugeVec
+	spaceVersionGauge            *prometheus.GaugeVec
+	spaceFieldVersionGauge       *prometheus.GaugeVec
+	spaceCountryGauge            *prometheus.GaugeVec
+	availabilityGauge            *prometheus.GaugeVec
+	sensorValueGauge             *prometheus.GaugeVec
+	calendarFetchCounter         *prometheus.CounterVec
+	calendarEventsGauge          prometheus.Gauge
+	planetFetchCounter           *prometheus.CounterVec
+	webhookDeliveryCounter       *prometheus.CounterVec
+	webhookDeliverySummary       prometheus.Summary
+	webhookQueueGauge            *prometheus.GaugeVec
+	httpRequestSummary           *prometheus.SummaryVec
+	nonConformingResponses       *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		spaceRequestSummary: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name:   "spaceapi_response",
+				Help:   "All the scraped spaces!",
+				MaxAge: 4 * time.Hour,
+			},
+			[]string{"route"},
+		),
+		spaceValidationGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_validation",
+				Help: "Result of the validator",
+			},
+			[]string{"route", "attribute"},
+		),
+		spaceValidationVersionsGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_validation_version",
+				Help: "SpaceAPI versions implemented by an endpoint",
+			},
+			[]string{"route", "version"},
+		),
+		spaceFieldGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_field",
+				Help: "Fields used from the spec",
+			},
+			[]string{"field"},
+		),
+		spaceVersionGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_version",
+				Help: "Versions used in the directory",
+			},
+			[]string{"version"},
+		),
+		spaceFieldVersionGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_field_version",
+				Help: "Fields used from the spec per declared version",
+			},
+			[]string{"version", "field"},
+		),
+		spaceCountryGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_country",
+				Help: "Countries spaces are from",
+			},
+			[]string{"country"},
+		),
+		availabilityGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_availability",
+				Help: "Share of successful scrapes of an endpoint",
+			},
+			[]string{"route", "window", "check"},
+		),
+		sensorValueGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_sensor_value",
+				Help: "Sensor values of the spaces in their normalized unit",
+			},
+			[]string{"space", "type", "property", "sensor", "unit"},
+		),
+		calendarFetchCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "spaceapi_calendar_fetches",
+				Help: "Fetched iCalendar feeds by result",
+			},
+			[]string{"result"},
+		),
+		calendarEventsGauge: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_calendar_events",
+				Help: "Events of all fetched iCalendar feeds",
+			},
+		),
+		planetFetchCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "spaceapi_planet_fetches",
+				Help: "Fetched blog and wiki feeds by result",
+			},
+			[]string{"result"},
+		),
+		webhookDeliveryCounter: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "spaceapi_webhook_deliveries",
+				Help: "Webhook delivery attempts by result",
+			},
+			[]string{"result"},
+		),
+		webhookDeliverySummary: prometheus.NewSummary(
+			prometheus.SummaryOpts{
+				Name: "spaceapi_webhook_delivery_duration",
+				Help: "Time used to deliver a webhook",
+			},
+		),
+		webhookQueueGauge: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_webhook_queue",
+				Help: "Webhook deliveries waiting in the queue and the dead letter list",
+			},
+			[]string{"queue"},
+		),
+		httpRequestSummary: prometheus.NewSummaryVec(
+			prometheus.SummaryOpts{
+				Name: "spaceapi_http_requests",
+				Help: "All the http requests!",
+			},
+			[]string{"method", "route", "code"},
+		),
+		nonConformingResponses: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "spaceapi_openapi_nonconforming_responses",
+				Help: "Responses not matching their schema in the OpenAPI document",
+			},
+			[]string{"method", "route"},
+		),
+	}
+}
+
+func (m *metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{
+		m.spaceRequestSummary,
+		m.spaceValidationGauge,
+		m.spaceValidationVersionsGauge,
+		m.spaceFieldGauge,
+		m.spaceVersionGauge,
+		m.spaceFieldVersionGauge,
+		m.spaceCountryGauge,
+		m.availabilityGauge,
+		m.sensorValueGauge,
+		m.calendarFetchCounter,
+		m.calendarEventsGauge,
+		m.planetFetchCounter,
+		m.webhookDeliveryCounter,
+		m.webhookDeliverySummary,
+		m.webhookQueueGauge,
+		m.httpRequestSummary,
+		m.nonConformingResponses,
+	}
+}
+
+// registerMetrics registers the metrics of the collector and of its source
+// if it has any. Nothing stays registered if one of them fails.
+func (c *Collector) registerMetrics() error {
+	collectors := c.metrics.collectors()
+	if source, ok := c.options.Source.(prometheus.Collector); ok {
+		collectors = append(collectors, source)
+	}
+
+	for i, collector := range collectors {
+		if err := c.options.Registerer.Register(collector); err != nil {
+			for _, registered := range collectors[:i] {
+				c.options.Registerer.Unregister(registered)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Collector) unregisterMetrics() {
+	for _, collector := range c.metrics.collectors() {
+		c.options.Registerer.Unregister(collector)
+	}
+	if source, ok := c.options.Source.(prometheus.Collector); ok {
+		c.options.Registerer.Unregister(source)
+	}
+}
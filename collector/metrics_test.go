@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCollectorsHaveTheirOwnMetrics(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	first := newFixtureCollector(server, Options{})
+	second := newFixtureCollector(server, Options{})
+	for _, c := range []*Collector{first, second} {
+		if err := c.Start(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer first.Stop()
+	defer second.Stop()
+
+	first.Rebuild()
+	if count := testutil.ToFloat64(first.metrics.spaceVersionGauge.With(prometheus.Labels{"version": "14"})); count != 1 {
+		t.Errorf("expected 1 space with version 14, got %v", count)
+	}
+
+	// requests to the first collector aren't counted by the second one
+	first.Handler().ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/stats", nil))
+	if !gathers(t, first, "spaceapi_http_requests") {
+		t.Errorf("the request isn't in the metrics of the first collector")
+	}
+	if gathers(t, second, "spaceapi_http_requests") {
+		t.Errorf("the request to the first collector is in the metrics of the second one")
+	}
+}
+
+func gathers(t *testing.T, c *Collector, name string) bool {
+	families, err := c.options.Gatherer.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCollectorsCantShareARegistry(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	registry := prometheus.NewRegistry()
+	first := newFixtureCollector(server, Options{Registerer: registry})
+	if err := first.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	second := newFixtureCollector(server, Options{Registerer: registry})
+	if err := second.Start(); err == nil || !strings.Contains(err.Error(), "can't register metrics") {
+		t.Errorf("expected the registration to fail, got %v", err)
+	}
+
+	// the metrics are unregistered when the collector stops
+	first.Stop()
+	third := newFixtureCollector(server, Options{Registerer: registry})
+	if err := third.Start(); err != nil {
+		t.Fatal(err)
+	}
+	third.Stop()
+}
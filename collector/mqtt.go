@@ -0,0 +1,326 @@
+package collector
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	mqttPublishTimeout = 10 * time.Second
+	// mqttPublishWorkers limits the spaces published at the same time
+	mqttPublishWorkers = 8
+	// mqttMaxRetryDelay is the longest delay between attempts to connect to
+	// a broker that wasn't reachable on start
+	mqttMaxRetryDelay = time.Minute
+)
+
+// MqttOptions configure publishing the spaces and change events to an MQTT
+// broker, publishing is disabled without a broker.
+type MqttOptions struct {
+	// Broker is the url of the broker, e.g. tcp://localhost:1883 or
+	// ssl://broker:8883
+	Broker string
+	// TopicPrefix is prepended to all published topics, defaults to spaceapi
+	TopicPrefix string
+	// Qos is the quality of service level (0, 1 or 2)
+	Qos      int
+	ClientId string
+	Username string
+	Password string
+	// CaFile contains the PEM encoded CA certificates used to verify the
+	// broker, CertFile and KeyFile a PEM encoded client certificate
+	CaFile   string
+	CertFile string
+	KeyFile  string
+	// Insecure skips the verification of the certificate of the broker
+	Insecure bool
+}
+
+// connectMqtt connects to the configured broker, without a broker the
+// publishing functions don't do anything. If the broker isn't reachable yet
+// the connection is retried in the background, messages published until
+// then are dropped. The spaces are published again whenever the connection
+// is established, the broker may have lost the retained messages.
+func (c *Collector) connectMqtt() error {
+	options := c.options.Mqtt
+	if options.Broker == "" {
+		return nil
+	}
+	if options.Qos < 0 || options.Qos > 2 {
+		return fmt.Errorf("invalid MQTT qos %d", options.Qos)
+	}
+
+	tlsConfig, err := mqttTlsConfig(options)
+	if err != nil {
+		return err
+	}
+
+	clientOptions := mqtt.NewClientOptions().
+		AddBroker(options.Broker).
+		SetClientID(options.ClientId).
+		SetUsername(options.Username).
+		SetPassword(options.Password).
+		SetTLSConfig(tlsConfig).
+		SetAutoReconnect(true).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("lost connection to MQTT broker: %v\n", err)
+		}).
+		SetOnConnectHandler(func(_ mqtt.Client) {
+			c.start(c.republishMqtt)
+		})
+
+	c.mqttClient = mqtt.NewClient(clientOptions)
+	if err := connectMqttClient(c.mqttClient); err != nil {
+		log.Printf("can't connect to MQTT broker, retrying in the background: %v\n", err)
+		c.start(c.retryMqttConnect)
+	}
+
+	return nil
+}
+
+func connectMqttClient(client mqtt.Client) error {
+	token := client.Connect()
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		return errors.New("timeout while connecting to the MQTT broker")
+	}
+
+	return token.Error()
+}
+
+// retryMqttConnect connects to the broker with a growing delay between the
+// attempts until it succeeds or the collector is stopped. Once connected,
+// the client reconnects by itself.
+func (c *Collector) retryMqttConnect() {
+	delay := time.Second
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-time.After(delay):
+		}
+
+		err := connectMqttClient(c.mqttClient)
+		if err == nil {
+			log.Println("connected to MQTT broker")
+			return
+		}
+		log.Printf("can't connect to MQTT broker: %v\n", err)
+
+		delay *= 2
+		if delay > mqttMaxRetryDelay {
+			delay = mqttMaxRetryDelay
+		}
+	}
+}
+
+// republishMqtt publishes the retained messages of all spaces.
+func (c *Collector) republishMqtt() {
+	// a rebuild running at the same time publishes newer data
+	c.rebuildMutex.Lock()
+	defer c.rebuildMutex.Unlock()
+
+	var entries []spaceapi.Entry
+	for _, e := range c.Snapshot() {
+		entries = append(entries, e)
+	}
+	forEachParallel(len(entries), mqttPublishWorkers, func(i int) {
+		c.publishSpaceMqtt(entries[i], spaceapi.Entry{})
+	})
+}
+
+func mqttTlsConfig(options MqttOptions) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: options.Insecure}
+
+	if options.CaFile != "" {
+		ca, err := ioutil.ReadFile(options.CaFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, errors.New("no certificates found in " + options.CaFile)
+		}
+	}
+
+	if options.CertFile != "" || options.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(options.CertFile, options.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+func (c *Collector) mqttTopic(parts ...string) string {
+	return c.options.Mqtt.TopicPrefix + "/" + strings.Join(parts, "/")
+}
+
+func (c *Collector) mqttPublish(topic string, retained bool, payload interface{}) {
+	if !c.mqttClient.IsConnected() {
+		// losing the connection is logged once by the client
+		return
+	}
+	token := c.mqttClient.Publish(topic, byte(c.options.Mqtt.Qos), retained, payload)
+	if !token.WaitTimeout(mqttPublishTimeout) {
+		log.Printf("timeout while publishing to %v\n", topic)
+		return
+	}
+	if err := token.Error(); err != nil {
+		log.Printf("can't publish to %v: %v\n", topic, err)
+	}
+}
+
+func (c *Collector) mqttPublishJson(topic string, retained bool, value interface{}) {
+	payload, err := json.Marshal(value)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	c.mqttPublish(topic, retained, payload)
+}
+
+// mqttMessage is a retained message describing a space.
+type mqttMessage struct {
+	topic   string
+	payload []byte
+}
+
+// publishSpaceMqtt publishes the current state, sensors and validity of a
+// space as retained messages, so new subscribers get the latest values.
+// previous is the entry of the last scrape, the retained messages of sensors
+// and state fields the space doesn't publish anymore are cleared.
+func (c *Collector) publishSpaceMqtt(e spaceapi.Entry, previous spaceapi.Entry) {
+	if c.mqttClient == nil {
+		return
+	}
+
+	published := make(map[string]bool)
+	for _, message := range c.mqttSpaceMessages(spaceId(e), e) {
+		c.mqttPublish(message.topic, true, message.payload)
+		published[message.topic] = true
+	}
+	// without data we don't know which messages the space still has
+	if previous.Url == "" || e.Data == nil {
+		return
+	}
+	for _, message := range c.mqttSpaceMessages(spaceId(previous), previous) {
+		if !published[message.topic] {
+			c.mqttPublish(message.topic, true, []byte{})
+		}
+	}
+}
+
+// clearSpaceMqtt publishes empty retained messages to the topics of a space,
+// which makes the broker drop the messages retained for them.
+func (c *Collector) clearSpaceMqtt(id string, e spaceapi.Entry) {
+	if c.mqttClient == nil {
+		return
+	}
+
+	for _, message := range c.mqttSpaceMessages(id, e) {
+		c.mqttPublish(message.topic, true, []byte{})
+	}
+}
+
+// mqttSpaceMessages returns the retained messages of a space, the sensors
+// are sorted by type.
+func (c *Collector) mqttSpaceMessages(id string, e spaceapi.Entry) []mqttMessage {
+	var messages []mqttMessage
+	add := func(payload []byte, parts ...string) {
+		messages = append(messages, mqttMessage{topic: c.mqttTopic(append([]string{id}, parts...)...), payload: payload})
+	}
+	addJson := func(value interface{}, parts ...string) {
+		payload, err := json.Marshal(value)
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		add(payload, parts...)
+	}
+
+	add([]byte(strconv.FormatBool(e.Valid)), "valid")
+	addJson(e.ValidationResult, "validation")
+
+	if e.Data == nil {
+		return messages
+	}
+
+	if state, ok := e.Data["state"].(map[string]interface{}); ok {
+		if open, ok := state["open"].(bool); ok {
+			add([]byte(strconv.FormatBool(open)), "state", "open")
+		}
+		if lastChange, ok := state["lastchange"].(float64); ok {
+			add([]byte(strconv.FormatFloat(lastChange, 'f', -1, 64)), "state", "lastchange")
+		}
+		if message, ok := state["message"].(string); ok {
+			add([]byte(message), "state", "message")
+		}
+	}
+
+	sensors, _ := e.Data["sensors"].(map[string]interface{})
+	var sensorTypes []string
+	for sensorType := range sensors {
+		sensorTypes = append(sensorTypes, sensorType)
+	}
+	sort.Strings(sensorTypes)
+
+	for _, sensorType := range sensorTypes {
+		measurements, _ := sensors[sensorType].([]interface{})
+		for i, measurement := range measurements {
+			addJson(measurement, "sensors", sensorType, mqttSensorName(measurement, i))
+		}
+	}
+
+	return messages
+}
+
+// mqttSensorName builds a topic level for a sensor from its name or location
+// and falls back to its position in the list.
+func mqttSensorName(measurement interface{}, index int) string {
+	values, _ := measurement.(map[string]interface{})
+	for _, key := range []string{"name", "location"} {
+		if name, ok := values[key].(string); ok && name != "" {
+			return mqttTopicLevel(name)
+		}
+	}
+
+	return strconv.Itoa(index)
+}
+
+// mqttTopicLevel strips the characters with a special meaning in topics.
+func mqttTopicLevel(name string) string {
+	return strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(name)
+}
+
+// publishChangesMqtt publishes the change events of a rebuild, they're not
+// retained as they only make sense for connected subscribers. The retained
+// messages of removed spaces are cleared, previous is the directory before
+// the rebuild.
+func (c *Collector) publishChangesMqtt(previous map[string]spaceapi.Entry, events []spaceapi.ChangeEvent) {
+	if c.mqttClient == nil {
+		return
+	}
+
+	for _, event := range events {
+		c.mqttPublishJson(c.mqttTopic("events"), false, event)
+		c.mqttPublishJson(c.mqttTopic(event.SpaceId, "events"), false, event)
+
+		if event.Type == spaceapi.ChangeRemoved {
+			c.clearSpaceMqtt(event.SpaceId, previous[event.Url])
+		}
+	}
+}
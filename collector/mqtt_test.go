@@ -0,0 +1,247 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"github.com/eclipse/paho.mqtt.golang"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeMqttClient records the published messages instead of sending them to a
+// broker, the retained ones are kept like a broker would. The first
+// connectErrors attempts to connect fail.
+type fakeMqttClient struct {
+	mqtt.Client
+	mutex         sync.Mutex
+	retained      map[string][]byte
+	topics        []string
+	disconnected  bool
+	connectErrors int
+	connects      int
+}
+
+func newFakeMqttClient() *fakeMqttClient {
+	return &fakeMqttClient{retained: make(map[string][]byte)}
+}
+
+// fakeMqttToken is a completed token with the error of the operation.
+type fakeMqttToken struct {
+	mqtt.DummyToken
+	err error
+}
+
+func (t *fakeMqttToken) Error() error {
+	return t.err
+}
+
+func (f *fakeMqttClient) Connect() mqtt.Token {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.connects++
+	if f.connects <= f.connectErrors {
+		return &fakeMqttToken{err: errors.New("connection refused")}
+	}
+	f.disconnected = false
+	return &fakeMqttToken{}
+}
+
+func (f *fakeMqttClient) IsConnected() bool {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return !f.disconnected
+}
+
+func (f *fakeMqttClient) Publish(topic string, qos byte, retained bool, payload interface{}) mqtt.Token {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.topics = append(f.topics, topic)
+	if retained {
+		content := payload.([]byte)
+		if len(content) == 0 {
+			delete(f.retained, topic)
+		} else {
+			f.retained[topic] = content
+		}
+	}
+
+	return &mqtt.DummyToken{}
+}
+
+func (f *fakeMqttClient) Disconnect(quiesce uint) {}
+
+func (f *fakeMqttClient) retainedTopics(prefix string) []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	var topics []string
+	for topic := range f.retained {
+		if strings.HasPrefix(topic, prefix) {
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+func TestRemovedSpacesAreClearedFromTheBroker(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{})
+	client := newFakeMqttClient()
+	c.mqttClient = client
+
+	c.Rebuild()
+	legacy := client.retainedTopics("spaceapi/legacy-space/")
+	if len(legacy) == 0 {
+		t.Fatal("nothing was retained for the legacy space")
+	}
+	fixture := client.retainedTopics("spaceapi/fixture-space/")
+	hasSensor := false
+	for _, topic := range fixture {
+		hasSensor = hasSensor || strings.HasPrefix(topic, "spaceapi/fixture-space/sensors/")
+	}
+	if !hasSensor {
+		t.Fatalf("no sensors were retained for the fixture space: %v", fixture)
+	}
+
+	// the legacy space is gone from the source
+	c.options.Source = SourceFunc(func(ctx context.Context) ([]string, error) {
+		return []string{server.URL + "/space.json"}, nil
+	})
+	c.Rebuild()
+
+	if topics := client.retainedTopics("spaceapi/legacy-space/"); len(topics) != 0 {
+		t.Errorf("the topics of the removed space are still retained: %v", topics)
+	}
+	if topics := client.retainedTopics("spaceapi/fixture-space/"); len(topics) != len(fixture) {
+		t.Errorf("expected the topics %v to be retained, got %v", fixture, topics)
+	}
+
+	removed := false
+	for _, topic := range client.topics {
+		removed = removed || topic == "spaceapi/legacy-space/events"
+	}
+	if !removed {
+		t.Errorf("the removed event wasn't published")
+	}
+}
+
+func TestUnreachableSpacesKeepTheirTopics(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{})
+	client := newFakeMqttClient()
+	c.mqttClient = client
+	c.Rebuild()
+	retained := client.retainedTopics("spaceapi/fixture-space/")
+
+	// the validator fails, the space keeps its id and last state
+	validator := c.options.Validator
+	c.options.Validator = ValidatorFunc(func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+		if strings.HasSuffix(url, "/space.json") {
+			return spaceapi.ValidationResult{}, nil, context.DeadlineExceeded
+		}
+		return validator.Validate(ctx, url)
+	})
+	c.Rebuild()
+
+	if valid := client.retained["spaceapi/fixture-space/valid"]; string(valid) != "true" {
+		t.Errorf("expected the space to stay valid, got %q", valid)
+	}
+	if topics := client.retainedTopics("spaceapi/fixture-space/"); len(topics) != len(retained) {
+		t.Errorf("expected the topics %v to be retained, got %v", retained, topics)
+	}
+	for topic := range client.retained {
+		if strings.Contains(topic, "space-json") {
+			t.Errorf("the space was published under its url: %v", topic)
+		}
+	}
+}
+
+func TestVanishedSensorsAreClearedFromTheBroker(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{})
+	client := newFakeMqttClient()
+	c.mqttClient = client
+	c.Rebuild()
+	if len(client.retainedTopics("spaceapi/fixture-space/sensors/")) == 0 {
+		t.Fatal("no sensors were retained for the fixture space")
+	}
+
+	// the space stops publishing its sensors and the state message
+	validator := c.options.Validator
+	c.options.Validator = ValidatorFunc(func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+		result, data, err := validator.Validate(ctx, url)
+		if strings.HasSuffix(url, "/space.json") && data != nil {
+			delete(data, "sensors")
+			if state, ok := data["state"].(map[string]interface{}); ok {
+				delete(state, "message")
+			}
+		}
+		return result, data, err
+	})
+	c.Rebuild()
+
+	if topics := client.retainedTopics("spaceapi/fixture-space/sensors/"); len(topics) != 0 {
+		t.Errorf("the sensors of the space are still retained: %v", topics)
+	}
+	if topics := client.retainedTopics("spaceapi/fixture-space/state/message"); len(topics) != 0 {
+		t.Errorf("the state message of the space is still retained")
+	}
+	if topics := client.retainedTopics("spaceapi/fixture-space/state/open"); len(topics) != 1 {
+		t.Errorf("the open state of the space was cleared")
+	}
+}
+
+func TestMqttConnectionIsRetried(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{})
+	client := newFakeMqttClient()
+	client.connectErrors = 1
+	client.disconnected = true
+	c.mqttClient = client
+	c.Rebuild()
+	if len(client.topics) != 0 {
+		t.Fatalf("messages were published without a connection: %v", client.topics)
+	}
+
+	if err := connectMqttClient(client); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	c.start(c.retryMqttConnect)
+	c.running.Wait()
+	if !client.IsConnected() || client.connects != 2 {
+		t.Fatalf("expected to be connected after 2 attempts, got %d", client.connects)
+	}
+
+	// the spaces are published again once connected
+	c.republishMqtt()
+	if len(client.retainedTopics("spaceapi/fixture-space/")) == 0 {
+		t.Errorf("the spaces weren't published after connecting")
+	}
+}
+
+func TestMqttConnectRetryStopsWithTheCollector(t *testing.T) {
+	c := New(Options{})
+	client := newFakeMqttClient()
+	client.connectErrors = 1000
+	client.disconnected = true
+	c.mqttClient = client
+
+	c.start(c.retryMqttConnect)
+	c.Stop()
+	if client.IsConnected() || client.connects != 0 {
+		t.Errorf("the client tried to connect after the collector was stopped")
+	}
+}
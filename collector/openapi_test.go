@@ -0,0 +1,168 @@
+package collector
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
+	"goji.io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newFixtureServer serves the files in testdata as the endpoints, calendars
+// and feeds of the spaces, {{server}} in the files is replaced by its url.
+func newFixtureServer() *httptest.Server {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", path.Base(r.URL.Path)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(bytes.Replace(content, []byte("{{server}}"), []byte(server.URL), -1))
+	}))
+
+	return server
+}
+
+// newFixtureCollector returns a collector for the space.json and
+// legacy.json endpoints of the fixture server. Every endpoint is valid
+// except the legacy one, the validation service isn't called.
+func newFixtureCollector(server *httptest.Server, options Options) *Collector {
+	urls := []string{server.URL + "/space.json", server.URL + "/legacy.json"}
+	options.Source = SourceFunc(func(ctx context.Context) ([]string, error) {
+		return urls, nil
+	})
+	options.Validator = ValidatorFunc(func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+		resp, err := http.Get(url)
+		if err != nil {
+			return spaceapi.ValidationResult{}, nil, err
+		}
+		defer resp.Body.Close()
+
+		var data map[string]interface{}
+		if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+			return spaceapi.ValidationResult{}, nil, err
+		}
+
+		valid := !strings.HasSuffix(url, "/legacy.json")
+		return spaceapi.ValidationResult{
+			Valid:           valid,
+			Reachable:       true,
+			ContentType:     true,
+			CheckedVersions: []string{"14"},
+		}, data, nil
+	})
+
+	// the fixture locations aren't geocoded
+	latLonCountryMutex.Lock()
+	latLonCountry[50.1] = map[float64]string{8.6: "de"}
+	latLonCountry[52.5] = map[float64]string{13.4: "de"}
+	latLonCountryMutex.Unlock()
+
+	return New(options)
+}
+
+// conformanceRequest is a request of the conformance test, its response
+// has to have the status and match the OpenAPI document.
+type conformanceRequest struct {
+	method string
+	path   string
+	body   string
+	status int
+}
+
+func TestResponsesMatchOpenApiDocument(t *testing.T) {
+	server := newFixtureServer()
+	defer server.Close()
+
+	c := newFixtureCollector(server, Options{WebhookToken: "fixture"})
+	spec := c.spec()
+	spec.CheckResponses = func(r *http.Request, route openapi.Route, problems []string) {
+		t.Errorf("%s %s doesn't match the OpenAPI document:\n%s", r.Method, r.URL, strings.Join(problems, "\n"))
+	}
+	mux := goji.NewMux()
+	handleRoutes(mux, spec)
+
+	covered := make(map[string]bool)
+	send := func(request conformanceRequest) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(request.method, request.path, strings.NewReader(request.body))
+		r.Header.Set("Authorization", "Bearer fixture")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+
+		if w.Code != request.status {
+			t.Errorf("%s %s responded with %d instead of %d: %s", request.method, request.path, w.Code, request.status, w.Body.String())
+		}
+		for _, route := range spec.Routes() {
+			if route.Method == request.method && matchesPath(route.Path, r.URL.Path) {
+				covered[route.Method+" "+route.Path] = true
+			}
+		}
+
+		return w
+	}
+
+	// registered before the rebuild, so there are deliveries to list
+	w := send(conformanceRequest{method: http.MethodPost, path: "/webhooks", body: `{"url": "` + server.URL + `/hook", "types": ["added"]}`, status: http.StatusCreated})
+	var hook webhook
+	if err := json.Unmarshal(w.Body.Bytes(), &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	c.Rebuild()
+	c.updateCalendars()
+	c.updatePlanet()
+
+	for _, request := range []conformanceRequest{
+		{method: http.MethodGet, path: "/", status: http.StatusOK},
+		{method: http.MethodGet, path: "/changes", status: http.StatusOK},
+		{method: http.MethodGet, path: "/changes?order=desc&limit=1&types=added", status: http.StatusOK},
+		{method: http.MethodGet, path: "/changes?limit=0", status: http.StatusBadRequest},
+		{method: http.MethodGet, path: "/calendars", status: http.StatusOK},
+		{method: http.MethodGet, path: "/planet", status: http.StatusOK},
+		{method: http.MethodGet, path: "/sensors", status: http.StatusOK},
+		{method: http.MethodGet, path: "/openinghours", status: http.StatusOK},
+		{method: http.MethodGet, path: "/stats", status: http.StatusOK},
+		{method: http.MethodGet, path: "/trends", status: http.StatusOK},
+		{method: http.MethodGet, path: "/trends?from=2000-01-01&to=2100-01-01", status: http.StatusOK},
+		{method: http.MethodGet, path: "/webhooks", status: http.StatusOK},
+		{method: http.MethodGet, path: "/webhooks/" + hook.Id + "/deliveries", status: http.StatusOK},
+		{method: http.MethodGet, path: "/webhooks/unknown/deliveries", status: http.StatusNotFound},
+		{method: http.MethodPost, path: "/webhooks/" + hook.Id + "/deliveries/retry", status: http.StatusOK},
+		{method: http.MethodPost, path: "/webhooks/unknown/deliveries/retry", status: http.StatusNotFound},
+		{method: http.MethodDelete, path: "/webhooks/" + hook.Id, status: http.StatusNoContent},
+	} {
+		send(request)
+	}
+
+	for _, route := range spec.Routes() {
+		if !covered[route.Method+" "+route.Path] {
+			t.Errorf("%s %s isn't covered by the conformance test", route.Method, route.Path)
+		}
+	}
+}
+
+// matchesPath compares a path with the path of a route, parameters match
+// any segment.
+func matchesPath(routePath string, requestPath string) bool {
+	routeParts := strings.Split(routePath, "/")
+	requestParts := strings.Split(requestPath, "/")
+	if len(routeParts) != len(requestParts) {
+		return false
+	}
+	for i, part := range routeParts {
+		if !strings.HasPrefix(part, "{") && part != requestParts[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,183 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	hoursPerWeek = 7 * 24
+	// openingHoursDecay is applied to the samples once per week, so samples
+	// lose half of their weight after about four weeks and the heatmap
+	// follows changed opening hours
+	openingHoursDecay = 0.84
+)
+
+// openingHours collects state.open samples of a space in hourly buckets of
+// the week in the local time of the space. Bucket 0 is Monday 00:00 to
+// 01:00, bucket 167 is Sunday 23:00 to 24:00.
+type openingHours struct {
+	Timezone string                `json:"timezone"`
+	Week     int64                 `json:"week"`
+	Samples  [hoursPerWeek]float64 `json:"samples"`
+	Open     [hoursPerWeek]float64 `json:"open"`
+}
+
+type openingHoursStore struct {
+	mutex  sync.RWMutex
+	Spaces map[string]*openingHours `json:"spaces"`
+	// info keeps the name and country of the spaces for the endpoint, it's
+	// rebuilt from the directory and not persisted
+	info map[string]spaceapi.SpaceOpeningHours
+}
+
+func (c *Collector) serveOpeningHours(w http.ResponseWriter, _ *http.Request) {
+	c.openingHours.mutex.RLock()
+	response := make([]spaceapi.SpaceOpeningHours, 0, len(c.openingHours.Spaces))
+	for id, stats := range c.openingHours.Spaces {
+		heatmap := c.openingHours.info[id]
+		heatmap.SpaceId = id
+		heatmap.Timezone = stats.Timezone
+		heatmap.Samples = make([]float64, hoursPerWeek)
+		heatmap.Probability = make([]float64, hoursPerWeek)
+		for i := range stats.Samples {
+			heatmap.Samples[i] = math.Round(stats.Samples[i]*100) / 100
+			if stats.Samples[i] > 0 {
+				heatmap.Probability[i] = math.Round(stats.Open[i]/stats.Samples[i]*1000) / 1000
+			}
+		}
+		response = append(response, heatmap)
+	}
+	c.openingHours.mutex.RUnlock()
+
+	sort.Slice(response, func(i, j int) bool {
+		return response[i].SpaceId < response[j].SpaceId
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// updateOpeningHours samples the state of every reachable space that
+// publishes whether it's open. Spaces which left the directory are dropped.
+func (c *Collector) updateOpeningHours(directory map[string]spaceapi.Entry, now time.Time) {
+	c.openingHours.mutex.Lock()
+	defer c.openingHours.mutex.Unlock()
+
+	present := make(map[string]bool)
+	for _, e := range directory {
+		id := spaceId(e)
+		present[id] = true
+
+		open, ok := isOpen(e.Data)
+		if !ok || !e.ValidationResult.Reachable {
+			continue
+		}
+
+		location := spaceLocation(e)
+		local := now.In(location)
+		week := mondayOf(local)
+
+		stats, ok := c.openingHours.Spaces[id]
+		if !ok {
+			stats = &openingHours{Week: week}
+			c.openingHours.Spaces[id] = stats
+		}
+		stats.Timezone = location.String()
+		for ; stats.Week < week; stats.Week += 7 * 24 * 60 * 60 {
+			for i := range stats.Samples {
+				stats.Samples[i] *= openingHoursDecay
+				stats.Open[i] *= openingHoursDecay
+			}
+		}
+
+		bucket := (int(local.Weekday())+6)%7*24 + local.Hour()
+		stats.Samples[bucket]++
+		if open {
+			stats.Open[bucket]++
+		}
+
+		name, _ := e.Data["space"].(string)
+		c.openingHours.info[id] = spaceapi.SpaceOpeningHours{Space: name, Country: spaceCountry(e)}
+	}
+
+	for id := range c.openingHours.Spaces {
+		if !present[id] {
+			delete(c.openingHours.Spaces, id)
+			delete(c.openingHours.info, id)
+		}
+	}
+}
+
+// spaceLocation returns the time zone of a space. Spaces that don't publish
+// location.timezone get a fixed offset derived from their longitude, which
+// is close enough for hourly buckets.
+func spaceLocation(e spaceapi.Entry) *time.Location {
+	location, _ := e.Data["location"].(map[string]interface{})
+	if name, ok := location["timezone"].(string); ok && name != "" {
+		if tz, err := time.LoadLocation(name); err == nil {
+			return tz
+		}
+	}
+
+	if lon, ok := location["lon"].(float64); ok {
+		offset := int(math.Round(lon / 15))
+		if offset != 0 {
+			return time.FixedZone(fmt.Sprintf("UTC%+d", offset), offset*60*60)
+		}
+	}
+
+	return time.UTC
+}
+
+// mondayOf returns the unix time of the start of the week of t, using the
+// wall clock so it is the same for every sample of a week.
+func mondayOf(t time.Time) int64 {
+	days := (int(t.Weekday()) + 6) % 7
+	monday := time.Date(t.Year(), t.Month(), t.Day()-days, 0, 0, 0, 0, time.UTC)
+
+	return monday.Unix()
+}
+
+func (c *Collector) persistOpeningHours() {
+	c.openingHours.mutex.RLock()
+	openingHoursJson, err := json.Marshal(&c.openingHours)
+	c.openingHours.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreOpeningHours, openingHoursJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentOpeningHours() {
+	content, err := c.options.Storage.Load(StoreOpeningHours)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read opening hours, starting without samples...")
+		return
+	}
+
+	c.openingHours.mutex.Lock()
+	defer c.openingHours.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.openingHours); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal opening hours, starting without samples...")
+		c.openingHours.Spaces = nil
+	}
+	if c.openingHours.Spaces == nil {
+		c.openingHours.Spaces = make(map[string]*openingHours)
+	}
+}
@@ -0,0 +1,419 @@
+package collector
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"golang.org/x/net/html/charset"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	planetTimeout       = 30 * time.Second
+	planetMaxSize       = 5 << 20
+	planetMaxItems      = 50
+	planetMaxContent    = 100 << 10
+	planetExcerptLength = 1000
+)
+
+var (
+	planetClient    = &http.Client{Timeout: planetTimeout}
+	planetFeedTypes = []string{"blog", "wiki"}
+	errNoFeed       = errors.New("not an RSS or Atom feed")
+	// planetPolicy removes scripts, styles and everything else that isn't
+	// safe to embed from the content of the feeds
+	planetPolicy      = bluemonday.UGCPolicy()
+	planetTextOnly    = bluemonday.StrictPolicy()
+	planetDateFormats = []string{
+		time.RFC3339,
+		time.RFC1123Z,
+		time.RFC1123,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST",
+		"2 Jan 2006 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02",
+	}
+)
+
+type planetStore struct {
+	mutex sync.RWMutex
+	Feeds map[string]spaceapi.PlanetFeed `json:"feeds"`
+}
+
+// feedXml covers RSS 2.0, RSS 1.0 and Atom, elements are matched by their
+// local name only.
+type feedXml struct {
+	XMLName xml.Name
+	Channel struct {
+		Items []feedXmlItem `xml:"item"`
+	} `xml:"channel"`
+	Items   []feedXmlItem `xml:"item"`
+	Entries []feedXmlItem `xml:"entry"`
+}
+
+type feedXmlItem struct {
+	Title       feedXmlText   `xml:"title"`
+	Links       []feedXmlLink `xml:"link"`
+	Guid        string        `xml:"guid"`
+	Id          string        `xml:"id"`
+	PubDate     string        `xml:"pubDate"`
+	Published   string        `xml:"published"`
+	Updated     string        `xml:"updated"`
+	Date        string        `xml:"date"`
+	Description feedXmlText   `xml:"description"`
+	Summary     feedXmlText   `xml:"summary"`
+	Content     feedXmlText   `xml:"content"`
+	Encoded     string        `xml:"encoded"`
+	Creator     string        `xml:"creator"`
+	Author      struct {
+		Name string `xml:"name"`
+		Text string `xml:",chardata"`
+	} `xml:"author"`
+}
+
+type feedXmlText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+type feedXmlLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+	Text string `xml:",chardata"`
+}
+
+func (c *Collector) servePlanet(w http.ResponseWriter, _ *http.Request) {
+	c.planet.mutex.RLock()
+	response := make([]spaceapi.PlanetFeed, 0, len(c.planet.Feeds))
+	for _, feed := range c.planet.Feeds {
+		response = append(response, feed)
+	}
+	c.planet.mutex.RUnlock()
+
+	sort.Slice(response, func(i, j int) bool {
+		if response[i].SpaceId != response[j].SpaceId {
+			return response[i].SpaceId < response[j].SpaceId
+		}
+		return response[i].Type < response[j].Type
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// updatePlanetSources takes the blog and wiki feeds of the spaces from a
+// rebuilt directory, a wiki feed with the same url as the blog is skipped.
+func (c *Collector) updatePlanetSources(directory map[string]spaceapi.Entry) {
+	sources := make(map[string]spaceapi.PlanetFeed)
+	for _, e := range directory {
+		feeds, _ := e.Data["feeds"].(map[string]interface{})
+		seen := make(map[string]bool)
+
+		for _, feedType := range planetFeedTypes {
+			feed, _ := feeds[feedType].(map[string]interface{})
+			feedUrl, _ := feed["url"].(string)
+			if feedUrl == "" || seen[feedUrl] {
+				continue
+			}
+			seen[feedUrl] = true
+
+			source := spaceapi.PlanetFeed{
+				SpaceId: spaceId(e),
+				Country: spaceCountry(e),
+				Type:    feedType,
+				Url:     feedUrl,
+				Items:   []spaceapi.PlanetItem{},
+			}
+			source.Space, _ = e.Data["space"].(string)
+			sources[source.SpaceId+"/"+feedType] = source
+		}
+	}
+
+	c.planet.mutex.Lock()
+	defer c.planet.mutex.Unlock()
+
+	for key, source := range sources {
+		if previous, ok := c.planet.Feeds[key]; ok && previous.Url == source.Url {
+			source.LastFetched = previous.LastFetched
+			source.Error = previous.Error
+			source.Items = previous.Items
+		}
+		sources[key] = source
+	}
+	c.planet.Feeds = sources
+}
+
+// updatePlanet fetches the blog and wiki feeds of all spaces. A feed that
+// can't be fetched keeps its previous items.
+func (c *Collector) updatePlanet() {
+	c.planet.mutex.RLock()
+	var sources []spaceapi.PlanetFeed
+	for _, feed := range c.planet.Feeds {
+		sources = append(sources, feed)
+	}
+	c.planet.mutex.RUnlock()
+
+	fetched := make([]spaceapi.PlanetFeed, len(sources))
+	forEachParallel(len(sources), feedFetchWorkers, func(i int) {
+		fetched[i] = c.fetchPlanetFeed(sources[i])
+	})
+
+	c.planet.mutex.Lock()
+	for _, feed := range fetched {
+		// the source may have been removed or changed while fetching
+		key := feed.SpaceId + "/" + feed.Type
+		if current, ok := c.planet.Feeds[key]; ok && current.Url == feed.Url {
+			feed.Space = current.Space
+			feed.Country = current.Country
+			c.planet.Feeds[key] = feed
+		}
+	}
+	c.planet.mutex.Unlock()
+
+	c.persistPlanet()
+}
+
+func (c *Collector) fetchPlanetFeed(feed spaceapi.PlanetFeed) spaceapi.PlanetFeed {
+	items, err := fetchFeedItems(feed.Url, feed.Items)
+	feed.LastFetched = time.Now().Unix()
+	if err != nil {
+		c.metrics.planetFetchCounter.With(prometheus.Labels{"result": "error"}).Inc()
+		feed.Error = err.Error()
+		return feed
+	}
+
+	c.metrics.planetFetchCounter.With(prometheus.Labels{"result": "success"}).Inc()
+	feed.Error = ""
+	feed.Items = items
+	return feed
+}
+
+func fetchFeedItems(feedUrl string, previous []spaceapi.PlanetItem) ([]spaceapi.PlanetItem, error) {
+	resp, err := planetClient.Get(feedUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("feed responded with %v", resp.StatusCode)
+	}
+
+	base, err := url.Parse(feedUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFeed(io.LimitReader(resp.Body, planetMaxSize), base, previous)
+}
+
+// parseFeed normalizes the items of a feed, newest first. Items without a
+// date keep the time they were seen first.
+func parseFeed(r io.Reader, base *url.URL, previous []spaceapi.PlanetItem) ([]spaceapi.PlanetItem, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+	decoder.Strict = false
+
+	var feed feedXml
+	if err := decoder.Decode(&feed); err != nil {
+		return nil, err
+	}
+	if name := feed.XMLName.Local; name != "rss" && name != "RDF" && name != "feed" {
+		return nil, errNoFeed
+	}
+
+	firstSeen := make(map[string]int64)
+	for _, item := range previous {
+		firstSeen[item.Id] = item.Published
+	}
+
+	raw := append(append(feed.Channel.Items, feed.Items...), feed.Entries...)
+	seen := make(map[string]bool)
+	items := make([]spaceapi.PlanetItem, 0, len(raw))
+	now := time.Now().Unix()
+
+	for _, r := range raw {
+		item := normalizeFeedItem(r, base)
+		if item.Id == "" || seen[item.Id] {
+			continue
+		}
+		seen[item.Id] = true
+
+		if item.Published == 0 {
+			item.Published = now
+			if published, ok := firstSeen[item.Id]; ok {
+				item.Published = published
+			}
+		}
+		items = append(items, item)
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Published > items[j].Published
+	})
+	if len(items) > planetMaxItems {
+		items = items[:planetMaxItems]
+	}
+
+	return items, nil
+}
+
+func normalizeFeedItem(r feedXmlItem, base *url.URL) spaceapi.PlanetItem {
+	item := spaceapi.PlanetItem{
+		Title:  feedPlainText(feedXmlHtml(r.Title)),
+		Link:   resolveFeedLink(feedXmlItemLink(r), base),
+		Author: strings.TrimSpace(firstNonEmpty(r.Author.Name, r.Creator, r.Author.Text)),
+	}
+
+	item.Id = strings.TrimSpace(firstNonEmpty(r.Guid, r.Id, item.Link))
+
+	for _, date := range []string{r.Published, r.PubDate, r.Date, r.Updated} {
+		if t, ok := parseFeedDate(date); ok {
+			item.Published = t.Unix()
+			break
+		}
+	}
+
+	content := firstNonEmpty(r.Encoded, feedXmlHtml(r.Content), feedXmlHtml(r.Description), feedXmlHtml(r.Summary))
+	item.Content = sanitizeFeedContent(content)
+
+	return item
+}
+
+func feedXmlItemLink(r feedXmlItem) string {
+	for _, link := range r.Links {
+		if link.Href != "" && (link.Rel == "" || link.Rel == "alternate") {
+			return link.Href
+		}
+	}
+	for _, link := range r.Links {
+		if text := strings.TrimSpace(link.Text); text != "" {
+			return text
+		}
+	}
+
+	return ""
+}
+
+func resolveFeedLink(link string, base *url.URL) string {
+	parsed, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || link == "" {
+		return ""
+	}
+
+	return base.ResolveReference(parsed).String()
+}
+
+// feedXmlHtml returns the text of an element as html, Atom text constructs
+// can be plain text, escaped html or inline xhtml.
+func feedXmlHtml(text feedXmlText) string {
+	switch text.Type {
+	case "xhtml":
+		return text.Inner
+	case "text":
+		return html.EscapeString(text.Text)
+	default:
+		return text.Text
+	}
+}
+
+func feedPlainText(content string) string {
+	return strings.TrimSpace(html.UnescapeString(planetTextOnly.Sanitize(content)))
+}
+
+// sanitizeFeedContent removes unsafe html, overly long posts are cut down to
+// a plain text excerpt.
+func sanitizeFeedContent(content string) string {
+	sanitized := strings.TrimSpace(planetPolicy.Sanitize(content))
+	if len(sanitized) <= planetMaxContent {
+		return sanitized
+	}
+
+	text := feedPlainText(content)
+	if utf8.RuneCountInString(text) > planetExcerptLength {
+		text = string([]rune(text)[:planetExcerptLength]) + "…"
+	}
+
+	return html.EscapeString(text)
+}
+
+func parseFeedDate(date string) (time.Time, bool) {
+	date = strings.TrimSpace(date)
+	if date == "" {
+		return time.Time{}, false
+	}
+
+	for _, layout := range planetDateFormats {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func (c *Collector) persistPlanet() {
+	c.planet.mutex.RLock()
+	planetJson, err := json.Marshal(&c.planet)
+	c.planet.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StorePlanet, planetJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentPlanet() {
+	content, err := c.options.Storage.Load(StorePlanet)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read planet, fetching feeds from scratch...")
+		return
+	}
+
+	c.planet.mutex.Lock()
+	defer c.planet.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.planet); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal planet, fetching feeds from scratch...")
+		c.planet.Feeds = nil
+	}
+	if c.planet.Feeds == nil {
+		c.planet.Feeds = make(map[string]spaceapi.PlanetFeed)
+	}
+}
@@ -0,0 +1,233 @@
+package collector
+
+import (
+	"github.com/spaceapi/directory-api/spaceapi"
+	"github.com/spaceapi/directory-api/spaceapi/openapi"
+	"goji.io/pat"
+	"net/http"
+)
+
+// collectorDocument is the part of the OpenAPI document that isn't
+// generated from the routes.
+var collectorDocument = openapi.Document{
+	Servers: []openapi.Server{{Url: "https://collector.spaceapi.io"}},
+	Info: openapi.Info{
+		Title:          "SpaceApi collector",
+		Description:    "This is the spaceApi collector",
+		Version:        "0.0.1",
+		TermsOfService: "https://spaceapi.io/daemon/terms",
+		Contact:        &openapi.Contact{Email: "spaceapi-team@chaospott.de"},
+		License: &openapi.License{
+			Name: "Apache 2.0",
+			Url:  "http://www.apache.org/licenses/LICENSE-2.0.html",
+		},
+	},
+	ExternalDocs: &openapi.ExternalDocs{
+		Description: "Find out more about spaceApi directory",
+		Url:         "https://spaceapi.io",
+	},
+}
+
+// routes lists the routes of the collector. The OpenAPI document served on
+// /openapi.json is generated from them and their parameters are validated
+// before the handlers are called.
+func (c *Collector) routes() []openapi.Route {
+	webhookId := openapi.PathParam("id", "Id of the webhook")
+	bearerToken := openapi.HeaderParam("Authorization", "Bearer followed by the webhook token of the collector", openapi.String())
+	unauthorized := openapi.Response{Status: http.StatusUnauthorized, Description: "missing or wrong token"}
+	disabled := openapi.Response{Status: http.StatusForbidden, Description: "webhook registration is disabled"}
+	unknownWebhook := openapi.Response{Status: http.StatusNotFound, Description: "unknown webhook"}
+
+	return []openapi.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/",
+			Handler: c.serveDirectory,
+			Operation: openapi.Operation{
+				Summary: "Internal SpaceAPI Directory entries",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.Entry{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/changes",
+			Handler: c.serveChanges,
+			Operation: openapi.Operation{
+				Summary: "Change events recorded while rebuilding the directory",
+				Parameters: []openapi.Parameter{
+					openapi.Query("since", "Unix timestamp or a cursor returned by a previous call, only newer events are returned", openapi.String()),
+					openapi.Query("limit", "Maximum number of events to return, larger values are capped at 5000", openapi.Integer().WithDefault(defaultChangeLimit).WithMinimum(1)),
+					openapi.Query("spaceId", "Comma separated list of space ids", openapi.String()),
+					openapi.Query("types", "Comma separated list of event types", openapi.String()),
+					openapi.Query("order", "asc returns the oldest events after since first, desc the newest events first", openapi.Enum("asc", "desc").WithDefault("asc")),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: spaceapi.ChangesResponse{}},
+					{Status: http.StatusBadRequest, Description: "invalid since, limit or order parameter"},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/calendars",
+			Handler: c.serveCalendars,
+			Operation: openapi.Operation{
+				Summary: "Parsed iCalendar feeds of the spaces, recurring events aren't expanded",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.SpaceCalendar{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/planet",
+			Handler: c.servePlanet,
+			Operation: openapi.Operation{
+				Summary: "Normalized blog and wiki feeds of the spaces",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.PlanetFeed{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/sensors",
+			Handler: c.serveSensors,
+			Operation: openapi.Operation{
+				Summary: "Sensor values of all spaces",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.SensorReading{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/openinghours",
+			Handler: c.serveOpeningHours,
+			Operation: openapi.Operation{
+				Summary: "Weekly heatmaps of the sampled open state of the spaces",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []spaceapi.SpaceOpeningHours{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/stats",
+			Handler: c.serveStatistics,
+			Operation: openapi.Operation{
+				Summary: "Field usage, versions, countries and validity of the directory",
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: spaceapi.Statistics{}},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/trends",
+			Handler: c.serveTrends,
+			Operation: openapi.Operation{
+				Summary: "Daily rollups of the directory statistics",
+				Parameters: []openapi.Parameter{
+					openapi.Query("from", "First day, e.g. 2024-01-01", openapi.String().WithFormat("date")),
+					openapi.Query("to", "Last day, inclusive", openapi.String().WithFormat("date")),
+				},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "Average statistics of the snapshots taken on a day (UTC)", Body: []dailyRollup{}},
+					{Status: http.StatusBadRequest, Description: "Invalid date"},
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/webhooks",
+			Handler: c.listWebhooks,
+			Operation: openapi.Operation{
+				Summary:    "List registered webhooks",
+				Parameters: []openapi.Parameter{bearerToken},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: []webhook{}},
+					unauthorized,
+					disabled,
+				},
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/webhooks",
+			Handler: c.createWebhook,
+			Operation: openapi.Operation{
+				Summary:     "Register a webhook",
+				Description: "The webhook is called with a POST request for every matching change event. Every attempt sends its Unix timestamp in the X-SpaceApi-Timestamp header. The timestamp, a dot and the body are signed with HMAC-SHA256 using the secret of the webhook, the hex encoded signature is sent in the X-SpaceApi-Signature header as sha256=<signature>. Receivers should reject deliveries with a timestamp more than 5 minutes off their clock. Failed deliveries are retried with exponential backoff and moved to the dead letters after the maximum number of attempts, POST /webhooks/{id}/deliveries/retry queues them again. Every webhook is delivered to on its own, a slow receiver doesn't delay the others. The events of a webhook are delivered in order, later events wait until a failed delivery succeeded or is dead. Deleting a webhook drops its pending and dead deliveries.",
+				Parameters:  []openapi.Parameter{bearerToken},
+				RequestBody: &openapi.RequestBody{Required: true, Body: webhook{}},
+				Responses: []openapi.Response{
+					{Status: http.StatusCreated, Description: "the registered webhook including its secret", Body: webhook{}},
+					{Status: http.StatusBadRequest, Description: "invalid webhook"},
+					unauthorized,
+					disabled,
+				},
+			},
+		},
+		{
+			Method:  http.MethodDelete,
+			Path:    "/webhooks/{id}",
+			Handler: c.deleteWebhook,
+			Operation: openapi.Operation{
+				Summary:    "Remove a webhook",
+				Parameters: []openapi.Parameter{webhookId, bearerToken},
+				Responses: []openapi.Response{
+					{Status: http.StatusNoContent, Description: "webhook removed"},
+					unauthorized,
+					disabled,
+					unknownWebhook,
+				},
+			},
+		},
+		{
+			Method:  http.MethodGet,
+			Path:    "/webhooks/{id}/deliveries",
+			Handler: c.listWebhookDeliveries,
+			Operation: openapi.Operation{
+				Summary:    "Pending and dead deliveries of a webhook",
+				Parameters: []openapi.Parameter{webhookId, bearerToken},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "successful operation", Body: webhookDeliveries{}},
+					unauthorized,
+					disabled,
+					unknownWebhook,
+				},
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/webhooks/{id}/deliveries/retry",
+			Handler: c.retryWebhookDeliveries,
+			Operation: openapi.Operation{
+				Summary:    "Queue the dead deliveries of a webhook again",
+				Parameters: []openapi.Parameter{webhookId, bearerToken},
+				Responses: []openapi.Response{
+					{Status: http.StatusOK, Description: "the deliveries moved back into the queue, they get all attempts again", Body: []webhookDelivery{}},
+					unauthorized,
+					disabled,
+					unknownWebhook,
+				},
+			},
+		},
+	}
+}
+
+// routePattern matches the method and path of a route, GET routes answer
+// HEAD requests as well.
+func routePattern(route openapi.Route) *pat.Pattern {
+	switch route.Method {
+	case http.MethodPost:
+		return pat.Post(route.Pattern())
+	case http.MethodDelete:
+		return pat.Delete(route.Pattern())
+	default:
+		return pat.Get(route.Pattern())
+	}
+}
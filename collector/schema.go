@@ -0,0 +1,191 @@
+package collector
+
+import (
+	"strings"
+)
+
+// The fields of the SpaceAPI schema versions in the path notation of the
+// field statistics, array elements are marked with []. Fields starting with
+// ext_ are always allowed and not listed. Keep this in sync with
+// https://github.com/SpaceApi/schema when a new version is released.
+
+var sensorFields = []string{"value", "unit", "location", "name", "description"}
+
+// schema13Fields are the fields of version 0.13.
+var schema13Fields = joinFields(
+	[]string{
+		"/api", "/space", "/logo", "/url",
+		"/location/address", "/location/lat", "/location/lon",
+		"/spacefed/spacenet", "/spacefed/spacesaml", "/spacefed/spacephone",
+		"/cam[]",
+		"/stream/m4", "/stream/mjpeg", "/stream/ustream",
+		"/state/open", "/state/lastchange", "/state/trigger_person", "/state/message",
+		"/state/icon/open", "/state/icon/closed",
+		"/events[]/name", "/events[]/type", "/events[]/timestamp", "/events[]/extra",
+		"/contact/phone", "/contact/sip", "/contact/irc", "/contact/twitter",
+		"/contact/facebook", "/contact/google/plus", "/contact/identica",
+		"/contact/foursquare", "/contact/email", "/contact/ml", "/contact/jabber",
+		"/contact/issue_mail",
+		"/contact/keymasters[]/name", "/contact/keymasters[]/irc_nick",
+		"/contact/keymasters[]/phone", "/contact/keymasters[]/email",
+		"/contact/keymasters[]/twitter",
+		"/issue_report_channels[]",
+		"/sensors/wind[]/location", "/sensors/wind[]/name", "/sensors/wind[]/description",
+		"/sensors/network_connections[]/type", "/sensors/network_connections[]/machines[]/name",
+		"/sensors/network_connections[]/machines[]/mac",
+		"/sensors/people_now_present[]/names[]",
+		"/feeds/blog/type", "/feeds/blog/url", "/feeds/wiki/type", "/feeds/wiki/url",
+		"/feeds/calendar/type", "/feeds/calendar/url", "/feeds/flickr/type", "/feeds/flickr/url",
+		"/cache/schedule",
+		"/projects[]",
+		"/radio_show[]/name", "/radio_show[]/url", "/radio_show[]/type",
+		"/radio_show[]/start", "/radio_show[]/end",
+	},
+	sensorPaths([]string{
+		"temperature", "door_locked", "barometer", "humidity", "beverage_supply",
+		"power_consumption", "network_connections", "account_balance",
+		"total_member_count", "people_now_present",
+		"radiation/alpha", "radiation/beta", "radiation/gamma", "radiation/beta_gamma",
+	}, sensorFields),
+	sensorPaths([]string{
+		"radiation/alpha", "radiation/beta", "radiation/gamma", "radiation/beta_gamma",
+	}, []string{"dead_time", "conversion_factor"}),
+	windPaths("speed", "gust", "direction", "elevation"),
+)
+
+// schema14Fields adds the time zone, more contact options, new sensors and
+// the last change of sensors to 0.13.
+var schema14Fields = joinFields(
+	schema13Fields,
+	[]string{
+		"/location/timezone",
+		"/contact/mastodon", "/contact/matrix", "/contact/xmpp",
+		"/contact/keymasters[]/xmpp", "/contact/keymasters[]/mastodon",
+		"/contact/keymasters[]/matrix",
+		"/sensors/network_traffic[]/properties/bits_per_second/value",
+		"/sensors/network_traffic[]/properties/bits_per_second/maximum",
+		"/sensors/network_traffic[]/properties/packets_per_second/value",
+		"/sensors/network_traffic[]/location", "/sensors/network_traffic[]/name",
+		"/sensors/network_traffic[]/description",
+		"/links[]/name", "/links[]/description", "/links[]/url",
+		"/membership_plans[]/name", "/membership_plans[]/value",
+		"/membership_plans[]/currency", "/membership_plans[]/billing_interval",
+		"/membership_plans[]/description",
+	},
+	sensorPaths([]string{"carbondioxide", "power_generation"}, sensorFields),
+	sensorPaths(sensorTypes(), []string{"lastchange"}),
+)
+
+// schema15Removed are the deprecated fields of 14 that are gone in 15.
+var schema15Removed = []string{
+	"/api", "/cache/schedule", "/spacefed/spacephone",
+	"/contact/google/plus", "/contact/identica", "/contact/foursquare",
+	"/contact/jabber", "/contact/issue_mail", "/issue_report_channels[]",
+	"/radio_show[]/name", "/radio_show[]/url", "/radio_show[]/type",
+	"/radio_show[]/start", "/radio_show[]/end",
+}
+
+// schema15Fields adds the country code, areas and linked spaces.
+var schema15Fields = joinFields(
+	withoutFields(schema14Fields, schema15Removed),
+	[]string{
+		"/location/country_code", "/location/hint",
+		"/location/areas[]/name", "/location/areas[]/description",
+		"/location/areas[]/square_meters",
+		"/linked_spaces[]/endpoint", "/linked_spaces[]/website",
+	},
+)
+
+// schemaFields maps a version to its fields and all their parents, so empty
+// objects and arrays are known as well.
+var schemaFields = map[string]map[string]bool{
+	"0.13": fieldSet(schema13Fields),
+	"14":   fieldSet(schema14Fields),
+	"15":   fieldSet(schema15Fields),
+}
+
+// knownField reports whether a field exists in the schema of a version. The
+// second result is false if we don't have the schema of the version.
+// api_compatibility is known in every version, as it's how spaces declare
+// to implement several versions at once.
+func knownField(version string, field string) (bool, bool) {
+	fields, ok := schemaFields[version]
+	if !ok {
+		return false, false
+	}
+
+	known := fields[field] || field == "/api_compatibility[]" || strings.Contains(field, "/ext_")
+	return known, true
+}
+
+func sensorTypes() []string {
+	return []string{
+		"temperature", "door_locked", "barometer", "humidity", "beverage_supply",
+		"power_consumption", "power_generation", "wind", "network_connections",
+		"account_balance", "total_member_count", "people_now_present",
+		"carbondioxide", "network_traffic",
+		"radiation/alpha", "radiation/beta", "radiation/gamma", "radiation/beta_gamma",
+	}
+}
+
+func sensorPaths(types []string, fields []string) []string {
+	var paths []string
+	for _, sensorType := range types {
+		for _, field := range fields {
+			paths = append(paths, "/sensors/"+sensorType+"[]/"+field)
+		}
+	}
+
+	return paths
+}
+
+func windPaths(properties ...string) []string {
+	var paths []string
+	for _, property := range properties {
+		paths = append(paths,
+			"/sensors/wind[]/properties/"+property+"/value",
+			"/sensors/wind[]/properties/"+property+"/unit",
+		)
+	}
+
+	return paths
+}
+
+func joinFields(lists ...[]string) []string {
+	var fields []string
+	for _, list := range lists {
+		fields = append(fields, list...)
+	}
+
+	return fields
+}
+
+func withoutFields(fields []string, removed []string) []string {
+	skip := make(map[string]bool)
+	for _, field := range removed {
+		skip[field] = true
+	}
+
+	var result []string
+	for _, field := range fields {
+		if !skip[field] {
+			result = append(result, field)
+		}
+	}
+
+	return result
+}
+
+func fieldSet(fields []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, field := range fields {
+		set[field] = true
+		for i := strings.LastIndex(field, "/"); i > 0; i = strings.LastIndex(field, "/") {
+			field = field[:i]
+			set[field] = true
+			set[strings.TrimSuffix(field, "[]")] = true
+		}
+	}
+
+	return set
+}
@@ -0,0 +1,221 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type sensorStore struct {
+	mutex    sync.RWMutex
+	readings []spaceapi.SensorReading
+}
+
+type unitConversion struct {
+	unit    string
+	convert func(float64) float64
+}
+
+var (
+	// unitConversions maps sensor types and units to the common unit of
+	// the type, the keys are type, property and unit
+	unitConversions = map[string]unitConversion{
+		"temperature//°C":       {"°C", func(v float64) float64 { return v }},
+		"temperature//°F":       {"°C", func(v float64) float64 { return (v - 32) * 5 / 9 }},
+		"temperature//K":        {"°C", func(v float64) float64 { return v - 273.15 }},
+		"temperature//°De":      {"°C", func(v float64) float64 { return 100 - v*2/3 }},
+		"temperature//°N":       {"°C", func(v float64) float64 { return v * 100 / 33 }},
+		"temperature//°R":       {"°C", func(v float64) float64 { return (v - 491.67) * 5 / 9 }},
+		"temperature//°Ré":      {"°C", func(v float64) float64 { return v * 5 / 4 }},
+		"temperature//°Rø":      {"°C", func(v float64) float64 { return (v - 7.5) * 40 / 21 }},
+		"barometer//hPA":        {"hPa", func(v float64) float64 { return v }},
+		"barometer//hPa":        {"hPa", func(v float64) float64 { return v }},
+		"power_consumption//mW": {"W", func(v float64) float64 { return v / 1000 }},
+		"power_consumption//kW": {"W", func(v float64) float64 { return v * 1000 }},
+		"power_generation//mW":  {"W", func(v float64) float64 { return v / 1000 }},
+		"power_generation//kW":  {"W", func(v float64) float64 { return v * 1000 }},
+		"wind/speed/km/h":       {"m/s", func(v float64) float64 { return v / 3.6 }},
+		"wind/speed/kn":         {"m/s", func(v float64) float64 { return v * 0.514444 }},
+		"wind/gust/km/h":        {"m/s", func(v float64) float64 { return v / 3.6 }},
+		"wind/gust/kn":          {"m/s", func(v float64) float64 { return v * 0.514444 }},
+		"wind/elevation/ft":     {"m", func(v float64) float64 { return v * 0.3048 }},
+	}
+	radiationConversions = map[string]unitConversion{
+		"µSv/h": {"µSv/h", func(v float64) float64 { return v }},
+		"µSv/a": {"µSv/h", func(v float64) float64 { return v / 8760 }},
+		"mSv/a": {"µSv/h", func(v float64) float64 { return v * 1000 / 8760 }},
+	}
+)
+
+func (c *Collector) serveSensors(w http.ResponseWriter, _ *http.Request) {
+	c.sensors.mutex.RLock()
+	readings := c.sensors.readings
+	c.sensors.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(readings); err != nil {
+		panic(err)
+	}
+}
+
+// updateSensors parses the sensors of a rebuilt directory and replaces the
+// exported metrics, so sensors that disappeared aren't reported anymore.
+func (c *Collector) updateSensors(directory map[string]spaceapi.Entry) {
+	readings := []spaceapi.SensorReading{}
+	for _, e := range directory {
+		readings = append(readings, parseSensors(e)...)
+	}
+
+	sort.SliceStable(readings, func(i, j int) bool {
+		if readings[i].SpaceId != readings[j].SpaceId {
+			return readings[i].SpaceId < readings[j].SpaceId
+		}
+		return readings[i].Type < readings[j].Type
+	})
+
+	c.sensors.mutex.Lock()
+	c.sensors.readings = readings
+	c.sensors.mutex.Unlock()
+
+	c.metrics.sensorValueGauge.Reset()
+	for _, r := range readings {
+		c.metrics.sensorValueGauge.With(prometheus.Labels{
+			"space":    r.SpaceId,
+			"type":     r.Type,
+			"property": r.Property,
+			"sensor":   r.Sensor,
+			"unit":     r.NormalizedUnit,
+		}).Set(r.NormalizedValue)
+	}
+}
+
+// parseSensors turns the sensors of a space into readings. Radiation is
+// grouped by its kind, wind and network traffic have several properties and
+// network connections are told apart by their type.
+func parseSensors(e spaceapi.Entry) []spaceapi.SensorReading {
+	data, _ := e.Data["sensors"].(map[string]interface{})
+	if len(data) == 0 {
+		return nil
+	}
+
+	space, _ := e.Data["space"].(string)
+	base := spaceapi.SensorReading{
+		SpaceId: spaceId(e),
+		Space:   space,
+		Country: spaceCountry(e),
+	}
+
+	var readings []spaceapi.SensorReading
+	for _, sensorType := range sortedKeys(data) {
+		if sensorType == "radiation" {
+			kinds, _ := data[sensorType].(map[string]interface{})
+			for _, kind := range sortedKeys(kinds) {
+				measurements, _ := kinds[kind].([]interface{})
+				readings = append(readings, parseMeasurements(base, sensorType, kind, measurements)...)
+			}
+			continue
+		}
+
+		measurements, _ := data[sensorType].([]interface{})
+		readings = append(readings, parseMeasurements(base, sensorType, "", measurements)...)
+	}
+
+	return readings
+}
+
+func parseMeasurements(base spaceapi.SensorReading, sensorType string, property string, measurements []interface{}) []spaceapi.SensorReading {
+	var readings []spaceapi.SensorReading
+	for i, m := range measurements {
+		measurement, ok := m.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		reading := base
+		reading.Type = sensorType
+		reading.Property = property
+		reading.Name, _ = measurement["name"].(string)
+		reading.Location, _ = measurement["location"].(string)
+		reading.Description, _ = measurement["description"].(string)
+		if lastChange, ok := measurement["lastchange"].(float64); ok {
+			reading.LastChange = int64(lastChange)
+		}
+		reading.Sensor = reading.Name
+		if reading.Sensor == "" {
+			reading.Sensor = reading.Location
+		}
+		if reading.Sensor == "" {
+			reading.Sensor = strconv.Itoa(i)
+		}
+		if connectionType, ok := measurement["type"].(string); ok && sensorType == "network_connections" {
+			reading.Property = connectionType
+		}
+
+		properties, ok := measurement["properties"].(map[string]interface{})
+		if !ok {
+			if value, ok := newSensorReading(reading, measurement); ok {
+				readings = append(readings, value)
+			}
+			continue
+		}
+
+		for _, name := range sortedKeys(properties) {
+			values, _ := properties[name].(map[string]interface{})
+			reading.Property = name
+			if value, ok := newSensorReading(reading, values); ok {
+				readings = append(readings, value)
+			}
+		}
+	}
+
+	return readings
+}
+
+// newSensorReading sets the value and unit of a reading, false is returned
+// for values that aren't numbers or booleans.
+func newSensorReading(reading spaceapi.SensorReading, values map[string]interface{}) (spaceapi.SensorReading, bool) {
+	switch value := values["value"].(type) {
+	case float64:
+		reading.Value = value
+	case bool:
+		reading.Value = 0
+		if value {
+			reading.Value = 1
+		}
+	default:
+		return reading, false
+	}
+
+	reading.Unit, _ = values["unit"].(string)
+	reading.NormalizedValue, reading.NormalizedUnit = normalizeSensorUnit(reading.Type, reading.Property, reading.Value, reading.Unit)
+
+	return reading, true
+}
+
+func normalizeSensorUnit(sensorType string, property string, value float64, unit string) (float64, string) {
+	conversion, ok := unitConversions[sensorType+"/"+property+"/"+unit]
+	if sensorType == "radiation" {
+		// both the micro sign and the greek letter mu are used
+		conversion, ok = radiationConversions[strings.Replace(unit, "μ", "µ", 1)]
+	}
+	if !ok {
+		return value, unit
+	}
+
+	return conversion.convert(value), conversion.unit
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+)
+
+// DefaultDirectoryUrl is the directory file of the spaceapi/directory
+// repository, spaces are added to the directory with a pull request to it.
+const DefaultDirectoryUrl = "https://raw.githubusercontent.com/spaceapi/directory/master/directory.json"
+
+// Source provides the urls of the endpoints in the directory, it's asked on
+// every rebuild.
+type Source interface {
+	Urls(ctx context.Context) ([]string, error)
+}
+
+// SourceFunc is a function used as a Source.
+type SourceFunc func(ctx context.Context) ([]string, error)
+
+func (f SourceFunc) Urls(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// StaticDirectory reads the urls from a JSON object mapping the names of
+// the spaces to their endpoints, like the one at DefaultDirectoryUrl. The
+// time and count of the lookups are exported with the metrics of the
+// collector using it.
+func StaticDirectory(url string) Source {
+	return &staticDirectory{
+		url: url,
+		scrapingTime: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "spaceapi_scrape_static_file_time",
+				Help: "Time used to load the static directory",
+			}),
+		scrapeCounter: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "spaceapi_scrape_static_file_count",
+				Help: "All the http requests!",
+			}),
+	}
+}
+
+type staticDirectory struct {
+	url           string
+	scrapingTime  prometheus.Gauge
+	scrapeCounter prometheus.Counter
+}
+
+func (s *staticDirectory) Describe(descs chan<- *prometheus.Desc) {
+	s.scrapingTime.Describe(descs)
+	s.scrapeCounter.Describe(descs)
+}
+
+func (s *staticDirectory) Collect(metrics chan<- prometheus.Metric) {
+	s.scrapingTime.Collect(metrics)
+	s.scrapeCounter.Collect(metrics)
+}
+
+func (s *staticDirectory) Urls(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	defer func() {
+		s.scrapingTime.Set(time.Since(start).Seconds())
+	}()
+
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("directory responded with %v", resp.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var staticDirectory map[string]string
+	if err := json.Unmarshal(body, &staticDirectory); err != nil {
+		return nil, err
+	}
+
+	var spaceUrls []string
+	for _, value := range staticDirectory {
+		spaceUrls = append(spaceUrls, value)
+	}
+
+	s.scrapeCounter.Inc()
+	return spaceUrls, nil
+}
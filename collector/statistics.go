@@ -1,59 +1,100 @@
-package main
+package collector
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/codingsince1985/geo-golang/openstreetmap"
 	"github.com/felixge/httpsnoop"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
 	"log"
 	"net/http"
 	"reflect"
+	"sort"
 	"strconv"
+	"sync"
+	"time"
 )
 
 var (
-	spaceFieldGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "spaceapi_field",
-			Help: "Fields used from the spec",
-		},
-		[]string{"field"},
-	)
-	spaceVersionGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "spaceapi_version",
-			Help: "Versions used in the directory",
-		},
-		[]string{"version"},
-	)
-	spaceCountryGauge = prometheus.NewGaugeVec(
-		prometheus.GaugeOpts{
-			Name: "spaceapi_country",
-			Help: "Countries spaces are from",
-		},
-		[]string{"country"},
-	)
-	httpRequestSummary = prometheus.NewSummaryVec(
-		prometheus.SummaryOpts{
-			Name: "spaceapi_http_requests",
-			Help: "All the http requests!",
-		},
-		[]string{"method", "route", "code"},
-	)
-	latLonCountry map[float64]map[float64]string
+	// latLonCountry caches the geocoded countries, it's shared by all
+	// collectors
+	latLonCountry      = make(map[float64]map[float64]string)
+	latLonCountryMutex sync.Mutex
 )
 
-func init() {
-	latLonCountry = make(map[float64]map[float64]string)
-	prometheus.MustRegister(spaceVersionGauge)
-	prometheus.MustRegister(spaceFieldGauge)
-	prometheus.MustRegister(spaceCountryGauge)
-	prometheus.MustRegister(httpRequestSummary)
+type statisticsStore struct {
+	mutex    sync.RWMutex
+	snapshot spaceapi.Statistics
 }
 
-func generateCountryStatistics(entries map[string]entry) {
-	spaceCountryGauge.Reset()
+func newDirectoryStatistics(now time.Time) spaceapi.Statistics {
+	var stats spaceapi.Statistics
+	if !now.IsZero() {
+		stats.Time = now.Unix()
+	}
+	stats.Validity = make(map[string]int)
+	stats.Versions = make(map[string]int)
+	stats.Countries = make(map[string]int)
+	stats.Fields = make(map[string]int)
+	stats.FieldsByVersion = make(map[string]map[string]int)
+	stats.UnknownFields = make(map[string]map[string]int)
+
+	return stats
+}
+
+func (c *Collector) serveStatistics(w http.ResponseWriter, _ *http.Request) {
+	c.statistics.mutex.RLock()
+	snapshot := c.statistics.snapshot
+	c.statistics.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		panic(err)
+	}
+}
+
+// generateStatistics updates the gauges and the snapshot served on /stats.
+func (c *Collector) generateStatistics(entries map[string]spaceapi.Entry) spaceapi.Statistics {
+	stats := newDirectoryStatistics(time.Now())
+	c.generateFieldStatistic(entries, &stats)
+	stats.Countries = c.generateCountryStatistics(entries)
+
+	for _, e := range entries {
+		stats.Totals.Spaces++
+		if e.Valid {
+			stats.Totals.Valid++
+		} else {
+			stats.Totals.Invalid++
+		}
+		if e.ValidationResult.Reachable {
+			stats.Totals.Reachable++
+		}
+
+		for check, passed := range map[string]bool{
+			"valid":        e.ValidationResult.Valid,
+			"isHttps":      e.ValidationResult.IsHttps,
+			"httpsForward": e.ValidationResult.HttpsForward,
+			"reachable":    e.ValidationResult.Reachable,
+			"cors":         e.ValidationResult.Cors,
+			"contentType":  e.ValidationResult.ContentType,
+			"certValid":    e.ValidationResult.CertValid,
+		} {
+			stats.Validity[check] += countTrue(passed)
+		}
+	}
+
+	c.statistics.mutex.Lock()
+	c.statistics.snapshot = stats
+	c.statistics.mutex.Unlock()
+
+	return stats
+}
+
+func (c *Collector) generateCountryStatistics(entries map[string]spaceapi.Entry) map[string]int {
+	countries := make(map[string]int)
+	c.metrics.spaceCountryGauge.Reset()
 	for _, value := range entries {
 		if value.Data["location"] != nil && value.Data["url"] != nil && value.Valid {
 			val := reflect.ValueOf(value.Data["location"])
@@ -72,21 +113,46 @@ func generateCountryStatistics(entries map[string]entry) {
 
 			countryCode, err := getCountryCodeForLatLong(latVal.Interface().(float64), lonVal.Interface().(float64))
 			if err == nil {
-				spaceCountryGauge.With(prometheus.Labels{"country": countryCode}).Inc()
+				c.metrics.spaceCountryGauge.With(prometheus.Labels{"country": countryCode}).Inc()
+				countries[countryCode]++
 			} else {
 				log.Printf("%v\n", err)
 			}
 		}
 	}
+
+	return countries
+}
+
+// spaceCountry returns the country code for the location of a space or an
+// empty string if the space has no usable location.
+func spaceCountry(e spaceapi.Entry) string {
+	location, ok := e.Data["location"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+
+	lat, latOk := location["lat"].(float64)
+	lon, lonOk := location["lon"].(float64)
+	if !latOk || !lonOk {
+		return ""
+	}
+
+	countryCode, err := getCountryCodeForLatLong(lat, lon)
+	if err != nil {
+		log.Printf("%v\n", err)
+		return ""
+	}
+
+	return countryCode
 }
 
 func getCountryCodeForLatLong(lat, long float64) (string, error) {
-	if _, ok := latLonCountry[lat]; ok {
-		if _, ok := latLonCountry[lat][long]; ok {
-			return latLonCountry[lat][long], nil
-		}
-	} else {
-		latLonCountry[lat] = make(map[float64]string)
+	latLonCountryMutex.Lock()
+	countryCode, ok := latLonCountry[lat][long]
+	latLonCountryMutex.Unlock()
+	if ok {
+		return countryCode, nil
 	}
 
 	geocoder := openstreetmap.Geocoder()
@@ -95,38 +161,64 @@ func getCountryCodeForLatLong(lat, long float64) (string, error) {
 		return "", fmt.Errorf("unable to geocode lat: %v, long: %v, error was: %v", lat, long, err)
 	}
 
+	latLonCountryMutex.Lock()
+	if _, ok := latLonCountry[lat]; !ok {
+		latLonCountry[lat] = make(map[float64]string)
+	}
 	latLonCountry[lat][long] = address.CountryCode
+	latLonCountryMutex.Unlock()
 
 	return address.CountryCode, nil
 }
 
-func generateFieldStatistic(jsonArray map[string]entry) {
+// generateFieldStatistic counts the fields used by the spaces, in total and
+// per declared version, and the fields that aren't part of the schema of a
+// declared version.
+func (c *Collector) generateFieldStatistic(jsonArray map[string]spaceapi.Entry, stats *spaceapi.Statistics) {
 	newStats := make(map[string][]string)
 
-	spaceVersionGauge.Reset()
+	c.metrics.spaceVersionGauge.Reset()
+	c.metrics.spaceFieldVersionGauge.Reset()
 	for _, value := range jsonArray {
 		apiVersions, fields, err := getNewStats(value.Data)
 		if err == nil {
 			newStats[value.Url] = fields
 
 			for _, version := range apiVersions {
-				spaceVersionGauge.With(prometheus.Labels{"version": version}).Inc()
+				c.metrics.spaceVersionGauge.With(prometheus.Labels{"version": version}).Inc()
+				stats.Versions[version]++
+
+				if stats.FieldsByVersion[version] == nil {
+					stats.FieldsByVersion[version] = make(map[string]int)
+				}
+				for _, field := range fields {
+					c.metrics.spaceFieldVersionGauge.With(prometheus.Labels{"version": version, "field": field}).Inc()
+					stats.FieldsByVersion[version][field]++
+
+					if known, hasSchema := knownField(version, field); hasSchema && !known {
+						if stats.UnknownFields[version] == nil {
+							stats.UnknownFields[version] = make(map[string]int)
+						}
+						stats.UnknownFields[version][field]++
+					}
+				}
 			}
 		}
 	}
 
-	spaceFieldGauge.Reset()
+	c.metrics.spaceFieldGauge.Reset()
 	for _, fields := range newStats {
 		for _, field := range fields {
-			spaceFieldGauge.With(prometheus.Labels{"field": field}).Inc()
+			c.metrics.spaceFieldGauge.With(prometheus.Labels{"field": field}).Inc()
+			stats.Fields[field]++
 		}
 	}
 }
 
-func statisticMiddelware(inner http.Handler) http.Handler {
+func (c *Collector) statisticMiddelware(inner http.Handler) http.Handler {
 	mw := func(w http.ResponseWriter, r *http.Request) {
 		m := httpsnoop.CaptureMetrics(inner, w, r)
-		httpRequestSummary.With(prometheus.Labels{"method": r.Method, "route": r.URL.Path, "code": strconv.Itoa(m.Code)}).Observe(m.Duration.Seconds())
+		c.metrics.httpRequestSummary.With(prometheus.Labels{"method": r.Method, "route": r.URL.Path, "code": strconv.Itoa(m.Code)}).Observe(m.Duration.Seconds())
 	}
 	return http.HandlerFunc(mw)
 }
@@ -154,17 +246,46 @@ func getNewStats(value interface{}) ([]string, []string, error) {
 	}
 }
 
+// flatten returns the paths of all leaves of a space, arrays are descended
+// into and marked with [] like /sensors/temperature[]/unit. Every path is
+// only returned once, even if several array elements contain it.
 func flatten(from map[string]interface{}, prepend string) []string {
+	seen := make(map[string]bool)
 	var to []string
-	for key, value := range from {
-		obj, isObject := value.(map[string]interface{})
-
-		if isObject {
-			to = append(to, flatten(obj, prepend+"/"+key)...)
-		} else {
-			to = append(to, prepend+"/"+key)
+	for _, path := range flattenValue(from, prepend) {
+		if !seen[path] {
+			seen[path] = true
+			to = append(to, path)
 		}
 	}
+	sort.Strings(to)
 
 	return to
 }
+
+func flattenValue(value interface{}, path string) []string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		var to []string
+		for key, value := range v {
+			to = append(to, flattenValue(value, path+"/"+key)...)
+		}
+		return to
+	case []interface{}:
+		to := []string{path + "[]"}
+		nested := false
+		for _, element := range v {
+			if obj, isObject := element.(map[string]interface{}); isObject {
+				to = append(to, flattenValue(obj, path+"[]")...)
+				nested = true
+			}
+		}
+		if nested {
+			// the array itself isn't a leaf if its elements are objects
+			to = to[1:]
+		}
+		return to
+	default:
+		return []string{path}
+	}
+}
@@ -0,0 +1,130 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFlatten(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		data     string
+		expected []string
+	}{
+		{"flat", `{"space": "a", "url": "b"}`, []string{"/space", "/url"}},
+		{"nested", `{"state": {"open": true, "icon": {"open": "a"}}}`, []string{"/state/icon/open", "/state/open"}},
+		{"array of values", `{"cam": ["a", "b"]}`, []string{"/cam[]"}},
+		{"empty array", `{"projects": []}`, []string{"/projects[]"}},
+		{"array of objects", `{"sensors": {"temperature": [{"value": 1, "unit": "°C"}, {"value": 2, "location": "a"}]}}`,
+			[]string{"/sensors/temperature[]/location", "/sensors/temperature[]/unit", "/sensors/temperature[]/value"}},
+		{"nested arrays", `{"sensors": {"network_connections": [{"machines": [{"name": "a"}]}]}}`,
+			[]string{"/sensors/network_connections[]/machines[]/name"}},
+		{"null", `{"logo": null}`, []string{"/logo"}},
+		{"empty", `{}`, nil},
+	} {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(test.data), &data); err != nil {
+			t.Fatal(err)
+		}
+		if fields := flatten(data, ""); !reflect.DeepEqual(fields, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, fields)
+		}
+	}
+}
+
+func TestKnownField(t *testing.T) {
+	for _, test := range []struct {
+		version   string
+		field     string
+		known     bool
+		hasSchema bool
+	}{
+		{"14", "/space", true, true},
+		{"14", "/sensors/temperature[]/unit", true, true},
+		{"14", "/sensors/temperature[]/lastchange", true, true},
+		{"0.13", "/sensors/temperature[]/lastchange", false, true},
+		{"14", "/location/country_code", false, true},
+		{"15", "/location/country_code", true, true},
+		{"14", "/api", true, true},
+		{"15", "/api", false, true},
+		{"15", "/api_compatibility[]", true, true},
+		{"15", "/ext_ccc", true, true},
+		{"15", "/contact/ext_signal", true, true},
+		{"15", "/sensors", true, true},
+		{"15", "/favourite_color", false, true},
+		{"16", "/space", false, false},
+	} {
+		known, hasSchema := knownField(test.version, test.field)
+		if known != test.known || hasSchema != test.hasSchema {
+			t.Errorf("%s %s: expected %v and %v, got %v and %v", test.version, test.field, test.known, test.hasSchema, known, hasSchema)
+		}
+	}
+}
+
+func TestFieldStatistics(t *testing.T) {
+	entry := func(url string, data string) spaceapi.Entry {
+		e := spaceapi.Entry{Url: url}
+		if err := json.Unmarshal([]byte(data), &e.Data); err != nil {
+			t.Fatal(err)
+		}
+		return e
+	}
+	entries := map[string]spaceapi.Entry{
+		"a": entry("a", `{"api": "0.13", "space": "a", "sensors": {"temperature": [{"value": 1}, {"value": 2, "unit": "°C"}]}}`),
+		"b": entry("b", `{"api_compatibility": ["14", "15"], "space": "b", "location": {"country_code": "DE"}, "ext_ccc": "erfa"}`),
+		"c": entry("c", `{"api_compatibility": ["16"], "space": "c", "favourite_color": "green"}`),
+		"d": entry("d", `{"space": "d"}`),
+	}
+
+	c := &Collector{metrics: newMetrics()}
+	stats := newDirectoryStatistics(time.Time{})
+	c.generateFieldStatistic(entries, &stats)
+
+	for _, test := range []struct {
+		name     string
+		actual   interface{}
+		expected interface{}
+	}{
+		// spaces without a version aren't counted
+		{"versions", stats.Versions, map[string]int{"0.13": 1, "14": 1, "15": 1, "16": 1}},
+		{"fields", stats.Fields, map[string]int{
+			"/api": 1, "/api_compatibility[]": 2, "/space": 3, "/location/country_code": 1, "/ext_ccc": 1,
+			"/favourite_color": 1, "/sensors/temperature[]/value": 1, "/sensors/temperature[]/unit": 1,
+		}},
+		{"fields of 0.13", stats.FieldsByVersion["0.13"], map[string]int{
+			"/api": 1, "/space": 1, "/sensors/temperature[]/value": 1, "/sensors/temperature[]/unit": 1,
+		}},
+		{"fields of 14", stats.FieldsByVersion["14"], map[string]int{
+			"/api_compatibility[]": 1, "/space": 1, "/location/country_code": 1, "/ext_ccc": 1,
+		}},
+		{"fields of 15", stats.FieldsByVersion["15"], map[string]int{
+			"/api_compatibility[]": 1, "/space": 1, "/location/country_code": 1, "/ext_ccc": 1,
+		}},
+		// versions without a schema have no unknown fields
+		{"unknown fields", stats.UnknownFields, map[string]map[string]int{
+			"14": {"/location/country_code": 1},
+		}},
+	} {
+		if !reflect.DeepEqual(test.actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, test.actual)
+		}
+	}
+
+	if count := testutil.ToFloat64(c.metrics.spaceFieldVersionGauge.With(prometheus.Labels{"version": "15", "field": "/space"})); count != 1 {
+		t.Errorf("expected 1 space with /space in version 15, got %v", count)
+	}
+	if count := testutil.ToFloat64(c.metrics.spaceFieldGauge.With(prometheus.Labels{"field": "/space"})); count != 3 {
+		t.Errorf("expected 3 spaces with /space, got %v", count)
+	}
+
+	// the statistics are regenerated from scratch
+	c.generateFieldStatistic(entries, &stats)
+	if count := testutil.ToFloat64(c.metrics.spaceVersionGauge.With(prometheus.Labels{"version": "14"})); count != 1 {
+		t.Errorf("expected the version gauge to be reset, got %v", count)
+	}
+}
@@ -0,0 +1,80 @@
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// The names the state of the collector is stored under.
+const (
+	StoreDirectory    = "directory"
+	StoreChanges      = "changes"
+	StoreWebhooks     = "webhooks"
+	StoreCalendars    = "calendars"
+	StorePlanet       = "planet"
+	StoreAvailability = "availability"
+	StoreOpeningHours = "openingHours"
+	StoreTrends       = "trends"
+)
+
+// secretStores contain credentials and are only readable by the owner.
+var secretStores = map[string]bool{StoreWebhooks: true}
+
+var errNotStored = errors.New("store isn't persisted")
+
+// Storage persists the state of a Collector between restarts. Every store
+// is loaded once on Start and saved whenever it changes.
+type Storage interface {
+	Load(name string) ([]byte, error)
+	Save(name string, content []byte) error
+}
+
+// FileStorage stores the state in files, it maps the store names to their
+// paths. Stores without a path aren't persisted.
+type FileStorage map[string]string
+
+func (s FileStorage) Load(name string) ([]byte, error) {
+	path, ok := s[name]
+	if !ok {
+		return nil, errNotStored
+	}
+
+	return ioutil.ReadFile(path)
+}
+
+// Save writes the content to a temporary file next to the path and renames
+// it over the old file, so readers never see a partially written store.
+func (s FileStorage) Save(name string, content []byte) error {
+	path, ok := s[name]
+	if !ok {
+		return nil
+	}
+
+	perm := os.FileMode(0644)
+	if secretStores[name] {
+		perm = 0600
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = os.Remove(file.Name())
+	}()
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Chmod(perm); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
@@ -0,0 +1,150 @@
+package collector
+
+import (
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const trendDateFormat = "2006-01-02"
+
+// dailyRollup sums up the statistics of all snapshots taken on a day (UTC),
+// the averages are computed when the rollup is served.
+type dailyRollup struct {
+	Date      string             `json:"date" description:"Day of the snapshots (UTC)"`
+	Snapshots int                `json:"snapshots" description:"Number of snapshots of the day"`
+	Totals    map[string]float64 `json:"totals"`
+	Validity  map[string]float64 `json:"validity"`
+	Versions  map[string]float64 `json:"versions"`
+	Countries map[string]float64 `json:"countries"`
+	Fields    map[string]float64 `json:"fields"`
+}
+
+type trendStore struct {
+	mutex sync.RWMutex
+	Days  []dailyRollup `json:"days"`
+}
+
+// serveTrends returns the average statistics per day, optionally limited to
+// the days between from and to (both inclusive, formatted as 2006-01-02).
+func (c *Collector) serveTrends(w http.ResponseWriter, r *http.Request) {
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	for _, date := range []string{from, to} {
+		if _, err := time.Parse(trendDateFormat, date); date != "" && err != nil {
+			http.Error(w, "from and to have to be dates like 2006-01-02", http.StatusBadRequest)
+			return
+		}
+	}
+
+	c.trends.mutex.RLock()
+	response := []dailyRollup{}
+	for _, day := range c.trends.Days {
+		if (from != "" && day.Date < from) || (to != "" && day.Date > to) {
+			continue
+		}
+		response = append(response, day.averages())
+	}
+	c.trends.mutex.RUnlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// recordTrends adds a snapshot to the rollup of its day.
+func (c *Collector) recordTrends(stats spaceapi.Statistics) {
+	date := time.Unix(stats.Time, 0).UTC().Format(trendDateFormat)
+
+	c.trends.mutex.Lock()
+	defer c.trends.mutex.Unlock()
+
+	if len(c.trends.Days) == 0 || c.trends.Days[len(c.trends.Days)-1].Date != date {
+		c.trends.Days = append(c.trends.Days, dailyRollup{
+			Date:      date,
+			Totals:    make(map[string]float64),
+			Validity:  make(map[string]float64),
+			Versions:  make(map[string]float64),
+			Countries: make(map[string]float64),
+			Fields:    make(map[string]float64),
+		})
+	}
+
+	day := &c.trends.Days[len(c.trends.Days)-1]
+	day.Snapshots++
+	day.Totals["spaces"] += float64(stats.Totals.Spaces)
+	day.Totals["valid"] += float64(stats.Totals.Valid)
+	day.Totals["invalid"] += float64(stats.Totals.Invalid)
+	day.Totals["reachable"] += float64(stats.Totals.Reachable)
+	addCounts(day.Validity, stats.Validity)
+	addCounts(day.Versions, stats.Versions)
+	addCounts(day.Countries, stats.Countries)
+	addCounts(day.Fields, stats.Fields)
+}
+
+func addCounts(sums map[string]float64, counts map[string]int) {
+	for key, count := range counts {
+		sums[key] += float64(count)
+	}
+}
+
+// averages divides the sums by the number of snapshots, so a day with a
+// few failed scrapes doesn't stand out.
+func (d dailyRollup) averages() dailyRollup {
+	average := func(sums map[string]float64) map[string]float64 {
+		result := make(map[string]float64, len(sums))
+		for key, sum := range sums {
+			result[key] = math.Round(sum/float64(d.Snapshots)*100) / 100
+		}
+		return result
+	}
+
+	return dailyRollup{
+		Date:      d.Date,
+		Snapshots: d.Snapshots,
+		Totals:    average(d.Totals),
+		Validity:  average(d.Validity),
+		Versions:  average(d.Versions),
+		Countries: average(d.Countries),
+		Fields:    average(d.Fields),
+	}
+}
+
+func (c *Collector) persistTrends() {
+	c.trends.mutex.RLock()
+	trendsJson, err := json.Marshal(&c.trends)
+	c.trends.mutex.RUnlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreTrends, trendsJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentTrends() {
+	content, err := c.options.Storage.Load(StoreTrends)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read trends, starting without history...")
+		return
+	}
+
+	c.trends.mutex.Lock()
+	defer c.trends.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.trends); err != nil {
+		log.Println(err)
+		log.Println("can't unmarshal trends, starting without history...")
+		c.trends.Days = nil
+	}
+	if c.trends.Days == nil {
+		c.trends.Days = []dailyRollup{}
+	}
+}
@@ -0,0 +1,66 @@
+package collector
+
+import (
+	"context"
+	"github.com/spaceapi-community/go-spaceapi-validator-client"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// Validator checks an endpoint and returns the result together with the
+// validated data of the space. An error means the endpoint couldn't be
+// checked at all, an invalid endpoint is reported in the result.
+type Validator interface {
+	Validate(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error)
+}
+
+// ValidatorFunc is a function used as a Validator.
+type ValidatorFunc func(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error)
+
+func (f ValidatorFunc) Validate(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+	return f(ctx, url)
+}
+
+type validatorService struct {
+	client *spaceapivalidatorclient.APIClient
+}
+
+// NewValidatorService returns a Validator using the SpaceAPI validation
+// service, the default configuration of the client is used if it's nil.
+func NewValidatorService(configuration *spaceapivalidatorclient.Configuration) Validator {
+	if configuration == nil {
+		configuration = spaceapivalidatorclient.NewConfiguration()
+	}
+
+	return validatorService{client: spaceapivalidatorclient.NewAPIClient(configuration)}
+}
+
+func (v validatorService) Validate(ctx context.Context, url string) (spaceapi.ValidationResult, map[string]interface{}, error) {
+	response, httpResp, err := v.client.V2Api.V2ValidateURLPost(ctx, spaceapivalidatorclient.ValidateUrlV2{Url: url})
+	if err != nil {
+		if httpResp != nil && httpResp.StatusCode == 429 {
+			log.Println("Too many requests, enhancing calm...")
+			select {
+			case <-ctx.Done():
+				return spaceapi.ValidationResult{}, nil, ctx.Err()
+			case <-time.After(time.Duration(rand.Intn(9)+1) * time.Second):
+			}
+			return v.Validate(ctx, url)
+		}
+
+		return spaceapi.ValidationResult{}, nil, err
+	}
+
+	return spaceapi.ValidationResult{
+		Valid:           response.Valid,
+		IsHttps:         response.IsHttps,
+		HttpsForward:    response.HttpsForward,
+		Reachable:       response.Reachable,
+		Cors:            response.Cors,
+		ContentType:     response.ContentType,
+		CertValid:       response.CertValid,
+		CheckedVersions: response.CheckedVersions,
+	}, response.ValidatedJson, nil
+}
@@ -0,0 +1,559 @@
+package collector
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"goji.io/pat"
+	"io/ioutil"
+	"log"
+	mathrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	webhookBaseDelay      = 30 * time.Second
+	webhookMaxDelay       = 6 * time.Hour
+	webhookTimeout        = 10 * time.Second
+	webhookDeadLetterSize = 1000
+)
+
+var (
+	webhookClient = &http.Client{Timeout: webhookTimeout}
+)
+
+type webhook struct {
+	Id     string `json:"id" readOnly:"true"`
+	Url    string `json:"url" description:"url called for every matching event"`
+	Secret string `json:"secret,omitempty" description:"secret used to sign the payload, generated if omitted"`
+	// SpaceIds and Types restrict the events a webhook is called for, empty
+	// lists match everything
+	SpaceIds []string `json:"spaceIds,omitempty" description:"only call the webhook for these spaces"`
+	Types    []string `json:"types,omitempty" description:"only call the webhook for these event types"`
+	Created  int64    `json:"created" readOnly:"true"`
+}
+
+type webhookDelivery struct {
+	Id          string               `json:"id"`
+	WebhookId   string               `json:"webhookId"`
+	Event       spaceapi.ChangeEvent `json:"event"`
+	Attempts    int                  `json:"attempts"`
+	NextAttempt int64                `json:"nextAttempt" description:"Unix timestamp of the next attempt"`
+	LastError   string               `json:"lastError,omitempty"`
+}
+
+// webhookDeliveries are the pending and dead deliveries of a webhook.
+type webhookDeliveries struct {
+	Pending []webhookDelivery `json:"pending"`
+	Dead    []webhookDelivery `json:"dead"`
+}
+
+type webhookPayload struct {
+	DeliveryId string               `json:"deliveryId"`
+	WebhookId  string               `json:"webhookId"`
+	Event      spaceapi.ChangeEvent `json:"event"`
+}
+
+type webhookStore struct {
+	mutex       sync.Mutex
+	Hooks       map[string]webhook `json:"hooks"`
+	Queue       []webhookDelivery  `json:"queue"`
+	DeadLetters []webhookDelivery  `json:"deadLetters"`
+	// delivering are the webhooks with deliveries in flight, their other
+	// deliveries wait until these are done to keep the order
+	delivering map[string]bool
+	// saveMutex serializes persisting the store, so an older state can't
+	// overwrite a newer one
+	saveMutex sync.Mutex
+}
+
+func (c *Collector) authorizeWebhookRequest(w http.ResponseWriter, r *http.Request) bool {
+	if c.options.WebhookToken == "" {
+		http.Error(w, "webhook registration is disabled", http.StatusForbidden)
+		return false
+	}
+
+	if !hmac.Equal([]byte(r.Header.Get("Authorization")), []byte("Bearer "+c.options.WebhookToken)) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return false
+	}
+
+	return true
+}
+
+func (c *Collector) createWebhook(w http.ResponseWriter, r *http.Request) {
+	if !c.authorizeWebhookRequest(w, r) {
+		return
+	}
+
+	var hook webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hookUrl, err := url.Parse(hook.Url)
+	if err != nil || (hookUrl.Scheme != "http" && hookUrl.Scheme != "https") || hookUrl.Host == "" {
+		http.Error(w, "url has to be an absolute http or https url", http.StatusBadRequest)
+		return
+	}
+
+	hook.Id = randomHex(8)
+	hook.Created = time.Now().Unix()
+	if hook.Secret == "" {
+		hook.Secret = randomHex(32)
+	}
+
+	c.webhooks.mutex.Lock()
+	c.webhooks.Hooks[hook.Id] = hook
+	c.webhooks.mutex.Unlock()
+	c.persistWebhooks()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(hook); err != nil {
+		panic(err)
+	}
+}
+
+func (c *Collector) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !c.authorizeWebhookRequest(w, r) {
+		return
+	}
+
+	c.webhooks.mutex.Lock()
+	hooks := []webhook{}
+	for _, hook := range c.webhooks.Hooks {
+		hook.Secret = ""
+		hooks = append(hooks, hook)
+	}
+	c.webhooks.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(hooks); err != nil {
+		panic(err)
+	}
+}
+
+func (c *Collector) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !c.authorizeWebhookRequest(w, r) {
+		return
+	}
+
+	id := pat.Param(r, "id")
+	c.webhooks.mutex.Lock()
+	_, ok := c.webhooks.Hooks[id]
+	delete(c.webhooks.Hooks, id)
+	c.webhooks.DeadLetters = deliveriesOfOtherWebhooks(c.webhooks.DeadLetters, id)
+	c.webhooks.mutex.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.updateWebhookQueueGauge()
+	c.persistWebhooks()
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries shows the pending and dead deliveries of a webhook.
+func (c *Collector) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !c.authorizeWebhookRequest(w, r) {
+		return
+	}
+
+	id := pat.Param(r, "id")
+	response := webhookDeliveries{[]webhookDelivery{}, []webhookDelivery{}}
+
+	c.webhooks.mutex.Lock()
+	_, ok := c.webhooks.Hooks[id]
+	for _, delivery := range c.webhooks.Queue {
+		if delivery.WebhookId == id {
+			response.Pending = append(response.Pending, delivery)
+		}
+	}
+	for _, delivery := range c.webhooks.DeadLetters {
+		if delivery.WebhookId == id {
+			response.Dead = append(response.Dead, delivery)
+		}
+	}
+	c.webhooks.mutex.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		panic(err)
+	}
+}
+
+// retryWebhookDeliveries moves the dead deliveries of a webhook back into
+// the queue, they get all attempts again.
+func (c *Collector) retryWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !c.authorizeWebhookRequest(w, r) {
+		return
+	}
+
+	id := pat.Param(r, "id")
+	retried := []webhookDelivery{}
+
+	c.webhooks.mutex.Lock()
+	_, ok := c.webhooks.Hooks[id]
+	var dead []webhookDelivery
+	for _, delivery := range c.webhooks.DeadLetters {
+		if delivery.WebhookId != id {
+			dead = append(dead, delivery)
+			continue
+		}
+		delivery.Attempts = 0
+		delivery.NextAttempt = time.Now().Unix()
+		retried = append(retried, delivery)
+	}
+	c.webhooks.DeadLetters = dead
+	c.webhooks.Queue = append(c.webhooks.Queue, retried...)
+	c.webhooks.mutex.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	c.updateWebhookQueueGauge()
+	c.persistWebhooks()
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(retried); err != nil {
+		panic(err)
+	}
+}
+
+// queueWebhookDeliveries adds a delivery for every webhook interested in one
+// of the events.
+func (c *Collector) queueWebhookDeliveries(events []spaceapi.ChangeEvent) {
+	c.webhooks.mutex.Lock()
+	now := time.Now().Unix()
+	for _, event := range events {
+		for _, hook := range c.webhooks.Hooks {
+			if !hook.wants(event) {
+				continue
+			}
+			c.webhooks.Queue = append(c.webhooks.Queue, webhookDelivery{
+				Id:          randomHex(8),
+				WebhookId:   hook.Id,
+				Event:       event,
+				NextAttempt: now,
+			})
+		}
+	}
+	c.webhooks.mutex.Unlock()
+
+	c.persistWebhooks()
+}
+
+func (hook webhook) wants(event spaceapi.ChangeEvent) bool {
+	return (len(hook.SpaceIds) == 0 || containsString(hook.SpaceIds, event.SpaceId)) &&
+		(len(hook.Types) == 0 || containsString(hook.Types, event.Type))
+}
+
+// runWebhookDeliveries works through the due deliveries of the queue.
+// Deliveries are retried with exponential backoff and end up in the dead
+// letters after WebhookMaxAttempts failed attempts. It returns once the
+// collector is stopped.
+func (c *Collector) runWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.deliverDueWebhooks()
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDueWebhooks starts delivering the due deliveries, every webhook in
+// its own goroutine so a slow receiver doesn't hold up the others. Webhooks
+// that are still busy with earlier deliveries are skipped, and deliveries
+// queued after one that isn't due yet wait for it. The deliveries stay in the
+// queue until they succeeded or are dead.
+func (c *Collector) deliverDueWebhooks() {
+	now := time.Now().Unix()
+
+	c.webhooks.mutex.Lock()
+	due := make(map[string][]webhookDelivery)
+	// waiting are the webhooks with a delivery that isn't due yet, their
+	// later deliveries wait for it
+	waiting := make(map[string]bool)
+	var queue []webhookDelivery
+	for _, delivery := range c.webhooks.Queue {
+		if _, ok := c.webhooks.Hooks[delivery.WebhookId]; !ok {
+			// the webhook was deleted in the meantime
+			continue
+		}
+		queue = append(queue, delivery)
+		if delivery.NextAttempt > now {
+			waiting[delivery.WebhookId] = true
+		}
+		if !waiting[delivery.WebhookId] && !c.webhooks.delivering[delivery.WebhookId] {
+			due[delivery.WebhookId] = append(due[delivery.WebhookId], delivery)
+		}
+	}
+	c.webhooks.Queue = queue
+	if c.webhooks.delivering == nil {
+		c.webhooks.delivering = make(map[string]bool)
+	}
+	hooks := make(map[string]webhook, len(due))
+	for id := range due {
+		c.webhooks.delivering[id] = true
+		hooks[id] = c.webhooks.Hooks[id]
+	}
+	c.webhooks.mutex.Unlock()
+
+	c.updateWebhookQueueGauge()
+	for id, deliveries := range due {
+		hook, deliveries := hooks[id], deliveries
+		started := c.start(func() {
+			c.deliverWebhooks(hook, deliveries)
+		})
+		if !started {
+			c.webhooks.mutex.Lock()
+			delete(c.webhooks.delivering, id)
+			c.webhooks.mutex.Unlock()
+		}
+	}
+}
+
+// deliverWebhooks delivers the due deliveries of a webhook in order and
+// updates them in the queue. It stops at the first failed delivery, the
+// remaining ones wait in the queue until it was retried. It also stops if the
+// collector is stopped, the remaining deliveries are attempted after the
+// restart.
+func (c *Collector) deliverWebhooks(hook webhook, deliveries []webhookDelivery) {
+	defer func() {
+		c.webhooks.mutex.Lock()
+		delete(c.webhooks.delivering, hook.Id)
+		c.webhooks.mutex.Unlock()
+
+		c.updateWebhookQueueGauge()
+		c.persistWebhooks()
+	}()
+
+	for _, delivery := range deliveries {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		err := c.deliverWebhook(hook, delivery)
+		if err == nil {
+			c.updateWebhookDelivery(delivery, "success")
+			continue
+		}
+
+		delivery.Attempts++
+		delivery.LastError = err.Error()
+		if delivery.Attempts >= c.options.WebhookMaxAttempts {
+			c.updateWebhookDelivery(delivery, "dead")
+			continue
+		}
+
+		delivery.NextAttempt = time.Now().Add(webhookBackoff(delivery.Attempts)).Unix()
+		c.updateWebhookDelivery(delivery, "failure")
+		return
+	}
+}
+
+// deliveriesOfOtherWebhooks drops the deliveries of a webhook.
+func deliveriesOfOtherWebhooks(deliveries []webhookDelivery, webhookId string) []webhookDelivery {
+	var kept []webhookDelivery
+	for _, delivery := range deliveries {
+		if delivery.WebhookId != webhookId {
+			kept = append(kept, delivery)
+		}
+	}
+
+	return kept
+}
+
+// updateWebhookDelivery records the result of an attempt, which is success,
+// failure or dead. Successful deliveries are removed from the queue, failed
+// ones replaced with the next attempt and dead ones moved to the dead
+// letters. Deliveries of webhooks deleted in the meantime are dropped.
+func (c *Collector) updateWebhookDelivery(delivery webhookDelivery, result string) {
+	c.metrics.webhookDeliveryCounter.With(prometheus.Labels{"result": result}).Inc()
+
+	c.webhooks.mutex.Lock()
+	defer c.webhooks.mutex.Unlock()
+
+	for i, queued := range c.webhooks.Queue {
+		if queued.Id != delivery.Id {
+			continue
+		}
+
+		if result == "failure" {
+			c.webhooks.Queue[i] = delivery
+			return
+		}
+		c.webhooks.Queue = append(c.webhooks.Queue[:i:i], c.webhooks.Queue[i+1:]...)
+		if result == "dead" {
+			c.webhooks.DeadLetters = append(c.webhooks.DeadLetters, delivery)
+			if len(c.webhooks.DeadLetters) > webhookDeadLetterSize {
+				c.webhooks.DeadLetters = append([]webhookDelivery(nil), c.webhooks.DeadLetters[len(c.webhooks.DeadLetters)-webhookDeadLetterSize:]...)
+			}
+		}
+		return
+	}
+}
+
+// webhookBackoff doubles the delay with every failed attempt and adds up to
+// 10% jitter, so failing receivers don't get hit by all deliveries at once.
+func webhookBackoff(attempts int) time.Duration {
+	delay := webhookBaseDelay
+	for i := 1; i < attempts && delay < webhookMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookMaxDelay {
+		delay = webhookMaxDelay
+	}
+
+	return delay + time.Duration(mathrand.Int63n(int64(delay/10)+1))
+}
+
+func (c *Collector) deliverWebhook(hook webhook, delivery webhookDelivery) error {
+	start := time.Now()
+	defer func() {
+		c.metrics.webhookDeliverySummary.Observe(time.Since(start).Seconds())
+	}()
+
+	body, err := json.Marshal(webhookPayload{
+		DeliveryId: delivery.Id,
+		WebhookId:  hook.Id,
+		Event:      delivery.Event,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "spaceapi-directory-webhooks")
+	req.Header.Set("X-SpaceApi-Event", delivery.Event.Type)
+	req.Header.Set("X-SpaceApi-Delivery", delivery.Id)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("X-SpaceApi-Timestamp", timestamp)
+	req.Header.Set("X-SpaceApi-Signature", "sha256="+signWebhookPayload(hook.Secret, timestamp, body))
+
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		err := resp.Body.Close()
+		if err != nil {
+			log.Println(err)
+		}
+	}()
+	_, _ = ioutil.ReadAll(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("receiver responded with %v", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// signWebhookPayload returns the hex encoded HMAC-SHA256 of the timestamp
+// of the attempt, a dot and the body. The receiver computes it with the
+// shared secret to verify the payload, and rejects timestamps more than 5
+// minutes away from its clock so captured deliveries can't be replayed
+// later.
+func signWebhookPayload(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = mac.Write([]byte(timestamp + "."))
+	_, _ = mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Collector) updateWebhookQueueGauge() {
+	c.webhooks.mutex.Lock()
+	defer c.webhooks.mutex.Unlock()
+
+	c.metrics.webhookQueueGauge.With(prometheus.Labels{"queue": "pending"}).Set(float64(len(c.webhooks.Queue)))
+	c.metrics.webhookQueueGauge.With(prometheus.Labels{"queue": "dead"}).Set(float64(len(c.webhooks.DeadLetters)))
+}
+
+func (c *Collector) persistWebhooks() {
+	c.webhooks.saveMutex.Lock()
+	defer c.webhooks.saveMutex.Unlock()
+
+	c.webhooks.mutex.Lock()
+	webhooksJson, err := json.Marshal(&c.webhooks)
+	c.webhooks.mutex.Unlock()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	if err := c.options.Storage.Save(StoreWebhooks, webhooksJson); err != nil {
+		log.Println(err)
+	}
+}
+
+func (c *Collector) loadPersistentWebhooks() error {
+	content, err := c.options.Storage.Load(StoreWebhooks)
+	if err != nil {
+		log.Println(err)
+		log.Println("can't read webhooks, starting without webhooks...")
+		return nil
+	}
+
+	c.webhooks.mutex.Lock()
+	defer c.webhooks.mutex.Unlock()
+	if err := json.Unmarshal(content, &c.webhooks); err != nil {
+		return fmt.Errorf("can't unmarshal webhooks: %v", err)
+	}
+	if c.webhooks.Hooks == nil {
+		c.webhooks.Hooks = make(map[string]webhook)
+	}
+
+	return nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("can't read random bytes: " + err.Error()))
+	}
+
+	return hex.EncodeToString(b)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
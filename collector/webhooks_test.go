@@ -0,0 +1,321 @@
+package collector
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"errors"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// verifyWebhook checks a delivery like a receiver would, the timestamp has
+// to be within 5 minutes of now.
+func verifyWebhook(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-SpaceApi-Timestamp")
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+	if offset := now.Sub(time.Unix(unix, 0)); offset > 5*time.Minute || offset < -5*time.Minute {
+		return errors.New("timestamp outside of the tolerance")
+	}
+
+	expected := "sha256=" + signWebhookPayload(secret, timestamp, body)
+	if !hmac.Equal([]byte(header.Get("X-SpaceApi-Signature")), []byte(expected)) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+// webhookReceiver records the deliveries and answers them with handle.
+type webhookReceiver struct {
+	*httptest.Server
+	requests chan *http.Request
+	bodies   chan []byte
+}
+
+func newWebhookReceiver(handle http.HandlerFunc) *webhookReceiver {
+	receiver := &webhookReceiver{requests: make(chan *http.Request, 10), bodies: make(chan []byte, 10)}
+	receiver.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		receiver.requests <- r
+		receiver.bodies <- body
+		handle(w, r)
+	}))
+
+	return receiver
+}
+
+func newWebhookCollector(maxAttempts int, receivers ...*webhookReceiver) *Collector {
+	c := New(Options{WebhookToken: "fixture", WebhookMaxAttempts: maxAttempts})
+	for i, receiver := range receivers {
+		id := "hook" + strconv.Itoa(i)
+		c.webhooks.Hooks[id] = webhook{Id: id, Url: receiver.URL, Secret: "secret" + strconv.Itoa(i)}
+	}
+
+	return c
+}
+
+func TestWebhookSignatureCoversTheTimestamp(t *testing.T) {
+	receiver := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {})
+	defer receiver.Close()
+
+	c := newWebhookCollector(3, receiver)
+	c.queueWebhookDeliveries([]spaceapi.ChangeEvent{{Id: 1, Type: spaceapi.ChangeAdded, SpaceId: "fixture-space"}})
+	c.deliverDueWebhooks()
+	c.running.Wait()
+
+	r, body := <-receiver.requests, <-receiver.bodies
+	if err := verifyWebhook("secret0", r.Header, body, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a captured delivery can't be replayed later or with another timestamp
+	if err := verifyWebhook("secret0", r.Header, body, time.Now().Add(10*time.Minute)); err == nil {
+		t.Errorf("the delivery was accepted 10 minutes later")
+	}
+	replayed := http.Header{}
+	replayed.Set("X-SpaceApi-Timestamp", strconv.FormatInt(time.Now().Add(10*time.Minute).Unix(), 10))
+	replayed.Set("X-SpaceApi-Signature", r.Header.Get("X-SpaceApi-Signature"))
+	if err := verifyWebhook("secret0", replayed, body, time.Now().Add(10*time.Minute)); err == nil {
+		t.Errorf("the signature was accepted with another timestamp")
+	}
+}
+
+// deliverUntilReceived runs the delivery loop until the receiver got a
+// request, like the ticker of runWebhookDeliveries.
+func deliverUntilReceived(c *Collector, receiver *webhookReceiver) bool {
+	timeout := time.After(5 * time.Second)
+	for {
+		c.deliverDueWebhooks()
+		select {
+		case <-receiver.requests:
+			return true
+		case <-timeout:
+			return false
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func TestSlowReceiversDontBlockOthers(t *testing.T) {
+	release := make(chan struct{})
+	slow := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	})
+	defer slow.Close()
+	released := false
+	defer func() {
+		if !released {
+			close(release)
+		}
+	}()
+	fast := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {})
+	defer fast.Close()
+
+	c := newWebhookCollector(3, slow, fast)
+	c.queueWebhookDeliveries([]spaceapi.ChangeEvent{{Id: 1, Type: spaceapi.ChangeAdded, SpaceId: "fixture-space"}})
+	if !deliverUntilReceived(c, fast) {
+		t.Fatal("the fast receiver waited for the slow one")
+	}
+	<-slow.requests
+
+	// the next event waits for the delivery in flight to the slow receiver
+	c.queueWebhookDeliveries([]spaceapi.ChangeEvent{{Id: 2, Type: spaceapi.ChangeOpened, SpaceId: "fixture-space"}})
+	if !deliverUntilReceived(c, fast) {
+		t.Fatal("the fast receiver didn't get the second event")
+	}
+	select {
+	case <-slow.requests:
+		t.Error("the slow receiver got the second event before it answered the first one")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	released = true
+	c.running.Wait()
+	c.deliverDueWebhooks()
+	c.running.Wait()
+
+	var events []int64
+	for len(slow.bodies) > 0 {
+		var payload webhookPayload
+		if err := json.Unmarshal(<-slow.bodies, &payload); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, payload.Event.Id)
+	}
+	if len(events) != 2 || events[0] != 1 || events[1] != 2 {
+		t.Errorf("expected the slow receiver to get the events 1 and 2 in order, got %v", events)
+	}
+	if len(c.webhooks.Queue) != 0 {
+		t.Errorf("deliveries left in the queue: %+v", c.webhooks.Queue)
+	}
+}
+
+func TestDeadDeliveriesCanBeRetried(t *testing.T) {
+	failing := true
+	receiver := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+	defer receiver.Close()
+
+	c := newWebhookCollector(1, receiver)
+	c.queueWebhookDeliveries([]spaceapi.ChangeEvent{{Id: 1, Type: spaceapi.ChangeAdded, SpaceId: "fixture-space"}})
+	c.deliverDueWebhooks()
+	c.running.Wait()
+	if len(c.webhooks.Queue) != 0 || len(c.webhooks.DeadLetters) != 1 {
+		t.Fatalf("expected a dead delivery, got %+v and %+v", c.webhooks.Queue, c.webhooks.DeadLetters)
+	}
+
+	retry := func(id string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/webhooks/"+id+"/deliveries/retry", nil)
+		r.Header.Set("Authorization", "Bearer fixture")
+		w := httptest.NewRecorder()
+		c.Handler().ServeHTTP(w, r)
+		return w
+	}
+	if w := retry("unknown"); w.Code != http.StatusNotFound {
+		t.Errorf("retrying the deliveries of an unknown webhook responded with %d", w.Code)
+	}
+
+	w := retry("hook0")
+	var retried []webhookDelivery
+	if err := json.Unmarshal(w.Body.Bytes(), &retried); err != nil {
+		t.Fatal(err)
+	}
+	if w.Code != http.StatusOK || len(retried) != 1 || retried[0].Attempts != 0 || !strings.Contains(retried[0].LastError, "500") {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if len(c.webhooks.Queue) != 1 || len(c.webhooks.DeadLetters) != 0 {
+		t.Fatalf("expected the delivery to be queued again, got %+v and %+v", c.webhooks.Queue, c.webhooks.DeadLetters)
+	}
+
+	failing = false
+	c.deliverDueWebhooks()
+	c.running.Wait()
+	if len(c.webhooks.Queue) != 0 || len(c.webhooks.DeadLetters) != 0 {
+		t.Errorf("expected the delivery to succeed, got %+v and %+v", c.webhooks.Queue, c.webhooks.DeadLetters)
+	}
+	if len(receiver.requests) != 2 {
+		t.Errorf("expected 2 attempts, got %d", len(receiver.requests))
+	}
+}
+
+func TestFailedDeliveriesHoldBackLaterOnes(t *testing.T) {
+	failing := true
+	receiver := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	})
+	defer receiver.Close()
+
+	c := newWebhookCollector(3, receiver)
+	c.queueWebhookDeliveries([]spaceapi.ChangeEvent{
+		{Id: 1, Type: spaceapi.ChangeOpened, SpaceId: "fixture-space"},
+		{Id: 2, Type: spaceapi.ChangeClosed, SpaceId: "fixture-space"},
+	})
+	c.deliverDueWebhooks()
+	c.running.Wait()
+	if len(receiver.requests) != 1 {
+		t.Fatalf("expected the batch to stop at the failed delivery, got %d requests", len(receiver.requests))
+	}
+
+	// the later delivery waits for the backoff of the failed one
+	c.deliverDueWebhooks()
+	c.running.Wait()
+	if len(receiver.requests) != 1 {
+		t.Fatalf("the later delivery was sent before the failed one")
+	}
+
+	failing = false
+	c.webhooks.mutex.Lock()
+	c.webhooks.Queue[0].NextAttempt = time.Now().Unix()
+	c.webhooks.mutex.Unlock()
+	c.deliverDueWebhooks()
+	c.running.Wait()
+
+	var events []int64
+	for len(receiver.bodies) > 0 {
+		<-receiver.requests
+		var payload webhookPayload
+		if err := json.Unmarshal(<-receiver.bodies, &payload); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, payload.Event.Id)
+	}
+	if len(events) != 3 || events[0] != 1 || events[1] != 1 || events[2] != 2 {
+		t.Errorf("expected the events 1, 1 and 2, got %v", events)
+	}
+	if len(c.webhooks.Queue) != 0 {
+		t.Errorf("deliveries left in the queue: %+v", c.webhooks.Queue)
+	}
+}
+
+func TestDeletingAWebhookDropsItsDeliveries(t *testing.T) {
+	first := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {})
+	defer first.Close()
+	second := newWebhookReceiver(func(w http.ResponseWriter, r *http.Request) {})
+	defer second.Close()
+
+	c := newWebhookCollector(3, first, second)
+	c.webhooks.DeadLetters = []webhookDelivery{{Id: "a", WebhookId: "hook0"}, {Id: "b", WebhookId: "hook1"}}
+
+	r := httptest.NewRequest(http.MethodDelete, "/webhooks/hook0", nil)
+	r.Header.Set("Authorization", "Bearer fixture")
+	w := httptest.NewRecorder()
+	c.Handler().ServeHTTP(w, r)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("deleting the webhook responded with %d", w.Code)
+	}
+
+	if len(c.webhooks.DeadLetters) != 1 || c.webhooks.DeadLetters[0].WebhookId != "hook1" {
+		t.Errorf("expected only the dead delivery of the other webhook, got %+v", c.webhooks.DeadLetters)
+	}
+}
+
+func TestPersistingWebhooksConcurrently(t *testing.T) {
+	storage := FileStorage{StoreWebhooks: filepath.Join(t.TempDir(), "webhooks.json")}
+	c := New(Options{WebhookToken: "fixture", Storage: storage})
+	for i := 0; i < 50; i++ {
+		id := "hook" + strconv.Itoa(i)
+		c.webhooks.Hooks[id] = webhook{Id: id, Url: "https://hooks.example/" + strings.Repeat("x", i*100)}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.persistWebhooks()
+		}()
+	}
+	wg.Wait()
+
+	loaded := New(Options{Storage: storage})
+	if err := loaded.loadPersistentWebhooks(); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.webhooks.Hooks) != 50 {
+		t.Errorf("expected 50 webhooks, got %d", len(loaded.webhooks.Hooks))
+	}
+	if files, _ := filepath.Glob(filepath.Join(filepath.Dir(storage[StoreWebhooks]), "*.tmp")); len(files) != 0 {
+		t.Errorf("temporary files were left behind: %v", files)
+	}
+	if info, err := os.Stat(storage[StoreWebhooks]); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the webhooks to be only readable by the owner, got %v %v", info, err)
+	}
+}
@@ -0,0 +1,39 @@
+package spaceapi
+
+// CalendarEvent is a VEVENT of a calendar feed. Recurring events are kept
+// with their rule, the api expands them for the requested time range.
+type CalendarEvent struct {
+	Uid         string `json:"uid"`
+	Summary     string `json:"summary,omitempty"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+	Url         string `json:"url,omitempty"`
+	Start       int64  `json:"start" description:"Unix timestamp"`
+	End         int64  `json:"end" description:"Unix timestamp"`
+	AllDay      bool   `json:"allDay,omitempty"`
+	// TimeZone of the start, recurrences have to be expanded in it to keep
+	// their local time across daylight saving time changes
+	TimeZone string  `json:"timeZone,omitempty" description:"Time zone the recurrence rule is evaluated in"`
+	RRule    string  `json:"rrule,omitempty" description:"RFC 5545 recurrence rule"`
+	RDates   []int64 `json:"rdates,omitempty"`
+	ExDates  []int64 `json:"exdates,omitempty"`
+	// RecurrenceId is set for events replacing a single occurrence of the
+	// recurring event with the same uid
+	RecurrenceId int64 `json:"recurrenceId,omitempty" description:"Start of the occurrence of the recurring event with the same uid this event replaces"`
+	Cancelled    bool  `json:"cancelled,omitempty"`
+}
+
+// SpaceCalendar is the calendar feed of a space as fetched and parsed by the
+// collector and served on its /calendars.
+type SpaceCalendar struct {
+	SpaceId     string          `json:"spaceId"`
+	Space       string          `json:"space,omitempty"`
+	Url         string          `json:"url" description:"Url of the iCalendar feed"`
+	Country     string          `json:"country,omitempty"`
+	Lat         *float64        `json:"lat,omitempty"`
+	Lon         *float64        `json:"lon,omitempty"`
+	TimeZone    string          `json:"timeZone,omitempty" description:"Time zone floating times and dates of the feed are read in"`
+	LastFetched int64           `json:"lastFetched,omitempty"`
+	Error       string          `json:"error,omitempty" description:"Error of the last fetch, the events of the previous fetch are kept"`
+	Events      []CalendarEvent `json:"events"`
+}
@@ -0,0 +1,41 @@
+package spaceapi
+
+// The types of change events.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeValid   = "valid"
+	ChangeInvalid = "invalid"
+	ChangeOpened  = "opened"
+	ChangeClosed  = "closed"
+	ChangeData    = "changed"
+)
+
+// ChangeEvent is recorded by the collector when a space was added, removed,
+// became valid or invalid, opened, closed or changed its data.
+type ChangeEvent struct {
+	Id    int64  `json:"id" description:"Sequential id of the event"`
+	Time  int64  `json:"time" description:"Unix timestamp of the rebuild that detected the change"`
+	Type  string `json:"type" enum:"added,removed,valid,invalid,opened,closed,changed"`
+	Space string `json:"space,omitempty" description:"The name of the space"`
+	Url   string `json:"url" description:"url to the spaceapi file"`
+	// SpaceId is the id of the space in the directory, derived from its name
+	// when the space was first seen with data. It stays the same when the
+	// space is renamed.
+	SpaceId string   `json:"spaceId" description:"Url friendly identifier of the space"`
+	Country string   `json:"country,omitempty" description:"Country code of the space location"`
+	Lat     *float64 `json:"lat,omitempty" description:"Latitude of the space location"`
+	Lon     *float64 `json:"lon,omitempty" description:"Longitude of the space location"`
+	// Cursor points to this event, it's only set in responses
+	Cursor string `json:"cursor,omitempty" description:"Cursor pointing to this event"`
+}
+
+// ChangesResponse is a page of the change feed. Cursor is passed as since to
+// get the next page, Truncated is set if events the client hasn't seen yet
+// were already dropped from the log.
+type ChangesResponse struct {
+	Events    []ChangeEvent `json:"events" description:"Events ordered from the oldest to the newest"`
+	Cursor    string        `json:"cursor" description:"Pass as since to resume after the last returned event"`
+	HasMore   bool          `json:"hasMore" description:"More events are available, request again with the returned cursor"`
+	Truncated bool          `json:"truncated" description:"Events after the given cursor were already dropped from the log"`
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/url"
+)
+
+// Changes returns a page of the change feed. Pass the cursor of the response
+// to Since to get the next page, or use ChangesIterator.
+func (c *Client) Changes(ctx context.Context, options ...Option) (spaceapi.ChangesResponse, error) {
+	var response spaceapi.ChangesResponse
+	_, err := c.getJson(ctx, "/v2/changes", options, &response)
+	return response, err
+}
+
+// ChangesIterator pages through the change feed from the oldest to the
+// newest event:
+//
+//	it := c.ChangesIterator(client.Since(cursor))
+//	for it.Next(ctx) {
+//		event := it.Event()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+//	cursor = it.Cursor()
+type ChangesIterator struct {
+	client    *Client
+	options   []Option
+	cursor    string
+	events    []spaceapi.ChangeEvent
+	event     spaceapi.ChangeEvent
+	done      bool
+	truncated bool
+	err       error
+}
+
+// ChangesIterator returns an iterator over the change events selected by
+// the options. NewestFirst isn't supported, the feed is always paged from
+// the oldest event on.
+func (c *Client) ChangesIterator(options ...Option) *ChangesIterator {
+	it := &ChangesIterator{client: c}
+	for _, option := range options {
+		query := url.Values{}
+		option(query)
+		// the cursor is taken over by the iterator
+		if since, ok := query["since"]; ok {
+			it.cursor = since[0]
+			continue
+		}
+		if _, ok := query["order"]; ok {
+			continue
+		}
+		it.options = append(it.options, option)
+	}
+
+	return it
+}
+
+// Next advances to the next event and requests the next page if needed. It
+// returns false at the end of the feed or after an error.
+func (it *ChangesIterator) Next(ctx context.Context) bool {
+	for len(it.events) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+
+		options := append([]Option{}, it.options...)
+		if it.cursor != "" {
+			options = append(options, Since(it.cursor))
+		}
+
+		response, err := it.client.Changes(ctx, options...)
+		if err != nil {
+			it.err = err
+			return false
+		}
+
+		it.events = response.Events
+		it.cursor = response.Cursor
+		it.done = !response.HasMore
+		it.truncated = it.truncated || response.Truncated
+	}
+
+	it.event = it.events[0]
+	it.events = it.events[1:]
+	return true
+}
+
+// Event is the current event.
+func (it *ChangesIterator) Event() spaceapi.ChangeEvent {
+	return it.event
+}
+
+// Err is the error that stopped the iteration.
+func (it *ChangesIterator) Err() error {
+	return it.err
+}
+
+// Cursor is the position after the last requested page, pass it to Since
+// to continue later. It's only complete once Next returned false.
+func (it *ChangesIterator) Cursor() string {
+	return it.cursor
+}
+
+// Truncated reports whether events after the start cursor were already
+// dropped from the change log and are missing.
+func (it *ChangesIterator) Truncated() bool {
+	return it.truncated
+}
@@ -0,0 +1,129 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// changeFeed serves events 1 to n pageSize events at a time, the cursor of
+// an event is its id. Events before oldest were dropped from the log.
+type changeFeed struct {
+	n        int64
+	pageSize int64
+	oldest   int64
+
+	mutex    sync.Mutex
+	requests []string
+}
+
+func (f *changeFeed) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	f.requests = append(f.requests, r.URL.RawQuery)
+	f.mutex.Unlock()
+
+	since, _ := strconv.ParseInt(r.URL.Query().Get("since"), 10, 64)
+	response := spaceapi.ChangesResponse{Events: []spaceapi.ChangeEvent{}, Cursor: r.URL.Query().Get("since")}
+	if since < f.oldest-1 {
+		response.Truncated = true
+		since = f.oldest - 1
+	}
+	for id := since + 1; id <= f.n && int64(len(response.Events)) < f.pageSize; id++ {
+		cursor := strconv.FormatInt(id, 10)
+		response.Events = append(response.Events, spaceapi.ChangeEvent{Id: id, Type: spaceapi.ChangeOpened, SpaceId: "fixture-space", Cursor: cursor})
+		response.Cursor = cursor
+	}
+	response.HasMore = len(response.Events) > 0 && response.Events[len(response.Events)-1].Id < f.n
+
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+func TestChangesIteratorPagesThroughCursors(t *testing.T) {
+	feed := &changeFeed{n: 5, pageSize: 2, oldest: 1}
+	server := httptest.NewServer(feed)
+	defer server.Close()
+
+	c := New(server.URL)
+	it := c.ChangesIterator(Since("1"), Types(spaceapi.ChangeOpened), NewestFirst())
+	var ids []int64
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Event().Id)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ids) != 4 || ids[0] != 2 || ids[3] != 5 {
+		t.Errorf("expected the events 2 to 5, got %v", ids)
+	}
+	if it.Cursor() != "5" {
+		t.Errorf("expected the cursor 5, got %q", it.Cursor())
+	}
+	if it.Truncated() {
+		t.Errorf("no events were dropped")
+	}
+
+	// the order is dropped and since is advanced with every page
+	expected := []string{"since=1&types=opened", "since=3&types=opened"}
+	if len(feed.requests) != len(expected) {
+		t.Fatalf("expected the requests %v, got %v", expected, feed.requests)
+	}
+	for i, query := range expected {
+		if feed.requests[i] != query {
+			t.Errorf("request %d: expected %q, got %q", i+1, query, feed.requests[i])
+		}
+	}
+
+	// continuing from the cursor returns the new events only
+	feed.n = 6
+	it = c.ChangesIterator(Since(it.Cursor()))
+	if !it.Next(context.Background()) || it.Event().Id != 6 {
+		t.Errorf("expected the new event 6, got %+v", it.Event())
+	}
+	if it.Next(context.Background()) {
+		t.Errorf("unexpected event %+v", it.Event())
+	}
+}
+
+func TestChangesIteratorReportsTruncation(t *testing.T) {
+	server := httptest.NewServer(&changeFeed{n: 5, pageSize: 10, oldest: 4})
+	defer server.Close()
+
+	it := New(server.URL).ChangesIterator(Since("1"))
+	var ids []int64
+	for it.Next(context.Background()) {
+		ids = append(ids, it.Event().Id)
+	}
+	if len(ids) != 2 || !it.Truncated() {
+		t.Errorf("expected the events 4 and 5 and the truncation, got %v %v", ids, it.Truncated())
+	}
+}
+
+func TestChangesIteratorStopsOnErrors(t *testing.T) {
+	feed := &changeFeed{n: 5, pageSize: 2, oldest: 1}
+	server := newRecordingServer(
+		feed.ServeHTTP,
+		respond(http.StatusBadRequest, "since has to be a cursor"),
+	)
+	defer server.Close()
+
+	it := newTestClient(server).ChangesIterator()
+	count := 0
+	for it.Next(context.Background()) {
+		count++
+	}
+	if count != 2 {
+		t.Errorf("expected the 2 events of the first page, got %d", count)
+	}
+	if apiError, ok := it.Err().(*Error); !ok || apiError.StatusCode != http.StatusBadRequest {
+		t.Errorf("unexpected error %v", it.Err())
+	}
+	if it.Cursor() != "2" {
+		t.Errorf("expected the cursor of the first page, got %q", it.Cursor())
+	}
+}
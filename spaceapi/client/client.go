@@ -0,0 +1,231 @@
+// Package client is a Go client for the SpaceAPI directory api. Responses
+// are decoded into the models of the spaceapi package, failed requests are
+// retried and unchanged responses are served from a cache with conditional
+// requests.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBaseUrl is the public instance of the api.
+const DefaultBaseUrl = "https://api.spaceapi.io"
+
+const (
+	defaultRetries    = 3
+	defaultRetryDelay = 500 * time.Millisecond
+	maxRetryDelay     = 30 * time.Second
+	maxCachedBodies   = 64
+)
+
+// Client calls the api. Its fields must not be changed after the first
+// request, it's safe for concurrent use.
+type Client struct {
+	// BaseUrl of the api without a trailing slash
+	BaseUrl    string
+	HttpClient *http.Client
+	UserAgent  string
+	// Retries is the number of times a request is repeated after a network
+	// error, 429 or 5xx response, RetryDelay the delay before the first
+	// retry. The delay doubles with every retry unless the api sends a
+	// Retry-After header.
+	Retries    int
+	RetryDelay time.Duration
+	// DisableCache turns off conditional requests, every response is
+	// downloaded in full
+	DisableCache bool
+
+	mutex sync.Mutex
+	cache map[string]cachedBody
+}
+
+// cachedBody is the last response of a url together with its ETag.
+type cachedBody struct {
+	etag string
+	body []byte
+}
+
+// Error is returned for responses with a status other than 200.
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("api responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// IsNotFound reports whether err is a 404 response of the api.
+func IsNotFound(err error) bool {
+	apiError, ok := err.(*Error)
+	return ok && apiError.StatusCode == http.StatusNotFound
+}
+
+// New returns a Client for the api at baseUrl with the default retries.
+func New(baseUrl string) *Client {
+	return &Client{
+		BaseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		HttpClient: http.DefaultClient,
+		UserAgent:  "spaceapi-directory-client",
+		Retries:    defaultRetries,
+		RetryDelay: defaultRetryDelay,
+	}
+}
+
+// getJson requests path with the query of the options and decodes the body
+// into v. The headers of the response are returned.
+func (c *Client) getJson(ctx context.Context, path string, options []Option, v interface{}) (http.Header, error) {
+	query := url.Values{}
+	for _, option := range options {
+		option(query)
+	}
+
+	requestUrl := c.BaseUrl + path
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	header, body, err := c.get(ctx, requestUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// get requests the url and retries failed attempts. A 304 response to the
+// ETag of the cached body returns the cached body.
+func (c *Client) get(ctx context.Context, requestUrl string) (http.Header, []byte, error) {
+	cached, isCached := c.cached(requestUrl)
+
+	delay := c.RetryDelay
+	for attempt := 0; ; attempt++ {
+		header, body, retryAfter, err := c.attempt(ctx, requestUrl, cached, isCached)
+		if err == nil || retryAfter < 0 || attempt >= c.Retries {
+			return header, body, err
+		}
+
+		wait := delay
+		if retryAfter > 0 {
+			wait = retryAfter
+		}
+		if wait > maxRetryDelay {
+			wait = maxRetryDelay
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		case <-timer.C:
+		}
+		delay *= 2
+	}
+}
+
+// attempt sends a single request. retryAfter is negative if the request
+// must not be retried and positive if the api asked for a delay.
+func (c *Client) attempt(ctx context.Context, requestUrl string, cached cachedBody, isCached bool) (http.Header, []byte, time.Duration, error) {
+	req, err := http.NewRequest(http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return nil, nil, -1, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Accept", "application/json")
+	if c.UserAgent != "" {
+		req.Header.Set("User-Agent", c.UserAgent)
+	}
+	if isCached {
+		req.Header.Set("If-None-Match", cached.etag)
+	}
+
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, -1, ctx.Err()
+		}
+		return nil, nil, 0, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && isCached:
+		return resp.Header, cached.body, 0, nil
+	case resp.StatusCode == http.StatusOK:
+		c.store(requestUrl, resp.Header.Get("ETag"), body)
+		return resp.Header, body, 0, nil
+	}
+
+	apiError := &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500 {
+		return nil, nil, retryAfter(resp.Header.Get("Retry-After")), apiError
+	}
+
+	return nil, nil, -1, apiError
+}
+
+// retryAfter parses the delay in seconds of a Retry-After header, dates
+// aren't sent by the api and fall back to the default delay.
+func retryAfter(value string) time.Duration {
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func (c *Client) cached(requestUrl string) (cachedBody, bool) {
+	if c.DisableCache {
+		return cachedBody{}, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cached, ok := c.cache[requestUrl]
+	return cached, ok
+}
+
+func (c *Client) store(requestUrl string, etag string, body []byte) {
+	if c.DisableCache || etag == "" {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.cache == nil {
+		c.cache = make(map[string]cachedBody)
+	}
+	// the cache is only meant for polling the same few urls, it's dropped
+	// as a whole once it gets too big
+	if _, ok := c.cache[requestUrl]; !ok && len(c.cache) >= maxCachedBodies {
+		c.cache = make(map[string]cachedBody)
+	}
+	c.cache[requestUrl] = cachedBody{etag: etag, body: body}
+}
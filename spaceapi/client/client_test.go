@@ -0,0 +1,262 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingServer answers the requests with the handlers in order, the last
+// one answers all remaining requests. The requests and the time they were
+// received are recorded.
+type recordingServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	requests []*http.Request
+	times    []time.Time
+}
+
+func newRecordingServer(handlers ...http.HandlerFunc) *recordingServer {
+	s := &recordingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mutex.Lock()
+		n := len(s.requests)
+		s.requests = append(s.requests, r)
+		s.times = append(s.times, time.Now())
+		s.mutex.Unlock()
+
+		if n >= len(handlers) {
+			n = len(handlers) - 1
+		}
+		handlers[n](w, r)
+	}))
+
+	return s
+}
+
+func (s *recordingServer) count() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.requests)
+}
+
+func respond(status int, body string, headers ...string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i+1 < len(headers); i += 2 {
+			w.Header().Set(headers[i], headers[i+1])
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func newTestClient(server *recordingServer) *Client {
+	c := New(server.URL + "/")
+	c.RetryDelay = 20 * time.Millisecond
+	return c
+}
+
+func TestRetriesWithBackoff(t *testing.T) {
+	server := newRecordingServer(
+		respond(http.StatusServiceUnavailable, "maintenance"),
+		respond(http.StatusTooManyRequests, "slow down"),
+		respond(http.StatusOK, `{"Fixture Space": "https://fixture.example/space.json"}`),
+	)
+	defer server.Close()
+
+	spaces, err := newTestClient(server).V1(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if spaces["Fixture Space"] != "https://fixture.example/space.json" {
+		t.Errorf("unexpected response %v", spaces)
+	}
+	if server.count() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", server.count())
+	}
+
+	// the delay doubles with every retry
+	if delay := server.times[1].Sub(server.times[0]); delay < 20*time.Millisecond {
+		t.Errorf("first retry after %v", delay)
+	}
+	if delay := server.times[2].Sub(server.times[1]); delay < 40*time.Millisecond {
+		t.Errorf("second retry after %v", delay)
+	}
+}
+
+func TestGivesUpAfterRetries(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusBadGateway, "collector unavailable"))
+	defer server.Close()
+
+	c := newTestClient(server)
+	c.Retries = 2
+	_, err := c.V1(context.Background())
+	apiError, ok := err.(*Error)
+	if !ok || apiError.StatusCode != http.StatusBadGateway || apiError.Message != "collector unavailable" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if server.count() != 3 {
+		t.Errorf("expected 3 attempts, got %d", server.count())
+	}
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusNotFound, "404 page not found"))
+	defer server.Close()
+
+	_, err := newTestClient(server).Space(context.Background(), "unknown")
+	if !IsNotFound(err) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+	if server.count() != 1 {
+		t.Errorf("expected 1 attempt, got %d", server.count())
+	}
+}
+
+func TestRetryWaitEndsWithContext(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusServiceUnavailable, "maintenance", "Retry-After", "60"))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := newTestClient(server).V1(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expected the deadline to be exceeded, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("waited %v for the retry", time.Since(start))
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	for value, expected := range map[string]time.Duration{
+		"":                              0,
+		"0":                             0,
+		"-3":                            0,
+		"5":                             5 * time.Second,
+		"Wed, 21 Oct 2015 07:28:00 GMT": 0,
+	} {
+		if delay := retryAfter(value); delay != expected {
+			t.Errorf("Retry-After %q: expected %v, got %v", value, expected, delay)
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	body := `[{"id": "fixture-space", "url": "https://fixture.example/space.json", "valid": true, "space": "Fixture Space", "lastSeen": 1600000000}]`
+	server := newRecordingServer(
+		respond(http.StatusOK, body, "ETag", `"v1"`),
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("If-None-Match") != `"v1"` {
+				respond(http.StatusOK, body, "ETag", `"v1"`)(w, r)
+				return
+			}
+			respond(http.StatusNotModified, "", "ETag", `"v1"`)(w, r)
+		},
+	)
+	defer server.Close()
+
+	c := newTestClient(server)
+	for i := 0; i < 2; i++ {
+		response, err := c.Spaces(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Spaces) != 1 || response.Spaces[0].Id != "fixture-space" {
+			t.Errorf("request %d: unexpected response %+v", i+1, response.Spaces)
+		}
+	}
+
+	if server.requests[0].Header.Get("If-None-Match") != "" {
+		t.Errorf("the first request sent If-None-Match %q", server.requests[0].Header.Get("If-None-Match"))
+	}
+	if server.requests[1].Header.Get("If-None-Match") != `"v1"` {
+		t.Errorf("the second request sent If-None-Match %q", server.requests[1].Header.Get("If-None-Match"))
+	}
+}
+
+func TestCacheIsPerUrl(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusOK, `{}`, "ETag", `"v1"`))
+	defer server.Close()
+
+	c := newTestClient(server)
+	if _, err := c.V1(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.V1(context.Background(), AllSpaces()); err != nil {
+		t.Fatal(err)
+	}
+	if etag := server.requests[1].Header.Get("If-None-Match"); etag != "" {
+		t.Errorf("the ETag of /v1 was sent for /v1?valid=all")
+	}
+}
+
+func TestDisableCache(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusOK, `{}`, "ETag", `"v1"`))
+	defer server.Close()
+
+	c := newTestClient(server)
+	c.DisableCache = true
+	for i := 0; i < 2; i++ {
+		if _, err := c.V1(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if etag := server.requests[1].Header.Get("If-None-Match"); etag != "" {
+		t.Errorf("If-None-Match %q was sent with the cache disabled", etag)
+	}
+}
+
+func TestUnrepresentableFields(t *testing.T) {
+	server := newRecordingServer(respond(http.StatusOK, `{"id": "fixture-space"}`, unrepresentableFieldsHeader, "contact.xmpp, issue_report_channels"))
+	defer server.Close()
+
+	response, err := newTestClient(server).Space(context.Background(), "fixture-space", Version("0.13"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(response.UnrepresentableFields) != 2 || response.UnrepresentableFields[0] != "contact.xmpp" || response.UnrepresentableFields[1] != "issue_report_channels" {
+		t.Errorf("unexpected fields %v", response.UnrepresentableFields)
+	}
+	if server.requests[0].URL.Path != "/v2/spaces/fixture-space" {
+		t.Errorf("requested %v", server.requests[0].URL.Path)
+	}
+}
+
+func TestUnconvertedSpaces(t *testing.T) {
+	server := newRecordingServer(
+		respond(http.StatusOK, `[{"id": "fixture-space"}, {"id": "legacy-space"}]`, unconvertedSpacesHeader, "legacy-space"),
+		respond(http.StatusOK, `{"id": "legacy-space"}`, unconvertedSpacesHeader, "legacy-space"),
+		respond(http.StatusOK, `{"id": "fixture-space"}`),
+	)
+	defer server.Close()
+
+	c := newTestClient(server)
+	spaces, err := c.Spaces(context.Background(), IncludeData(), Version("0.13"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spaces.UnconvertedSpaces) != 1 || spaces.UnconvertedSpaces[0] != "legacy-space" {
+		t.Errorf("unexpected spaces %v", spaces.UnconvertedSpaces)
+	}
+
+	// the server answers in this order
+	for _, test := range []struct {
+		id          string
+		unconverted bool
+	}{
+		{"legacy-space", true},
+		{"fixture-space", false},
+	} {
+		space, err := c.Space(context.Background(), test.id, Version("0.13"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if space.Unconverted != test.unconverted {
+			t.Errorf("%v: expected unconverted to be %v", test.id, test.unconverted)
+		}
+	}
+}
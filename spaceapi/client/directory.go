@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	unrepresentableFieldsHeader = "X-SpaceAPI-Unrepresentable-Fields"
+	unconvertedSpacesHeader     = "X-SpaceAPI-Unconverted-Spaces"
+)
+
+// SpacesResponse is the directory as listed on /v2.
+type SpacesResponse struct {
+	Spaces []spaceapi.ListedEntry
+	// UnrepresentableFields are the fields dropped when converting the data
+	// to the requested version
+	UnrepresentableFields []string
+	// UnconvertedSpaces are the ids of the spaces the collector couldn't
+	// normalize, their data is returned as published
+	UnconvertedSpaces []string
+}
+
+// SpaceResponse is a single space as returned by /v2/spaces/{id}.
+type SpaceResponse struct {
+	Space                 spaceapi.ListedEntry
+	UnrepresentableFields []string
+	// Unconverted is set if the data is returned as published because the
+	// collector couldn't normalize it
+	Unconverted bool
+}
+
+// V1 returns the names of the spaces mapped to their endpoints. Spaces
+// without data are listed as unknown_ followed by a random number.
+func (c *Client) V1(ctx context.Context, options ...Option) (map[string]string, error) {
+	var response map[string]string
+	if _, err := c.getJson(ctx, "/v1", options, &response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// Spaces returns the directory, see IncludeData, IncludeValidationResult
+// and SortByAvailability for what is listed.
+func (c *Client) Spaces(ctx context.Context, options ...Option) (SpacesResponse, error) {
+	var response SpacesResponse
+	header, err := c.getJson(ctx, "/v2", options, &response.Spaces)
+	if err != nil {
+		return response, err
+	}
+	response.UnrepresentableFields = headerList(header, unrepresentableFieldsHeader)
+	response.UnconvertedSpaces = headerList(header, unconvertedSpacesHeader)
+
+	return response, nil
+}
+
+// Space returns a single space with its data and validation result, an
+// unknown id is an error for which IsNotFound is true.
+func (c *Client) Space(ctx context.Context, id string, options ...Option) (SpaceResponse, error) {
+	var response SpaceResponse
+	header, err := c.getJson(ctx, "/v2/spaces/"+url.PathEscape(id), options, &response.Space)
+	if err != nil {
+		return response, err
+	}
+	response.UnrepresentableFields = headerList(header, unrepresentableFieldsHeader)
+	response.Unconverted = len(headerList(header, unconvertedSpacesHeader)) > 0
+
+	return response, nil
+}
+
+// Cache returns the directory as kept by the collector, including the raw
+// and the normalized data of every space.
+func (c *Client) Cache(ctx context.Context, options ...Option) ([]spaceapi.Entry, error) {
+	var response []spaceapi.Entry
+	if _, err := c.getJson(ctx, "/cache", options, &response); err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// headerList splits the comma separated values of a header.
+func headerList(header http.Header, name string) []string {
+	var fields []string
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, field := range strings.Split(value, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+
+	return fields
+}
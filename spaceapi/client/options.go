@@ -0,0 +1,119 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Option sets query parameters of a request. Options that don't apply to an
+// endpoint are ignored by the api.
+type Option func(query url.Values)
+
+// Valid only returns spaces that are valid (the default) or invalid.
+func Valid(valid bool) Option {
+	return func(query url.Values) {
+		query.Set("valid", strconv.FormatBool(valid))
+	}
+}
+
+// AllSpaces returns valid and invalid spaces.
+func AllSpaces() Option {
+	return func(query url.Values) {
+		query.Set("valid", "all")
+	}
+}
+
+// Filter selects the entries with a jq expression, e.g.
+// `.data.state.open == true`.
+func Filter(expression string) Option {
+	return func(query url.Values) {
+		query.Set("filter", expression)
+	}
+}
+
+// IncludeData adds the data of the spaces to /v2.
+func IncludeData() Option {
+	return func(query url.Values) {
+		query.Set("includeData", "true")
+	}
+}
+
+// IncludeValidationResult adds the validation results to /v2.
+func IncludeValidationResult() Option {
+	return func(query url.Values) {
+		query.Set("includeValidationResult", "true")
+	}
+}
+
+// Raw returns the data as published by the spaces instead of the normalized
+// data.
+func Raw() Option {
+	return func(query url.Values) {
+		query.Set("raw", "true")
+	}
+}
+
+// Version converts the normalized data to a schema version, 0.13, 14 or
+// 15. It can't be combined with Raw.
+func Version(version string) Option {
+	return func(query url.Values) {
+		query.Set("version", version)
+	}
+}
+
+// SortByAvailability sorts /v2 by the availability in a window of 24h, 7d
+// or 30d, the most available spaces first unless ascending is set.
+func SortByAvailability(window string, ascending bool) Option {
+	return func(query url.Values) {
+		query.Set("sort", "availability")
+		query.Set("window", window)
+		if ascending {
+			query.Set("order", "asc")
+		}
+	}
+}
+
+// Since returns the change events after a cursor of a previous response.
+func Since(cursor string) Option {
+	return func(query url.Values) {
+		query.Set("since", cursor)
+	}
+}
+
+// SinceTime returns the change events after a point in time.
+func SinceTime(t time.Time) Option {
+	return func(query url.Values) {
+		query.Set("since", strconv.FormatInt(t.Unix(), 10))
+	}
+}
+
+// Limit is the maximum number of change events per response.
+func Limit(limit int) Option {
+	return func(query url.Values) {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+}
+
+// SpaceIds only returns the change events of these spaces.
+func SpaceIds(ids ...string) Option {
+	return func(query url.Values) {
+		query.Set("spaceId", strings.Join(ids, ","))
+	}
+}
+
+// Types only returns change events of these types, e.g.
+// spaceapi.ChangeOpened.
+func Types(types ...string) Option {
+	return func(query url.Values) {
+		query.Set("types", strings.Join(types, ","))
+	}
+}
+
+// NewestFirst returns the newest change events first.
+func NewestFirst() Option {
+	return func(query url.Values) {
+		query.Set("order", "desc")
+	}
+}
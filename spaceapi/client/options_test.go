@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"github.com/spaceapi/directory-api/spaceapi"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestOptionsSetQueryParameters(t *testing.T) {
+	for _, test := range []struct {
+		options []Option
+		query   string
+	}{
+		{nil, ""},
+		{[]Option{Valid(false)}, "valid=false"},
+		{[]Option{AllSpaces()}, "valid=all"},
+		{[]Option{Filter(`.data.state.open == true`)}, "filter=.data.state.open+%3D%3D+true"},
+		{[]Option{IncludeData(), IncludeValidationResult()}, "includeData=true&includeValidationResult=true"},
+		{[]Option{IncludeData(), Raw()}, "includeData=true&raw=true"},
+		{[]Option{IncludeData(), Version("0.13")}, "includeData=true&version=0.13"},
+		{[]Option{SortByAvailability("7d", false)}, "sort=availability&window=7d"},
+		{[]Option{SortByAvailability("24h", true)}, "order=asc&sort=availability&window=24h"},
+		{[]Option{Since("ZXZlbnQ6Mg")}, "since=ZXZlbnQ6Mg"},
+		{[]Option{SinceTime(time.Unix(1600000000, 0))}, "since=1600000000"},
+		{[]Option{Limit(10), NewestFirst()}, "limit=10&order=desc"},
+		{[]Option{SpaceIds("fixture-space", "legacy-space")}, "spaceId=fixture-space%2Clegacy-space"},
+		{[]Option{Types(spaceapi.ChangeOpened, spaceapi.ChangeClosed)}, "types=opened%2Cclosed"},
+		// later options override earlier ones
+		{[]Option{Valid(true), AllSpaces()}, "valid=all"},
+	} {
+		server := newRecordingServer(respond(http.StatusOK, `[]`))
+		if _, err := newTestClient(server).Spaces(context.Background(), test.options...); err != nil {
+			t.Fatal(err)
+		}
+		server.Close()
+
+		if query := server.requests[0].URL.RawQuery; query != test.query {
+			t.Errorf("expected query %q, got %q", test.query, query)
+		}
+	}
+}
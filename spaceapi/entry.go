@@ -0,0 +1,78 @@
+// Package spaceapi holds the models shared by the api and the collector: the
+// data of a space and the entries of the directory as they are passed from
+// the collector to the api and on to clients.
+package spaceapi
+
+// Entry is a space in the directory as kept by the collector and served on
+// its root, the api reads it back from there.
+type Entry struct {
+	Id               string                  `json:"id,omitempty" description:"Url friendly identifier of the space, it stays the same when the space is renamed"`
+	Url              string                  `json:"url" description:"url to the spaceapi file"`
+	Valid            bool                    `json:"valid" description:"indicates if the provided file is valid"`
+	LastSeen         int64                   `json:"lastSeen,omitempty" description:"when we've seen the endpoint the last time (doesn't have to be valid, but the url was reachable and provided valid json)"`
+	ErrMsg           []string                `json:"errMsg,omitempty" description:"provided if we found an error with that specific endpoint"`
+	Data             map[string]interface{}  `json:"data,omitempty" description:"Last validated data as published by the space"`
+	Normalized       *Space                  `json:"normalized,omitempty" description:"Last validated data normalized to the latest schema version"`
+	ValidationResult ValidationResult        `json:"validationResult,omitempty" description:"Last Validation result"`
+	Availability     map[string]Availability `json:"availability,omitempty" description:"Availability of the endpoint per window (24h, 7d and 30d), windows without scrapes are missing"`
+}
+
+// SpaceName returns the name from the raw data, if there is any.
+func (e Entry) SpaceName() string {
+	name, _ := e.Data["space"].(string)
+	return name
+}
+
+// ListedEntry is a space as listed by the api on /v2. Data and the
+// validation result are only set if requested, Data is either the normalized
+// or the raw data of the entry.
+type ListedEntry struct {
+	Id               string                  `json:"id,omitempty" description:"Url friendly identifier of the space, it stays the same when the space is renamed"`
+	Url              string                  `json:"url" description:"url to the spaceapi file"`
+	Valid            bool                    `json:"valid" description:"indicates if the provided file is valid"`
+	Space            string                  `json:"space,omitempty" description:"The name of the space"`
+	LastSeen         int64                   `json:"lastSeen,omitempty" description:"when we've seen the endpoint the last time (doesn't have to be valid, but the url was reachable and provided valid json)"`
+	ErrMsg           []string                `json:"errMsg,omitempty" description:"provided if we found an error with that specific endpoint"`
+	Data             map[string]interface{}  `json:"data,omitempty" description:"Last validated data, normalized to the latest schema version unless raw is set"`
+	ValidationResult *ValidationResult       `json:"validationResult,omitempty" description:"Last Validation result"`
+	Availability     map[string]Availability `json:"availability,omitempty" description:"Availability of the endpoint per window (24h, 7d and 30d), windows without scrapes are missing"`
+}
+
+// ValidationResult is the outcome of the last validation of an endpoint by
+// the validator.
+type ValidationResult struct {
+	Valid           bool     `json:"valid" description:"Data is valid against the spaceapi schema"`
+	IsHttps         bool     `json:"isHttps" description:"Endpoint uses https"`
+	HttpsForward    bool     `json:"httpsForward" description:"Endpoint forwards http calls to https"`
+	Reachable       bool     `json:"reachable" description:"We could reach the endpoint at the last check"`
+	Cors            bool     `json:"cors" description:"Endpoint sends CORS headers"`
+	ContentType     bool     `json:"contentType" description:"Endpoint sends Content-Type header"`
+	CertValid       bool     `json:"certValid" description:"Endpoint provides valid tls cert"`
+	CheckedVersions []string `json:"checkedVersions" description:"Versions the data was validated against"`
+	// Deprecations isn't set by the validator, the collector derives it from
+	// the data
+	Deprecations *DeprecationReport `json:"deprecations,omitempty"`
+}
+
+// Availability is the percentage of successful scrapes of an endpoint
+// during a window like 24h, 7d or 30d.
+type Availability struct {
+	Scrapes   int     `json:"scrapes" description:"Number of scrapes during the window"`
+	Reachable float64 `json:"reachable" description:"Percentage of scrapes where the endpoint was reachable"`
+	Valid     float64 `json:"valid" description:"Percentage of scrapes where the data was valid"`
+	Https     float64 `json:"https" description:"Percentage of scrapes where the endpoint used https"`
+}
+
+// DeprecationReport tells a space what keeps it from implementing the latest
+// version of the schema.
+type DeprecationReport struct {
+	Versions []string `json:"versions" description:"Versions declared in api and api_compatibility"`
+	// DeprecatedVersions are the declared versions before 14, which
+	// introduced api_compatibility
+	DeprecatedVersions []string `json:"deprecatedVersions" description:"Declared versions before 14"`
+	// DeprecatedFields are the fields that exist in a declared version but
+	// not in the latest one
+	DeprecatedFields []string `json:"deprecatedFields" description:"Used fields that exist in a declared version but not in the latest one"`
+	Compliant        bool     `json:"compliant" description:"The space declares the latest version and uses only its fields"`
+	Changes          []string `json:"changes" description:"Changes needed to implement the latest version"`
+}
@@ -0,0 +1,99 @@
+package spaceapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestEntryRoundTrip(t *testing.T) {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(fixtureSpace), &data); err != nil {
+		t.Fatal(err)
+	}
+	var normalized Space
+	if err := json.Unmarshal([]byte(fixtureSpace), &normalized); err != nil {
+		t.Fatal(err)
+	}
+
+	entry := Entry{
+		Id:       "fixture-space",
+		Url:      "https://fixture.example/space.json",
+		Valid:    true,
+		LastSeen: 1600000000,
+		ErrMsg:   []string{"certificate expires soon"},
+		// the raw data keeps the fields of every version and the extensions
+		Data:       data,
+		Normalized: &normalized,
+		ValidationResult: ValidationResult{
+			Valid:           true,
+			IsHttps:         true,
+			Reachable:       true,
+			CheckedVersions: []string{"14", "15"},
+			Deprecations: &DeprecationReport{
+				Versions:           []string{"14", "15"},
+				DeprecatedVersions: []string{},
+				DeprecatedFields:   []string{},
+				Compliant:          true,
+				Changes:            []string{},
+			},
+		},
+		Availability: map[string]Availability{
+			"24h": {Scrapes: 24, Reachable: 100, Valid: 95.83, Https: 100},
+		},
+	}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Entry
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entry, decoded) {
+		t.Errorf("the entry changed in the round trip:\n%+v\n%+v", entry, decoded)
+	}
+
+	if _, ok := decoded.Data["issue_report_channels"]; !ok {
+		t.Errorf("the unknown field of the raw data was dropped")
+	}
+	if contact, _ := decoded.Data["contact"].(map[string]interface{}); contact["ext_signal"] != "+49" {
+		t.Errorf("the nested extension of the raw data was dropped")
+	}
+	if decoded.Normalized.Extensions["ext_ccc"] != "erfa" {
+		t.Errorf("the extension of the normalized data was dropped")
+	}
+	if decoded.SpaceName() != "Fixture Space" {
+		t.Errorf("unexpected name %q", decoded.SpaceName())
+	}
+}
+
+func TestEntryWithoutData(t *testing.T) {
+	entry := Entry{Url: "https://fixture.example/space.json", ErrMsg: []string{"connection refused"}}
+
+	content, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, field := range []string{"id", "data", "normalized", "availability", "lastSeen"} {
+		if _, ok := fields[field]; ok {
+			t.Errorf("the empty field %v was encoded", field)
+		}
+	}
+
+	var decoded Entry
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(entry, decoded) {
+		t.Errorf("the entry changed in the round trip:\n%+v\n%+v", entry, decoded)
+	}
+	if decoded.SpaceName() != "" {
+		t.Errorf("unexpected name %q", decoded.SpaceName())
+	}
+}
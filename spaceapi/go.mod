@@ -0,0 +1,3 @@
+module github.com/spaceapi/directory-api/spaceapi
+
+go 1.12
@@ -0,0 +1,105 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// maxCheckedBody is the size up to which response bodies are checked.
+const maxCheckedBody = 32 << 20
+
+// Handler wraps the handler of a route. Requests with invalid parameters
+// are answered with 400 Bad Request, or 404 Not Found if it's a path
+// parameter. If CheckResponses is set the JSON responses are checked against
+// their schemas.
+func (s *Spec) Handler(route Route) http.Handler {
+	checked := s.CheckResponses != nil && hasJsonResponse(route)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := s.ValidateRequest(route, r); err != nil {
+			if err.(*ParameterError).Parameter.In == "path" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !checked {
+			route.Handler(w, r)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		route.Handler(recorder, r)
+		if problems := s.checkResponse(route, recorder); len(problems) > 0 {
+			s.CheckResponses(r, route, problems)
+		}
+	})
+}
+
+func (s *Spec) checkResponse(route Route, recorder *responseRecorder) []string {
+	schema, ok := s.responseSchema(route, recorder.status)
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not documented", recorder.status)}
+	}
+
+	contentType := recorder.Header().Get("Content-Type")
+	if recorder.body.Len() == 0 || !strings.HasPrefix(contentType, "application/json") {
+		return nil
+	}
+	if schema == nil {
+		return []string{fmt.Sprintf("status %d isn't documented as JSON", recorder.status)}
+	}
+	if recorder.truncated {
+		return nil
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(recorder.body.Bytes(), &value); err != nil {
+		return []string{"invalid JSON: " + err.Error()}
+	}
+
+	return s.ValidateValue(schema, value)
+}
+
+func hasJsonResponse(route Route) bool {
+	for _, response := range route.Responses {
+		if response.Body != nil && (response.ContentType == "" || response.ContentType == "application/json") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// responseRecorder passes a response on and keeps a copy of its body.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.body.Len()+len(p) > maxCheckedBody {
+		r.truncated = true
+	} else if !r.truncated {
+		r.body.Write(p)
+	}
+
+	return r.ResponseWriter.Write(p)
+}
+
+func (r *responseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,305 @@
+// Package openapi describes the routes of the api and the collector in Go.
+// The OpenAPI documents are generated from these route definitions and the
+// Go types of the responses, requests are validated against the declared
+// parameters and responses can be checked against their schemas.
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const Version = "3.0.0"
+
+// Route is an operation of an api together with the handler serving it.
+// Path uses the OpenAPI syntax for parameters, e.g. /v2/spaces/{id}.
+type Route struct {
+	Method  string
+	Path    string
+	Handler http.HandlerFunc
+	Operation
+}
+
+// Operation documents a route. The parameters are validated before the
+// handler is called.
+type Operation struct {
+	Summary     string
+	Description string
+	Parameters  []Parameter
+	RequestBody *RequestBody
+	Responses   []Response
+}
+
+// Response documents a response of an operation. Body is a value of the Go
+// type the handler encodes or a *Schema, responses without a body leave it
+// nil. A status with several content types is listed once per type.
+type Response struct {
+	Status      int
+	Description string
+	// ContentType defaults to application/json if there is a Body
+	ContentType string
+	Body        interface{}
+	Headers     map[string]Header
+}
+
+// RequestBody documents the body of an operation, Body is used like the
+// one of a Response.
+type RequestBody struct {
+	Description string
+	Required    bool
+	ContentType string
+	Body        interface{}
+	Example     interface{}
+}
+
+// Parameter is a query, path or header parameter of an operation.
+type Parameter struct {
+	Name        string             `json:"name"`
+	In          string             `json:"in"`
+	Description string             `json:"description,omitempty"`
+	Required    bool               `json:"required,omitempty"`
+	Schema      *Schema            `json:"schema,omitempty"`
+	Example     interface{}        `json:"example,omitempty"`
+	Examples    map[string]Example `json:"examples,omitempty"`
+}
+
+type Example struct {
+	Summary string      `json:"summary,omitempty"`
+	Value   interface{} `json:"value"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// Query returns an optional query parameter.
+func Query(name string, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// PathParam returns a path parameter, they are always required strings.
+func PathParam(name string, description string) Parameter {
+	return Parameter{Name: name, In: "path", Description: description, Required: true, Schema: String()}
+}
+
+// HeaderParam returns an optional header parameter.
+func HeaderParam(name string, description string, schema *Schema) Parameter {
+	return Parameter{Name: name, In: "header", Description: description, Schema: schema}
+}
+
+// Document is an OpenAPI document. Info, Servers and ExternalDocs are
+// passed to New, the paths and components are generated from the routes.
+type Document struct {
+	OpenApi      string              `json:"openapi"`
+	Servers      []Server            `json:"servers,omitempty"`
+	Info         Info                `json:"info"`
+	Paths        map[string]PathItem `json:"paths"`
+	Components   Components          `json:"components"`
+	ExternalDocs *ExternalDocs       `json:"externalDocs,omitempty"`
+}
+
+type Server struct {
+	Url string `json:"url"`
+}
+
+type Info struct {
+	Title          string   `json:"title"`
+	Description    string   `json:"description,omitempty"`
+	Version        string   `json:"version"`
+	TermsOfService string   `json:"termsOfService,omitempty"`
+	Contact        *Contact `json:"contact,omitempty"`
+	License        *License `json:"license,omitempty"`
+}
+
+type Contact struct {
+	Email string `json:"email,omitempty"`
+}
+
+type License struct {
+	Name string `json:"name"`
+	Url  string `json:"url,omitempty"`
+}
+
+type ExternalDocs struct {
+	Description string `json:"description,omitempty"`
+	Url         string `json:"url"`
+}
+
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem maps the lower case methods of a path to their operations.
+type PathItem map[string]*OperationObject
+
+type OperationObject struct {
+	Summary     string                     `json:"summary,omitempty"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBodyObject         `json:"requestBody,omitempty"`
+	Responses   map[string]*ResponseObject `json:"responses"`
+}
+
+type RequestBodyObject struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+type ResponseObject struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema  *Schema     `json:"schema,omitempty"`
+	Example interface{} `json:"example,omitempty"`
+}
+
+// Spec is the generated document of a set of routes.
+type Spec struct {
+	// PathParam looks up the path parameters of a request, they aren't
+	// validated without it
+	PathParam func(r *http.Request, name string) string
+	// CheckResponses enables the conformance check of the responses, it's
+	// called for every JSON response that doesn't match its schema
+	CheckResponses func(r *http.Request, route Route, problems []string)
+
+	routes   []Route
+	document Document
+	json     []byte
+}
+
+// New generates the paths and components of the document from the routes.
+func New(document Document, routes []Route) *Spec {
+	g := newGenerator()
+	document.OpenApi = Version
+	document.Paths = make(map[string]PathItem)
+	for _, route := range routes {
+		item, ok := document.Paths[route.Path]
+		if !ok {
+			item = make(PathItem)
+			document.Paths[route.Path] = item
+		}
+		item[strings.ToLower(route.Method)] = g.operation(route.Operation)
+	}
+	document.Components.Schemas = g.schemas
+
+	content, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+
+	return &Spec{routes: routes, document: document, json: append(content, '\n')}
+}
+
+// Routes returns the routes the document was generated from.
+func (s *Spec) Routes() []Route {
+	return s.routes
+}
+
+// Document returns the generated document, it must not be modified.
+func (s *Spec) Document() Document {
+	return s.document
+}
+
+// ServeHTTP serves the document as JSON.
+func (s *Spec) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(s.json)
+}
+
+// Pattern returns the path of the route in the syntax of goji, e.g.
+// /v2/spaces/:id.
+func (r Route) Pattern() string {
+	parts := strings.Split(r.Path, "/")
+	for i, part := range parts {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			parts[i] = ":" + strings.TrimSuffix(strings.TrimPrefix(part, "{"), "}")
+		}
+	}
+
+	return strings.Join(parts, "/")
+}
+
+func (g *generator) operation(operation Operation) *OperationObject {
+	result := &OperationObject{
+		Summary:     operation.Summary,
+		Description: operation.Description,
+		Parameters:  operation.Parameters,
+		Responses:   make(map[string]*ResponseObject),
+	}
+
+	if body := operation.RequestBody; body != nil {
+		result.RequestBody = &RequestBodyObject{
+			Description: body.Description,
+			Required:    body.Required,
+			Content:     g.content(body.ContentType, body.Body),
+		}
+		for contentType, mediaType := range result.RequestBody.Content {
+			mediaType.Example = body.Example
+			result.RequestBody.Content[contentType] = mediaType
+		}
+	}
+
+	for _, response := range operation.Responses {
+		status := strconv.Itoa(response.Status)
+		content := g.content(response.ContentType, response.Body)
+		// responses with several content types are listed once per type
+		if existing, ok := result.Responses[status]; ok {
+			if existing.Content == nil {
+				existing.Content = content
+				continue
+			}
+			for contentType, mediaType := range content {
+				existing.Content[contentType] = mediaType
+			}
+			continue
+		}
+
+		result.Responses[status] = &ResponseObject{
+			Description: response.Description,
+			Headers:     response.Headers,
+			Content:     content,
+		}
+	}
+
+	return result
+}
+
+func (g *generator) content(contentType string, body interface{}) map[string]MediaType {
+	if body == nil && contentType == "" {
+		return nil
+	}
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	var schema *Schema
+	switch body := body.(type) {
+	case nil:
+	case *Schema:
+		schema = body
+	default:
+		schema = g.schema(reflect.TypeOf(body))
+	}
+
+	return map[string]MediaType{contentType: {Schema: schema}}
+}
+
+// responseSchema returns the schema of a JSON response of the route with
+// the status, ok is false for undocumented statuses.
+func (s *Spec) responseSchema(route Route, status int) (*Schema, bool) {
+	operation := s.document.Paths[route.Path][strings.ToLower(route.Method)]
+	response, ok := operation.Responses[strconv.Itoa(status)]
+	if !ok {
+		return nil, false
+	}
+
+	return response.Content["application/json"].Schema, true
+}
@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Schema is the subset of the OpenAPI schema object used by the documents.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	ReadOnly             bool               `json:"readOnly,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+}
+
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+func Number() *Schema {
+	return &Schema{Type: "number"}
+}
+
+// Object returns a schema for objects with any properties.
+func Object() *Schema {
+	return &Schema{Type: "object"}
+}
+
+// Enum returns a string schema only allowing the values.
+func Enum(values ...string) *Schema {
+	schema := String()
+	for _, value := range values {
+		schema.Enum = append(schema.Enum, value)
+	}
+
+	return schema
+}
+
+// List returns a schema for comma separated lists in query parameters.
+func List(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+func (s *Schema) WithDefault(value interface{}) *Schema {
+	s.Default = value
+	return s
+}
+
+func (s *Schema) WithFormat(format string) *Schema {
+	s.Format = format
+	return s
+}
+
+func (s *Schema) WithMinimum(minimum float64) *Schema {
+	s.Minimum = &minimum
+	return s
+}
+
+func (s *Schema) WithMaximum(maximum float64) *Schema {
+	s.Maximum = &maximum
+	return s
+}
+
+// WithMaxLength limits the number of characters of a string.
+func (s *Schema) WithMaxLength(maxLength int) *Schema {
+	s.MaxLength = &maxLength
+	return s
+}
+
+func (s *Schema) WithDescription(description string) *Schema {
+	s.Description = description
+	return s
+}
+
+// generator turns Go types into schemas. Named structs become components
+// named after the type, the fields are documented with description, enum
+// and readOnly tags:
+//
+//	Type string `json:"type" description:"Type of the event" enum:"added,removed"`
+//	Id   string `json:"id" readOnly:"true"`
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: make(map[string]*Schema),
+		names:   make(map[reflect.Type]string),
+	}
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == timeType {
+		return String().WithFormat("date-time")
+	}
+	// types with their own encoding can't be described from their fields
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType) {
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := g.schema(t.Elem())
+		if schema.Ref != "" {
+			return &Schema{AllOf: []*Schema{schema}, Nullable: true}
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem()), Nullable: true}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return String().WithFormat("byte")
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem()), Nullable: true}
+	case reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return Integer().WithFormat("int32")
+	case reflect.Int64, reflect.Uint64:
+		return Integer().WithFormat("int64")
+	case reflect.Float32, reflect.Float64:
+		return Number()
+	case reflect.String:
+		return String()
+	}
+
+	return &Schema{}
+}
+
+// component registers a named struct and returns the name of its schema.
+// Types of different packages with the same name get the package as a
+// prefix.
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := upperFirst(t.Name())
+	if _, taken := g.schemas[name]; taken {
+		parts := strings.Split(t.PkgPath(), "/")
+		name = upperFirst(parts[len(parts)-1]) + name
+	}
+
+	g.names[t] = name
+	// registered before the fields, so recursive types end up as references
+	g.schemas[name] = &Schema{}
+	*g.schemas[name] = *g.structSchema(t)
+
+	return name
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.addFields(schema, t)
+	if len(schema.Properties) == 0 {
+		schema.Properties = nil
+	}
+
+	return schema
+}
+
+func (g *generator) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma:]
+		}
+
+		// fields of embedded structs are encoded as fields of the outer one
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				g.addFields(schema, embedded)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := g.schema(field.Type)
+		description := field.Tag.Get("description")
+		enum := field.Tag.Get("enum")
+		readOnly := field.Tag.Get("readOnly") == "true"
+		if property.Ref != "" && (description != "" || enum != "" || readOnly) {
+			property = &Schema{AllOf: []*Schema{property}}
+		}
+		property.Description = description
+		property.ReadOnly = readOnly
+		if enum != "" {
+			target := property
+			if property.Type == "array" {
+				target = property.Items
+			}
+			for _, value := range strings.Split(enum, ",") {
+				target.Enum = append(target.Enum, value)
+			}
+		}
+
+		schema.Properties[name] = property
+		if !strings.Contains(options, ",omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+}
+
+func upperFirst(name string) string {
+	if name == "" {
+		return name
+	}
+
+	return strings.ToUpper(name[:1]) + name[1:]
+}
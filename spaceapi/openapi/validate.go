@@ -0,0 +1,231 @@
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxProblems limits the problems reported for a single response.
+const maxProblems = 20
+
+// ParameterError is returned for a parameter not matching its declaration.
+type ParameterError struct {
+	Parameter Parameter
+	Message   string
+}
+
+func (e *ParameterError) Error() string {
+	return e.Message
+}
+
+// ValidateRequest checks the parameters of a request against the ones
+// declared by the route. Empty parameters are treated as missing, the
+// returned error is a *ParameterError.
+func (s *Spec) ValidateRequest(route Route, r *http.Request) error {
+	query := r.URL.Query()
+	for _, parameter := range route.Parameters {
+		var value string
+		switch parameter.In {
+		case "query":
+			value = query.Get(parameter.Name)
+		case "header":
+			value = r.Header.Get(parameter.Name)
+		case "path":
+			if s.PathParam == nil {
+				continue
+			}
+			value = s.PathParam(r, parameter.Name)
+		}
+
+		if value == "" {
+			if parameter.Required {
+				return &ParameterError{parameter, parameter.Name + " is required"}
+			}
+			continue
+		}
+		if parameter.Schema == nil {
+			continue
+		}
+		if err := validateParameter(parameter.Name, parameter.Schema, value); err != nil {
+			return &ParameterError{parameter, err.Error()}
+		}
+	}
+
+	return nil
+}
+
+func validateParameter(name string, schema *Schema, value string) error {
+	switch schema.Type {
+	case "array":
+		if schema.Items == nil {
+			return nil
+		}
+		for _, item := range strings.Split(value, ",") {
+			if err := validateParameter(name, schema.Items, strings.TrimSpace(item)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "boolean":
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%s has to be true or false", name)
+		}
+	case "integer":
+		number, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s has to be an integer", name)
+		}
+		if err := checkRange(name, schema, float64(number)); err != nil {
+			return err
+		}
+	case "number":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("%s has to be a number", name)
+		}
+		if err := checkRange(name, schema, number); err != nil {
+			return err
+		}
+	case "string":
+		if schema.MaxLength != nil && utf8.RuneCountInString(value) > *schema.MaxLength {
+			return fmt.Errorf("%s has to be at most %d characters", name, *schema.MaxLength)
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		values := make([]string, len(schema.Enum))
+		for i, allowed := range schema.Enum {
+			values[i] = fmt.Sprint(allowed)
+		}
+		return fmt.Errorf("%s has to be one of %s", name, strings.Join(values, ", "))
+	}
+
+	return nil
+}
+
+func checkRange(name string, schema *Schema, number float64) error {
+	if schema.Minimum != nil && number < *schema.Minimum {
+		return fmt.Errorf("%s has to be at least %v", name, *schema.Minimum)
+	}
+	if schema.Maximum != nil && number > *schema.Maximum {
+		return fmt.Errorf("%s has to be at most %v", name, *schema.Maximum)
+	}
+
+	return nil
+}
+
+func inEnum(enum []interface{}, value interface{}) bool {
+	for _, allowed := range enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateValue checks a decoded JSON value against a schema of the
+// document and returns what doesn't match, the locations are JSON pointers.
+func (s *Spec) ValidateValue(schema *Schema, value interface{}) []string {
+	var problems []string
+	s.validate(schema, value, "", &problems)
+	if len(problems) > maxProblems {
+		problems = append(problems[:maxProblems], fmt.Sprintf("and %d more", len(problems)-maxProblems))
+	}
+
+	return problems
+}
+
+func (s *Spec) validate(schema *Schema, value interface{}, path string, problems *[]string) {
+	if schema == nil {
+		return
+	}
+	if schema.Ref != "" {
+		name := strings.TrimPrefix(schema.Ref, "#/components/schemas/")
+		if referenced, ok := s.document.Components.Schemas[name]; ok {
+			s.validate(referenced, value, path, problems)
+		} else {
+			*problems = append(*problems, fmt.Sprintf("%s: unknown schema %s", location(path), name))
+		}
+		return
+	}
+
+	if value == nil {
+		if !schema.Nullable && (schema.Type != "" || len(schema.AllOf) > 0) {
+			*problems = append(*problems, fmt.Sprintf("%s: is null", location(path)))
+		}
+		return
+	}
+	for _, part := range schema.AllOf {
+		s.validate(part, value, path, problems)
+	}
+
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be an object", location(path)))
+			return
+		}
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: %s is missing", location(path), name))
+			}
+		}
+		for name, property := range object {
+			if propertySchema, ok := schema.Properties[name]; ok {
+				s.validate(propertySchema, property, path+"/"+name, problems)
+			} else if schema.AdditionalProperties != nil {
+				s.validate(schema.AdditionalProperties, property, path+"/"+name, problems)
+			}
+		}
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be an array", location(path)))
+			return
+		}
+		for i, item := range array {
+			s.validate(schema.Items, item, path+"/"+strconv.Itoa(i), problems)
+		}
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be a string", location(path)))
+			return
+		}
+		if schema.MaxLength != nil && utf8.RuneCountInString(text) > *schema.MaxLength {
+			*problems = append(*problems, fmt.Sprintf("%s: is longer than %d characters", location(path), *schema.MaxLength))
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be a boolean", location(path)))
+			return
+		}
+	case "number", "integer":
+		number, ok := value.(float64)
+		if !ok {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be a number", location(path)))
+			return
+		}
+		if schema.Type == "integer" && number != math.Trunc(number) {
+			*problems = append(*problems, fmt.Sprintf("%s: has to be an integer", location(path)))
+		}
+	}
+
+	if len(schema.Enum) > 0 && !inEnum(schema.Enum, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not allowed", location(path), value))
+	}
+}
+
+func location(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
@@ -0,0 +1,14 @@
+package spaceapi
+
+// SpaceOpeningHours is the weekly heatmap of a space derived by the
+// collector from its state.open samples. Bucket 0 is Monday 00:00 to 01:00
+// in the time zone of the space, the probability of buckets without
+// samples is 0.
+type SpaceOpeningHours struct {
+	SpaceId     string    `json:"spaceId"`
+	Space       string    `json:"space,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	Timezone    string    `json:"timezone" description:"Time zone of the buckets, a fixed offset derived from the longitude if the space doesn't publish location.timezone"`
+	Samples     []float64 `json:"samples" description:"Weight of the samples in the 168 hourly buckets starting Monday 00:00, decaying by week"`
+	Probability []float64 `json:"probability" description:"Share of the samples the space was open per bucket"`
+}
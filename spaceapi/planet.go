@@ -0,0 +1,25 @@
+package spaceapi
+
+// PlanetItem is a normalized post of a blog or wiki feed, the content is
+// sanitized html.
+type PlanetItem struct {
+	Id        string `json:"id"`
+	Title     string `json:"title"`
+	Link      string `json:"link"`
+	Author    string `json:"author,omitempty"`
+	Published int64  `json:"published" description:"Unix timestamp, the time the item was first seen if the feed has no date"`
+	Content   string `json:"content,omitempty" description:"Sanitized html"`
+}
+
+// PlanetFeed is a blog or wiki feed of a space as fetched by the collector
+// and served on its /planet.
+type PlanetFeed struct {
+	SpaceId     string       `json:"spaceId"`
+	Space       string       `json:"space,omitempty"`
+	Country     string       `json:"country,omitempty"`
+	Type        string       `json:"type" enum:"blog,wiki"`
+	Url         string       `json:"url"`
+	LastFetched int64        `json:"lastFetched,omitempty"`
+	Error       string       `json:"error,omitempty" description:"Error of the last fetch, the items of the previous fetch are kept"`
+	Items       []PlanetItem `json:"items"`
+}
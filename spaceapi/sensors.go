@@ -0,0 +1,23 @@
+package spaceapi
+
+// SensorReading is a single measurement of a sensor of a space. Sensors with
+// several values, like wind, get one reading per property. The value is
+// also converted to a common unit per sensor type if the unit is known.
+type SensorReading struct {
+	SpaceId     string  `json:"spaceId"`
+	Space       string  `json:"space,omitempty"`
+	Country     string  `json:"country,omitempty"`
+	Type        string  `json:"type" description:"Sensor type of the SpaceAPI schema, e.g. temperature or people_now_present"`
+	Property    string  `json:"property,omitempty" description:"Kind of radiation, property of wind and network_traffic sensors or type of network_connections"`
+	Sensor      string  `json:"sensor" description:"Name or location of the sensor, its position if it has neither"`
+	Name        string  `json:"name,omitempty"`
+	Location    string  `json:"location,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Value       float64 `json:"value" description:"Booleans like door_locked are 1 or 0"`
+	Unit        string  `json:"unit,omitempty"`
+	// NormalizedValue and NormalizedUnit are the same as the value and unit
+	// if there is no conversion for the unit
+	NormalizedValue float64 `json:"normalizedValue"`
+	NormalizedUnit  string  `json:"normalizedUnit,omitempty" description:"°C, hPa, W, m/s, m or µSv/h, the original unit if it can't be converted"`
+	LastChange      int64   `json:"lastchange,omitempty"`
+}
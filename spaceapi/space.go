@@ -0,0 +1,276 @@
+package spaceapi
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Space is the data of a space in the layout of the latest schema version,
+// whatever version the space publishes. Fields that were removed are either
+// moved to their replacement or dropped by the collector, extension fields on
+// the top level are kept in Extensions.
+type Space struct {
+	ApiCompatibility []string         `json:"api_compatibility"`
+	Space            string           `json:"space"`
+	Logo             string           `json:"logo"`
+	Url              string           `json:"url"`
+	Location         *Location        `json:"location,omitempty"`
+	Spacefed         *Spacefed        `json:"spacefed,omitempty"`
+	Cam              []string         `json:"cam,omitempty"`
+	Stream           *Stream          `json:"stream,omitempty"`
+	State            *State           `json:"state,omitempty"`
+	Events           []Event          `json:"events,omitempty"`
+	Contact          Contact          `json:"contact"`
+	Sensors          *Sensors         `json:"sensors,omitempty"`
+	Feeds            *Feeds           `json:"feeds,omitempty"`
+	Projects         []string         `json:"projects,omitempty"`
+	Links            []Link           `json:"links,omitempty"`
+	MembershipPlans  []MembershipPlan `json:"membership_plans,omitempty"`
+	LinkedSpaces     []LinkedSpace    `json:"linked_spaces,omitempty"`
+	// Extensions are the ext_ fields on the top level
+	Extensions map[string]interface{} `json:"-"`
+}
+
+type Location struct {
+	Address     string  `json:"address,omitempty"`
+	Lat         float64 `json:"lat"`
+	Lon         float64 `json:"lon"`
+	Timezone    string  `json:"timezone,omitempty"`
+	CountryCode string  `json:"country_code,omitempty"`
+	Hint        string  `json:"hint,omitempty"`
+	Areas       []Area  `json:"areas,omitempty"`
+}
+
+type Area struct {
+	Name         string  `json:"name,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	SquareMeters float64 `json:"square_meters"`
+}
+
+type Spacefed struct {
+	Spacenet  bool `json:"spacenet"`
+	Spacesaml bool `json:"spacesaml"`
+}
+
+type Stream struct {
+	M4      string `json:"m4,omitempty"`
+	Mjpeg   string `json:"mjpeg,omitempty"`
+	Ustream string `json:"ustream,omitempty"`
+}
+
+type State struct {
+	Open          *bool      `json:"open,omitempty"`
+	LastChange    int64      `json:"lastchange,omitempty"`
+	TriggerPerson string     `json:"trigger_person,omitempty"`
+	Message       string     `json:"message,omitempty"`
+	Icon          *StateIcon `json:"icon,omitempty"`
+}
+
+type StateIcon struct {
+	Open   string `json:"open"`
+	Closed string `json:"closed"`
+}
+
+type Event struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	Timestamp int64  `json:"timestamp"`
+	Extra     string `json:"extra,omitempty"`
+}
+
+type Contact struct {
+	Phone      string      `json:"phone,omitempty"`
+	Sip        string      `json:"sip,omitempty"`
+	Keymasters []Keymaster `json:"keymasters,omitempty"`
+	Irc        string      `json:"irc,omitempty"`
+	Twitter    string      `json:"twitter,omitempty"`
+	Mastodon   string      `json:"mastodon,omitempty"`
+	Facebook   string      `json:"facebook,omitempty"`
+	Email      string      `json:"email,omitempty"`
+	Ml         string      `json:"ml,omitempty"`
+	Xmpp       string      `json:"xmpp,omitempty"`
+	Matrix     string      `json:"matrix,omitempty"`
+}
+
+type Keymaster struct {
+	Name     string `json:"name,omitempty"`
+	IrcNick  string `json:"irc_nick,omitempty"`
+	Phone    string `json:"phone,omitempty"`
+	Email    string `json:"email,omitempty"`
+	Twitter  string `json:"twitter,omitempty"`
+	Xmpp     string `json:"xmpp,omitempty"`
+	Mastodon string `json:"mastodon,omitempty"`
+	Matrix   string `json:"matrix,omitempty"`
+}
+
+// Sensor holds the fields shared by all sensors, the value is a
+// pointer so a measured 0 isn't dropped.
+type Sensor struct {
+	Value       *float64 `json:"value,omitempty"`
+	Unit        string   `json:"unit,omitempty"`
+	Location    string   `json:"location,omitempty"`
+	Name        string   `json:"name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	LastChange  int64    `json:"lastchange,omitempty"`
+}
+
+type DoorLocked struct {
+	Value       bool   `json:"value"`
+	Location    string `json:"location,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Description string `json:"description,omitempty"`
+	LastChange  int64  `json:"lastchange,omitempty"`
+}
+
+type PeopleNowPresent struct {
+	Sensor
+	Names []string `json:"names,omitempty"`
+}
+
+type RadiationSensor struct {
+	Sensor
+	DeadTime         *float64 `json:"dead_time,omitempty"`
+	ConversionFactor *float64 `json:"conversion_factor,omitempty"`
+}
+
+type Radiation struct {
+	Alpha     []RadiationSensor `json:"alpha,omitempty"`
+	Beta      []RadiationSensor `json:"beta,omitempty"`
+	Gamma     []RadiationSensor `json:"gamma,omitempty"`
+	BetaGamma []RadiationSensor `json:"beta_gamma,omitempty"`
+}
+
+type Measurement struct {
+	Value   float64  `json:"value"`
+	Unit    string   `json:"unit,omitempty"`
+	Maximum *float64 `json:"maximum,omitempty"`
+}
+
+// PropertySensor is a sensor with several measurements, like the
+// speed and direction of the wind.
+type PropertySensor struct {
+	Properties  map[string]Measurement `json:"properties"`
+	Location    string                 `json:"location,omitempty"`
+	Name        string                 `json:"name,omitempty"`
+	Description string                 `json:"description,omitempty"`
+	LastChange  int64                  `json:"lastchange,omitempty"`
+}
+
+type NetworkConnections struct {
+	Sensor
+	Type     string    `json:"type,omitempty"`
+	Machines []Machine `json:"machines,omitempty"`
+}
+
+type Machine struct {
+	Name string `json:"name,omitempty"`
+	Mac  string `json:"mac"`
+}
+
+type Sensors struct {
+	Temperature        []Sensor             `json:"temperature,omitempty"`
+	CarbonDioxide      []Sensor             `json:"carbondioxide,omitempty"`
+	DoorLocked         []DoorLocked         `json:"door_locked,omitempty"`
+	Barometer          []Sensor             `json:"barometer,omitempty"`
+	Radiation          *Radiation           `json:"radiation,omitempty"`
+	Humidity           []Sensor             `json:"humidity,omitempty"`
+	BeverageSupply     []Sensor             `json:"beverage_supply,omitempty"`
+	PowerConsumption   []Sensor             `json:"power_consumption,omitempty"`
+	PowerGeneration    []Sensor             `json:"power_generation,omitempty"`
+	Wind               []PropertySensor     `json:"wind,omitempty"`
+	NetworkConnections []NetworkConnections `json:"network_connections,omitempty"`
+	AccountBalance     []Sensor             `json:"account_balance,omitempty"`
+	TotalMemberCount   []Sensor             `json:"total_member_count,omitempty"`
+	PeopleNowPresent   []PeopleNowPresent   `json:"people_now_present,omitempty"`
+	NetworkTraffic     []PropertySensor     `json:"network_traffic,omitempty"`
+}
+
+type Feed struct {
+	Type string `json:"type,omitempty"`
+	Url  string `json:"url"`
+}
+
+type Feeds struct {
+	Blog     *Feed `json:"blog,omitempty"`
+	Wiki     *Feed `json:"wiki,omitempty"`
+	Calendar *Feed `json:"calendar,omitempty"`
+	Flickr   *Feed `json:"flickr,omitempty"`
+}
+
+type Link struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Url         string `json:"url"`
+}
+
+type MembershipPlan struct {
+	Name            string  `json:"name"`
+	Value           float64 `json:"value"`
+	Currency        string  `json:"currency"`
+	BillingInterval string  `json:"billing_interval"`
+	Description     string  `json:"description,omitempty"`
+}
+
+type LinkedSpace struct {
+	Endpoint string `json:"endpoint,omitempty"`
+	Website  string `json:"website,omitempty"`
+}
+
+// MarshalJSON adds the extension fields next to the schema fields.
+func (s Space) MarshalJSON() ([]byte, error) {
+	type plain Space
+	data, err := json.Marshal(plain(s))
+	if err != nil || len(s.Extensions) == 0 {
+		return data, err
+	}
+
+	var merged map[string]interface{}
+	if err := json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range s.Extensions {
+		merged[key] = value
+	}
+
+	return json.Marshal(merged)
+}
+
+// UnmarshalJSON reads the extension fields as well, so decoding what
+// MarshalJSON encoded gives back an equal Space. Like json.Unmarshal it
+// fills in as much as possible if values have the wrong type and returns
+// the first error.
+func (s *Space) UnmarshalJSON(data []byte) error {
+	type plain Space
+	typeErr := json.Unmarshal(data, (*plain)(s))
+	if _, ok := typeErr.(*json.UnmarshalTypeError); typeErr != nil && !ok {
+		return typeErr
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	s.Extensions = nil
+	for key, value := range fields {
+		if strings.HasPrefix(key, "ext_") {
+			if s.Extensions == nil {
+				s.Extensions = make(map[string]interface{})
+			}
+			s.Extensions[key] = value
+		}
+	}
+
+	return typeErr
+}
+
+// Map returns the space as decoded json, like the raw data of an entry.
+func (s Space) Map() (map[string]interface{}, error) {
+	content, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var data map[string]interface{}
+	err = json.Unmarshal(content, &data)
+	return data, err
+}
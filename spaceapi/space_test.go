@@ -0,0 +1,118 @@
+package spaceapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const fixtureSpace = `{
+	"api_compatibility": ["14", "15"],
+	"space": "Fixture Space",
+	"logo": "https://fixture.example/logo.png",
+	"url": "https://fixture.example",
+	"location": {"address": "Fixture Street 1", "lat": 50.1, "lon": 8.6, "timezone": "Europe/Berlin"},
+	"state": {"open": false, "lastchange": 1600000000, "icon": {"open": "https://fixture.example/open.png", "closed": "https://fixture.example/closed.png"}},
+	"contact": {"email": "info@fixture.example", "xmpp": "space@fixture.example", "ext_signal": "+49"},
+	"sensors": {
+		"temperature": [{"value": 0, "unit": "°C", "location": "Hackcenter"}],
+		"door_locked": [{"value": false, "location": "Front door"}],
+		"wind": [{"properties": {"speed": {"value": 3.5, "unit": "m/s"}}, "location": "Roof"}],
+		"people_now_present": [{"value": 2, "names": ["alice", "bob"]}]
+	},
+	"feeds": {"calendar": {"type": "ical", "url": "https://fixture.example/calendar.ics"}},
+	"links": [{"name": "Wiki", "url": "https://fixture.example/wiki"}],
+	"issue_report_channels": ["email"],
+	"ext_ccc": "erfa",
+	"ext_habitat": {"rooms": 3, "pets": ["cat"]}
+}`
+
+func TestSpaceRoundTrip(t *testing.T) {
+	var space Space
+	if err := json.Unmarshal([]byte(fixtureSpace), &space); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(space.Extensions) != 2 || space.Extensions["ext_ccc"] != "erfa" {
+		t.Errorf("unexpected extensions %v", space.Extensions)
+	}
+	if space.Sensors == nil || len(space.Sensors.Temperature) != 1 || space.Sensors.Temperature[0].Value == nil {
+		t.Fatalf("the temperature of 0 °C was dropped: %+v", space.Sensors)
+	}
+
+	content, err := json.Marshal(space)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Space
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(space, decoded) {
+		t.Errorf("the space changed in the round trip:\n%+v\n%+v", space, decoded)
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(content, &fields); err != nil {
+		t.Fatal(err)
+	}
+	habitat, ok := fields["ext_habitat"].(map[string]interface{})
+	if !ok || habitat["rooms"] != 3.0 {
+		t.Errorf("the nested extension wasn't encoded: %v", fields["ext_habitat"])
+	}
+	// fields that aren't in the latest schema are dropped, extensions are
+	// only kept on the top level
+	if _, ok := fields["issue_report_channels"]; ok {
+		t.Errorf("the unknown field issue_report_channels was encoded")
+	}
+	if contact, _ := fields["contact"].(map[string]interface{}); contact["ext_signal"] != nil {
+		t.Errorf("the extension of the contact was encoded")
+	}
+	if state, _ := fields["state"].(map[string]interface{}); state["open"] != false {
+		t.Errorf("the closed state was dropped: %v", fields["state"])
+	}
+}
+
+func TestSpaceWithoutExtensions(t *testing.T) {
+	content, err := json.Marshal(Space{Space: "Fixture Space"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded Space
+	if err := json.Unmarshal(content, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Extensions != nil {
+		t.Errorf("unexpected extensions %v", decoded.Extensions)
+	}
+	if decoded.Space != "Fixture Space" {
+		t.Errorf("unexpected space %+v", decoded)
+	}
+}
+
+func TestSpaceKeepsValidFieldsOfWrongTypes(t *testing.T) {
+	var space Space
+	err := json.Unmarshal([]byte(`{"space": "Fixture Space", "logo": 3, "ext_ccc": "erfa"}`), &space)
+	if _, ok := err.(*json.UnmarshalTypeError); !ok {
+		t.Errorf("expected a type error, got %v", err)
+	}
+	if space.Space != "Fixture Space" || space.Extensions["ext_ccc"] != "erfa" {
+		t.Errorf("the valid fields weren't decoded: %+v", space)
+	}
+}
+
+func TestSpaceMap(t *testing.T) {
+	var space Space
+	if err := json.Unmarshal([]byte(fixtureSpace), &space); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := space.Map()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data["space"] != "Fixture Space" || data["ext_ccc"] != "erfa" {
+		t.Errorf("unexpected data %v", data)
+	}
+}
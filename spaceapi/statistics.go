@@ -0,0 +1,24 @@
+package spaceapi
+
+// Statistics is a snapshot of the directory taken by the collector on every
+// rebuild and served on its /stats, the api passes it on as /v2/stats.
+type Statistics struct {
+	Time   int64 `json:"time" description:"Unix timestamp of the snapshot"`
+	Totals struct {
+		Spaces    int `json:"spaces"`
+		Valid     int `json:"valid"`
+		Invalid   int `json:"invalid"`
+		Reachable int `json:"reachable"`
+	} `json:"totals"`
+	// Validity counts the endpoints passing each check of the validator
+	Validity  map[string]int `json:"validity" description:"Number of endpoints passing each check of the validator"`
+	Versions  map[string]int `json:"versions" description:"Number of endpoints implementing each SpaceAPI version"`
+	Countries map[string]int `json:"countries" description:"Number of valid spaces per country code"`
+	Fields    map[string]int `json:"fields" description:"Number of endpoints using each field, nested fields are joined with / and array elements are marked with [] like /sensors/temperature[]/unit"`
+	// FieldsByVersion counts the fields per declared version, a space
+	// declaring several versions is counted for each of them
+	FieldsByVersion map[string]map[string]int `json:"fieldsByVersion" description:"Number of endpoints using each field per declared version"`
+	// UnknownFields counts the fields that aren't in the schema of a
+	// declared version, versions without a known schema are missing
+	UnknownFields map[string]map[string]int `json:"unknownFields" description:"Number of endpoints using fields that aren't in the schema of a declared version, per version. Fields starting with ext_ are allowed."`
+}